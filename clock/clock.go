@@ -0,0 +1,154 @@
+// Package clock lets code that waits for time to pass
+// run on a clock that tests control.
+package clock
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Clock tells the time and makes timers.
+type Clock interface {
+	Now() time.Time
+
+	// NewTimer returns a Timer that sends the current time
+	// on its channel once at least d has passed.
+	NewTimer(d time.Duration) Timer
+}
+
+// A Timer is a single event, like time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing.
+	// It returns false if the timer already fired or was stopped.
+	Stop() bool
+}
+
+// Real is the wall clock, from package time.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+// Sleep waits until d has passed on clk
+// or ctx is canceled, whichever is first.
+// It returns ctx.Err() if ctx was canceled.
+func Sleep(ctx context.Context, clk Clock, d time.Duration) error {
+	t := clk.NewTimer(d)
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		t.Stop()
+		return ctx.Err()
+	}
+}
+
+// Manual is a Clock whose time moves
+// only when Advance is called.
+// It is okay to call methods on Manual concurrently.
+type Manual struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*manualTimer // sorted by when
+}
+
+type manualTimer struct {
+	m    *Manual
+	when time.Time
+	c    chan time.Time
+}
+
+// NewManual returns a Manual clock set to t.
+func NewManual(t time.Time) *Manual {
+	return &Manual{now: t}
+}
+
+// Now returns m's current time.
+func (m *Manual) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// NewTimer implements Clock.
+// The timer fires when Advance moves m's time
+// to or past its deadline,
+// or at once if d is not positive.
+func (m *Manual) NewTimer(d time.Duration) Timer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := &manualTimer{m: m, when: m.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- m.now
+		return t
+	}
+	i := sort.Search(len(m.timers), func(i int) bool {
+		return t.when.Before(m.timers[i].when)
+	})
+	m.timers = append(m.timers, nil)
+	copy(m.timers[i+1:], m.timers[i:])
+	m.timers[i] = t
+	return t
+}
+
+// Advance moves m's time forward by d,
+// firing the timers whose deadlines it reaches,
+// in order.
+func (m *Manual) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = m.now.Add(d)
+	for len(m.timers) > 0 && !m.timers[0].when.After(m.now) {
+		m.timers[0].c <- m.now
+		m.timers = m.timers[1:]
+	}
+}
+
+// Timers returns the number of m's pending timers.
+// Tests can use it to wait for code under test
+// to start waiting before they call Advance.
+func (m *Manual) Timers() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.timers)
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTimer) Stop() bool {
+	m := t.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, t2 := range m.timers {
+		if t2 == t {
+			m.timers = append(m.timers[:i], m.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestManual(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewManual(start)
+	t1 := m.NewTimer(time.Minute)
+	t2 := m.NewTimer(time.Second)
+	t3 := m.NewTimer(time.Hour)
+	if n := m.Timers(); n != 3 {
+		t.Fatalf("got %d timers, want 3", n)
+	}
+
+	m.Advance(time.Second)
+	if got := <-t2.C(); !got.Equal(start.Add(time.Second)) {
+		t.Errorf("t2 fired at %s, want %s", got, start.Add(time.Second))
+	}
+	select {
+	case <-t1.C():
+		t.Fatal("t1 fired early")
+	default:
+	}
+
+	if !t3.Stop() {
+		t.Error("t3.Stop() = false, want true")
+	}
+	m.Advance(2 * time.Hour)
+	<-t1.C()
+	select {
+	case <-t3.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+	if t1.Stop() {
+		t.Error("t1.Stop() = true after firing, want false")
+	}
+	if got, want := m.Now(), start.Add(2*time.Hour+time.Second); !got.Equal(want) {
+		t.Errorf("got time %s, want %s", got, want)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	m := NewManual(time.Now())
+	done := make(chan error)
+	go func() {
+		done <- Sleep(context.Background(), m, time.Minute)
+	}()
+	for m.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	m.Advance(time.Minute)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Sleep(ctx, m, time.Minute); err != context.Canceled {
+		t.Errorf("got error %v, want %s", err, context.Canceled)
+	}
+	if n := m.Timers(); n != 0 {
+		t.Errorf("got %d timers after canceled sleep, want 0", n)
+	}
+}
@@ -0,0 +1,78 @@
+// Command starlight-export writes an accounting export
+// of a Starlight agent's wallet and channel transactions.
+//
+// It reads the database in a starlightd data directory,
+// so it must run while starlightd is stopped.
+// (A running agent serves the same export
+// at /api/export-accounting.)
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+
+	"github.com/interstellar/starlight/starlight"
+)
+
+func main() {
+	var (
+		dir    = flag.String("data", "./starlight-data", "data directory")
+		start  = flag.String("start", "", "include updates at or after `time` (RFC 3339 or YYYY-MM-DD)")
+		end    = flag.String("end", "", "include updates before `time` (RFC 3339 or YYYY-MM-DD)")
+		format = flag.String("format", "csv", "output format, csv or json")
+	)
+	flag.Parse()
+
+	startTime, err := parseTime(*start)
+	if err != nil {
+		log.Fatalf("bad -start: %s", err)
+	}
+	endTime, err := parseTime(*end)
+	if err != nil {
+		log.Fatalf("bad -end: %s", err)
+	}
+
+	db, err := bolt.Open(filepath.Join(*dir, "db"), 0600, &bolt.Options{
+		ReadOnly: true,
+		Timeout:  time.Second,
+	})
+	if err != nil {
+		log.Fatalf("error opening database (is starlightd running?): %s", err)
+	}
+	defer db.Close()
+
+	entries, err := starlight.ExportAccounting(db, startTime, endTime)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch *format {
+	case "csv":
+		err = starlight.WriteAccountingCSV(os.Stdout, entries)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+	default:
+		log.Fatalf("unknown format %s", *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,83 @@
+// Command starlight-signer holds a Starlight agent's seed
+// and signs for it over a Unix socket,
+// so the seed stays out of the starlightd process.
+// Run starlightd with -signer naming the same socket.
+//
+// The seed is read from a file holding its mnemonic,
+// as returned by config-init or export-mnemonic.
+// The file must not be accessible to group or other users.
+//
+// Every request is appended to the audit log.
+// Transactions are signed only if they fit the signing policy
+// set by -limit, -period, and -allow;
+// see package signer for details.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/interstellar/starlight/starlight/signer"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+func main() {
+	var (
+		socket       = flag.String("socket", "./starlight-signer.sock", "listen on Unix socket `path`")
+		mnemonicFile = flag.String("mnemonic-file", "", "read the seed mnemonic from `file` (required)")
+		auditFile    = flag.String("audit", "./starlight-signer.log", "append the audit log to `file`")
+		limit        = flag.String("limit", "", "send at most `lumens` from the wallet account per period (default no limit)")
+		period       = flag.Duration("period", signer.DefaultPeriod, "spending limit period")
+		allow        = flag.String("allow", "", "comma-separated `accounts`, including channel counterparties, the wallet and channel accounts may pay (default any)")
+		keyIndexes   = flag.Uint("key-indexes", signer.DefaultKeyIndexes, "number of channel account keys to recognize in advance")
+	)
+	flag.Parse()
+
+	if *mnemonicFile == "" {
+		log.Fatal("-mnemonic-file is required")
+	}
+	seed, err := signer.ReadSeedFile(*mnemonicFile)
+	if err != nil {
+		log.Fatalf("reading seed: %s", err)
+	}
+
+	s := &signer.Server{
+		Seed:       seed,
+		KeyIndexes: uint32(*keyIndexes),
+	}
+	if *limit != "" {
+		s.Policy.Limit, err = xlm.Parse(*limit)
+		if err != nil {
+			log.Fatalf("bad -limit: %s", err)
+		}
+		s.Policy.Period = *period
+	}
+	if *allow != "" {
+		s.Policy.Destinations = make(map[string]bool)
+		for _, acct := range strings.Split(*allow, ",") {
+			s.Policy.Destinations[strings.TrimSpace(acct)] = true
+		}
+	}
+
+	audit, err := os.OpenFile(*auditFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		log.Fatalf("opening audit log: %s", err)
+	}
+	defer audit.Close()
+	s.Audit = audit
+
+	os.Remove(*socket)
+	l, err := net.Listen("unix", *socket)
+	if err != nil {
+		log.Fatalf("listen: %s", err)
+	}
+	err = os.Chmod(*socket, 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("signing on %s", *socket)
+	log.Fatal(s.Serve(l))
+}
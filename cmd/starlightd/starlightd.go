@@ -22,7 +22,9 @@ import (
 
 	i10rnet "github.com/interstellar/starlight/net"
 	"github.com/interstellar/starlight/starlight"
+	"github.com/interstellar/starlight/starlight/signer"
 	"github.com/interstellar/starlight/starlight/walletrpc"
+	"github.com/interstellar/starlight/worizon/xlm"
 )
 
 func main() {
@@ -31,9 +33,52 @@ func main() {
 		dir    = flag.String("data", "./starlight-data", "data directory")
 		debug  = flag.Bool("debug", false, "print verbose debugging output")
 		name   = flag.String("name", "", "name for the agent, used in log output")
+		retain = flag.Duration("retain", 0, "archive updates older than `duration` (0 keeps everything)")
+
+		metricsListen = flag.String("metrics-listen", "", "serve Prometheus metrics at /metrics on `address` (empty disables)")
+
+		seedFile       = flag.String("seed-file", "", "unlock the seed at startup with the password in `file`")
+		seedCredential = flag.String("seed-credential", "", "unlock the seed at startup with the password in systemd credential or environment variable `name`")
+		signerSocket   = flag.String("signer", "", "sign with the starlight-signer listening on Unix socket `path` instead of holding the seed")
+
+		fundSponsor  = flag.String("fund-sponsor", "", "fund a new wallet account from the sponsor account whose secret seed is in `file`, instead of from the friendbot")
+		fundAmount   = flag.String("fund-amount", "10000", "`lumens` to fund a new wallet account with from -fund-sponsor")
+		fundExternal = flag.Bool("fund-external", false, "wait for someone else to fund a new wallet account, instead of asking the friendbot")
 	)
 	flag.Parse()
 
+	var seedProviders []starlight.SeedProvider
+	if *seedFile != "" {
+		seedProviders = append(seedProviders, starlight.KeyFileSeed(*seedFile))
+	}
+	if *seedCredential != "" {
+		seedProviders = append(seedProviders, starlight.CredentialSeed(*seedCredential))
+	}
+	if len(seedProviders) > 1 {
+		log.Fatal("at most one of -seed-file and -seed-credential may be given")
+	}
+	if len(seedProviders) > 0 && *signerSocket != "" {
+		log.Fatal("-signer cannot be used with -seed-file or -seed-credential")
+	}
+
+	var funding starlight.FundingSource
+	if *fundSponsor != "" && *fundExternal {
+		log.Fatal("at most one of -fund-sponsor and -fund-external may be given")
+	}
+	if *fundSponsor != "" {
+		amount, err := xlm.Parse(*fundAmount)
+		if err != nil {
+			log.Fatalf("bad -fund-amount: %s", err)
+		}
+		funding, err = starlight.SponsorFile(*fundSponsor, amount)
+		if err != nil {
+			log.Fatalf("reading sponsor seed: %s", err)
+		}
+	}
+	if *fundExternal {
+		funding = starlight.ExternalFunding()
+	}
+
 	err := os.MkdirAll(*dir, 0700)
 	if err != nil {
 		log.Fatal(err)
@@ -47,11 +92,32 @@ func main() {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	g, err := starlight.StartAgent(ctx, db)
+	opts := []starlight.Option{starlight.WithDebug(*debug, *name)}
+	if funding != nil {
+		opts = append(opts, starlight.WithFunding(funding))
+	}
+	g, err := starlight.StartAgent(ctx, db, opts...)
 	if err != nil {
 		log.Fatalf("error starting agent: %s", err)
 	}
-	g.SetDebug(*debug, *name)
+	if len(seedProviders) > 0 {
+		err = g.Unlock(seedProviders[0])
+		if err != nil {
+			log.Fatalf("error unlocking seed: %s", err)
+		}
+	}
+	if *signerSocket != "" {
+		err = g.UseSigner(&signer.Client{Path: *signerSocket})
+		if err != nil {
+			log.Fatalf("error connecting to signer: %s", err)
+		}
+	}
+	if *retain > 0 {
+		go archiveUpdates(ctx, g, filepath.Join(*dir, "archive"), *retain)
+	}
+	if *metricsListen != "" {
+		go serveMetrics(g, *metricsListen)
+	}
 
 	handler := walletrpc.Handler(g)
 	if !i10rnet.IsLoopback(*listen) {
@@ -135,6 +201,50 @@ func main() {
 	}
 }
 
+// archiveUpdates periodically moves updates older than retain
+// out of the agent's database and into compressed files in dir.
+func archiveUpdates(ctx context.Context, g *starlight.Agent, dir string, retain time.Duration) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		// Updates carry ledger times, so compare against the ledger clock.
+		if now := g.Now(); !now.IsZero() {
+			path, n, err := g.ArchiveUpdates(dir, now.Add(-retain))
+			if err != nil {
+				log.Printf("archiving updates: %s", err)
+			} else if n > 0 {
+				log.Printf("archived %d updates to %s", n, path)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// serveMetrics serves g's metrics at /metrics on addr,
+// apart from the wallet,
+// so that it can listen on an address
+// only a metrics collector can reach.
+func serveMetrics(g *starlight.Agent, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", g.MetricsHandler())
+	s := &http.Server{
+		Addr:         addr,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		Handler:      mux,
+	}
+	err := s.ListenAndServe()
+	log.Fatalf("metrics: %s", err)
+}
+
 // autoHostWhitelist provides a TOFU-like mechanism as an
 // autocert host policy. It whitelists the first-requested
 // name and rejects all subsequent names.
@@ -0,0 +1,290 @@
+// Package metrics keeps counters and histograms,
+// and reports them, along with gauges computed on demand,
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Metric is a named family of samples,
+// one for each combination of its label values.
+type Metric interface {
+	// write writes the samples of the metric,
+	// after its HELP and TYPE lines.
+	write(w *bufio.Writer)
+	metricDesc() *desc
+}
+
+type desc struct {
+	name, help, typ string
+	labels          []string
+}
+
+func (d *desc) metricDesc() *desc { return d }
+
+// Registry is a set of metrics.
+// It is an http.Handler
+// serving them in the Prometheus text format.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []Metric // in registration order
+}
+
+// Register adds ms to r.
+func (r *Registry) Register(ms ...Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, ms...)
+}
+
+// Write writes all of r's metrics to w,
+// in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	ms := r.metrics
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range ms {
+		d := m.metricDesc()
+		fmt.Fprintf(bw, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", d.name, d.typ)
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
+
+// Counter is a metric whose samples only go up.
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	v           float64
+}
+
+// NewCounter returns a new counter
+// with the given name, help text, and label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{
+		desc:   desc{name: name, help: help, typ: "counter", labels: labels},
+		series: make(map[string]*counterSeries),
+	}
+}
+
+// Add adds v, which must not be negative,
+// to the sample with the given label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.checkLabels(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := seriesKey(labelValues)
+	s := c.series[k]
+	if s == nil {
+		s = &counterSeries{labelValues: labelValues}
+		c.series[k] = s
+	}
+	s.v += v
+}
+
+// Inc adds 1 to the sample with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range sortedKeys(c.series) {
+		s := c.series[k]
+		writeSample(w, c.name, c.labels, s.labelValues, "", "", s.v)
+	}
+}
+
+// Histogram is a metric whose samples
+// count observations in buckets.
+type Histogram struct {
+	desc
+	buckets []float64 // upper bounds, sorted, without +Inf
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // per bucket, not cumulative
+	sum         float64
+	count       uint64
+}
+
+// NewHistogram returns a new histogram
+// with the given name, help text, bucket upper bounds,
+// and label names.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Histogram{
+		desc:    desc{name: name, help: help, typ: "histogram", labels: labels},
+		buckets: b,
+		series:  make(map[string]*histogramSeries),
+	}
+}
+
+// Observe adds an observation of v
+// to the sample with the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.checkLabels(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := seriesKey(labelValues)
+	s := h.series[k]
+	if s == nil {
+		s = &histogramSeries{
+			labelValues: labelValues,
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[k] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, k := range sortedKeys(h.series) {
+		s := h.series[k]
+		var n uint64
+		for i, le := range h.buckets {
+			n += s.counts[i]
+			writeSample(w, h.name+"_bucket", h.labels, s.labelValues, "le", formatFloat(le), float64(n))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, s.labelValues, "le", "+Inf", float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.labelValues, "", "", s.sum)
+		writeSample(w, h.name+"_count", h.labels, s.labelValues, "", "", float64(s.count))
+	}
+}
+
+// GaugeFunc is a metric whose samples
+// are computed each time they are reported.
+type GaugeFunc struct {
+	desc
+	f func(set func(v float64, labelValues ...string))
+}
+
+// NewGaugeFunc returns a new gauge
+// with the given name, help text, and label names.
+// To report it, f is called with a function
+// that sets the sample with the given label values.
+// Samples not set are not reported.
+func NewGaugeFunc(name, help string, labels []string, f func(set func(v float64, labelValues ...string))) *GaugeFunc {
+	return &GaugeFunc{
+		desc: desc{name: name, help: help, typ: "gauge", labels: labels},
+		f:    f,
+	}
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	series := make(map[string]*counterSeries)
+	g.f(func(v float64, labelValues ...string) {
+		g.checkLabels(labelValues)
+		series[seriesKey(labelValues)] = &counterSeries{labelValues: labelValues, v: v}
+	})
+	for _, k := range sortedKeys(series) {
+		s := series[k]
+		writeSample(w, g.name, g.labels, s.labelValues, "", "", s.v)
+	}
+}
+
+func (d *desc) checkLabels(labelValues []string) {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s: got %d label values, want %d", d.name, len(labelValues), len(d.labels)))
+	}
+}
+
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*counterSeries:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*histogramSeries:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeSample writes one sample line.
+// If extraName is not empty,
+// it is added as a label after the others,
+// as for the le label of histogram buckets.
+func writeSample(w *bufio.Writer, name string, labels, labelValues []string, extraName, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, l, escapeLabel(labelValues[i]))
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	c := NewCounter("test_events_total", "Events,\nby kind.", "kind")
+	c.Inc("b")
+	c.Add(2.5, "a")
+	c.Inc("b")
+	c.Inc(`quo"te`)
+
+	h := NewHistogram("test_seconds", "Durations.", []float64{1, 0.5})
+	h.Observe(0.25)
+	h.Observe(0.75)
+	h.Observe(3)
+
+	g := NewGaugeFunc("test_things", "Things.", []string{"x", "y"}, func(set func(float64, ...string)) {
+		set(7, "1", "2")
+		set(-1, "0", "9")
+	})
+
+	r := new(Registry)
+	r.Register(c, h, g)
+	var buf bytes.Buffer
+	err := r.Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_events_total Events,\nby kind.
+# TYPE test_events_total counter
+test_events_total{kind="a"} 2.5
+test_events_total{kind="b"} 2
+test_events_total{kind="quo\"te"} 1
+# HELP test_seconds Durations.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.5"} 1
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 4
+test_seconds_count 3
+# HELP test_things Things.
+# TYPE test_things gauge
+test_things{x="0",y="9"} -1
+test_things{x="1",y="2"} 7
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	c := NewCounter("test_total", "Test.")
+	c.Inc()
+	r := new(Registry)
+	r.Register(c)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got content type %q", ct)
+	}
+	if got, want := rec.Body.String(), "test_total 1\n"; !strings.HasSuffix(got, want) {
+		t.Errorf("got %q, want suffix %q", got, want)
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic with wrong number of label values")
+		}
+	}()
+	NewCounter("test_total", "Test.", "a", "b").Inc("x")
+}
@@ -5,6 +5,8 @@ import (
 	"io/ioutil"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
@@ -34,6 +36,21 @@ import (
 // home domain, returning the account's federation address and
 // Starlight URL.
 func (g *Agent) FindAccount(target string) (accountID, starlightURL string, err error) {
+	rec, starlightURL, err := g.lookupAccount(target)
+	if err != nil {
+		return "", "", err
+	}
+	return rec.AccountID, starlightURL, nil
+}
+
+// lookupAccount is like FindAccount
+// but returns the full federation record for target,
+// including any memo the recipient requires.
+// For account ID targets, only the record's AccountID is set.
+//
+// Federation and stellar.toml responses are cached
+// for fedCacheTTL and tomlCacheTTL respectively.
+func (g *Agent) lookupAccount(target string) (*fedRecord, string, error) {
 	var host string
 	federation := true
 
@@ -43,15 +60,15 @@ func (g *Agent) FindAccount(target string) (accountID, starlightURL string, err
 		err := guest.SetAddress(target)
 		if err != nil {
 			err = errors.Sub(errBadAddress, err)
-			return "", "", errors.Wrap(err, target)
+			return nil, "", errors.Wrap(err, target)
 		}
 		acct, err := g.wclient.LoadAccount(target)
 		if err != nil {
 			err = errors.Sub(errBadAddress, err)
-			return "", "", errors.Wrapf(err, "loading account %s", target)
+			return nil, "", errors.Wrapf(err, "loading account %s", target)
 		}
 		if acct.HomeDomain == "" {
-			return "", "", errors.Wrap(errBadAddress, "no home domain set")
+			return nil, "", errors.Wrap(errBadAddress, "no home domain set")
 		}
 		host = acct.HomeDomain
 		federation = false
@@ -59,31 +76,16 @@ func (g *Agent) FindAccount(target string) (accountID, starlightURL string, err
 		host = target[i+1:]
 	}
 
-	// Get URLs from Stellar TOML configuration.
-	// See https://www.stellar.org/developers/guides/concepts/stellar-toml.html.
-	resp, err := g.httpclient.Get(protocol(host) + host + "/.well-known/stellar.toml")
-	if err != nil {
-		return "", "", errors.Sub(errBadHTTPRequest, err)
-	}
-	if resp.StatusCode/100 != 2 {
-		return "", "", errors.Wrapf(errBadHTTPStatus, "got http status %d looking up TOML", resp.StatusCode)
-	}
-	body, err := ioutil.ReadAll(resp.Body)
+	stellarTOML, err := g.loadTOML(host)
 	if err != nil {
-		err = errors.Sub(errBadHTTPRequest, err)
-		return "", "", errors.Wrap(err, "reading TOML")
-	}
-	var stellarTOML struct {
-		FedURL       string `toml:"FEDERATION_SERVER"`
-		StarlightURL string `toml:"STARLIGHT_SERVER"`
-	}
-	err = toml.Unmarshal(body, &stellarTOML)
-	if err != nil {
-		err = errors.Sub(errDecoding, err)
-		return "", "", errors.Wrap(err, "unmarshaling TOML")
+		return nil, "", err
 	}
 	if !federation {
-		return target, stellarTOML.StarlightURL, nil
+		return &fedRecord{AccountID: target}, stellarTOML.StarlightURL, nil
+	}
+
+	if v, ok := g.lookups.get("fed:"+target, g.clock.Now()); ok {
+		return v.(*fedRecord), stellarTOML.StarlightURL, nil
 	}
 
 	// Get account ID from federation server.
@@ -92,23 +94,123 @@ func (g *Agent) FindAccount(target string) (accountID, starlightURL string, err
 		"q":    {target},
 		"type": {"name"},
 	}
-	resp, err = g.httpclient.Get(stellarTOML.FedURL + "?" + q.Encode())
+	resp, err := g.httpclient.Get(stellarTOML.FedURL + "?" + q.Encode())
 	if err != nil {
 		err = errors.Sub(errBadHTTPRequest, err)
-		return "", "", errors.Wrapf(err, "getting account ID from %s", stellarTOML.FedURL)
+		return nil, "", errors.Wrapf(err, "getting account ID from %s", stellarTOML.FedURL)
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode/100 != 2 {
-		return "", "", errors.Wrapf(errBadHTTPStatus, "got http status %d", resp.StatusCode)
+		return nil, "", errors.Wrapf(errBadHTTPStatus, "got http status %d", resp.StatusCode)
 	}
-	var acct struct {
-		ID string `json:"account_id"`
+	rec := new(fedRecord)
+	err = json.NewDecoder(resp.Body).Decode(rec)
+	if err != nil {
+		err = errors.Sub(errDecoding, err)
+		return nil, "", errors.Wrapf(err, "decoding account ID from %s", stellarTOML.FedURL)
 	}
-	err = json.NewDecoder(resp.Body).Decode(&acct)
+	g.lookups.put("fed:"+target, rec, fedCacheTTL, g.clock.Now())
+	return rec, stellarTOML.StarlightURL, nil
+}
+
+// stellarTOML holds the fields of a stellar.toml file
+// used by the agent.
+// See https://www.stellar.org/developers/guides/concepts/stellar-toml.html.
+type stellarTOML struct {
+	FedURL       string `toml:"FEDERATION_SERVER"`
+	StarlightURL string `toml:"STARLIGHT_SERVER"`
+}
+
+// loadTOML gets the stellar.toml file for host.
+func (g *Agent) loadTOML(host string) (*stellarTOML, error) {
+	if v, ok := g.lookups.get("toml:"+host, g.clock.Now()); ok {
+		return v.(*stellarTOML), nil
+	}
+	resp, err := g.httpclient.Get(protocol(host) + host + "/.well-known/stellar.toml")
+	if err != nil {
+		return nil, errors.Sub(errBadHTTPRequest, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, errors.Wrapf(errBadHTTPStatus, "got http status %d looking up TOML", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		err = errors.Sub(errBadHTTPRequest, err)
+		return nil, errors.Wrap(err, "reading TOML")
+	}
+	t := new(stellarTOML)
+	err = toml.Unmarshal(body, t)
 	if err != nil {
 		err = errors.Sub(errDecoding, err)
-		return "", "", errors.Wrapf(err, "decoding account ID from %s", stellarTOML.FedURL)
+		return nil, errors.Wrap(err, "unmarshaling TOML")
+	}
+	g.lookups.put("toml:"+host, t, tomlCacheTTL, g.clock.Now())
+	return t, nil
+}
+
+// Lifetimes of cached lookups.
+const (
+	tomlCacheTTL = time.Hour
+	fedCacheTTL  = 10 * time.Minute
+
+	// maxCacheEntries is the size at which a lookupCache
+	// sweeps out its expired entries.
+	maxCacheEntries = 1000
+)
+
+// lookupCache holds the results of recent remote lookups
+// until they expire.
+// Its callers supply the current time,
+// from the agent's clock.
+// The zero value is an empty cache.
+type lookupCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	v       interface{}
+	expires time.Time
+}
+
+func (c *lookupCache) get(key string, now time.Time) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.v, true
+}
+
+func (c *lookupCache) put(key string, v interface{}, ttl time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+	if len(c.entries) >= maxCacheEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = cacheEntry{v: v, expires: now.Add(ttl)}
+}
+
+// memo returns the memo the federation server
+// requires on payments to r, or nil if there is none.
+func (r *fedRecord) memo() *Memo {
+	if r.MemoType == "" {
+		return nil
 	}
-	return acct.ID, stellarTOML.StarlightURL, nil
+	return &Memo{Type: r.MemoType, Value: r.Memo}
 }
 
 // protocol returns the protocol identifier to be used for the
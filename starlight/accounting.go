@@ -0,0 +1,331 @@
+package starlight
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/update"
+)
+
+// Accounting entry kinds.
+const (
+	EntryOpeningBalance    = "opening_balance"
+	EntryWalletPaymentIn   = "wallet_payment_in"
+	EntryWalletPaymentOut  = "wallet_payment_out"
+	EntryChannelFunding    = "channel_funding"
+	EntryChannelSetup      = "channel_setup" // reserves and fees held by channel accounts
+	EntryTopUp             = "top_up"
+	EntryChannelPaymentIn  = "channel_payment_in"
+	EntryChannelPaymentOut = "channel_payment_out"
+	EntrySettlement        = "settlement"
+	EntryRefund            = "refund"
+	EntryFee               = "fee"
+	EntryOther             = "other"
+)
+
+// WalletLedger is the Ledger of accounting entries for the wallet account.
+// Other entries have a channel ID as their Ledger.
+const WalletLedger = "wallet"
+
+// AccountingEntry is one movement of value
+// into or out of the wallet or one of the agent's channels.
+type AccountingEntry struct {
+	UpdateNum    uint64
+	Time         time.Time
+	Ledger       string // WalletLedger or a channel ID
+	Kind         string
+	Counterparty string `json:",omitempty"`
+	Round        uint64 `json:",omitempty"` // channel round number
+	Asset        string // "native", or the asset's string form
+
+	// Amount is the change, in stroops, to the ledger's
+	// balance of Asset; it is negative for outflows.
+	Amount int64
+
+	// Balance is the ledger's balance of Asset
+	// after this entry.
+	Balance int64
+}
+
+// ExportAccounting returns the accounting entries,
+// derived from the update log in boltDB,
+// for updates with ledger times in the half-open interval [start, end).
+// A zero start or end leaves that side of the range open.
+//
+// Running balances cover the whole log,
+// not just the selected range.
+// Where updates have been archived,
+// the first update after them yields opening-balance entries
+// for the balances they changed.
+func ExportAccounting(boltDB *bolt.DB, start, end time.Time) ([]*AccountingEntry, error) {
+	if !end.IsZero() && end.Before(start) {
+		return nil, errors.Wrap(errInvalidInput, "end before start")
+	}
+	acc := newAccountant()
+	err := db.View(boltDB, func(root *db.Root) error {
+		updates := root.Agent().Updates()
+		if updates.Bucket() == nil {
+			return nil
+		}
+		c := updates.Bucket().Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			ev := updates.Get(binary.BigEndian.Uint64(k))
+			if !end.IsZero() && !ev.UpdateLedgerTime.Before(end) {
+				break
+			}
+			acc.add(ev, !ev.UpdateLedgerTime.Before(start))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acc.entries, nil
+}
+
+// ExportAccounting returns the accounting entries
+// for the agent's updates in the ledger-time range [start, end).
+// See the package-level ExportAccounting.
+func (g *Agent) ExportAccounting(start, end time.Time) ([]*AccountingEntry, error) {
+	return ExportAccounting(g.db, start, end)
+}
+
+// WriteAccountingCSV writes entries to w as CSV,
+// with a header row.
+func WriteAccountingCSV(w io.Writer, entries []*AccountingEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"update_num", "time", "ledger", "kind", "counterparty", "round", "asset", "amount", "balance"})
+	for _, e := range entries {
+		var round string
+		if e.Round > 0 {
+			round = strconv.FormatUint(e.Round, 10)
+		}
+		cw.Write([]string{
+			strconv.FormatUint(e.UpdateNum, 10),
+			e.Time.UTC().Format(time.RFC3339),
+			e.Ledger,
+			e.Kind,
+			e.Counterparty,
+			round,
+			e.Asset,
+			strconv.FormatInt(e.Amount, 10),
+			strconv.FormatInt(e.Balance, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// accountant derives accounting entries
+// from successive balance snapshots in the update log.
+type accountant struct {
+	entries []*AccountingEntry
+
+	last     uint64                      // number of the last update added
+	balances map[string]map[string]int64 // ledger -> asset -> balance
+	channels map[string]bool             // IDs (escrow accounts) of channels seen
+}
+
+func newAccountant() *accountant {
+	return &accountant{
+		balances: make(map[string]map[string]int64),
+		channels: make(map[string]bool),
+	}
+}
+
+// add records the entries for ev.
+// It updates running balances regardless of emit,
+// but only keeps the entries if emit is true.
+func (a *accountant) add(ev *Update, emit bool) {
+	opening := ev.UpdateNum != a.last+1
+	a.last = ev.UpdateNum
+
+	post := func(ledger, kind, asset string, amount int64, counterparty string, round uint64) {
+		if amount == 0 {
+			return
+		}
+		if a.balances[ledger] == nil {
+			a.balances[ledger] = make(map[string]int64)
+		}
+		a.balances[ledger][asset] += amount
+		if !emit {
+			return
+		}
+		a.entries = append(a.entries, &AccountingEntry{
+			UpdateNum:    ev.UpdateNum,
+			Time:         ev.UpdateLedgerTime,
+			Ledger:       ledger,
+			Kind:         kind,
+			Counterparty: counterparty,
+			Round:        round,
+			Asset:        asset,
+			Amount:       amount,
+			Balance:      a.balances[ledger][asset],
+		})
+	}
+
+	keys := indexKeys(ev)
+	var counterparty string
+	if len(keys.counterparties) > 0 {
+		counterparty = keys.counterparties[0]
+	}
+	var cmd fsm.CommandName
+	if ev.InputCommand != nil {
+		cmd = ev.InputCommand.Name
+	}
+
+	// Channel balance.
+	if ch := ev.Channel; ch != nil && ev.Type == update.ChannelType {
+		a.channels[ch.ID] = true
+		local := int64(ch.HostAmount)
+		if ch.Role == fsm.Guest {
+			local = int64(ch.GuestAmount)
+		}
+		if ch.State == fsm.Closed {
+			local = 0
+		}
+		delta := local - a.balances[ch.ID]["native"]
+		var kind string
+		switch {
+		case opening:
+			kind = EntryOpeningBalance
+		case ch.State == fsm.Closed:
+			kind = EntrySettlement
+		case cmd == fsm.CreateChannel || ch.PrevState == fsm.Start:
+			kind = EntryChannelFunding
+		case ev.InputTx != nil && delta > 0:
+			kind = EntryTopUp
+		case delta > 0:
+			kind = EntryChannelPaymentIn
+		default:
+			kind = EntryChannelPaymentOut
+		}
+		post(ch.ID, kind, "native", delta, ch.CounterpartyAddress, ch.RoundNumber)
+	}
+
+	// Wallet balances.
+	// The native balance includes the wallet's reserve,
+	// which is held in the account, not spent.
+	if ev.Account == nil {
+		return
+	}
+	wallet := map[string]int64{
+		"native": int64(ev.Account.Balance + ev.Account.Reserve),
+	}
+	for asset, b := range ev.Account.Balances {
+		wallet[asset] = int64(b.Amount)
+	}
+	for asset := range a.balances[WalletLedger] {
+		if _, ok := wallet[asset]; !ok {
+			wallet[asset] = 0 // trustline removed
+		}
+	}
+	assets := make([]string, 0, len(wallet))
+	for asset := range wallet {
+		if asset != "native" {
+			assets = append(assets, asset)
+		}
+	}
+	sort.Strings(assets)
+	assets = append([]string{"native"}, assets...)
+
+	for _, asset := range assets {
+		delta := wallet[asset] - a.balances[WalletLedger][asset]
+		if delta == 0 {
+			continue
+		}
+		switch {
+		case opening:
+			post(WalletLedger, EntryOpeningBalance, asset, delta, "", 0)
+
+		case ev.Type == update.TxFailureType:
+			post(WalletLedger, EntryRefund, asset, delta, "", 0)
+
+		case cmd == fsm.Pay && delta < 0:
+			// The payment amount, plus the fee in native.
+			// A path payment spends up to SendMax of its send asset;
+			// what it does not spend is refunded later.
+			sendCode, sent := ev.InputCommand.AssetCode, ev.InputCommand.Amount
+			if ev.InputCommand.SendMax > 0 {
+				sendCode, sent = ev.InputCommand.SendAssetCode, ev.InputCommand.SendMax
+			}
+			var amount int64
+			if (asset == "native") == (sendCode == "") {
+				amount = int64(sent)
+			}
+			post(WalletLedger, EntryWalletPaymentOut, asset, -amount, counterparty, 0)
+			post(WalletLedger, EntryFee, asset, delta+amount, "", 0)
+
+		case cmd == fsm.BatchPay && delta < 0:
+			// Each payment in asset, plus the fees in native.
+			var total int64
+			for _, p := range ev.InputCommand.Payments {
+				if paymentAssetString(p.AssetCode, p.Issuer) != asset {
+					continue
+				}
+				post(WalletLedger, EntryWalletPaymentOut, asset, -int64(p.Amount), p.Recipient, 0)
+				total += int64(p.Amount)
+			}
+			post(WalletLedger, EntryFee, asset, delta+total, "", 0)
+
+		case cmd == fsm.CreateChannel && ev.Channel != nil && delta < 0:
+			amount := int64(ev.Channel.HostAmount)
+			post(WalletLedger, EntryChannelFunding, asset, -amount, ev.Channel.ID, 0)
+			post(WalletLedger, EntryChannelSetup, asset, delta+amount, ev.Channel.ID, 0)
+
+		case cmd == fsm.TopUp && ev.Channel != nil && delta < 0:
+			amount := int64(ev.InputCommand.Amount)
+			post(WalletLedger, EntryTopUp, asset, -amount, ev.Channel.ID, 0)
+			post(WalletLedger, EntryFee, asset, delta+amount, "", 0)
+
+		case delta > 0 && isPathPaymentRefund(ev, asset):
+			post(WalletLedger, EntryRefund, asset, delta, "", 0)
+
+		case delta > 0 && ev.Channel != nil:
+			post(WalletLedger, EntrySettlement, asset, delta, ev.Channel.ID, 0)
+
+		case delta > 0 && a.channels[counterparty]:
+			post(WalletLedger, EntrySettlement, asset, delta, counterparty, 0)
+
+		case delta > 0 && ev.InputTx != nil:
+			post(WalletLedger, EntryWalletPaymentIn, asset, delta, counterparty, 0)
+
+		case delta < 0 && (ev.Type == update.ConfigType || cmd == fsm.AddAsset):
+			post(WalletLedger, EntryFee, asset, delta, "", 0)
+
+		default:
+			post(WalletLedger, EntryOther, asset, delta, counterparty, 0)
+		}
+	}
+}
+
+// isPathPaymentRefund reports whether ev credits the wallet
+// with the unspent part of a path payment it sent in asset.
+func isPathPaymentRefund(ev *Update, asset string) bool {
+	if ev.Type != update.AccountType || ev.InputTx == nil || ev.InputTx.Env == nil {
+		return false
+	}
+	tx := ev.InputTx.Env.Tx
+	if ev.OpIndex >= len(tx.Operations) {
+		return false
+	}
+	op := tx.Operations[ev.OpIndex]
+	if op.Body.Type != xdr.OperationTypePathPayment {
+		return false
+	}
+	source := tx.SourceAccount
+	if op.SourceAccount != nil {
+		source = *op.SourceAccount
+	}
+	return source.Address() == ev.Account.ID && op.Body.PathPaymentOp.SendAsset.String() == asset
+}
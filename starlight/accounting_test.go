@@ -0,0 +1,189 @@
+package starlight
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/update"
+	"github.com/interstellar/starlight/worizon"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+func TestExportAccounting(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acct := func(balance xlm.Amount) *update.Account {
+		return &update.Account{Balance: uint64(balance), Reserve: uint64(xlm.Lumen)}
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		g.putUpdate(root, &Update{
+			Type:    update.AccountType,
+			Account: acct(99 * xlm.Lumen),
+			InputTx: &worizon.Tx{},
+		})
+		g.putUpdate(root, &Update{
+			Type:         update.AccountType,
+			Account:      acct(89*xlm.Lumen - 100),
+			InputCommand: &fsm.Command{Name: fsm.Pay, Amount: 10 * xlm.Lumen, Recipient: "bob*starlight.com"},
+		})
+		g.putUpdate(root, &Update{
+			Type:         update.ChannelType,
+			Account:      acct(69*xlm.Lumen - 100),
+			InputCommand: &fsm.Command{Name: fsm.CreateChannel},
+			Channel:      &fsm.Channel{ID: "chan1", Role: fsm.Host, State: fsm.SettingUp, HostAmount: 15 * xlm.Lumen},
+		})
+		g.putUpdate(root, &Update{
+			Type:         update.ChannelType,
+			Account:      acct(69*xlm.Lumen - 100),
+			InputCommand: &fsm.Command{Name: fsm.ChannelPay, Amount: 5 * xlm.Lumen},
+			Channel:      &fsm.Channel{ID: "chan1", Role: fsm.Host, State: fsm.Open, PrevState: fsm.Open, HostAmount: 10 * xlm.Lumen, RoundNumber: 2},
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := g.ExportAccounting(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		ledger, kind    string
+		amount, balance int64
+	}{
+		{WalletLedger, EntryWalletPaymentIn, int64(100 * xlm.Lumen), int64(100 * xlm.Lumen)},
+		{WalletLedger, EntryWalletPaymentOut, -int64(10 * xlm.Lumen), int64(90 * xlm.Lumen)},
+		{WalletLedger, EntryFee, -100, int64(90*xlm.Lumen) - 100},
+		{"chan1", EntryChannelFunding, int64(15 * xlm.Lumen), int64(15 * xlm.Lumen)},
+		{WalletLedger, EntryChannelFunding, -int64(15 * xlm.Lumen), int64(75*xlm.Lumen) - 100},
+		{WalletLedger, EntryChannelSetup, -int64(5 * xlm.Lumen), int64(70*xlm.Lumen) - 100},
+		{"chan1", EntryChannelPaymentOut, -int64(5 * xlm.Lumen), int64(10 * xlm.Lumen)},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		w := want[i]
+		if e.Ledger != w.ledger || e.Kind != w.kind || e.Amount != w.amount || e.Balance != w.balance {
+			t.Errorf("entry %d: got %s %s %d (balance %d), want %s %s %d (balance %d)",
+				i, e.Ledger, e.Kind, e.Amount, e.Balance, w.ledger, w.kind, w.amount, w.balance)
+		}
+	}
+	if entries[6].Round != 2 {
+		t.Errorf("got round %d, want 2", entries[6].Round)
+	}
+
+	buf := new(bytes.Buffer)
+	err = WriteAccountingCSV(buf, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != len(entries)+1 {
+		t.Errorf("got %d CSV lines, want %d", lines, len(entries)+1)
+	}
+
+	entries, err = g.ExportAccounting(time.Now().Add(time.Hour), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %d entries after the last update, want 0", len(entries))
+	}
+}
+
+func TestExportAccountingArchived(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acct := func(balance xlm.Amount) *update.Account {
+		return &update.Account{Balance: uint64(balance), Reserve: uint64(xlm.Lumen)}
+	}
+	pay := &fsm.Command{Name: fsm.Pay, Amount: 10 * xlm.Lumen, Recipient: "bob*starlight.com"}
+	err = db.Update(g.db, func(root *db.Root) error {
+		g.putUpdate(root, &Update{Type: update.AccountType, Account: acct(99 * xlm.Lumen), InputTx: &worizon.Tx{}})
+		g.putUpdate(root, &Update{Type: update.AccountType, Account: acct(89*xlm.Lumen - 100), InputCommand: pay})
+		g.putUpdate(root, &Update{Type: update.AccountType, Account: acct(109*xlm.Lumen - 100), InputTx: &worizon.Tx{}})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The latest update, the second payment received, is kept.
+	_, n, err := g.ArchiveUpdates(dir, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("got %d updates archived, want 2", n)
+	}
+
+	err = db.Update(g.db, func(root *db.Root) error {
+		g.putUpdate(root, &Update{Type: update.AccountType, Account: acct(99*xlm.Lumen - 200), InputCommand: pay})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := g.ExportAccounting(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The archived updates' changes,
+	// and the payment received in the first update after them,
+	// are carried in as an opening balance.
+	var got []*AccountingEntry
+	for _, e := range entries {
+		if e.UpdateNum > 1 {
+			got = append(got, e)
+		}
+	}
+	want := []struct {
+		kind    string
+		balance int64
+	}{
+		{EntryOpeningBalance, int64(110*xlm.Lumen) - 100},
+		{EntryWalletPaymentOut, int64(100*xlm.Lumen) - 100},
+		{EntryFee, int64(100*xlm.Lumen) - 200},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries after update 1, want %d", len(got), len(want))
+	}
+	for i, e := range got {
+		w := want[i]
+		if e.Ledger != WalletLedger || e.Kind != w.kind || e.Balance != w.balance {
+			t.Errorf("entry %d: got %s %s (balance %d), want %s %s (balance %d)",
+				i, e.Ledger, e.Kind, e.Balance, WalletLedger, w.kind, w.balance)
+		}
+	}
+}
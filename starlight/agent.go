@@ -3,6 +3,7 @@ package starlight
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -19,11 +20,10 @@ import (
 	"github.com/stellar/go/xdr"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/interstellar/starlight/clock"
 	"github.com/interstellar/starlight/errors"
-	"github.com/interstellar/starlight/net"
 	"github.com/interstellar/starlight/starlight/db"
 	"github.com/interstellar/starlight/starlight/fsm"
-	"github.com/interstellar/starlight/starlight/internal/message"
 	"github.com/interstellar/starlight/starlight/internal/update"
 	"github.com/interstellar/starlight/starlight/key"
 	"github.com/interstellar/starlight/starlight/taskbasket"
@@ -78,20 +78,34 @@ type Agent struct {
 	// messages (as well as all new inputs).
 	seed []byte // write-once; synchronized with db.Update
 
-	// Horizon client wrapper.
+	// Remote signer holding the seed in another process;
+	// if set, it's used instead of seed. See UseSigner.
+	remote key.Signer // synchronized with db.Update
+
+	// Source of funds for the wallet account;
+	// if nil, the configured friendbot is used.
+	// See WithFunding.
+	funding FundingSource
+
+	// Horizon client wrapper. See WithNetwork.
 	wclient *worizon.Client
 
 	// HTTP client used for agent requests. Treated as immutable state
-	// after agent creation.
+	// after agent creation. See WithNetwork.
 	httpclient http.Client
 
+	// Clock for real-time waits, such as retries and keep-alives,
+	// as opposed to ledger time, which comes from wclient.
+	// Treated as immutable state after agent creation.
+	clock clock.Clock
+
 	tb *taskbasket.TB
 
 	wg *sync.WaitGroup
 
 	db *bolt.DB // doubles as a mutex for the fields in this struct
 
-	// Channel to indicate when testnet faucet funds returns successfully
+	// Channel to indicate when the wallet account has been funded
 	wallet chan struct{}
 
 	// Maps Starlight channel IDs to cancellation functions.
@@ -103,6 +117,22 @@ type Agent struct {
 	// and are ready to be streamed from Horizon.
 	acctsReady map[string]chan struct{}
 
+	// Pending channel and schedule timers. See Timers.
+	timerMu  sync.Mutex
+	timers   map[timerKey]*agentTimer
+	timerGen uint64 // synchronized with db.Update
+
+	// Channels whose timeouts await the seed.
+	// See channelTimeout.
+	stalled map[string]bool
+
+	// lookups caches FindAccount's stellar.toml
+	// and federation responses.
+	lookups lookupCache
+
+	// See MetricsHandler.
+	metrics *agentMetrics
+
 	// These fields are used for logging.
 	// They should be set once during initialization and not changed.
 	// As such they may be accessed without holding the db mutex.
@@ -114,9 +144,23 @@ type Agent struct {
 type Config struct {
 	Username string `json:",omitempty"`
 	Password string `json:",omitempty"`
+	// HorizonURL can be a comma-separated list of URLs
+	// of Horizon servers on the same network,
+	// in order of preference;
+	// the agent fails over from one to the next.
 	// WARNING: this software is not compatible with Stellar mainnet.
 	HorizonURL string `json:",omitempty"`
 
+	// NetworkPassphrase, BaseReserve, and FriendbotURL
+	// describe the Stellar network HorizonURL is on.
+	// If NetworkPassphrase is empty, the network must be the testnet.
+	// If BaseReserve is zero, it's read from the latest ledger,
+	// and if FriendbotURL is empty, it's read from Horizon.
+	// Only FriendbotURL can be edited.
+	NetworkPassphrase string     `json:",omitempty"`
+	BaseReserve       xlm.Amount `json:",omitempty"`
+	FriendbotURL      string     `json:",omitempty"`
+
 	// OldPassword is required from the client in ConfigEdit
 	// when changing the password.
 	// It's never included in Updates.
@@ -140,14 +184,54 @@ type Config struct {
 }
 
 const (
-	tbBucket    = "tasks"
-	baseReserve = 500 * xlm.Millilumen
+	tbBucket = "tasks"
+
+	testnetFriendbotURL = "https://friendbot.stellar.org/"
 )
 
+// An Option changes how StartAgent sets up an agent.
+type Option func(*Agent)
+
+// WithNetwork makes the agent talk to Horizon with h,
+// ignoring the configured HorizonURL for everything
+// but loading the network's parameters,
+// and make its other HTTP requests,
+// to peers, federation servers, and friendbots,
+// with rt.
+// It lets tests run agents in-process,
+// with a simulated ledger and no sockets,
+// including agents restarted from an existing database.
+func WithNetwork(h *worizon.Client, rt http.RoundTripper) Option {
+	return func(g *Agent) {
+		g.wclient = h
+		g.httpclient.Transport = rt
+	}
+}
+
+// WithClock makes the agent measure real time with clk,
+// such as a clock.Manual in tests,
+// instead of the wall clock.
+// It applies to the agent's Horizon client too,
+// including one given by WithNetwork.
+func WithClock(clk clock.Clock) Option {
+	return func(g *Agent) {
+		g.clock = clk
+	}
+}
+
+// WithDebug turns on the agent's debug logging if debug is true,
+// and names the agent in its log lines.
+func WithDebug(debug bool, name string) Option {
+	return func(g *Agent) {
+		g.debug = debug
+		g.name = name
+	}
+}
+
 // StartAgent starts an agent
 // using the bucket "agent" in db for storage
 // and returns it.
-func StartAgent(ctx context.Context, boltDB *bolt.DB) (*Agent, error) {
+func StartAgent(ctx context.Context, boltDB *bolt.DB, opts ...Option) (*Agent, error) {
 	ctx, cancel := context.WithCancel(ctx)
 
 	g := &Agent{
@@ -159,7 +243,13 @@ func StartAgent(ctx context.Context, boltDB *bolt.DB) (*Agent, error) {
 		wallet:     make(chan struct{}),
 		acctsReady: make(map[string]chan struct{}),
 		wclient:    new(worizon.Client),
+		clock:      clock.Real,
 	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.wclient.SetClock(g.clock)
+	g.metrics = newAgentMetrics(g)
 
 	g.evcond.L = new(sync.Mutex)
 
@@ -176,11 +266,19 @@ func (g *Agent) start(root *db.Root) error {
 	if !g.isReadyConfigured(root) {
 		return nil
 	}
+	err := reindexUpdates(root)
+	if err != nil {
+		return err
+	}
+	err = migrateMessages(root)
+	if err != nil {
+		return err
+	}
 	if g.isReadyFunded(root) {
 		close(g.wallet)
 	} else {
 		primaryAcct := *root.Agent().PrimaryAcct()
-		g.allez(func() { g.getTestnetFaucetFunds(primaryAcct) }, "getTestnetFaucetFunds")
+		g.allez(func() { g.fundWallet(primaryAcct) }, "fundWallet")
 	}
 
 	// WARNING: this software is not compatible with Stellar mainnet.
@@ -189,7 +287,7 @@ func (g *Agent) start(root *db.Root) error {
 	chans := root.Agent().Channels()
 
 	var chanIDs []string
-	err := chans.Bucket().ForEach(func(chanID, _ []byte) error {
+	err = chans.Bucket().ForEach(func(chanID, _ []byte) error {
 		chanIDs = append(chanIDs, string(chanID))
 		return nil
 	})
@@ -209,7 +307,7 @@ func (g *Agent) start(root *db.Root) error {
 
 	g.allez(func() { g.watchWalletAcct(primaryAcct, horizon.Cursor(w.Cursor)) }, "watchWalletAcct")
 
-	tb, err := taskbasket.NewTx(g.rootCtx, root.Tx(), g.db, []byte(tbBucket), tbCodec{g: g})
+	tb, err := taskbasket.NewTx(g.rootCtx, root.Tx(), g.db, []byte(tbBucket), tbCodec{g: g}, g.clock)
 	if err != nil {
 		return err
 	}
@@ -217,13 +315,14 @@ func (g *Agent) start(root *db.Root) error {
 
 	g.allez(func() { g.tb.Run(g.rootCtx) }, "taskbasket")
 
-	return nil
+	return g.startSchedules(root)
 }
 
 // Close releases resources associated with the Agent.
 // It does not wait for its subordinate goroutines to exit.
 func (g *Agent) Close() {
 	g.rootCancel()
+	g.stopTimers()
 }
 
 // CloseWait releases resources associated with the Agent.
@@ -247,10 +346,21 @@ func (g *Agent) allez(f func(), desc string) {
 // ConfigInit sets g's configuration,
 // generates a private key for the wallet,
 // and performs any other necessary setup steps,
-// such as obtaining free testnet lumens.
+// such as getting the wallet account funded.
 // It is an error if g has already been configured.
 func (g *Agent) ConfigInit(c *Config, hostURL string) error {
-	err := g.wclient.ValidateTestnetURL(c.HorizonURL)
+	seed := make([]byte, 32)
+	randRead(seed)
+	return g.configInit(c, hostURL, seed, nil, 1)
+}
+
+// configInit does the work of ConfigInit and ConfigRecover,
+// configuring g to use seed.
+// If funded is non-nil, it holds the state
+// of the wallet's existing account.
+// Channel keys are derived starting at nextKeyIndex.
+func (g *Agent) configInit(c *Config, hostURL string, seed []byte, funded *fsm.WalletAcct, nextKeyIndex uint32) error {
+	err := g.loadNetwork(c)
 	if err != nil {
 		return err
 	}
@@ -259,9 +369,11 @@ func (g *Agent) ConfigInit(c *Config, hostURL string) error {
 		if g.isReadyConfigured(root) {
 			return errAlreadyConfigured
 		}
+		if funded == nil && c.FriendbotURL == "" && g.funding == nil {
+			return errors.Wrap(errInvalidInput, "network has no friendbot to fund the wallet account")
+		}
 
-		g.seed = make([]byte, 32)
-		randRead(g.seed)
+		g.seed = seed
 		k := key.DeriveAccountPrimary(g.seed)
 		primaryAcct := fsm.AccountID(key.PublicKeyXDR(k))
 
@@ -294,9 +406,12 @@ func (g *Agent) ConfigInit(c *Config, hostURL string) error {
 		root.Agent().Config().PutPwType("bcrypt")
 		root.Agent().Config().PutPwHash(digest[:])
 		root.Agent().Config().PutHorizonURL(c.HorizonURL)
+		root.Agent().Config().PutNetworkPassphrase(c.NetworkPassphrase)
+		root.Agent().Config().PutBaseReserve(int64(c.BaseReserve))
+		root.Agent().Config().PutFriendbotURL(c.FriendbotURL)
 		root.Agent().PutReady(true)
 		root.Agent().PutEncryptedSeed(sealBox(g.seed, []byte(c.Password)))
-		root.Agent().PutNextKeypathIndex(1)
+		root.Agent().PutNextKeypathIndex(nextKeyIndex)
 		root.Agent().PutPrimaryAcct(&primaryAcct)
 		if c.MaxRoundDurMins == 0 {
 			c.MaxRoundDurMins = defaultMaxRoundDurMins
@@ -329,6 +444,20 @@ func (g *Agent) ConfigInit(c *Config, hostURL string) error {
 			Address:       c.Username + "*" + hostURL,
 			Balances:      map[string]fsm.Balance{},
 		}
+		acct := &update.Account{
+			ID:      primaryAcct.Address(),
+			Balance: 0,
+		}
+		if funded != nil {
+			w.NativeBalance = funded.NativeBalance
+			w.Reserve = funded.Reserve
+			w.Seqnum = funded.Seqnum
+			w.Cursor = funded.Cursor
+			w.Balances = funded.Balances
+			acct.Balance = uint64(w.NativeBalance)
+			acct.Balances = w.Balances
+			acct.Reserve = uint64(w.Reserve)
+		}
 		root.Agent().PutWallet(w)
 		// WARNING: this software is not compatible with Stellar mainnet.
 		g.wclient.SetURL(c.HorizonURL)
@@ -338,16 +467,16 @@ func (g *Agent) ConfigInit(c *Config, hostURL string) error {
 				Username:          c.Username,
 				Password:          "[redacted]",
 				HorizonURL:        c.HorizonURL,
+				NetworkPassphrase: c.NetworkPassphrase,
+				BaseReserve:       c.BaseReserve,
+				FriendbotURL:      c.FriendbotURL,
 				MaxRoundDurMins:   c.MaxRoundDurMins,
 				FinalityDelayMins: c.FinalityDelayMins,
 				ChannelFeerate:    c.ChannelFeerate,
 				HostFeerate:       c.HostFeerate,
 				KeepAlive:         *c.KeepAlive,
 			},
-			Account: &update.Account{
-				ID:      primaryAcct.Address(),
-				Balance: 0,
-			},
+			Account: acct,
 		})
 
 		return g.start(root)
@@ -355,11 +484,13 @@ func (g *Agent) ConfigInit(c *Config, hostURL string) error {
 }
 
 // ConfigEdit edits g's configuration.
-// Only Password and HorizonURL can be changed;
-// attempting to change another field is an error.
+// Username, KeepAlive, NetworkPassphrase, and BaseReserve
+// can't be changed;
+// attempting to change them is an error.
+// A new HorizonURL must be on the same network.
 func (g *Agent) ConfigEdit(c *Config) error {
-	// Username and KeepAlive payments are not editable
-	if c.Username != "" || c.KeepAlive != nil {
+	// Username, KeepAlive payments, and the network are not editable
+	if c.Username != "" || c.KeepAlive != nil || c.NetworkPassphrase != "" || c.BaseReserve != 0 {
 		return errInvalidEdit
 	}
 
@@ -373,7 +504,12 @@ func (g *Agent) ConfigEdit(c *Config) error {
 		return errors.Wrap(errInvalidPassword, "too long (max 72 chars)") // bcrypt limit
 	}
 	if c.HorizonURL != "" {
-		err := g.wclient.ValidateTestnetURL(c.HorizonURL)
+		nc := &Config{HorizonURL: c.HorizonURL}
+		db.View(g.db, func(root *db.Root) error {
+			nc.NetworkPassphrase = g.passphrase(root)
+			return nil
+		})
+		err := g.loadNetwork(nc)
 		if err != nil {
 			return err
 		}
@@ -409,15 +545,23 @@ func (g *Agent) ConfigEdit(c *Config) error {
 			if err != nil {
 				return err
 			}
+			seed := g.seed
+			if seed == nil {
+				// Locked, or signing remotely.
+				seed = openBox(root.Agent().EncryptedSeed(), []byte(c.OldPassword))
+			}
 			root.Agent().Config().PutPwType("bcrypt")
 			root.Agent().Config().PutPwHash(digest[:])
-			root.Agent().PutEncryptedSeed(sealBox(g.seed, []byte(c.Password)))
+			root.Agent().PutEncryptedSeed(sealBox(seed, []byte(c.Password)))
 		}
 		// WARNING: this software is not compatible with Stellar mainnet.
 		if c.HorizonURL != "" {
 			root.Agent().Config().PutHorizonURL(c.HorizonURL)
 			g.wclient.SetURL(c.HorizonURL)
 		}
+		if c.FriendbotURL != "" {
+			root.Agent().Config().PutFriendbotURL(c.FriendbotURL)
+		}
 		if c.MaxRoundDurMins != 0 {
 			root.Agent().Config().PutMaxRoundDurMins(c.MaxRoundDurMins)
 		}
@@ -436,6 +580,7 @@ func (g *Agent) ConfigEdit(c *Config) error {
 				Username:          c.Username,
 				Password:          "[redacted]",
 				HorizonURL:        c.HorizonURL,
+				FriendbotURL:      c.FriendbotURL,
 				MaxRoundDurMins:   c.MaxRoundDurMins,
 				FinalityDelayMins: c.FinalityDelayMins,
 				ChannelFeerate:    c.ChannelFeerate,
@@ -460,6 +605,7 @@ func (g *Agent) AddAsset(assetCode, issuer string) error {
 		}
 		w := root.Agent().Wallet()
 		hostFeerate := xlm.Amount(root.Agent().Config().HostFeerate())
+		baseReserve := g.baseReserve(root)
 		if w.NativeBalance < (hostFeerate + baseReserve) {
 			return errors.Wrap(errInsufficientBalance, "fees and reserve to add non-native asset")
 		}
@@ -493,8 +639,7 @@ func (g *Agent) AddAsset(assetCode, issuer string) error {
 		if err != nil {
 			return err
 		}
-		k := key.DeriveAccountPrimary(g.seed)
-		env, err := btx.Sign(k.Seed())
+		env, err := g.signWallet(btx)
 		if err != nil {
 			return err
 		}
@@ -568,8 +713,7 @@ func (g *Agent) RemoveAsset(assetCode, issuer string) error {
 		if err != nil {
 			return err
 		}
-		k := key.DeriveAccountPrimary(g.seed)
-		env, err := btx.Sign(k.Seed())
+		env, err := g.signWallet(btx)
 		if err != nil {
 			return err
 		}
@@ -615,7 +759,7 @@ func (g *Agent) isReadyFunded(root *db.Root) bool {
 // When such transactions hit the ledger,
 // it reports an *Update back for the client to consume.
 func (g *Agent) watchWalletAcct(acctID string, cursor horizon.Cursor) {
-	// Wait until getTestnetFaucetFunds returns successfully
+	// Wait until fundWallet returns successfully
 
 	select {
 	// Block until accounts are ready to be watched
@@ -640,9 +784,14 @@ func (g *Agent) watchWalletAcct(acctID string, cursor horizon.Cursor) {
 				w := root.Agent().Wallet()
 				w.Cursor = htx.PT
 				root.Agent().PutWallet(w)
+				var opResults []*update.OpResult
+				if isBatchSeqnum(root, InputTx.Env.Tx.SeqNum) {
+					opResults = batchOpResults(&InputTx.Env.Tx, InputTx.Result, nil)
+				}
 				g.putUpdate(root, &Update{
-					Type:    update.TxSuccessType,
-					InputTx: InputTx,
+					Type:      update.TxSuccessType,
+					InputTx:   InputTx,
+					OpResults: opResults,
 				})
 			}
 			for index, op := range InputTx.Env.Tx.Operations {
@@ -666,6 +815,7 @@ func (g *Agent) watchWalletAcct(acctID string, cursor horizon.Cursor) {
 
 					w := root.Agent().Wallet()
 					hostFeerate := root.Agent().Config().HostFeerate()
+					baseReserve := g.baseReserve(root)
 					w.NativeBalance = xlm.Amount(createAccount.StartingBalance) - xlm.Amount(hostFeerate) - 2*baseReserve
 					w.Reserve = 2 * baseReserve
 					w.Seqnum = seqnum
@@ -698,8 +848,7 @@ func (g *Agent) watchWalletAcct(acctID string, cursor horizon.Cursor) {
 						if err != nil {
 							return errors.Wrap(err, "building home domain tx")
 						}
-						k := key.DeriveAccountPrimary(g.seed)
-						env, err := tx.Sign(k.Seed())
+						env, err := g.signWallet(tx)
 						if err != nil {
 							return err
 						}
@@ -714,47 +863,50 @@ func (g *Agent) watchWalletAcct(acctID string, cursor horizon.Cursor) {
 						continue
 					}
 					w := root.Agent().Wallet()
-					var asset xdr.Asset
-					switch paymentOp.Asset.Type {
-					case xdr.AssetTypeAssetTypeNative:
-						w.NativeBalance += xlm.Amount(paymentOp.Amount)
-					case xdr.AssetTypeAssetTypeCreditAlphanum4:
-						if shortAsset, ok := paymentOp.Asset.GetAlphaNum4(); ok {
-							// Since assets are treated as credits on the Stellar network,
-							// payments of an asset back to the issuer disappear.
-							if shortAsset.Issuer.Address() == acctID {
-								continue
-							}
-							err = asset.SetCredit(string(shortAsset.AssetCode[:]), shortAsset.Issuer)
-							if err != nil {
-								return errors.Sub(err, errInvalidAsset)
-							}
-						}
-					case xdr.AssetTypeAssetTypeCreditAlphanum12:
-						if longAsset, ok := paymentOp.Asset.GetAlphaNum12(); ok {
-							if longAsset.Issuer.Address() == acctID {
-								continue
-							}
-							err = asset.SetCredit(string(longAsset.AssetCode[:]), longAsset.Issuer)
-							if err != nil {
-								return errors.Sub(err, errInvalidAsset)
-							}
-						}
+					// Since assets are treated as credits on the Stellar network,
+					// payments of an asset back to the issuer disappear.
+					creditWallet(w, acctID, paymentOp.Asset, paymentOp.Amount)
+					w.Cursor = htx.PT
+					root.Agent().PutWallet(w)
+					g.putUpdate(root, &Update{
+						Type: update.AccountType,
+						Account: &update.Account{
+							ID:       acctID,
+							Balance:  uint64(w.NativeBalance),
+							Balances: w.Balances,
+							Reserve:  uint64(w.Reserve),
+						},
+						InputTx: InputTx,
+						OpIndex: index,
+						Memo:    memoFromXDR(InputTx.Env.Tx.Memo),
+					})
+
+				case xdr.OperationTypePathPayment:
+					pathPaymentOp := op.Body.PathPaymentOp
+					source := InputTx.Env.Tx.SourceAccount
+					if op.SourceAccount != nil {
+						source = *op.SourceAccount
 					}
-					if asset.Type != xdr.AssetTypeAssetTypeNative {
-						assetStr := asset.String()
-						var currBalance fsm.Balance
-						if currBalance, ok := w.Balances[assetStr]; ok {
-							currBalance.Amount += uint64(paymentOp.Amount)
-						} else {
-							currBalance = fsm.Balance{
-								Asset:      asset,
-								Amount:     uint64(paymentOp.Amount),
-								Pending:    false,
-								Authorized: true,
-							}
+					sent := source.Address() == acctID
+					received := pathPaymentOp.Destination.Address() == acctID
+					if !sent && !received {
+						continue
+					}
+					w := root.Agent().Wallet()
+					if sent {
+						// The send asset was debited by SendMax
+						// when the payment was made.
+						// Refund what the path did not spend.
+						res := (*InputTx.Result.Result.Results)[index].Tr.PathPaymentResult
+						if res != nil && res.Success != nil {
+							unspent := pathPaymentOp.SendMax - pathPaymentSent(pathPaymentOp, res.Success)
+							creditWallet(w, acctID, pathPaymentOp.SendAsset, unspent)
 						}
-						w.Balances[assetStr] = currBalance
+					}
+					var memo *Memo
+					if received {
+						creditWallet(w, acctID, pathPaymentOp.DestAsset, pathPaymentOp.DestAmount)
+						memo = memoFromXDR(InputTx.Env.Tx.Memo)
 					}
 					w.Cursor = htx.PT
 					root.Agent().PutWallet(w)
@@ -768,6 +920,7 @@ func (g *Agent) watchWalletAcct(acctID string, cursor horizon.Cursor) {
 						},
 						InputTx: InputTx,
 						OpIndex: index,
+						Memo:    memo,
 					})
 
 				case xdr.OperationTypeAccountMerge:
@@ -825,8 +978,8 @@ func (g *Agent) watchWalletAcct(acctID string, cursor horizon.Cursor) {
 					}
 					if changeTrustOp.Limit == 0 { // RemoveAsset
 						delete(w.Balances, changeTrustOp.Line.String())
-						w.NativeBalance += baseReserve // unreserve base reserve
-						w.Reserve -= baseReserve
+						w.NativeBalance += g.baseReserve(root) // unreserve base reserve
+						w.Reserve -= g.baseReserve(root)
 					} else { // AddAsset
 						var issuer xdr.AccountId
 						switch changeTrustOp.Line.Type {
@@ -923,67 +1076,13 @@ func (g *Agent) watchWalletAcct(acctID string, cursor horizon.Cursor) {
 	}
 }
 
-func (g *Agent) getTestnetFaucetFunds(acctID fsm.AccountID) {
-	// The faucet is not 100% reliable (it often times out),
-	// so this tries indefinitely with backoff until success.
-	backoff := &net.Backoff{Base: 100 * time.Millisecond}
-	defer close(g.wallet)
-
-	acctIDStr := acctID.Address()
-	faucetURL := "https://friendbot.stellar.org/?addr=" + acctIDStr
-
-	for counter := 0; ; counter++ {
-		if counter == 1 {
-			db.Update(g.db, func(root *db.Root) error {
-				g.putUpdate(root, &Update{
-					Type:    update.WarningType,
-					Warning: "could not retrieve testnet faucet funds, will retry until successful",
-				})
-				return nil
-			})
-		}
-
-		err := func() error {
-			resp, err := g.httpclient.Get(faucetURL)
-			if err != nil {
-				return err
-			}
-			if resp.Body != nil {
-				defer resp.Body.Close()
-			}
-
-			if resp.StatusCode/100 == 2 {
-				return nil
-			}
-
-			var v struct {
-				Detail      string
-				ResultCodes json.RawMessage `json:"result_codes"`
-			}
-			jErr := json.NewDecoder(resp.Body).Decode(&v)
-			if jErr != nil {
-				return fmt.Errorf("bad http status %d from faucet at %s", resp.StatusCode, faucetURL)
-			}
-			return fmt.Errorf("faucet at %s: %s (%s); http status %d", faucetURL, v.Detail, v.ResultCodes, resp.StatusCode)
-		}()
-		if err != nil {
-			dur := backoff.Next()
-			g.debugf("getting testnet funds for %s failed, will retry in %s: %s", acctIDStr, dur, err)
-			g.sleep(dur)
-			continue
-		}
-		return
-	}
-}
-
 // Authenticate authenticates the given user name and password.
 // If they're valid, it also decrypts the secret entropy seed
 // if necessary, allowing private-key operations to proceed.
 //
 // It returns whether name and password are valid.
 func (g *Agent) Authenticate(name, password string) bool {
-	var ok bool
-	var seed []byte
+	var ok, unlocked bool
 	if !validateUsername(name) {
 		return false
 	}
@@ -1000,16 +1099,19 @@ func (g *Agent) Authenticate(name, password string) bool {
 		digest := root.Agent().Config().PwHash()
 		err := bcrypt.CompareHashAndPassword(digest, []byte(password))
 		ok = err == nil
-		seed = g.seed
+		unlocked = g.signer() != nil
 		return nil
 	})
-	if ok && seed == nil {
+	if ok && !unlocked {
 		err := db.Update(g.db, func(root *db.Root) error {
-			if g.seed != nil {
-				return nil // already decrypted
+			if g.signer() != nil {
+				return nil // already decrypted, or signing remotely
 			}
 			encseed := root.Agent().EncryptedSeed()
 			g.seed = openBox(encseed, []byte(password))
+			if g.seed != nil {
+				g.resumeTimeouts(root)
+			}
 			return nil
 		})
 		if err != nil {
@@ -1108,28 +1210,40 @@ func (g *Agent) DoCreateChannel(guestFedAddr string, hostAmount xlm.Amount) (*fs
 			return errors.Wrap(err, "guest address", guestAcctStr)
 		}
 
+		signer := g.signer()
+		if signer == nil {
+			return errLocked
+		}
 		channelKeyIndex := nextChannelKeyIndex(root.Agent(), 3)
-		channelKeyPair := key.DeriveAccount(g.seed, channelKeyIndex)
-		channelID := channelKeyPair.Address()
+		channelID, err := signer.Address(channelKeyIndex)
+		if err != nil {
+			return errors.Wrap(err, "deriving escrow address")
+		}
 
 		var escrowAcct fsm.AccountID
-		err = escrowAcct.SetAddress(channelKeyPair.Address())
+		err = escrowAcct.SetAddress(channelID)
 		if err != nil {
-			return errors.Wrap(err, "setting escrow address", channelKeyPair.Address())
+			return errors.Wrap(err, "setting escrow address", channelID)
 		}
 
-		firstThrowawayKeyPair := key.DeriveAccount(g.seed, channelKeyIndex+1)
+		hostRatchetAddr, err := signer.Address(channelKeyIndex + 1)
+		if err != nil {
+			return errors.Wrap(err, "deriving host ratchet address")
+		}
 		var hostRatchetAcct fsm.AccountID
-		err = hostRatchetAcct.SetAddress(firstThrowawayKeyPair.Address())
+		err = hostRatchetAcct.SetAddress(hostRatchetAddr)
 		if err != nil {
-			return errors.Wrap(err, "setting host ratchet address", firstThrowawayKeyPair.Address())
+			return errors.Wrap(err, "setting host ratchet address", hostRatchetAddr)
 		}
 
-		secondThrowawayKeyPair := key.DeriveAccount(g.seed, channelKeyIndex+2)
+		guestRatchetAddr, err := signer.Address(channelKeyIndex + 2)
+		if err != nil {
+			return errors.Wrap(err, "deriving guest ratchet address")
+		}
 		var guestRatchetAcct fsm.AccountID
-		err = guestRatchetAcct.SetAddress(secondThrowawayKeyPair.Address())
+		err = guestRatchetAcct.SetAddress(guestRatchetAddr)
 		if err != nil {
-			return errors.Wrap(err, "setting guest ratchet address", secondThrowawayKeyPair.Address())
+			return errors.Wrap(err, "setting guest ratchet address", guestRatchetAddr)
 		}
 
 		fundingTime := g.wclient.Now()
@@ -1145,6 +1259,7 @@ func (g *Agent) DoCreateChannel(guestFedAddr string, hostAmount xlm.Amount) (*fs
 			CounterpartyAddress: guestFedAddr,
 			RemoteURL:           starlightURL,
 			Passphrase:          g.passphrase(root),
+			BaseReserve:         g.baseReserve(root),
 			MaxRoundDuration:    time.Duration(root.Agent().Config().MaxRoundDurMins()) * time.Minute,
 			FinalityDelay:       time.Duration(root.Agent().Config().FinalityDelayMins()) * time.Minute,
 			ChannelFeerate:      xlm.Amount(root.Agent().Config().ChannelFeerate()),
@@ -1184,7 +1299,19 @@ func (g *Agent) DoCreateChannel(guestFedAddr string, hostAmount xlm.Amount) (*fs
 }
 
 // DoWalletPay implements the wallet-pay command.
-func (g *Agent) DoWalletPay(dest string, amount uint64, assetCode, issuer string) error {
+// The payment's transaction carries memo, if it is not nil.
+//
+// Dest may be a Stellar account ID or a federation address.
+// If the federation server requires a memo
+// on payments to the address,
+// it is used when memo is nil,
+// and memo must match it otherwise.
+//
+// If dest does not exist yet,
+// a lumen payment creates it with a create-account operation,
+// and must meet the network's minimum account balance.
+// Other assets cannot be sent to an account that does not exist.
+func (g *Agent) DoWalletPay(dest string, amount uint64, assetCode, issuer string, memo *Memo) error {
 	if dest == "" {
 		return errEmptyAddress
 	}
@@ -1197,12 +1324,46 @@ func (g *Agent) DoWalletPay(dest string, amount uint64, assetCode, issuer string
 	if assetCode != "" && issuer == "" {
 		return errEmptyIssuer
 	}
+	if strings.Contains(dest, "*") {
+		rec, _, err := g.lookupAccount(dest)
+		if err != nil {
+			return errors.Wrapf(err, "resolving %s", dest)
+		}
+		if m := rec.memo(); m != nil {
+			if memo != nil && *memo != *m {
+				return errors.Wrapf(errInvalidMemo, "%s requires %s memo %q", dest, m.Type, m.Value)
+			}
+			memo = m
+		}
+		dest = rec.AccountID
+	}
+	var memoMut b.TransactionMutator
+	if memo != nil {
+		var err error
+		memoMut, err = memoMutator(memo)
+		if err != nil {
+			return err
+		}
+	}
+	exists, err := g.accountExists(dest)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if assetCode != "" {
+			return errors.Wrap(errNoDestination, "only lumens can create an account")
+		}
+	}
 	return db.Update(g.db, func(root *db.Root) error {
 		if !root.Agent().Ready() {
 			return errAgentClosing
 		}
+		// A new account's minimum balance is two base reserves.
+		if minBalance := 2 * g.baseReserve(root); !exists && xlm.Amount(amount) < minBalance {
+			return errors.Wrapf(errBelowMinBalance, "a new account needs at least %s", minBalance)
+		}
 		var (
-			paymentOp b.PaymentBuilder
+			paymentOp b.TransactionMutator
 			assetStr  string
 		)
 		w := root.Agent().Wallet()
@@ -1246,7 +1407,7 @@ func (g *Agent) DoWalletPay(dest string, amount uint64, assetCode, issuer string
 				b.CreditAmount{
 					Code:   assetCode,
 					Issuer: issuer,
-					Amount: string(amount),
+					Amount: xlm.Amount(amount).HorizonString(),
 				},
 			)
 		} else {
@@ -1254,26 +1415,37 @@ func (g *Agent) DoWalletPay(dest string, amount uint64, assetCode, issuer string
 				return errors.Wrap(errInsufficientBalance, "XLM amount for payment and fees")
 			}
 			w.NativeBalance -= (xlm.Amount(amount) + hostFeerate)
-			paymentOp = b.Payment(
-				b.SourceAccount{AddressOrSeed: hostAcct.Address()},
-				b.Destination{AddressOrSeed: dest},
-				b.NativeAmount{Amount: xlm.Amount(amount).HorizonString()},
-			)
+			if exists {
+				paymentOp = b.Payment(
+					b.SourceAccount{AddressOrSeed: hostAcct.Address()},
+					b.Destination{AddressOrSeed: dest},
+					b.NativeAmount{Amount: xlm.Amount(amount).HorizonString()},
+				)
+			} else {
+				paymentOp = b.CreateAccount(
+					b.SourceAccount{AddressOrSeed: hostAcct.Address()},
+					b.Destination{AddressOrSeed: dest},
+					b.NativeAmount{Amount: xlm.Amount(amount).HorizonString()},
+				)
+			}
 		}
 		w.Seqnum++
 		root.Agent().PutWallet(w)
 
-		btx, err := b.Transaction(
+		muts := []b.TransactionMutator{
 			b.Network{Passphrase: g.passphrase(root)},
 			b.SourceAccount{AddressOrSeed: hostAcct.Address()},
 			b.Sequence{Sequence: uint64(w.Seqnum)},
 			paymentOp,
-		)
+		}
+		if memoMut != nil {
+			muts = append(muts, memoMut)
+		}
+		btx, err := b.Transaction(muts...)
 		if err != nil {
 			return err
 		}
-		k := key.DeriveAccountPrimary(g.seed)
-		env, err := btx.Sign(k.Seed())
+		env, err := g.signWallet(btx)
 		if err != nil {
 			return err
 		}
@@ -1294,6 +1466,9 @@ func (g *Agent) DoWalletPay(dest string, amount uint64, assetCode, issuer string
 				Time:      time,
 				AssetCode: assetCode,
 				Issuer:    issuer,
+				Memo:      memo,
+
+				CreatesAccount: !exists,
 			},
 			InputLedgerTime: time,
 			PendingSequence: strconv.FormatInt(int64(w.Seqnum), 10),
@@ -1302,6 +1477,15 @@ func (g *Agent) DoWalletPay(dest string, amount uint64, assetCode, issuer string
 	})
 }
 
+// accountExists reports whether the Stellar account id exists.
+func (g *Agent) accountExists(id string) (bool, error) {
+	acct, err := g.loadAccountIfExists(id)
+	if err != nil {
+		return false, errors.Wrap(err, "loading destination account")
+	}
+	return acct != nil, nil
+}
+
 func (g *Agent) addTxTask(tx *bolt.Tx, chanID string, e xdr.TransactionEnvelope) error {
 	t := &TbTx{
 		g:      g,
@@ -1327,24 +1511,28 @@ func (g *Agent) addMsgTask(root *db.Root, c *fsm.Channel, msg *fsm.Message) erro
 }
 
 func (g *Agent) putMessage(root *db.Root, c *fsm.Channel, msg *fsm.Message) {
-	m := root.Agent().Messages().Get([]byte(c.ID))
-	if m == nil {
-		m = new(message.Message)
-	}
-	m.Add(msg, &msg.MsgNum)
-	root.Agent().Messages().Put([]byte(c.ID), m)
+	root.Agent().MessageLogs().GetByString(c.ID).Add(msg, &msg.MsgNum)
 	root.Tx().OnCommit(g.evcond.Broadcast)
 }
 
 // Messages returns all messages sent by the agent on
 // channel chanID in the half-open interval [a, b).
 // The returned slice will have length less than b-a
-// if a or b is out of range.
+// if a or b is out of range,
+// or if earlier messages have been pruned.
 func (g *Agent) Messages(chanID string, a, b uint64) []*fsm.Message {
 	msgs := make([]*fsm.Message, 0)
 	err := db.View(g.db, func(root *db.Root) error {
-		m := root.Agent().Messages().GetByString(chanID)
-		msgs = append(msgs, m.From(a, b)...)
+		log := root.Agent().MessageLogs().GetByString(chanID)
+		if log.Bucket() == nil {
+			return nil
+		}
+		c := log.Bucket().Cursor()
+		k := make([]byte, 8)
+		binary.BigEndian.PutUint64(k, a)
+		for k, _ = c.Seek(k); k != nil && binary.BigEndian.Uint64(k) < b; k, _ = c.Next() {
+			msgs = append(msgs, log.Get(binary.BigEndian.Uint64(k)))
+		}
 		return nil
 	})
 	if err != nil {
@@ -1369,8 +1557,8 @@ func (g *Agent) WaitMsg(ctx context.Context, chanID string, i uint64) {
 
 func lastMsgNum(boltDB *bolt.DB, chanID string) (n uint64) {
 	err := db.View(boltDB, func(root *db.Root) error {
-		if m := root.Agent().Messages().GetByString(chanID); m != nil {
-			n = m.LastSeqNum
+		if bu := root.Agent().MessageLogs().GetByString(chanID).Bucket(); bu != nil {
+			n = bu.Sequence()
 		}
 		return nil
 	})
@@ -1411,14 +1599,19 @@ func (g *Agent) DoCloseAccount(dest string) error {
 		root.Agent().PutReady(false)
 		hostAcct := root.Agent().PrimaryAcct()
 		closeAccountBuilder, err := b.Transaction(
-			b.Network{Passphrase: network.TestNetworkPassphrase},
+			b.Network{Passphrase: g.passphrase(root)},
 			b.SourceAccount{AddressOrSeed: hostAcct.Address()},
 			b.AccountMerge(
 				b.SourceAccount{AddressOrSeed: hostAcct.Address()},
 				b.Destination{AddressOrSeed: dest},
 			))
-		k := key.DeriveAccountPrimary(g.seed)
-		env, err := closeAccountBuilder.Sign(k.Seed())
+		if err != nil {
+			return err
+		}
+		env, err := g.signWallet(closeAccountBuilder)
+		if err != nil {
+			return err
+		}
 		g.addTxTask(root.Tx(), walletBucket, *env.E)
 		return nil
 	})
@@ -1449,24 +1642,58 @@ func (g *Agent) DoCommand(channelID string, c *fsm.Command) error {
 	})
 }
 
-func (g *Agent) scheduleTimer(tx *bolt.Tx, t time.Time, chanID string) {
-	tx.OnCommit(func() {
-		// TODO(bobg): this should be cancelable.
-		g.wclient.AfterFunc(t, func() {
-			err := g.updateChannel(chanID, func(_ *db.Root, updater *fsm.Updater, update *Update) error {
-				update.InputLedgerTime = g.wclient.Now()
-				return updater.Time()
-			})
-			if err != nil {
-				g.debugf("scheduling timer on channel %s: %s", string(chanID), err)
-				g.mustDeauthenticate()
-			}
-		})
-	})
+// passphrase returns the passphrase of g's Stellar network.
+func (g *Agent) passphrase(root *db.Root) string {
+	if p := root.Agent().Config().NetworkPassphrase(); p != "" {
+		return p
+	}
+	return network.TestNetworkPassphrase // configured before the network was
 }
 
-func (g *Agent) passphrase(root *db.Root) string {
-	return network.TestNetworkPassphrase
+// baseReserve returns the base reserve of g's Stellar network.
+func (g *Agent) baseReserve(root *db.Root) xlm.Amount {
+	if r := root.Agent().Config().BaseReserve(); r != 0 {
+		return xlm.Amount(r)
+	}
+	return fsm.DefaultBaseReserve
+}
+
+// loadNetwork checks that c.HorizonURL is on the network
+// c describes (the testnet if c.NetworkPassphrase is empty)
+// and fills in c's unset network fields from Horizon.
+func (g *Agent) loadNetwork(c *Config) error {
+	urls := worizon.SplitURLs(c.HorizonURL)
+	if len(urls) == 0 {
+		return errors.Wrap(errInvalidInput, "no horizon URL")
+	}
+	if c.NetworkPassphrase == "" {
+		c.NetworkPassphrase = network.TestNetworkPassphrase
+	}
+	for _, u := range urls {
+		n, err := g.wclient.LoadNetwork(u)
+		if err != nil {
+			return errors.Wrap(err, u)
+		}
+		if n.Passphrase != c.NetworkPassphrase {
+			return errors.Wrapf(errWrongNetwork, "horizon %s is on %q", u, n.Passphrase)
+		}
+		if c.BaseReserve == 0 {
+			c.BaseReserve = n.BaseReserve
+		}
+		if n.BaseReserve != c.BaseReserve {
+			return errors.Wrapf(errWrongNetwork, "network base reserve is %s, not %s", n.BaseReserve, c.BaseReserve)
+		}
+		if c.FriendbotURL == "" {
+			c.FriendbotURL = n.FriendbotURL
+		}
+	}
+	return nil
+}
+
+// HorizonStatus reports the health of the agent's Horizon servers
+// and which one is in use.
+func (g *Agent) HorizonStatus() []worizon.EndpointStatus {
+	return g.wclient.Endpoints()
 }
 
 // PeerHandler handles RPCs
@@ -1612,30 +1839,6 @@ func (g *Agent) channelRole(chanID string) (role fsm.Role) {
 	return role
 }
 
-func (g *Agent) handleFed(w http.ResponseWriter, req *http.Request) {
-	if req.URL.Query().Get("type") != "name" {
-		http.Error(w, "not implemented", http.StatusNotImplemented)
-		return
-	}
-
-	var name, acct string
-	db.View(g.db, func(root *db.Root) error {
-		name = root.Agent().Config().Username()
-		acct = root.Agent().PrimaryAcct().Address()
-		return nil
-	})
-
-	q := req.URL.Query().Get("q")
-	if q != name+"*"+req.Host {
-		http.Error(w, "not found", 404)
-		return
-	}
-	json.NewEncoder(w).Encode(map[string]string{
-		"stellar_address": q + "*" + req.Host,
-		"account_id":      acct,
-	})
-}
-
 func (g *Agent) handleTOML(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "text/plain")
@@ -1666,12 +1869,7 @@ func (g *Agent) getSequenceNumbers(chanID string, guestRatchetAcct, hostRatchetA
 
 // sleep sleeps until dur elapses or g's context is canceled.
 func (g *Agent) sleep(dur time.Duration) {
-	t := time.NewTimer(dur)
-	select {
-	case <-t.C:
-	case <-g.rootCtx.Done():
-		t.Stop()
-	}
+	clock.Sleep(g.rootCtx, g.clock, dur)
 }
 
 func (g *Agent) LoadAccount(accountID string) (worizon.Account, error) {
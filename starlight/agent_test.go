@@ -6,12 +6,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stellar/go/network"
 	"github.com/stellar/go/protocols/horizon"
 
 	"github.com/interstellar/starlight/errors"
 	"github.com/interstellar/starlight/starlight/db"
 	"github.com/interstellar/starlight/starlight/fsm"
 	"github.com/interstellar/starlight/starlight/internal/update"
+	"github.com/interstellar/starlight/worizon/worizontest"
 	"github.com/interstellar/starlight/worizon/xlm"
 )
 
@@ -36,6 +38,67 @@ func TestConfigInit(t *testing.T) {
 	}
 }
 
+func TestConfigInitNetwork(t *testing.T) {
+	cases := []struct {
+		name   string
+		config Config
+		want   error
+	}{
+		{
+			name:   "private network without passphrase",
+			config: Config{HorizonURL: testStandaloneURL, FriendbotURL: "https://friendbot.standalone.test/"},
+			want:   errWrongNetwork,
+		},
+		{
+			name:   "testnet with private passphrase",
+			config: Config{HorizonURL: testHorizonURL, NetworkPassphrase: testStandalonePassphrase},
+			want:   errWrongNetwork,
+		},
+		{
+			name:   "wrong base reserve",
+			config: Config{HorizonURL: testHorizonURL, BaseReserve: xlm.Lumen},
+			want:   errWrongNetwork,
+		},
+		{
+			name:   "no friendbot",
+			config: Config{HorizonURL: testStandaloneURL, NetworkPassphrase: testStandalonePassphrase},
+			want:   errInvalidInput,
+		},
+		{
+			name: "private network",
+			config: Config{
+				HorizonURL:        testStandaloneURL,
+				NetworkPassphrase: testStandalonePassphrase,
+				FriendbotURL:      "https://friendbot.standalone.test/",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g, closer := startTestAgent(t)
+			defer closer()
+			tc.config.Username = "alice"
+			tc.config.Password = "password"
+			err := g.ConfigInit(&tc.config, "")
+			if errors.Root(err) != tc.want {
+				t.Fatalf("got error %v, want %v", err, tc.want)
+			}
+			if err != nil {
+				return
+			}
+			db.View(g.db, func(root *db.Root) error {
+				if got := g.passphrase(root); got != testStandalonePassphrase {
+					t.Errorf("got passphrase %q, want %q", got, testStandalonePassphrase)
+				}
+				if got := g.baseReserve(root); got != testStandaloneReserve {
+					t.Errorf("got base reserve %s, want %s", got, testStandaloneReserve)
+				}
+				return nil
+			})
+		})
+	}
+}
+
 func TestConfigured(t *testing.T) {
 	g, closer := startTestAgent(t)
 	defer closer()
@@ -122,6 +185,9 @@ func TestInitConfigUpdate(t *testing.T) {
 			Username:          "alice",
 			Password:          "[redacted]",
 			HorizonURL:        testHorizonURL,
+			NetworkPassphrase: network.TestNetworkPassphrase,
+			BaseReserve:       500 * xlm.Millilumen,
+			FriendbotURL:      "https://friendbot.stellar.org/",
 			MaxRoundDurMins:   60,
 			FinalityDelayMins: 60,
 			ChannelFeerate:    100000,
@@ -471,3 +537,85 @@ func TestShutdown(t *testing.T) {
 		t.Error("timed out")
 	}
 }
+
+func TestCloseAccountLocked(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "password",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.mustDeauthenticate()
+
+	err = g.DoCloseAccount(randomAddress(t))
+	if err != errLocked {
+		t.Errorf("got error %v, want %s", err, errLocked)
+	}
+	db.View(g.db, func(root *db.Root) error {
+		if !root.Agent().Ready() {
+			t.Error("agent closing after failed close")
+		}
+		return nil
+	})
+}
+
+func TestWalletPayCreateAccount(t *testing.T) {
+	newAcct := randomAddress(t)
+	g, closer := startTestAgent(t, withFakeHorizon(&worizontest.FakeHorizonClient{
+		NotFound: map[string]bool{newAcct: true},
+	}))
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		w := root.Agent().Wallet()
+		w.NativeBalance = 50 * xlm.Lumen
+		root.Agent().PutWallet(w)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.DoWalletPay(newAcct, uint64(xlm.Lumen/2), "", "", nil)
+	if errors.Root(err) != errBelowMinBalance {
+		t.Errorf("got error %v, want %s", err, errBelowMinBalance)
+	}
+	err = g.DoWalletPay(newAcct, uint64(xlm.Lumen), "USD", testIssuer, nil)
+	if errors.Root(err) != errNoDestination {
+		t.Errorf("got error %v, want %s", err, errNoDestination)
+	}
+	err = g.DoWalletPay(newAcct, uint64(5*xlm.Lumen), "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		w           *fsm.WalletAcct
+		cmd         *fsm.Command
+		hostFeerate xlm.Amount
+	)
+	db.View(g.db, func(root *db.Root) error {
+		w = root.Agent().Wallet()
+		hostFeerate = xlm.Amount(root.Agent().Config().HostFeerate())
+		updates := root.Agent().Updates()
+		cmd = updates.Get(updates.Bucket().Sequence()).InputCommand
+		return nil
+	})
+	if cmd == nil || !cmd.CreatesAccount {
+		t.Errorf("got command %+v, want CreatesAccount", cmd)
+	}
+	if want := 45*xlm.Lumen - hostFeerate; w.NativeBalance != want {
+		t.Errorf("got balance %s, want %s", w.NativeBalance, want)
+	}
+}
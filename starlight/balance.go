@@ -0,0 +1,138 @@
+package starlight
+
+import (
+	"time"
+
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+// BalanceSheet is a consolidated view of the funds
+// held by an agent, in its wallet and in its channels.
+type BalanceSheet struct {
+	Wallet   WalletBalance
+	Channels []*ChannelBalance
+
+	// Totals, in lumens, across the wallet and all channels.
+	// Total is the sum of Spendable, Reserved, PendingTopUps,
+	// InChannels, and Locked.
+	Spendable     xlm.Amount
+	Reserved      xlm.Amount
+	PendingTopUps xlm.Amount
+	InChannels    xlm.Amount
+	Locked        xlm.Amount
+	Total         xlm.Amount
+}
+
+// WalletBalance is the balance of an agent's wallet account.
+type WalletBalance struct {
+	ID        string
+	Spendable xlm.Amount // native balance available to spend
+	Reserve   xlm.Amount // account minimum balance, including trustlines
+	Assets    map[string]fsm.Balance
+}
+
+// ChannelBalance is the agent's view of the funds in one channel.
+type ChannelBalance struct {
+	ID           string
+	Role         fsm.Role
+	State        fsm.State
+	Counterparty string
+
+	Local  xlm.Amount // the agent's balance
+	Remote xlm.Amount // the counterparty's balance
+
+	// In-flight amounts of the current round,
+	// not yet reflected in Local and Remote.
+	PendingSent     xlm.Amount
+	PendingReceived xlm.Amount
+
+	// PendingTopUp is a top-up already
+	// taken from the wallet, but not yet in Local.
+	PendingTopUp xlm.Amount
+
+	// Reserved is held by the channel accounts
+	// for minimum balances and fees (host only).
+	Reserved xlm.Amount
+
+	// ForceClosing is set when the channel is being force-closed.
+	// Local is then locked until settlement,
+	// which can happen no earlier than UnlockTime, if known.
+	ForceClosing bool
+	UnlockTime   time.Time `json:",omitempty"`
+}
+
+// BalanceSheet returns the agent's current balance sheet.
+func (g *Agent) BalanceSheet() (*BalanceSheet, error) {
+	bs := &BalanceSheet{
+		Channels: make([]*ChannelBalance, 0), // we want json "[]" not "null"
+	}
+	err := db.View(g.db, func(root *db.Root) error {
+		if !g.isReadyConfigured(root) {
+			return errNotConfigured
+		}
+		w := root.Agent().Wallet()
+		bs.Wallet = WalletBalance{
+			ID:        root.Agent().PrimaryAcct().Address(),
+			Spendable: w.NativeBalance,
+			Reserve:   w.Reserve,
+			Assets:    w.Balances,
+		}
+		bs.Spendable = w.NativeBalance
+		bs.Reserved = w.Reserve
+
+		chans := root.Agent().Channels()
+		if chans.Bucket() == nil {
+			return nil
+		}
+		return chans.Bucket().ForEach(func(k, _ []byte) error {
+			cb, err := channelBalance(chans.Get(k))
+			if err != nil {
+				return err
+			}
+			bs.Channels = append(bs.Channels, cb)
+			bs.Reserved += cb.Reserved
+			bs.PendingTopUps += cb.PendingTopUp
+			if cb.ForceClosing {
+				bs.Locked += cb.Local
+			} else {
+				bs.InChannels += cb.Local
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	bs.Total = bs.Spendable + bs.Reserved + bs.PendingTopUps + bs.InChannels + bs.Locked
+	return bs, nil
+}
+
+func channelBalance(c *fsm.Channel) (*ChannelBalance, error) {
+	cb := &ChannelBalance{
+		ID:              c.ID,
+		Role:            c.Role,
+		State:           c.State,
+		Counterparty:    c.CounterpartyAddress,
+		Local:           c.HostAmount,
+		Remote:          c.GuestAmount,
+		PendingSent:     c.PendingAmountSent,
+		PendingReceived: c.PendingAmountReceived,
+		ForceClosing:    c.IsForceClosing(),
+	}
+	if c.Role == fsm.Guest {
+		cb.Local, cb.Remote = c.GuestAmount, c.HostAmount
+	} else {
+		cb.Reserved = c.ReserveAmount()
+		cb.PendingTopUp = c.TopUpAmount
+	}
+	if c.State == fsm.AwaitingSettlementMintime {
+		t, err := c.TimerTime()
+		if err != nil {
+			return nil, err
+		}
+		cb.UnlockTime = *t
+	}
+	return cb, nil
+}
@@ -0,0 +1,97 @@
+package starlight
+
+import (
+	"testing"
+
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+func TestBalanceSheet(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	if _, err := g.BalanceSheet(); err != errNotConfigured {
+		t.Errorf("got error %v before configuration, want %s", err, errNotConfigured)
+	}
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := &fsm.Channel{
+		ID:                "host-chan",
+		Role:              fsm.Host,
+		State:             fsm.PaymentProposed,
+		HostAmount:        10 * xlm.Lumen,
+		GuestAmount:       2 * xlm.Lumen,
+		TopUpAmount:       xlm.Lumen,
+		PendingAmountSent: 3 * xlm.Lumen,
+		HostFeerate:       100,
+		ChannelFeerate:    100,
+	}
+	guest := &fsm.Channel{
+		ID:          "guest-chan",
+		Role:        fsm.Guest,
+		State:       fsm.AwaitingRatchet,
+		HostAmount:  5 * xlm.Lumen,
+		GuestAmount: 4 * xlm.Lumen,
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		w := root.Agent().Wallet()
+		w.NativeBalance = 50 * xlm.Lumen
+		w.Reserve = xlm.Lumen
+		root.Agent().PutWallet(w)
+		root.Agent().Channels().PutByString(host.ID, host)
+		root.Agent().Channels().PutByString(guest.ID, guest)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := g.BalanceSheet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bs.Channels) != 2 {
+		t.Fatalf("got %d channels, want 2", len(bs.Channels))
+	}
+	// The wallet's reserve, and the host channel's:
+	// ten base reserves of minimum balances
+	// and ten channel fees for its accounts' own transactions.
+	// Its setup and funding fees have been spent.
+	reserved := xlm.Lumen + 10*fsm.DefaultBaseReserve + 10*100
+	cases := []struct {
+		name      string
+		got, want xlm.Amount
+	}{
+		{"Spendable", bs.Spendable, 50 * xlm.Lumen},
+		{"Reserved", bs.Reserved, reserved},
+		{"PendingTopUps", bs.PendingTopUps, xlm.Lumen},
+		{"InChannels", bs.InChannels, 10 * xlm.Lumen},
+		{"Locked", bs.Locked, 4 * xlm.Lumen},
+		{"Total", bs.Total, 65*xlm.Lumen + reserved},
+	}
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, c.got, c.want)
+		}
+	}
+	for _, cb := range bs.Channels {
+		switch cb.ID {
+		case host.ID:
+			if cb.PendingSent != 3*xlm.Lumen || cb.Remote != 2*xlm.Lumen {
+				t.Errorf("host channel: got pending sent %s, remote %s", cb.PendingSent, cb.Remote)
+			}
+		case guest.ID:
+			if !cb.ForceClosing || cb.Local != 4*xlm.Lumen || cb.Reserved != 0 {
+				t.Errorf("guest channel: got force-closing %v, local %s, reserved %s", cb.ForceClosing, cb.Local, cb.Reserved)
+			}
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package starlight
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	b "github.com/stellar/go/build"
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/update"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+// maxOpsPerTx is the Stellar network's limit
+// on the number of operations in a transaction.
+const maxOpsPerTx = 100
+
+// WalletPayment is one payment of a batch sent by DoWalletBatchPay.
+type WalletPayment struct {
+	Dest   string
+	Amount uint64
+
+	// AssetCode and Issuer are empty for lumens.
+	AssetCode string `json:",omitempty"`
+	Issuer    string `json:",omitempty"`
+}
+
+// DoWalletBatchPay sends payments from the wallet,
+// packing up to maxOpsPerTx of them into each transaction.
+// Every payment is validated,
+// and the wallet's balances checked against the batch's total,
+// before any transaction is built.
+//
+// Stellar transactions are atomic:
+// if one payment in a transaction fails,
+// the others in it fail too.
+// When that happens, the payments that failed unretriably are refunded,
+// and the rest are resubmitted in a new transaction
+// (see resubmittablePayments).
+// A batch's transactions use consecutive sequence numbers,
+// so each is submitted only once the one before it is done.
+// The tx_success and tx_failed updates for batch transactions
+// report the outcome of each payment in OpResults.
+func (g *Agent) DoWalletBatchPay(payments []*WalletPayment) error {
+	if len(payments) == 0 {
+		return errors.Wrap(errInvalidInput, "no payments")
+	}
+	totals := make(map[string]*assetTotal) // by asset string
+	for i, p := range payments {
+		err := validateWalletPayment(p)
+		if err != nil {
+			return errors.Wrapf(err, "payment %d", i)
+		}
+		assetStr := paymentAssetString(p.AssetCode, p.Issuer)
+		t := totals[assetStr]
+		if t == nil {
+			t = &assetTotal{issuer: p.Issuer}
+			totals[assetStr] = t
+		}
+		t.amount += p.Amount
+	}
+
+	return db.Update(g.db, func(root *db.Root) error {
+		if !root.Agent().Ready() {
+			return errAgentClosing
+		}
+		w := root.Agent().Wallet()
+		hostAcct := root.Agent().PrimaryAcct()
+		hostFeerate := xlm.Amount(root.Agent().Config().HostFeerate())
+		ntx := (len(payments) + maxOpsPerTx - 1) / maxOpsPerTx
+		fees := hostFeerate * xlm.Amount(len(payments))
+
+		// Check and debit balances for the whole batch.
+		var native uint64
+		for assetStr, total := range totals {
+			if assetStr == "native" {
+				native = total.amount
+				continue
+			}
+			// Assets the wallet issues itself are not debited.
+			if total.issuer == hostAcct.Address() {
+				continue
+			}
+			currBalance, ok := w.Balances[assetStr]
+			if !ok {
+				return errors.Wrap(errInvalidAsset, fmt.Sprintf("no trustline exists for asset %s", assetStr))
+			}
+			if !currBalance.Authorized {
+				return errors.New(fmt.Sprintf("unauthorized trustline for %s", assetStr))
+			}
+			if currBalance.Amount < total.amount {
+				return errors.Wrap(errInsufficientBalance, fmt.Sprintf("%s amount for payments", assetStr))
+			}
+			currBalance.Amount -= total.amount
+			w.Balances[assetStr] = currBalance
+		}
+		if w.NativeBalance <= xlm.Amount(native)+fees {
+			return errors.Wrap(errInsufficientBalance, "XLM amount for payments and fees")
+		}
+		w.NativeBalance -= xlm.Amount(native) + fees
+
+		time := g.wclient.Now()
+		envs := make([]xdr.TransactionEnvelope, 0, ntx)
+		for i := 0; i < ntx; i++ {
+			batch := payments[i*maxOpsPerTx:]
+			if len(batch) > maxOpsPerTx {
+				batch = batch[:maxOpsPerTx]
+			}
+			w.Seqnum++
+			muts := []b.TransactionMutator{
+				b.Network{Passphrase: g.passphrase(root)},
+				b.SourceAccount{AddressOrSeed: hostAcct.Address()},
+				b.Sequence{Sequence: uint64(w.Seqnum)},
+				b.BaseFee{Amount: uint64(hostFeerate)},
+			}
+			cmdPayments := make([]fsm.Payment, 0, len(batch))
+			for _, p := range batch {
+				var amount b.PaymentMutator = b.NativeAmount{Amount: xlm.Amount(p.Amount).HorizonString()}
+				if p.AssetCode != "" {
+					amount = b.CreditAmount{
+						Code:   p.AssetCode,
+						Issuer: p.Issuer,
+						Amount: xlm.Amount(p.Amount).HorizonString(),
+					}
+				}
+				muts = append(muts, b.Payment(
+					b.SourceAccount{AddressOrSeed: hostAcct.Address()},
+					b.Destination{AddressOrSeed: p.Dest},
+					amount,
+				))
+				cmdPayments = append(cmdPayments, fsm.Payment{
+					Recipient: p.Dest,
+					Amount:    xlm.Amount(p.Amount),
+					AssetCode: p.AssetCode,
+					Issuer:    p.Issuer,
+				})
+			}
+			btx, err := b.Transaction(muts...)
+			if err != nil {
+				return err
+			}
+			env, err := g.signWallet(btx)
+			if err != nil {
+				return err
+			}
+			g.putUpdate(root, &Update{
+				Type: update.AccountType,
+				Account: &update.Account{
+					ID:       hostAcct.Address(),
+					Balance:  uint64(w.NativeBalance),
+					Balances: w.Balances,
+					Reserve:  uint64(w.Reserve),
+				},
+				InputCommand: &fsm.Command{
+					Name:     fsm.BatchPay,
+					Time:     time,
+					Payments: cmdPayments,
+				},
+				InputLedgerTime: time,
+				PendingSequence: strconv.FormatInt(int64(w.Seqnum), 10),
+			})
+			envs = append(envs, *env.E)
+		}
+		root.Agent().PutWallet(w)
+		return g.addBatchTxTask(root, envs)
+	})
+}
+
+// addBatchTxTask queues the transactions of a batch,
+// to be submitted one after another.
+// Must be called from within an update transaction.
+func (g *Agent) addBatchTxTask(root *db.Root, envs []xdr.TransactionEnvelope) error {
+	if len(envs) == 0 {
+		return nil
+	}
+	t := &TbTx{
+		g:      g,
+		ChanID: walletBucket,
+		E:      envs[0],
+		Batch:  true,
+		Next:   envs[1:],
+	}
+	return g.tb.AddTx(root.Tx(), t)
+}
+
+type assetTotal struct {
+	issuer string
+	amount uint64
+}
+
+func validateWalletPayment(p *WalletPayment) error {
+	if p.Dest == "" {
+		return errEmptyAddress
+	}
+	var dest xdr.AccountId
+	err := dest.SetAddress(p.Dest)
+	if err != nil {
+		return errors.Sub(errInvalidAddress, err)
+	}
+	if p.Amount == 0 {
+		return errEmptyAmount
+	}
+	if p.AssetCode == "" && p.Issuer != "" {
+		return errEmptyAsset
+	}
+	if p.AssetCode != "" && p.Issuer == "" {
+		return errEmptyIssuer
+	}
+	if p.AssetCode != "" {
+		_, err = b.CreditAsset(p.AssetCode, p.Issuer).ToXDR()
+		if err != nil {
+			return errors.Sub(errInvalidAsset, err)
+		}
+	}
+	return nil
+}
+
+// paymentAssetString returns the form used for wallet balances
+// of the asset given by code and issuer (empty for lumens).
+// The asset must be valid.
+func paymentAssetString(code, issuer string) string {
+	if code == "" {
+		return "native"
+	}
+	asset, err := b.CreditAsset(code, issuer).ToXDR()
+	if err != nil {
+		panic(err)
+	}
+	return asset.String()
+}
+
+// isBatchSeqnum reports whether the wallet transaction
+// with sequence number seqnum was sent by DoWalletBatchPay,
+// according to the batch payment updates.
+func isBatchSeqnum(root *db.Root, seqnum xdr.SequenceNumber) bool {
+	updates := root.Agent().Updates()
+	set := root.Agent().UpdateIndex().Command().GetByString(string(fsm.BatchPay))
+	bu := set.Bucket()
+	if bu == nil {
+		return false
+	}
+	// Later batch updates have later sequence numbers,
+	// so look from the latest back.
+	c := bu.Cursor()
+	for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+		ev := updates.Get(binary.BigEndian.Uint64(k))
+		n, err := strconv.ParseInt(ev.PendingSequence, 10, 64)
+		if err != nil {
+			continue // archived
+		}
+		switch {
+		case xdr.SequenceNumber(n) == seqnum:
+			return true
+		case xdr.SequenceNumber(n) < seqnum:
+			return false
+		}
+	}
+	return false
+}
+
+// batchOpResults returns the outcome of each payment
+// in batch transaction tx, from its result tr.
+// The payments at the indexes in resubmitted
+// are reported as resubmitted.
+func batchOpResults(tx *xdr.Transaction, tr *xdr.TransactionResult, resubmitted []int) []*update.OpResult {
+	var results []xdr.OperationResult
+	if tr.Result.Results != nil {
+		results = *tr.Result.Results
+	}
+	opResults := make([]*update.OpResult, 0, len(tx.Operations))
+	for i, op := range tx.Operations {
+		r := &update.OpResult{
+			OpIndex:   i,
+			Recipient: op.Body.PaymentOp.Destination.Address(),
+			Code:      tr.Result.Code.String(),
+		}
+		if i < len(results) {
+			opRes := results[i]
+			r.Code = opRes.Code.String()
+			if opRes.Code == xdr.OperationResultCodeOpInner && opRes.Tr.PaymentResult != nil {
+				r.Code = opRes.Tr.PaymentResult.Code.String()
+				r.Success = opRes.Tr.PaymentResult.Code == xdr.PaymentResultCodePaymentSuccess
+			}
+		}
+		if tr.Result.Code != xdr.TransactionResultCodeTxSuccess {
+			// Nothing in a failed transaction takes effect.
+			r.Success = false
+		}
+		for _, j := range resubmitted {
+			if i == j {
+				r.Resubmitted = true
+			}
+		}
+		opResults = append(opResults, r)
+	}
+	return opResults
+}
+
+// isBatchFailure reports whether a batch transaction
+// failed, with result tr, because of its payments.
+// Such a failure consumes the transaction's sequence number,
+// so resubmitting it unchanged cannot succeed;
+// instead its payments are sorted out by resubmittablePayments.
+func isBatchFailure(tr *xdr.TransactionResult) bool {
+	return tr.Result.Code == xdr.TransactionResultCodeTxFailed && tr.Result.Results != nil
+}
+
+// resubmittablePayments returns the indexes of the payments
+// in a failed batch transaction, with result tr,
+// that should be resubmitted:
+// those that succeeded before the transaction as a whole failed,
+// and those whose failures are retriable.
+// If that is every payment,
+// only the ones that succeeded are resubmitted,
+// so that each resubmission makes progress.
+func resubmittablePayments(tr *xdr.TransactionResult) []int {
+	if tr.Result.Code != xdr.TransactionResultCodeTxFailed || tr.Result.Results == nil {
+		return nil
+	}
+	results := *tr.Result.Results
+	var succeeded, retriable []int
+	for i, opRes := range results {
+		if opRes.Code == xdr.OperationResultCodeOpInner && opRes.Tr.PaymentResult != nil &&
+			opRes.Tr.PaymentResult.Code == xdr.PaymentResultCodePaymentSuccess {
+			succeeded = append(succeeded, i)
+			retriable = append(retriable, i)
+			continue
+		}
+		if isRetriableOpResult(opRes) {
+			retriable = append(retriable, i)
+		}
+	}
+	if len(retriable) == len(results) {
+		return succeeded
+	}
+	return retriable
+}
+
+// resubmitFee returns the fee for resubmitting n payments.
+func resubmitFee(root *db.Root, n int) xlm.Amount {
+	return xlm.Amount(root.Agent().Config().HostFeerate()) * xlm.Amount(n)
+}
+
+// resubmitPayments returns a new transaction
+// carrying the payments at the given indexes
+// of failed batch transaction tx,
+// to be submitted after the rest of its batch.
+// Their amounts are still debited from w;
+// the new transaction's fee is debited too,
+// or, if w can't pay it,
+// resubmitPayments returns errInsufficientBalance.
+func (g *Agent) resubmitPayments(root *db.Root, w *fsm.WalletAcct, tx *xdr.Transaction, indexes []int) (xdr.TransactionEnvelope, error) {
+	fee := resubmitFee(root, len(indexes))
+	if w.NativeBalance < fee {
+		return xdr.TransactionEnvelope{}, errors.Wrap(errInsufficientBalance, "fee for resubmitted payments")
+	}
+	w.NativeBalance -= fee
+	w.Seqnum++
+	newTx := xdr.Transaction{
+		SourceAccount: tx.SourceAccount,
+		Fee:           xdr.Uint32(fee),
+		SeqNum:        w.Seqnum,
+		TimeBounds:    tx.TimeBounds,
+		Memo:          tx.Memo,
+	}
+	payments := make([]fsm.Payment, 0, len(indexes))
+	for _, i := range indexes {
+		op := tx.Operations[i]
+		newTx.Operations = append(newTx.Operations, op)
+		p := fsm.Payment{
+			Recipient: op.Body.PaymentOp.Destination.Address(),
+			Amount:    xlm.Amount(op.Body.PaymentOp.Amount),
+		}
+		if op.Body.PaymentOp.Asset.Type != xdr.AssetTypeAssetTypeNative {
+			op.Body.PaymentOp.Asset.MustExtract(new(string), &p.AssetCode, &p.Issuer)
+		}
+		payments = append(payments, p)
+	}
+	btx := &b.TransactionBuilder{
+		TX:                &newTx,
+		NetworkPassphrase: g.passphrase(root),
+	}
+	env, err := g.signWallet(btx)
+	if err != nil {
+		return xdr.TransactionEnvelope{}, err
+	}
+	time := g.wclient.Now()
+	g.putUpdate(root, &Update{
+		Type: update.AccountType,
+		Account: &update.Account{
+			ID:       tx.SourceAccount.Address(),
+			Balance:  uint64(w.NativeBalance),
+			Balances: w.Balances,
+			Reserve:  uint64(w.Reserve),
+		},
+		InputCommand: &fsm.Command{
+			Name:     fsm.BatchPay,
+			Time:     time,
+			Payments: payments,
+		},
+		InputLedgerTime: time,
+		PendingSequence: strconv.FormatInt(int64(w.Seqnum), 10),
+	})
+	return *env.E, nil
+}
@@ -0,0 +1,241 @@
+package starlight
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/update"
+	"github.com/interstellar/starlight/worizon/worizontest"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+func TestWalletBatchPay(t *testing.T) {
+	fake := new(worizontest.FakeHorizonClient)
+	g, closer := startTestAgent(t, withFakeHorizon(fake))
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		w := root.Agent().Wallet()
+		w.NativeBalance = 500 * xlm.Lumen
+		root.Agent().PutWallet(w)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var payments []*WalletPayment
+	for i := 0; i < 150; i++ {
+		payments = append(payments, &WalletPayment{
+			Dest:   randomAddress(t),
+			Amount: uint64(xlm.Lumen),
+		})
+	}
+
+	bad := append([]*WalletPayment{}, payments...)
+	bad[120] = &WalletPayment{Dest: "bogus", Amount: 1}
+	if err := g.DoWalletBatchPay(bad); errors.Root(err) != errInvalidAddress {
+		t.Errorf("got error %v, want %s", err, errInvalidAddress)
+	}
+	bad[120] = &WalletPayment{Dest: randomAddress(t), Amount: 1, AssetCode: "USD", Issuer: testIssuer}
+	if err := g.DoWalletBatchPay(bad); errors.Root(err) != errInvalidAsset {
+		t.Errorf("got error %v, want %s", err, errInvalidAsset)
+	}
+
+	var before uint64
+	db.View(g.db, func(root *db.Root) error {
+		before = root.Agent().Updates().Bucket().Sequence()
+		return nil
+	})
+	err = g.DoWalletBatchPay(payments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		sizes       []int
+		w           *fsm.WalletAcct
+		hostFeerate xlm.Amount
+	)
+	db.View(g.db, func(root *db.Root) error {
+		w = root.Agent().Wallet()
+		hostFeerate = xlm.Amount(root.Agent().Config().HostFeerate())
+		updates := root.Agent().Updates()
+		for n := before + 1; n <= updates.Bucket().Sequence(); n++ {
+			ev := updates.Get(n)
+			if ev.InputCommand != nil && ev.InputCommand.Name == fsm.BatchPay {
+				sizes = append(sizes, len(ev.InputCommand.Payments))
+			}
+		}
+		return nil
+	})
+	if want := []int{100, 50}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("got batch sizes %v, want %v", sizes, want)
+	}
+	if want := 500*xlm.Lumen - 150*xlm.Lumen - 150*hostFeerate; w.NativeBalance != want {
+		t.Errorf("got balance %s, want %s", w.NativeBalance, want)
+	}
+
+	// The batch's transactions are submitted in sequence order.
+	var seqnums []xdr.SequenceNumber
+	for i := 0; i < 100 && len(seqnums) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		seqnums = nil
+		for _, s := range fake.TransactionEnvelopes() {
+			var env xdr.TransactionEnvelope
+			err := xdr.SafeUnmarshalBase64(s, &env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(env.Tx.Operations) > 1 {
+				seqnums = append(seqnums, env.Tx.SeqNum)
+			}
+		}
+	}
+	if len(seqnums) != 2 || seqnums[1] != seqnums[0]+1 || seqnums[1] != w.Seqnum {
+		t.Errorf("got batch transactions with seqnums %v, want %d and %d in order", seqnums, w.Seqnum-1, w.Seqnum)
+	}
+	db.Update(g.db, func(root *db.Root) error {
+		for _, n := range []xdr.SequenceNumber{w.Seqnum - 1, w.Seqnum} {
+			if !isBatchSeqnum(root, n) {
+				t.Errorf("seqnum %d not a batch", n)
+			}
+		}
+		if isBatchSeqnum(root, w.Seqnum-2) {
+			t.Errorf("seqnum %d is a batch", w.Seqnum-2)
+		}
+		return nil
+	})
+}
+
+func TestResubmitPaymentsFee(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := &xdr.Transaction{
+		SourceAccount: mustAccountID(t, testIssuer),
+	}
+	for i := 0; i < 3; i++ {
+		tx.Operations = append(tx.Operations, xdr.Operation{
+			Body: xdr.OperationBody{
+				Type:      xdr.OperationTypePayment,
+				PaymentOp: &xdr.PaymentOp{Destination: mustAccountID(t, testIssuer), Amount: 1},
+			},
+		})
+	}
+	db.Update(g.db, func(root *db.Root) error {
+		w := &fsm.WalletAcct{NativeBalance: resubmitFee(root, 2) - 1, Seqnum: 7}
+		_, err := g.resubmitPayments(root, w, tx, []int{0, 2})
+		if errors.Root(err) != errInsufficientBalance {
+			t.Errorf("got error %v, want %s", err, errInsufficientBalance)
+		}
+		if w.NativeBalance != resubmitFee(root, 2)-1 || w.Seqnum != 7 {
+			t.Errorf("got wallet %+v after refusing, want it unchanged", w)
+		}
+		return nil
+	})
+}
+
+func TestResubmittablePayments(t *testing.T) {
+	result := func(code xdr.PaymentResultCode) xdr.OperationResult {
+		return xdr.OperationResult{
+			Code: xdr.OperationResultCodeOpInner,
+			Tr: &xdr.OperationResultTr{
+				Type:          xdr.OperationTypePayment,
+				PaymentResult: &xdr.PaymentResult{Code: code},
+			},
+		}
+	}
+	txResult := func(results ...xdr.OperationResult) *xdr.TransactionResult {
+		return &xdr.TransactionResult{
+			Result: xdr.TransactionResultResult{
+				Code:    xdr.TransactionResultCodeTxFailed,
+				Results: &results,
+			},
+		}
+	}
+	cases := []struct {
+		name string
+		tr   *xdr.TransactionResult
+		want []int
+	}{
+		{
+			name: "malformed",
+			tr: txResult(
+				result(xdr.PaymentResultCodePaymentSuccess),
+				result(xdr.PaymentResultCodePaymentMalformed),
+				result(xdr.PaymentResultCodePaymentSuccess),
+			),
+			want: []int{0, 2},
+		},
+		{
+			name: "retriable",
+			tr: txResult(
+				result(xdr.PaymentResultCodePaymentSuccess),
+				result(xdr.PaymentResultCodePaymentNoDestination),
+				result(xdr.PaymentResultCodePaymentMalformed),
+			),
+			want: []int{0, 1},
+		},
+		{
+			name: "all retriable",
+			tr: txResult(
+				result(xdr.PaymentResultCodePaymentNoDestination),
+				result(xdr.PaymentResultCodePaymentSuccess),
+			),
+			want: []int{1},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := resubmittablePayments(c.tr)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	tx := &xdr.Transaction{}
+	for range *cases[0].tr.Result.Results {
+		tx.Operations = append(tx.Operations, xdr.Operation{
+			Body: xdr.OperationBody{
+				Type:      xdr.OperationTypePayment,
+				PaymentOp: &xdr.PaymentOp{Destination: mustAccountID(t, testIssuer)},
+			},
+		})
+	}
+	if !isBatchFailure(cases[0].tr) {
+		t.Error("got no batch failure")
+	}
+	opResults := batchOpResults(tx, cases[0].tr, []int{0, 2})
+	want := []*update.OpResult{
+		{OpIndex: 0, Recipient: testIssuer, Code: "PaymentResultCodePaymentSuccess", Resubmitted: true},
+		{OpIndex: 1, Recipient: testIssuer, Code: "PaymentResultCodePaymentMalformed"},
+		{OpIndex: 2, Recipient: testIssuer, Code: "PaymentResultCodePaymentSuccess", Resubmitted: true},
+	}
+	if !reflect.DeepEqual(opResults, want) {
+		for i := range opResults {
+			t.Errorf("result %d: got %+v, want %+v", i, opResults[i], want[i])
+		}
+	}
+}
@@ -109,6 +109,7 @@ func (g *Agent) pollGuestMessages(ctx context.Context, chanID string) error {
 		resp, err := g.httpclient.Do(req)
 		if err != nil {
 			g.debugf("unexpected error requesting messages: %s", err)
+			g.sleep(time.Second) // the guest may be down for a while
 			continue
 		}
 		defer resp.Body.Close()
@@ -126,11 +127,21 @@ func (g *Agent) pollGuestMessages(ctx context.Context, chanID string) error {
 		}
 
 		for _, msg := range messages {
-			g.updateChannel(msg.ChannelID, func(root *db.Root, updater *fsm.Updater, update *Update) error {
+			err := g.updateChannel(msg.ChannelID, func(root *db.Root, updater *fsm.Updater, update *Update) error {
+				if g.signer() == nil {
+					// Leave the message for the next poll,
+					// after the user logs in,
+					// instead of losing it.
+					return errLocked
+				}
 				from = msg.MsgNum + 1
 				update.InputMessage = msg
 				return updater.Msg(msg)
 			})
+			if err == errLocked {
+				g.sleep(time.Second)
+				break
+			}
 		}
 	}
 }
@@ -247,13 +258,13 @@ func (g *Agent) keepAlive(ctx context.Context, channelID string) {
 			break // channel has been closed
 		}
 
-		timer := time.NewTimer(net.Jitter(ch.MaxRoundDuration / 2))
+		timer := g.clock.NewTimer(net.Jitter(ch.MaxRoundDuration / 2))
 		select {
 		case <-ctx.Done():
 			g.debugf("context canceled, keepAlive(%s) exiting", channelID)
 			return
 
-		case <-timer.C:
+		case <-timer.C():
 			// ok
 		}
 
@@ -275,18 +286,15 @@ func (g *Agent) putChannel(root *db.Root, chanID string, channel *fsm.Channel) {
 	root.Agent().Channels().Put([]byte(chanID), channel)
 }
 
-// Function startChannel schedules any timer,
+// Function startChannel sets the channel's timer, if any,
 // and sets watchers for the channel.
 // Must be called from within an update transaction.
 func (g *Agent) startChannel(root *db.Root, chanID string) error {
 	c := g.getChannel(root, chanID)
-	t, err := c.TimerTime()
+	err := g.syncChannelTimer(root, c)
 	if err != nil {
 		return err
 	}
-	if t != nil {
-		g.scheduleTimer(root.Tx(), *t, chanID)
-	}
 	g.watchChannel(root, chanID)
 	return nil
 }
@@ -322,15 +330,17 @@ func (g *Agent) doUpdateChannel(root *db.Root, chanID string, f func(*db.Root, *
 
 	o := new(outputter)
 	updater := &fsm.Updater{
-		C:          c,
-		O:          o,
-		H:          h,
-		Seed:       g.seed,
-		LedgerTime: g.wclient.Now(),
-		Passphrase: g.passphrase(root),
+		C:           c,
+		O:           o,
+		H:           h,
+		Signer:      g.signer(),
+		LedgerTime:  g.wclient.Now(),
+		Passphrase:  g.passphrase(root),
+		BaseReserve: g.baseReserve(root),
 	}
 	updater.SetDebug(g.debug)
 
+	prevState, prevLocal := c.State, localAmount(c)
 	err := f(root, updater, u)
 	if err != nil {
 		return err
@@ -338,6 +348,9 @@ func (g *Agent) doUpdateChannel(root *db.Root, chanID string, f func(*db.Root, *
 	if c.State == fsm.Start {
 		return nil // channel (still) does not exist; do not store it
 	}
+	root.Tx().OnCommit(func() {
+		g.metrics.observeChannel(g.clock.Now(), c, prevState, prevLocal)
+	})
 
 	g.putChannel(root, chanID, c)
 
@@ -361,10 +374,15 @@ func (g *Agent) doUpdateChannel(root *db.Root, chanID string, f func(*db.Root, *
 		if err != nil {
 			return err
 		}
+		err = deleteMessages(root, chanID)
+		if err != nil {
+			return err
+		}
 		if canceler := g.cancelers[string(chanID)]; canceler != nil {
 			canceler()
 			delete(g.cancelers, string(chanID))
 		}
+		g.stopTimer(root, ChannelTimer, chanID)
 		return nil
 	}
 
@@ -395,14 +413,11 @@ func (g *Agent) doUpdateChannel(root *db.Root, chanID string, f func(*db.Root, *
 			return err
 		}
 	}
-	t, err := c.TimerTime()
+	err = pruneMessages(root, c)
 	if err != nil {
 		return err
 	}
-	if t != nil {
-		g.scheduleTimer(tx, *t, c.ID)
-	}
-	return nil
+	return g.syncChannelTimer(root, c)
 }
 
 // watchChannel sets a watcher for the escrow account,
@@ -0,0 +1,258 @@
+package starlight
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/update"
+)
+
+// ArchiveUpdates moves the updates recorded before ledger time t
+// out of the database,
+// into a new gzip-compressed file of JSON lines in dir.
+// It returns the path of the file
+// and the number of updates archived.
+// If there is nothing to archive,
+// it returns an empty path.
+//
+// Some updates are kept regardless of age,
+// since clients rebuild their view of the agent from the log:
+// init and config updates,
+// the latest update for each open channel,
+// and the latest update overall.
+//
+// The file is complete before any update is deleted,
+// and the database is not locked while it is written.
+// If the deletion fails, the file is removed;
+// if the process stops first, the file is left,
+// and the updates in it are archived again next time.
+func (g *Agent) ArchiveUpdates(dir string, t time.Time) (path string, n int, err error) {
+	var archived []*Update
+	err = db.View(g.db, func(root *db.Root) error {
+		archived = archivableUpdates(root, t)
+		return nil
+	})
+	if err != nil {
+		return "", 0, errors.Wrap(err, "archiving updates")
+	}
+	if len(archived) == 0 {
+		return "", 0, nil
+	}
+
+	name := fmt.Sprintf("updates-%d-%d.json.gz", archived[0].UpdateNum, archived[len(archived)-1].UpdateNum)
+	path = filepath.Join(dir, name)
+	err = writeArchive(path, archived)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "archiving updates")
+	}
+
+	err = db.Update(g.db, func(root *db.Root) error {
+		updates := root.Agent().Updates()
+		for _, ev := range archived {
+			k := make([]byte, 8)
+			binary.BigEndian.PutUint64(k, ev.UpdateNum)
+			if updates.Bucket().Get(k) == nil {
+				continue // archived concurrently
+			}
+			n++
+			err := unindexUpdate(root, ev)
+			if err != nil {
+				return err
+			}
+			err = updates.Bucket().Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		os.Remove(path)
+		return "", 0, errors.Wrap(err, "archiving updates")
+	}
+	return path, n, nil
+}
+
+// archivableUpdates returns the updates
+// recorded before ledger time t
+// that ArchiveUpdates moves out of the database.
+func archivableUpdates(root *db.Root, t time.Time) []*Update {
+	updates := root.Agent().Updates()
+	last := updates.Bucket().Sequence()
+
+	keep := make(map[uint64]bool)
+	keep[last] = true
+	chans := root.Agent().Channels().Bucket()
+
+	var archive []*Update
+	c := updates.Bucket().Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		ev := updates.Get(binary.BigEndian.Uint64(k))
+		if !ev.UpdateLedgerTime.Before(t) {
+			break
+		}
+		archive = append(archive, ev)
+	}
+
+	// Find each open channel's latest update
+	// among the candidates.
+	// Later updates for the channel (if any)
+	// are past the cutoff and so kept anyway.
+	latest := make(map[string]uint64)
+	for _, ev := range archive {
+		if ev.Channel != nil && chans.Get([]byte(ev.Channel.ID)) != nil {
+			latest[ev.Channel.ID] = ev.UpdateNum
+		}
+	}
+	for _, n := range latest {
+		keep[n] = true
+	}
+
+	var archived []*Update
+	for _, ev := range archive {
+		if keep[ev.UpdateNum] || ev.Type == update.InitType || ev.Type == update.ConfigType {
+			continue
+		}
+		archived = append(archived, ev)
+	}
+	return archived
+}
+
+// writeArchive writes updates to a new file at path,
+// one JSON object per line, compressed with gzip.
+// The file is complete and synced to disk when writeArchive returns.
+func writeArchive(path string, updates []*Update) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".updates")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op after a successful rename
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	zw := gzip.NewWriter(bw)
+	enc := json.NewEncoder(zw)
+	for _, ev := range updates {
+		err = enc.Encode(ev)
+		if err != nil {
+			return err
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+	err = bw.Flush()
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// unindexUpdate removes ev from the update indexes.
+func unindexUpdate(root *db.Root, ev *Update) error {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, ev.UpdateNum)
+
+	index := root.Agent().UpdateIndex()
+	keys := indexKeys(ev)
+	sets := []*db.UpdateSet{index.Type().GetByString(keys.typ)}
+	if keys.channel != "" {
+		sets = append(sets, index.Channel().GetByString(keys.channel))
+	}
+	if keys.command != "" {
+		sets = append(sets, index.Command().GetByString(keys.command))
+	}
+	for _, cp := range keys.counterparties {
+		sets = append(sets, index.Counterparty().GetByString(cp))
+	}
+	for _, set := range sets {
+		err := set.Bucket().Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneMessages deletes the messages in the log for channel c
+// that the host is known to have handled.
+//
+// Messages are handled in order,
+// and the host only completes a round
+// (or confirms funding)
+// after handling every message the guest sent before its last one.
+// So once the guest's channel is back to Open,
+// everything below its LastMsgIndex
+// is also below the host's CounterpartyMsgIndex
+// and will never be fetched again.
+func pruneMessages(root *db.Root, c *fsm.Channel) error {
+	if c.Role != fsm.Guest || c.State != fsm.Open {
+		return nil
+	}
+	bu := root.Agent().MessageLogs().GetByString(c.ID).Bucket()
+	cur := bu.Cursor()
+	for k, _ := cur.First(); k != nil && binary.BigEndian.Uint64(k) < c.LastMsgIndex; k, _ = cur.First() {
+		err := cur.Delete()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteMessages deletes the message log for channel chanID.
+func deleteMessages(root *db.Root, chanID string) error {
+	bu := root.Agent().MessageLogs().Bucket()
+	if bu.Bucket([]byte(chanID)) == nil {
+		return nil
+	}
+	return bu.DeleteBucket([]byte(chanID))
+}
+
+// migrateMessages moves messages stored in the old format,
+// one record per channel holding all its messages,
+// into keyed message logs.
+func migrateMessages(root *db.Root) error {
+	old := root.Agent().Bucket().Bucket([]byte("Messages"))
+	if old == nil {
+		return nil
+	}
+	err := old.ForEach(func(chanID, rec []byte) error {
+		var v struct {
+			Messages   []*fsm.Message
+			LastSeqNum uint64
+		}
+		err := json.Unmarshal(rec, &v)
+		if err != nil {
+			return err
+		}
+		log := root.Agent().MessageLogs().Get(chanID)
+		for _, msg := range v.Messages {
+			log.Put(msg.MsgNum, msg)
+		}
+		return log.Bucket().SetSequence(v.LastSeqNum)
+	})
+	if err != nil {
+		return errors.Wrap(err, "migrating messages")
+	}
+	return root.Agent().Bucket().DeleteBucket([]byte("Messages"))
+}
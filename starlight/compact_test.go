@@ -0,0 +1,188 @@
+package starlight
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/update"
+)
+
+func TestArchiveUpdates(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Update 1 is init. Updates 2-4 are for open channel chan1,
+	// 5-6 for closed channel chan2, and 7 is a warning.
+	err = db.Update(g.db, func(root *db.Root) error {
+		root.Agent().Channels().PutByString("chan1", &fsm.Channel{ID: "chan1"})
+		for i := 0; i < 3; i++ {
+			g.putUpdate(root, &Update{Type: update.ChannelType, Channel: &fsm.Channel{ID: "chan1"}})
+		}
+		for i := 0; i < 2; i++ {
+			g.putUpdate(root, &Update{Type: update.ChannelType, Channel: &fsm.Channel{ID: "chan2"}})
+		}
+		g.putUpdate(root, &Update{Type: update.WarningType, Warning: "x"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path, n, err := g.ArchiveUpdates(dir, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("got %d updates archived, want 4", n)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archived []uint64
+	dec := json.NewDecoder(zr)
+	for dec.More() {
+		var ev Update
+		err = dec.Decode(&ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archived = append(archived, ev.UpdateNum)
+	}
+	want := []uint64{2, 3, 5, 6}
+	if !equalNums(archived, want) {
+		t.Errorf("got archived updates %v, want %v", archived, want)
+	}
+
+	var kept []uint64
+	for _, ev := range g.Updates(1, 100) {
+		kept = append(kept, ev.UpdateNum)
+	}
+	want = []uint64{1, 4, 7}
+	if !equalNums(kept, want) {
+		t.Errorf("got remaining updates %v, want %v", kept, want)
+	}
+
+	page, err := g.QueryUpdates(&UpdateQuery{ChannelID: "chan2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Updates) != 0 {
+		t.Errorf("got %d indexed updates for archived channel, want 0", len(page.Updates))
+	}
+
+	path, n, err = g.ArchiveUpdates(dir, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 || path != "" {
+		t.Errorf("second archive got %d updates in %q, want none", n, path)
+	}
+}
+
+func TestMessageLogs(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+
+	// Store messages in the old single-record format and migrate them.
+	err := db.Update(g.db, func(root *db.Root) error {
+		old, err := root.Agent().Bucket().CreateBucketIfNotExists([]byte("Messages"))
+		if err != nil {
+			return err
+		}
+		rec, err := json.Marshal(map[string]interface{}{
+			"Messages": []*fsm.Message{
+				{ChannelID: "chan1", MsgNum: 1},
+				{ChannelID: "chan1", MsgNum: 2},
+			},
+			"LastSeqNum": 2,
+		})
+		if err != nil {
+			return err
+		}
+		err = old.Put([]byte("chan1"), rec)
+		if err != nil {
+			return err
+		}
+		return migrateMessages(root)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &fsm.Channel{ID: "chan1", Role: fsm.Guest, State: fsm.Open}
+	err = db.Update(g.db, func(root *db.Root) error {
+		for i := 0; i < 2; i++ {
+			err := g.addMsgTask(root, c, &fsm.Message{ChannelID: "chan1"})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lastMsgNum(g.db, "chan1"); got != 4 {
+		t.Errorf("got last message number %d, want 4", got)
+	}
+	var nums []uint64
+	for _, msg := range g.Messages("chan1", 2, 4) {
+		nums = append(nums, msg.MsgNum)
+	}
+	if want := []uint64{2, 3}; !equalNums(nums, want) {
+		t.Errorf("got messages %v, want %v", nums, want)
+	}
+
+	err = db.Update(g.db, func(root *db.Root) error {
+		return pruneMessages(root, c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nums = nil
+	for _, msg := range g.Messages("chan1", 1, 100) {
+		nums = append(nums, msg.MsgNum)
+	}
+	if want := []uint64{4}; !equalNums(nums, want) {
+		t.Errorf("got messages after pruning %v, want %v", nums, want)
+	}
+}
+
+func equalNums(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -9,8 +9,10 @@ import binary "encoding/binary"
 import json "encoding/json"
 import bolt "github.com/coreos/bbolt"
 import fsm "github.com/interstellar/starlight/starlight/fsm"
-import message "github.com/interstellar/starlight/starlight/internal/message"
+import alias "github.com/interstellar/starlight/starlight/internal/alias"
+import schedule "github.com/interstellar/starlight/starlight/internal/schedule"
 import update "github.com/interstellar/starlight/starlight/internal/update"
+import webhook "github.com/interstellar/starlight/starlight/internal/webhook"
 
 const _ = binary.MaxVarintLen16
 const _ = bolt.MaxKeySize
@@ -104,6 +106,57 @@ func (o *Config) Bucket() *bolt.Bucket {
 	return o.db
 }
 
+// UpdateIndex is a bucket with a static set of elements.
+//
+// UpdateIndex is the db layout for the secondary indexes
+// over an agent's update log.
+// Each map is keyed by the indexed value
+// (a channel ID, update type, command name,
+// or counterparty address)
+// and holds the set of matching update numbers.
+//
+// Accessor methods read and write records
+// and open child buckets.
+type UpdateIndex struct {
+	db *bolt.Bucket
+}
+
+// Bucket returns o's underlying *bolt.Bucket object.
+// This can be useful to access low-level database functions
+// or other features not exposed by this generated code.
+//
+// Note, if o's transaction is read-only and the underlying
+// bucket has not previously been created in a writable
+// transaction, Bucket returns nil.
+func (o *UpdateIndex) Bucket() *bolt.Bucket {
+	return o.db
+}
+
+// UpdateSet is a bucket with a static set of elements.
+//
+// UpdateSet is a set of update numbers.
+// genbolt doesn't support sets yet,
+// so the members are stored directly as keys
+// (big-endian uint64) of the underlying bucket,
+// with empty values.
+//
+// Accessor methods read and write records
+// and open child buckets.
+type UpdateSet struct {
+	db *bolt.Bucket
+}
+
+// Bucket returns o's underlying *bolt.Bucket object.
+// This can be useful to access low-level database functions
+// or other features not exposed by this generated code.
+//
+// Note, if o's transaction is read-only and the underlying
+// bucket has not previously been created in a writable
+// transaction, Bucket returns nil.
+func (o *UpdateSet) Bucket() *bolt.Bucket {
+	return o.db
+}
+
 // Agent gets the child bucket with key "Agent" from o.
 //
 // Agent creates a new bucket if none exists
@@ -140,6 +193,20 @@ func (o *Agent) Updates() *SeqOfUpdateUpdate {
 	return &SeqOfUpdateUpdate{bucket(o.db, keyUpdates)}
 }
 
+// UpdateIndex gets the child bucket with key "UpdateIndex" from o.
+//
+// UpdateIndex holds secondary indexes over Updates.
+//
+// UpdateIndex creates a new bucket if none exists
+// and o's transaction is writable.
+// Regardless, it always returns a non-nil *UpdateIndex;
+// if the bucket doesn't exist
+// and o's transaction is read-only, the returned value
+// represents an empty bucket.
+func (o *Agent) UpdateIndex() *UpdateIndex {
+	return &UpdateIndex{bucket(o.db, keyUpdateIndex)}
+}
+
 // Channels gets the child bucket with key "Channels" from o.
 //
 // Channels holds the state of all open channels. Closed channels
@@ -155,16 +222,114 @@ func (o *Agent) Channels() *MapOfFsmChannel {
 	return &MapOfFsmChannel{bucket(o.db, keyChannels)}
 }
 
-// Messages gets the child bucket with key "Messages" from o.
+// MessageLogs gets the child bucket with key "MessageLogs" from o.
+//
+// MessageLogs holds, for each channel where the agent is guest,
+// the outgoing messages waiting to be fetched by the host.
+// Each log is keyed by MsgNum.
+// Messages the host has handled are pruned.
+// (This replaces the old Messages field,
+// which stored each channel's messages in one record.)
 //
-// Messages creates a new bucket if none exists
+// MessageLogs creates a new bucket if none exists
 // and o's transaction is writable.
-// Regardless, it always returns a non-nil *MapOfMessageMessage;
+// Regardless, it always returns a non-nil *MapOfSeqOfFsmMessage;
 // if the bucket doesn't exist
 // and o's transaction is read-only, the returned value
 // represents an empty bucket.
-func (o *Agent) Messages() *MapOfMessageMessage {
-	return &MapOfMessageMessage{bucket(o.db, keyMessages)}
+func (o *Agent) MessageLogs() *MapOfSeqOfFsmMessage {
+	return &MapOfSeqOfFsmMessage{bucket(o.db, keyMessageLogs)}
+}
+
+// Webhooks gets the child bucket with key "Webhooks" from o.
+//
+// Webhooks holds the registered webhooks, keyed by ID.
+//
+// Webhooks creates a new bucket if none exists
+// and o's transaction is writable.
+// Regardless, it always returns a non-nil *MapOfWebhookWebhook;
+// if the bucket doesn't exist
+// and o's transaction is read-only, the returned value
+// represents an empty bucket.
+func (o *Agent) Webhooks() *MapOfWebhookWebhook {
+	return &MapOfWebhookWebhook{bucket(o.db, keyWebhooks)}
+}
+
+// Schedules gets the child bucket with key "Schedules" from o.
+//
+// Schedules holds the recurring payment schedules, keyed by ID.
+//
+// Schedules creates a new bucket if none exists
+// and o's transaction is writable.
+// Regardless, it always returns a non-nil *MapOfScheduleSchedule;
+// if the bucket doesn't exist
+// and o's transaction is read-only, the returned value
+// represents an empty bucket.
+func (o *Agent) Schedules() *MapOfScheduleSchedule {
+	return &MapOfScheduleSchedule{bucket(o.db, keySchedules)}
+}
+
+// Aliases gets the child bucket with key "Aliases" from o.
+//
+// Aliases holds the federation names served for the agent
+// in addition to its username, keyed by name.
+//
+// Aliases creates a new bucket if none exists
+// and o's transaction is writable.
+// Regardless, it always returns a non-nil *MapOfAliasAlias;
+// if the bucket doesn't exist
+// and o's transaction is read-only, the returned value
+// represents an empty bucket.
+func (o *Agent) Aliases() *MapOfAliasAlias {
+	return &MapOfAliasAlias{bucket(o.db, keyAliases)}
+}
+
+// Channel gets the child bucket with key "Channel" from o.
+//
+// Channel creates a new bucket if none exists
+// and o's transaction is writable.
+// Regardless, it always returns a non-nil *MapOfUpdateSet;
+// if the bucket doesn't exist
+// and o's transaction is read-only, the returned value
+// represents an empty bucket.
+func (o *UpdateIndex) Channel() *MapOfUpdateSet {
+	return &MapOfUpdateSet{bucket(o.db, keyChannel)}
+}
+
+// Type gets the child bucket with key "Type" from o.
+//
+// Type creates a new bucket if none exists
+// and o's transaction is writable.
+// Regardless, it always returns a non-nil *MapOfUpdateSet;
+// if the bucket doesn't exist
+// and o's transaction is read-only, the returned value
+// represents an empty bucket.
+func (o *UpdateIndex) Type() *MapOfUpdateSet {
+	return &MapOfUpdateSet{bucket(o.db, keyType)}
+}
+
+// Command gets the child bucket with key "Command" from o.
+//
+// Command creates a new bucket if none exists
+// and o's transaction is writable.
+// Regardless, it always returns a non-nil *MapOfUpdateSet;
+// if the bucket doesn't exist
+// and o's transaction is read-only, the returned value
+// represents an empty bucket.
+func (o *UpdateIndex) Command() *MapOfUpdateSet {
+	return &MapOfUpdateSet{bucket(o.db, keyCommand)}
+}
+
+// Counterparty gets the child bucket with key "Counterparty" from o.
+//
+// Counterparty creates a new bucket if none exists
+// and o's transaction is writable.
+// Regardless, it always returns a non-nil *MapOfUpdateSet;
+// if the bucket doesn't exist
+// and o's transaction is read-only, the returned value
+// represents an empty bucket.
+func (o *UpdateIndex) Counterparty() *MapOfUpdateSet {
+	return &MapOfUpdateSet{bucket(o.db, keyCounterparty)}
 }
 
 // Ready reads the record stored under key "Ready".
@@ -307,6 +472,63 @@ func (o *Config) PutUsername(v string) {
 	put(o.db, keyUsername, rec)
 }
 
+// NetworkPassphrase reads the record stored under key "NetworkPassphrase".
+//
+// NetworkPassphrase, BaseReserve, and FriendbotURL
+// describe the Stellar network the agent is on.
+// They're empty in databases from before they were added;
+// such agents are on the testnet.
+//
+// If no record has been stored, NetworkPassphrase returns
+// the zero value.
+func (o *Config) NetworkPassphrase() string {
+	rec := get(o.db, keyNetworkPassphrase)
+	return string(rec)
+}
+
+// PutNetworkPassphrase stores v as a record under the key "NetworkPassphrase".
+//
+// NetworkPassphrase, BaseReserve, and FriendbotURL
+// describe the Stellar network the agent is on.
+// They're empty in databases from before they were added;
+// such agents are on the testnet.
+func (o *Config) PutNetworkPassphrase(v string) {
+	rec := []byte(v)
+	put(o.db, keyNetworkPassphrase, rec)
+}
+
+// BaseReserve reads the record stored under key "BaseReserve".
+// If no record has been stored, BaseReserve returns
+// the zero value.
+func (o *Config) BaseReserve() int64 {
+	rec := get(o.db, keyBaseReserve)
+	if rec == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(rec))
+}
+
+// PutBaseReserve stores v as a record under the key "BaseReserve".
+func (o *Config) PutBaseReserve(v int64) {
+	rec := make([]byte, 8)
+	binary.BigEndian.PutUint64(rec, uint64(v))
+	put(o.db, keyBaseReserve, rec)
+}
+
+// FriendbotURL reads the record stored under key "FriendbotURL".
+// If no record has been stored, FriendbotURL returns
+// the zero value.
+func (o *Config) FriendbotURL() string {
+	rec := get(o.db, keyFriendbotURL)
+	return string(rec)
+}
+
+// PutFriendbotURL stores v as a record under the key "FriendbotURL".
+func (o *Config) PutFriendbotURL(v string) {
+	rec := []byte(v)
+	put(o.db, keyFriendbotURL, rec)
+}
+
 // PwType reads the record stored under key "PwType".
 //
 // PwType records which hashing function was used for PwHash.
@@ -450,6 +672,153 @@ func (o *Config) PutPublic(v bool) {
 	put(o.db, keyPublic, rec)
 }
 
+// LastIndexed reads the record stored under key "LastIndexed".
+//
+// LastIndexed is the number of the latest update
+// added to the indexes.
+//
+// If no record has been stored, LastIndexed returns
+// the zero value.
+func (o *UpdateIndex) LastIndexed() uint64 {
+	rec := get(o.db, keyLastIndexed)
+	if rec == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(rec)
+}
+
+// PutLastIndexed stores v as a record under the key "LastIndexed".
+//
+// LastIndexed is the number of the latest update
+// added to the indexes.
+func (o *UpdateIndex) PutLastIndexed(v uint64) {
+	rec := make([]byte, 8)
+	binary.BigEndian.PutUint64(rec, v)
+	put(o.db, keyLastIndexed, rec)
+}
+
+// MapOfSeqOfFsmMessage is a bucket with arbitrary keys,
+// holding child buckets of type SeqOfFsmMessage.
+type MapOfSeqOfFsmMessage struct {
+	db *bolt.Bucket
+}
+
+// Bucket returns o's underlying *bolt.Bucket object.
+// This can be useful to access low-level database functions
+// or other features not exposed by this generated code.
+//
+// Note, if o's transaction is read-only and the underlying
+// bucket has not previously been created in a writable
+// transaction, Bucket returns nil.
+func (o *MapOfSeqOfFsmMessage) Bucket() *bolt.Bucket {
+	return o.db
+}
+
+// Get gets the child bucket with the given key from o.
+//
+// It creates a new bucket if none exists
+// and o's transaction is writable.
+// Regardless, it always returns a non-nil *SeqOfFsmMessage;
+// if the bucket doesn't exist
+// and o's transaction is read-only, the returned value
+// represents an empty bucket.
+func (o *MapOfSeqOfFsmMessage) Get(key []byte) *SeqOfFsmMessage {
+	return &SeqOfFsmMessage{bucket(o.db, key)}
+}
+
+// GetByString is equivalent to o.Get([]byte(key)).
+func (o *MapOfSeqOfFsmMessage) GetByString(key string) *SeqOfFsmMessage {
+	return &SeqOfFsmMessage{bucket(o.db, []byte(key))}
+}
+
+// MapOfUpdateSet is a bucket with arbitrary keys,
+// holding child buckets of type UpdateSet.
+type MapOfUpdateSet struct {
+	db *bolt.Bucket
+}
+
+// Bucket returns o's underlying *bolt.Bucket object.
+// This can be useful to access low-level database functions
+// or other features not exposed by this generated code.
+//
+// Note, if o's transaction is read-only and the underlying
+// bucket has not previously been created in a writable
+// transaction, Bucket returns nil.
+func (o *MapOfUpdateSet) Bucket() *bolt.Bucket {
+	return o.db
+}
+
+// Get gets the child bucket with the given key from o.
+//
+// It creates a new bucket if none exists
+// and o's transaction is writable.
+// Regardless, it always returns a non-nil *UpdateSet;
+// if the bucket doesn't exist
+// and o's transaction is read-only, the returned value
+// represents an empty bucket.
+func (o *MapOfUpdateSet) Get(key []byte) *UpdateSet {
+	return &UpdateSet{bucket(o.db, key)}
+}
+
+// GetByString is equivalent to o.Get([]byte(key)).
+func (o *MapOfUpdateSet) GetByString(key string) *UpdateSet {
+	return &UpdateSet{bucket(o.db, []byte(key))}
+}
+
+// MapOfAliasAlias is a bucket with arbitrary keys,
+// holding records of type *alias.Alias.
+type MapOfAliasAlias struct {
+	db *bolt.Bucket
+}
+
+// Bucket returns o's underlying *bolt.Bucket object.
+// This can be useful to access low-level database functions
+// or other features not exposed by this generated code.
+//
+// Note, if o's transaction is read-only and the underlying
+// bucket has not previously been created in a writable
+// transaction, Bucket returns nil.
+func (o *MapOfAliasAlias) Bucket() *bolt.Bucket {
+	return o.db
+}
+
+// Get reads the record stored in o under the given key.
+//
+// If no record has been stored, it returns
+// a pointer to
+// the zero value.
+func (o *MapOfAliasAlias) Get(key []byte) *alias.Alias {
+	rec := get(o.db, key)
+	v := new(alias.Alias)
+	if rec == nil {
+		return v
+	}
+	err := json.Unmarshal(rec, json.Unmarshaler(v))
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// GetByString is equivalent to o.Get([]byte(key)).
+func (o *MapOfAliasAlias) GetByString(key string) *alias.Alias {
+	return o.Get([]byte(key))
+}
+
+// Put stores v in o as a record under the given key.
+func (o *MapOfAliasAlias) Put(key []byte, v *alias.Alias) {
+	rec, err := json.Marshal(json.Marshaler(v))
+	if err != nil {
+		panic(err)
+	}
+	put(o.db, key, rec)
+}
+
+// PutByString is equivalent to o.Put([]byte(key), v).
+func (o *MapOfAliasAlias) PutByString(key string, v *alias.Alias) {
+	o.Put([]byte(key), v)
+}
+
 // MapOfFsmChannel is a bucket with arbitrary keys,
 // holding records of type *fsm.Channel.
 type MapOfFsmChannel struct {
@@ -504,9 +873,63 @@ func (o *MapOfFsmChannel) PutByString(key string, v *fsm.Channel) {
 	o.Put([]byte(key), v)
 }
 
-// MapOfMessageMessage is a bucket with arbitrary keys,
-// holding records of type *message.Message.
-type MapOfMessageMessage struct {
+// MapOfScheduleSchedule is a bucket with arbitrary keys,
+// holding records of type *schedule.Schedule.
+type MapOfScheduleSchedule struct {
+	db *bolt.Bucket
+}
+
+// Bucket returns o's underlying *bolt.Bucket object.
+// This can be useful to access low-level database functions
+// or other features not exposed by this generated code.
+//
+// Note, if o's transaction is read-only and the underlying
+// bucket has not previously been created in a writable
+// transaction, Bucket returns nil.
+func (o *MapOfScheduleSchedule) Bucket() *bolt.Bucket {
+	return o.db
+}
+
+// Get reads the record stored in o under the given key.
+//
+// If no record has been stored, it returns
+// a pointer to
+// the zero value.
+func (o *MapOfScheduleSchedule) Get(key []byte) *schedule.Schedule {
+	rec := get(o.db, key)
+	v := new(schedule.Schedule)
+	if rec == nil {
+		return v
+	}
+	err := json.Unmarshal(rec, json.Unmarshaler(v))
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// GetByString is equivalent to o.Get([]byte(key)).
+func (o *MapOfScheduleSchedule) GetByString(key string) *schedule.Schedule {
+	return o.Get([]byte(key))
+}
+
+// Put stores v in o as a record under the given key.
+func (o *MapOfScheduleSchedule) Put(key []byte, v *schedule.Schedule) {
+	rec, err := json.Marshal(json.Marshaler(v))
+	if err != nil {
+		panic(err)
+	}
+	put(o.db, key, rec)
+}
+
+// PutByString is equivalent to o.Put([]byte(key), v).
+func (o *MapOfScheduleSchedule) PutByString(key string, v *schedule.Schedule) {
+	o.Put([]byte(key), v)
+}
+
+// MapOfWebhookWebhook is a bucket with arbitrary keys,
+// holding records of type *webhook.Webhook.
+type MapOfWebhookWebhook struct {
 	db *bolt.Bucket
 }
 
@@ -517,7 +940,7 @@ type MapOfMessageMessage struct {
 // Note, if o's transaction is read-only and the underlying
 // bucket has not previously been created in a writable
 // transaction, Bucket returns nil.
-func (o *MapOfMessageMessage) Bucket() *bolt.Bucket {
+func (o *MapOfWebhookWebhook) Bucket() *bolt.Bucket {
 	return o.db
 }
 
@@ -526,9 +949,9 @@ func (o *MapOfMessageMessage) Bucket() *bolt.Bucket {
 // If no record has been stored, it returns
 // a pointer to
 // the zero value.
-func (o *MapOfMessageMessage) Get(key []byte) *message.Message {
+func (o *MapOfWebhookWebhook) Get(key []byte) *webhook.Webhook {
 	rec := get(o.db, key)
-	v := new(message.Message)
+	v := new(webhook.Webhook)
 	if rec == nil {
 		return v
 	}
@@ -540,12 +963,12 @@ func (o *MapOfMessageMessage) Get(key []byte) *message.Message {
 }
 
 // GetByString is equivalent to o.Get([]byte(key)).
-func (o *MapOfMessageMessage) GetByString(key string) *message.Message {
+func (o *MapOfWebhookWebhook) GetByString(key string) *webhook.Webhook {
 	return o.Get([]byte(key))
 }
 
 // Put stores v in o as a record under the given key.
-func (o *MapOfMessageMessage) Put(key []byte, v *message.Message) {
+func (o *MapOfWebhookWebhook) Put(key []byte, v *webhook.Webhook) {
 	rec, err := json.Marshal(json.Marshaler(v))
 	if err != nil {
 		panic(err)
@@ -554,10 +977,72 @@ func (o *MapOfMessageMessage) Put(key []byte, v *message.Message) {
 }
 
 // PutByString is equivalent to o.Put([]byte(key), v).
-func (o *MapOfMessageMessage) PutByString(key string, v *message.Message) {
+func (o *MapOfWebhookWebhook) PutByString(key string, v *webhook.Webhook) {
 	o.Put([]byte(key), v)
 }
 
+// SeqOfFsmMessage is a bucket with sequential numeric keys,
+// holding records of type *fsm.Message.
+type SeqOfFsmMessage struct {
+	db *bolt.Bucket
+}
+
+// Bucket returns o's underlying *bolt.Bucket object.
+// This can be useful to access low-level database functions
+// or other features not exposed by this generated code.
+//
+// Note, if o's transaction is read-only and the underlying
+// bucket has not previously been created in a writable
+// transaction, Bucket returns nil.
+func (o *SeqOfFsmMessage) Bucket() *bolt.Bucket {
+	return o.db
+}
+
+// Get reads the record stored in o under sequence number n.
+//
+// If no record has been stored, it returns
+// a pointer to
+// the zero value.
+func (o *SeqOfFsmMessage) Get(n uint64) *fsm.Message {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	rec := get(o.db, key)
+	v := new(fsm.Message)
+	if rec == nil {
+		return v
+	}
+	err := json.Unmarshal(rec, json.Unmarshaler(v))
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Add stores v in o under a new sequence number.
+// It writes the new sequence number to *np
+// before marshaling v. It is okay for
+// np to point to a field inside v, to store
+// the sequence number in the new record.
+func (o *SeqOfFsmMessage) Add(v *fsm.Message, np *uint64) {
+	n, err := o.db.NextSequence()
+	if err != nil {
+		panic(err)
+	}
+	*np = n
+	o.Put(n, v)
+}
+
+// Put stores v in o as a record under sequence number n.
+func (o *SeqOfFsmMessage) Put(n uint64, v *fsm.Message) {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	rec, err := json.Marshal(json.Marshaler(v))
+	if err != nil {
+		panic(err)
+	}
+	put(o.db, key, rec)
+}
+
 // SeqOfUpdateUpdate is a bucket with sequential numeric keys,
 // holding records of type *update.Update.
 type SeqOfUpdateUpdate struct {
@@ -622,25 +1107,37 @@ func (o *SeqOfUpdateUpdate) Put(n uint64, v *update.Update) {
 
 var (
 	keyAgent             = []byte("Agent")
+	keyAliases           = []byte("Aliases")
+	keyBaseReserve       = []byte("BaseReserve")
+	keyChannel           = []byte("Channel")
 	keyChannelFeerate    = []byte("ChannelFeerate")
 	keyChannels          = []byte("Channels")
+	keyCommand           = []byte("Command")
 	keyConfig            = []byte("Config")
+	keyCounterparty      = []byte("Counterparty")
 	keyEncryptedSeed     = []byte("EncryptedSeed")
 	keyFinalityDelayMins = []byte("FinalityDelayMins")
+	keyFriendbotURL      = []byte("FriendbotURL")
 	keyHorizonURL        = []byte("HorizonURL")
 	keyHostFeerate       = []byte("HostFeerate")
 	keyKeepAlive         = []byte("KeepAlive")
+	keyLastIndexed       = []byte("LastIndexed")
 	keyMaxRoundDurMins   = []byte("MaxRoundDurMins")
-	keyMessages          = []byte("Messages")
+	keyMessageLogs       = []byte("MessageLogs")
+	keyNetworkPassphrase = []byte("NetworkPassphrase")
 	keyNextKeypathIndex  = []byte("NextKeypathIndex")
 	keyPrimaryAcct       = []byte("PrimaryAcct")
 	keyPublic            = []byte("Public")
 	keyPwHash            = []byte("PwHash")
 	keyPwType            = []byte("PwType")
 	keyReady             = []byte("Ready")
+	keySchedules         = []byte("Schedules")
+	keyType              = []byte("Type")
+	keyUpdateIndex       = []byte("UpdateIndex")
 	keyUpdates           = []byte("Updates")
 	keyUsername          = []byte("Username")
 	keyWallet            = []byte("Wallet")
+	keyWebhooks          = []byte("Webhooks")
 )
 
 type db interface {
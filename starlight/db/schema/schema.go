@@ -5,15 +5,20 @@ import (
 	"encoding/json"
 
 	"github.com/interstellar/starlight/starlight/fsm"
-	"github.com/interstellar/starlight/starlight/internal/message"
+	"github.com/interstellar/starlight/starlight/internal/alias"
+	"github.com/interstellar/starlight/starlight/internal/schedule"
 	"github.com/interstellar/starlight/starlight/internal/update"
+	"github.com/interstellar/starlight/starlight/internal/webhook"
 )
 
 var (
 	_ json.Marshaler = (*fsm.Channel)(nil)
+	_ json.Marshaler = (*fsm.Message)(nil)
 	_ json.Marshaler = (*fsm.WalletAcct)(nil)
-	_ json.Marshaler = (*message.Message)(nil)
 	_ json.Marshaler = (*update.Update)(nil)
+	_ json.Marshaler = (*webhook.Webhook)(nil)
+	_ json.Marshaler = (*schedule.Schedule)(nil)
+	_ json.Marshaler = (*alias.Alias)(nil)
 
 	_ encoding.BinaryMarshaler = (*fsm.AccountID)(nil)
 )
@@ -28,6 +33,9 @@ type Agent struct {
 	Config  *Config
 	Updates []*update.Update
 
+	// UpdateIndex holds secondary indexes over Updates.
+	UpdateIndex *UpdateIndex
+
 	// Ready indicates whether or not the Agent is ready to accept
 	// and process new commands. The Agent is only in a not-ready
 	// state when it is closing.
@@ -37,12 +45,28 @@ type Agent struct {
 	// are deleted. (Their history is still available in Updates.)
 	Channels map[string]*fsm.Channel
 
-	Messages map[string]*message.Message
+	// MessageLogs holds, for each channel where the agent is guest,
+	// the outgoing messages waiting to be fetched by the host.
+	// Each log is keyed by MsgNum.
+	// Messages the host has handled are pruned.
+	// (This replaces the old Messages field,
+	// which stored each channel's messages in one record.)
+	MessageLogs map[string][]*fsm.Message
 
 	EncryptedSeed    []byte
 	NextKeypathIndex uint32
 	PrimaryAcct      *fsm.AccountID
 	Wallet           *fsm.WalletAcct
+
+	// Webhooks holds the registered webhooks, keyed by ID.
+	Webhooks map[string]*webhook.Webhook
+
+	// Schedules holds the recurring payment schedules, keyed by ID.
+	Schedules map[string]*schedule.Schedule
+
+	// Aliases holds the federation names served for the agent
+	// in addition to its username, keyed by name.
+	Aliases map[string]*alias.Alias
 }
 
 // Config is the db layout for Starlight agent-level configuration.
@@ -50,6 +74,14 @@ type Config struct {
 	HorizonURL string
 	Username   string
 
+	// NetworkPassphrase, BaseReserve, and FriendbotURL
+	// describe the Stellar network the agent is on.
+	// They're empty in databases from before they were added;
+	// such agents are on the testnet.
+	NetworkPassphrase string
+	BaseReserve       int64
+	FriendbotURL      string
+
 	// PwType records which hashing function was used for PwHash.
 	// Currently, it's always "bcrypt".
 	PwType string
@@ -63,3 +95,27 @@ type Config struct {
 	KeepAlive bool
 	Public    bool
 }
+
+// UpdateIndex is the db layout for the secondary indexes
+// over an agent's update log.
+// Each map is keyed by the indexed value
+// (a channel ID, update type, command name,
+// or counterparty address)
+// and holds the set of matching update numbers.
+type UpdateIndex struct {
+	Channel      map[string]*UpdateSet
+	Type         map[string]*UpdateSet
+	Command      map[string]*UpdateSet
+	Counterparty map[string]*UpdateSet
+
+	// LastIndexed is the number of the latest update
+	// added to the indexes.
+	LastIndexed uint64
+}
+
+// UpdateSet is a set of update numbers.
+// genbolt doesn't support sets yet,
+// so the members are stored directly as keys
+// (big-endian uint64) of the underlying bucket,
+// with empty values.
+type UpdateSet struct{}
@@ -0,0 +1,60 @@
+package starlight
+
+import (
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+)
+
+// EmergencyClose force-closes channel chanID
+// using only the fully signed ratchet and settlement transactions
+// the channel holds from its latest completed round,
+// so it works while the agent's seed is unavailable,
+// for instance after an unattended restart.
+// Once the ratchet transaction is submitted,
+// the channel follows its usual timers to Closed,
+// which also need no seed.
+//
+// The agent calls it itself
+// when a channel's timer fires while it is locked.
+// If the channel is already force-closing,
+// EmergencyClose resubmits the transactions for its current stage.
+func (g *Agent) EmergencyClose(chanID string) error {
+	return db.Update(g.db, func(root *db.Root) error {
+		c := g.getChannel(root, chanID)
+		if c.ID == "" {
+			return errInvalidChannelID
+		}
+		if len(c.CurrentRatchetTx.Signatures) == 0 {
+			return errNoSignedRound // no round has completed
+		}
+		switch c.State {
+		case fsm.AwaitingRatchet:
+			return g.addTxTask(root.Tx(), chanID, c.CurrentRatchetTx)
+		case fsm.AwaitingSettlementMintime:
+			return nil // the settlement timer is running
+		case fsm.AwaitingSettlement:
+			if c.CurrentSettleWithGuestTx != nil {
+				err := g.addTxTask(root.Tx(), chanID, *c.CurrentSettleWithGuestTx)
+				if err != nil {
+					return err
+				}
+			}
+			return g.addTxTask(root.Tx(), chanID, c.CurrentSettleWithHostTx)
+		}
+		return g.doUpdateChannel(root, chanID, func(_ *db.Root, updater *fsm.Updater, update *Update) error {
+			cmd := &fsm.Command{Name: fsm.ForceClose}
+			update.InputCommand = cmd
+			return updater.Cmd(cmd)
+		})
+	})
+}
+
+// isLocked reports whether the agent's seed is unavailable.
+func (g *Agent) isLocked() bool {
+	var locked bool
+	db.View(g.db, func(*db.Root) error {
+		locked = g.signer() == nil
+		return nil
+	})
+	return locked
+}
@@ -0,0 +1,86 @@
+package starlight
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+func TestEmergencyClose(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chanID := randomAddress(t)
+	signed := xdr.TransactionEnvelope{
+		Signatures: []xdr.DecoratedSignature{{Signature: []byte{1}}},
+	}
+	c := &fsm.Channel{
+		ID:        chanID,
+		Role:      fsm.Host,
+		State:     fsm.Open,
+		PrevState: fsm.Open,
+		// Far enough ahead that the round timer doesn't interfere.
+		PaymentTime:      time.Now().Add(time.Hour),
+		MaxRoundDuration: time.Hour,
+		HostAmount:       10 * xlm.Lumen,
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		w := root.Agent().Wallet()
+		w.Seqnum = 1
+		root.Agent().PutWallet(w)
+		g.putChannel(root, chanID, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.mustDeauthenticate()
+
+	if err := g.EmergencyClose(chanID); err != errNoSignedRound {
+		t.Errorf("got error %v before any round completed, want %s", err, errNoSignedRound)
+	}
+
+	c.CurrentRatchetTx = signed
+	c.CurrentSettleWithHostTx = signed
+	err = db.Update(g.db, func(root *db.Root) error {
+		g.putChannel(root, chanID, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.EmergencyClose(chanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.View(g.db, func(root *db.Root) error {
+		c = g.getChannel(root, chanID)
+		return nil
+	})
+	if c.State != fsm.AwaitingRatchet {
+		t.Errorf("got state %s, want %s", c.State, fsm.AwaitingRatchet)
+	}
+	if len(c.CurrentRatchetTx.Signatures) != 1 {
+		t.Errorf("got ratchet tx %+v, want the signed one", c.CurrentRatchetTx)
+	}
+
+	// Already force-closing: the ratchet is resubmitted.
+	err = g.EmergencyClose(chanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,13 +3,17 @@ package starlight
 import (
 	"errors"
 	"net/http"
+
+	"github.com/interstellar/starlight/starlight/internal/keyfile"
 )
 
 // Defines errors returned by the agent.
 var (
 	errAcctsSame         = errors.New("same host and guest acct address")
 	errAgentClosing      = errors.New("agent in closing state: cannot process new commands")
+	errAliasExists       = errors.New("alias exists")
 	errAlreadyConfigured = errors.New("already configured")
+	errBelowMinBalance   = errors.New("amount below minimum account balance")
 	errBadAddress        = errors.New("bad address")
 	errBadHTTPStatus     = errors.New("bad http status")
 	errBadHTTPRequest    = errors.New("bad http request")
@@ -25,19 +29,34 @@ var (
 	errChannelExistsRetriable = errors.New("channel exists in a setup state")
 	errFetchingAccounts       = errors.New("error fetching accounts")
 	errInsufficientBalance    = errors.New("insufficient balance")
+	errInsecureKeyFile        = keyfile.ErrInsecure
 	errInvalidAddress         = errors.New("invalid address")
 	errInvalidAsset           = errors.New("invalid asset")
 	errInvalidChannelID       = errors.New("invalid channel ID")
 	errInvalidEdit            = errors.New("can only update password and horizon URL")
 	errInvalidInput           = errors.New("invalid input")
+	errInvalidMemo            = errors.New("invalid memo")
+	errInvalidMnemonic        = errors.New("invalid mnemonic")
 	errInvalidPassword        = errors.New("invalid password")
+	errInvalidURL             = errors.New("invalid URL")
 	errInvalidUsername        = errors.New("invalid username")
+	errLocked                 = errors.New("seed unavailable")
 	errNoChannelSpecified     = errors.New("channel not specified")
+	errNoAlias                = errors.New("alias not found")
 	errNoCommandSpecified     = errors.New("command not specified")
+	errNoCredential           = errors.New("credential not found")
+	errNoDestination          = errors.New("destination account does not exist")
+	errNoPath                 = errors.New("no payment path found")
+	errNoSchedule             = errors.New("schedule not found")
+	errNoSignedRound          = errors.New("no completed round to close with")
+	errNoWebhook              = errors.New("webhook not found")
 	errNotConfigured          = errors.New("not configured")
 	errNotFunded              = errors.New("primary acct not funded")
 	errPasswordsDontMatch     = errors.New("old password doesn't match")
 	errRemoteGuestMessage     = errors.New("received RPC message from guest")
+	errRemoteSigner           = errors.New("seed held by remote signer")
+	errWrongNetwork           = errors.New("horizon is on the wrong network")
+	errWrongSeed              = errors.New("seed does not match agent")
 )
 
 // WriteError formats an error with the correct message and status from
@@ -0,0 +1,157 @@
+package starlight
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/internal/alias"
+)
+
+// Alias is an additional federation name for the agent's account.
+type Alias = alias.Alias
+
+// fedRecord is a federation server response.
+// See https://www.stellar.org/developers/guides/concepts/federation.html.
+type fedRecord struct {
+	StellarAddress string `json:"stellar_address,omitempty"`
+	AccountID      string `json:"account_id"`
+	MemoType       string `json:"memo_type,omitempty"`
+	Memo           string `json:"memo,omitempty"`
+}
+
+// AddAlias registers name as a federation name
+// for the agent's account, alongside its username.
+// If memo is non-nil, federation lookups of name return it,
+// so payments sent to the alias can be identified.
+func (g *Agent) AddAlias(name string, memo *Memo) (*Alias, error) {
+	if name == "" || !validateUsername(name) {
+		return nil, errInvalidUsername
+	}
+	if memo != nil {
+		_, err := memoMutator(memo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	a := &Alias{Name: name, Memo: memo}
+	err := db.Update(g.db, func(root *db.Root) error {
+		if !g.isReadyConfigured(root) {
+			return errNotConfigured
+		}
+		if name == root.Agent().Config().Username() || root.Agent().Aliases().GetByString(name).Name != "" {
+			return errAliasExists
+		}
+		root.Agent().Aliases().PutByString(name, a)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// RemoveAlias unregisters the federation name name.
+func (g *Agent) RemoveAlias(name string) error {
+	return db.Update(g.db, func(root *db.Root) error {
+		bu := root.Agent().Aliases().Bucket()
+		if bu.Get([]byte(name)) == nil {
+			return errNoAlias
+		}
+		return bu.Delete([]byte(name))
+	})
+}
+
+// Aliases returns the agent's registered aliases.
+func (g *Agent) Aliases() []*Alias {
+	aliases := make([]*Alias, 0) // we want json "[]" not "null"
+	err := db.View(g.db, func(root *db.Root) error {
+		bu := root.Agent().Aliases().Bucket()
+		if bu == nil {
+			return nil
+		}
+		return bu.ForEach(func(k, _ []byte) error {
+			aliases = append(aliases, root.Agent().Aliases().Get(k))
+			return nil
+		})
+	})
+	if err != nil {
+		panic(err) // only errors here are bugs
+	}
+	return aliases
+}
+
+// handleFed serves federation requests for req.Host.
+// Name lookups resolve the agent's username and aliases,
+// and ID lookups of the agent's account return its username.
+func (g *Agent) handleFed(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	q := req.URL.Query().Get("q")
+	if q == "" {
+		fedError(w, http.StatusBadRequest, "missing q parameter")
+		return
+	}
+
+	var rec *fedRecord
+	switch req.URL.Query().Get("type") {
+	case "name":
+		i := strings.LastIndex(q, "*")
+		if i < 0 || !strings.EqualFold(q[i+1:], req.Host) {
+			break
+		}
+		name := q[:i]
+		db.View(g.db, func(root *db.Root) error {
+			if !g.isReadyConfigured(root) {
+				return nil
+			}
+			acct := root.Agent().PrimaryAcct().Address()
+			if name == root.Agent().Config().Username() {
+				rec = &fedRecord{StellarAddress: q, AccountID: acct}
+				return nil
+			}
+			a := root.Agent().Aliases().GetByString(name)
+			if a.Name == "" {
+				return nil
+			}
+			rec = &fedRecord{StellarAddress: q, AccountID: acct}
+			if a.Memo != nil {
+				rec.MemoType = a.Memo.Type
+				rec.Memo = a.Memo.Value
+			}
+			return nil
+		})
+	case "id":
+		db.View(g.db, func(root *db.Root) error {
+			if !g.isReadyConfigured(root) {
+				return nil
+			}
+			acct := root.Agent().PrimaryAcct().Address()
+			if q == acct {
+				rec = &fedRecord{
+					StellarAddress: root.Agent().Config().Username() + "*" + req.Host,
+					AccountID:      acct,
+				}
+			}
+			return nil
+		})
+	default:
+		fedError(w, http.StatusNotImplemented, "not implemented")
+		return
+	}
+
+	if rec == nil {
+		fedError(w, http.StatusNotFound, "not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
+
+// fedError writes a federation error response
+// in the form the federation protocol specifies.
+func fedError(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"detail": detail})
+}
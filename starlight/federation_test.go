@@ -0,0 +1,137 @@
+package starlight
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+)
+
+func TestHandleFed(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var acct string
+	db.View(g.db, func(root *db.Root) error {
+		acct = root.Agent().PrimaryAcct().Address()
+		return nil
+	})
+
+	if _, err := g.AddAlias("alice", nil); err != errAliasExists {
+		t.Errorf("got error %v adding username as alias, want %s", err, errAliasExists)
+	}
+	if _, err := g.AddAlias("bad*name", nil); err != errInvalidUsername {
+		t.Errorf("got error %v adding invalid alias, want %s", err, errInvalidUsername)
+	}
+	memo := &Memo{Type: fsm.MemoID, Value: "17"}
+	_, err = g.AddAlias("shop", memo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Aliases(); len(got) != 1 || got[0].Name != "shop" {
+		t.Errorf("got aliases %+v, want [shop]", got)
+	}
+
+	cases := []struct {
+		name, typ, q string
+		status       int
+		want         fedRecord
+	}{
+		{"username", "name", "alice*starlight.com", 200, fedRecord{StellarAddress: "alice*starlight.com", AccountID: acct}},
+		{"alias", "name", "shop*starlight.com", 200, fedRecord{StellarAddress: "shop*starlight.com", AccountID: acct, MemoType: "id", Memo: "17"}},
+		{"wrong host", "name", "alice*example.com", 404, fedRecord{}},
+		{"unknown name", "name", "bob*starlight.com", 404, fedRecord{}},
+		{"id", "id", acct, 200, fedRecord{StellarAddress: "alice*starlight.com", AccountID: acct}},
+		{"unknown id", "id", testIssuer, 404, fedRecord{}},
+		{"txid", "txid", "abcd", 501, fedRecord{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q := url.Values{"type": {c.typ}, "q": {c.q}}
+			req := httptest.NewRequest("GET", "http://starlight.com/federation?"+q.Encode(), nil)
+			w := httptest.NewRecorder()
+			g.handleFed(w, req)
+			if w.Code != c.status {
+				t.Fatalf("got status %d, want %d", w.Code, c.status)
+			}
+			if c.status != 200 {
+				return
+			}
+			var got fedRecord
+			err := json.NewDecoder(w.Body).Decode(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+
+	err = g.RemoveAlias("shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.RemoveAlias("shop"); err != errNoAlias {
+		t.Errorf("got error %v removing alias twice, want %s", err, errNoAlias)
+	}
+}
+
+type countingHTTP struct {
+	n int32
+}
+
+func (c *countingHTTP) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.n, 1)
+	return agentHTTP{}.RoundTrip(req)
+}
+
+func TestFindAccountCache(t *testing.T) {
+	clk, withClock := manualClock(time.Now())
+	transport := new(countingHTTP)
+	g, closer := startTestAgent(t, withClock, func(g *Agent) {
+		g.httpclient.Transport = transport
+	})
+	defer closer()
+
+	for i := 0; i < 3; i++ {
+		_, _, err := g.FindAccount("alice*starlight.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if transport.n != 2 {
+		t.Errorf("got %d requests, want 2 (stellar.toml and federation)", transport.n)
+	}
+
+	// Failed lookups are not cached.
+	for i := 0; i < 2; i++ {
+		g.FindAccount("doesnotexist*starlight.com")
+	}
+	if transport.n != 4 {
+		t.Errorf("got %d requests, want 4", transport.n)
+	}
+
+	// Expiry follows the agent's clock.
+	clk.Advance(fedCacheTTL)
+	_, _, err := g.FindAccount("alice*starlight.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport.n != 5 {
+		t.Errorf("got %d requests after the federation record expired, want 5", transport.n)
+	}
+}
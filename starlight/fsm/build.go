@@ -37,7 +37,7 @@ func buildSetupAccountTx(ch *Channel, account AccountID, seqnum xdr.SequenceNumb
 		seqnum,
 		b.CreateAccount(
 			b.Destination{AddressOrSeed: account.Address()},
-			b.NativeAmount{Amount: xlm.Lumen.HorizonString()},
+			b.NativeAmount{Amount: (2 * ch.baseReserve()).HorizonString()},
 		),
 	)
 	return tb, err
@@ -94,7 +94,7 @@ func buildFundingTx(ch *Channel, h *WalletAcct) (*b.TransactionBuilder, error) {
 		b.Payment(
 			b.SourceAccount{AddressOrSeed: ch.HostAcct.Address()},
 			b.Destination{AddressOrSeed: ch.EscrowAcct.Address()},
-			b.NativeAmount{Amount: (ch.HostAmount + 500*xlm.Millilumen + 8*ch.ChannelFeerate).HorizonString()},
+			b.NativeAmount{Amount: (ch.HostAmount + ch.baseReserve() + 8*ch.ChannelFeerate).HorizonString()},
 		),
 		b.SetOptions(
 			b.SourceAccount{AddressOrSeed: ch.EscrowAcct.Address()},
@@ -106,7 +106,7 @@ func buildFundingTx(ch *Channel, h *WalletAcct) (*b.TransactionBuilder, error) {
 		b.Payment(
 			b.SourceAccount{AddressOrSeed: ch.HostAcct.Address()},
 			b.Destination{AddressOrSeed: ch.GuestRatchetAcct.Address()},
-			b.NativeAmount{Amount: (xlm.Lumen + ch.ChannelFeerate).HorizonString()},
+			b.NativeAmount{Amount: (2*ch.baseReserve() + ch.ChannelFeerate).HorizonString()},
 		),
 		b.SetOptions(
 			b.SourceAccount{AddressOrSeed: ch.GuestRatchetAcct.Address()},
@@ -123,7 +123,7 @@ func buildFundingTx(ch *Channel, h *WalletAcct) (*b.TransactionBuilder, error) {
 		b.Payment(
 			b.SourceAccount{AddressOrSeed: ch.HostAcct.Address()},
 			b.Destination{AddressOrSeed: ch.HostRatchetAcct.Address()},
-			b.NativeAmount{Amount: (500*xlm.Millilumen + ch.ChannelFeerate).HorizonString()},
+			b.NativeAmount{Amount: (ch.baseReserve() + ch.ChannelFeerate).HorizonString()},
 		),
 		b.SetOptions(
 			b.SourceAccount{AddressOrSeed: ch.HostRatchetAcct.Address()},
@@ -21,6 +21,7 @@ const (
 	Pay           CommandName = "Pay"
 	AddAsset      CommandName = "AddAsset"
 	RemoveAsset   CommandName = "RemoveAsset"
+	BatchPay      CommandName = "BatchPay"
 )
 
 // Command contains a command name and its required arguments.
@@ -31,6 +32,27 @@ type Command struct {
 	Recipient string // for Pay
 	AssetCode string // for AddAsset, RemoveAsset
 	Issuer    string // for AddAsset, RemoveAsset
+
+	// For Pay by path payment: the asset sent (empty for lumens),
+	// and the most of it that may be spent.
+	SendAssetCode string     `json:",omitempty"`
+	SendIssuer    string     `json:",omitempty"`
+	SendMax       xlm.Amount `json:",omitempty"`
+
+	Payments []Payment `json:",omitempty"` // for BatchPay
+	Memo     *Memo     `json:",omitempty"` // for Pay
+
+	// CreatesAccount is set for a Pay
+	// that creates the recipient's account.
+	CreatesAccount bool `json:",omitempty"`
+}
+
+// Payment is one of the payments of a BatchPay command.
+type Payment struct {
+	Recipient string
+	Amount    xlm.Amount
+	AssetCode string `json:",omitempty"` // empty for lumens
+	Issuer    string `json:",omitempty"`
 }
 
 var commandFuncs = map[CommandName]func(*Command, *Updater) error{
@@ -13,6 +13,7 @@ var (
 	ErrChannelExists            = errors.New("received channel propose message for channel that already exists")
 	ErrInvalidVersion           = errors.New("invalid version number")
 	ErrUnusedSettleWithGuestSig = errors.New("unused settle with guest sig")
+	ErrWrongNetwork             = errors.New("channel proposed on a different network")
 
 	// Tx errors
 	errRatchetTxFailed = errors.New("ratchet tx failed")
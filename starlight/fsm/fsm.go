@@ -23,6 +23,7 @@ import (
 	b "github.com/stellar/go/build"
 	"github.com/stellar/go/xdr"
 
+	"github.com/interstellar/starlight/starlight/key"
 	"github.com/interstellar/starlight/worizon/xlm"
 )
 
@@ -47,7 +48,8 @@ type Channel struct {
 	CounterpartyAddress    string // either the Guest's federation address, or the Host's public key address
 	RemoteURL              string
 	Passphrase             string
-	Cursor                 string // where we are in watching escrowacct txs on the ledger
+	BaseReserve            xlm.Amount // zero means DefaultBaseReserve
+	Cursor                 string     // where we are in watching escrowacct txs on the ledger
 	BaseSequenceNumber     xdr.SequenceNumber
 	RoundNumber            uint64
 	CounterpartyMsgIndex   uint64
@@ -170,10 +172,10 @@ func (ch *Channel) roundSeqNum() xdr.SequenceNumber {
 	return ch.BaseSequenceNumber + xdr.SequenceNumber(ch.RoundNumber*4)
 }
 
-func (ch *Channel) setCounterpartySettlementTxes(guestTx, hostTx *b.TransactionBuilder, guestSig, hostSig xdr.DecoratedSignature, seed []byte) error {
+func (ch *Channel) setCounterpartySettlementTxes(guestTx, hostTx *b.TransactionBuilder, guestSig, hostSig xdr.DecoratedSignature, signer key.Signer) error {
 	var counterpartySettleWithGuestTx *xdr.TransactionEnvelope
 	if guestTx != nil {
-		myGuestSig, err := detachedSig(guestTx.TX, seed, ch.Passphrase, ch.KeyIndex)
+		myGuestSig, err := detachedSig(guestTx.TX, signer, ch.Passphrase, ch.KeyIndex)
 		if err != nil {
 			return err
 		}
@@ -183,7 +185,7 @@ func (ch *Channel) setCounterpartySettlementTxes(guestTx, hostTx *b.TransactionB
 		}
 	}
 	ch.CounterpartyLatestSettleWithGuestTx = counterpartySettleWithGuestTx
-	myHostSig, err := detachedSig(hostTx.TX, seed, ch.Passphrase, ch.KeyIndex)
+	myHostSig, err := detachedSig(hostTx.TX, signer, ch.Passphrase, ch.KeyIndex)
 	if err != nil {
 		return err
 	}
@@ -198,11 +200,11 @@ func (ch *Channel) setLatestSettlementTxes(
 	guestTx, hostTx *b.TransactionBuilder,
 	guestSig *xdr.DecoratedSignature,
 	hostSig xdr.DecoratedSignature,
-	seed []byte,
+	signer key.Signer,
 ) error {
 	var latestSettleWithGuestTx *xdr.TransactionEnvelope
 	if guestTx != nil {
-		myGuestSig, err := detachedSig(guestTx.TX, seed, ch.Passphrase, ch.KeyIndex)
+		myGuestSig, err := detachedSig(guestTx.TX, signer, ch.Passphrase, ch.KeyIndex)
 		if err != nil {
 			return err
 		}
@@ -216,7 +218,7 @@ func (ch *Channel) setLatestSettlementTxes(
 		}
 	}
 
-	myHostSig, err := detachedSig(hostTx.TX, seed, ch.Passphrase, ch.KeyIndex)
+	myHostSig, err := detachedSig(hostTx.TX, signer, ch.Passphrase, ch.KeyIndex)
 	if err != nil {
 		return err
 	}
@@ -232,8 +234,8 @@ func (ch *Channel) setLatestSettlementTxes(
 	return nil
 }
 
-func (ch *Channel) signRatchetTx(ratchetTx *b.TransactionBuilder, ratchetSig xdr.DecoratedSignature, seed []byte) error {
-	myRatchetSig, err := detachedSig(ratchetTx.TX, seed, ch.Passphrase, ch.KeyIndex)
+func (ch *Channel) signRatchetTx(ratchetTx *b.TransactionBuilder, ratchetSig xdr.DecoratedSignature, signer key.Signer) error {
+	myRatchetSig, err := detachedSig(ratchetTx.TX, signer, ch.Passphrase, ch.KeyIndex)
 	if err != nil {
 		return err
 	}
@@ -247,15 +249,39 @@ func (ch *Channel) signRatchetTx(ratchetTx *b.TransactionBuilder, ratchetSig xdr
 // SetupAndFundingReserveAmount reports the amount in lumens needed to set up and fund the channel.
 func (ch *Channel) SetupAndFundingReserveAmount() xlm.Amount {
 	var result xlm.Amount
-	result += setupMinBalanceAmount()
+	result += ch.setupMinBalanceAmount()
 	result += ch.setupFeeAmount()
 	result += ch.totalFundingTxAmount()
 	return result
 }
 
-func setupMinBalanceAmount() xlm.Amount {
-	// Escrow, host ratchet, guest ratchet have min balance of 1 XLM.
-	return 3 * xlm.Lumen
+// ReserveAmount reports the amount in lumens, beyond HostAmount,
+// that the host keeps in the channel accounts:
+// their minimum balances,
+// and the fees for the transactions they submit later.
+// The fees of the setup and funding transactions
+// are spent, so they are not included.
+// Whatever remains returns to the host when the channel closes.
+func (ch *Channel) ReserveAmount() xlm.Amount {
+	minBalances := ch.setupMinBalanceAmount() + ch.fundingBalanceAmount() - ch.HostAmount
+	return minBalances + ch.fundedAcctsTxFeeAmount()
+}
+
+// DefaultBaseReserve is the base reserve
+// of channels that don't record one.
+// It is the base reserve of the Stellar testnet.
+const DefaultBaseReserve = 500 * xlm.Millilumen
+
+func (ch *Channel) baseReserve() xlm.Amount {
+	if ch.BaseReserve == 0 {
+		return DefaultBaseReserve
+	}
+	return ch.BaseReserve
+}
+
+func (ch *Channel) setupMinBalanceAmount() xlm.Amount {
+	// Escrow, host ratchet, guest ratchet have min balance of 2 base reserves.
+	return 6 * ch.baseReserve()
 }
 
 func (ch *Channel) setupFeeAmount() xlm.Amount {
@@ -274,8 +300,8 @@ func (ch *Channel) totalFundingTxAmount() xlm.Amount {
 
 func (ch *Channel) fundingBalanceAmount() xlm.Amount {
 	// Guest ratchet has 2 additional signers, escrow and host ratchet 1 each.
-	// Each additional signer adds .5 Lumen to the minimum reserve balance.
-	return ch.HostAmount + 2*xlm.Lumen
+	// Each additional signer adds a base reserve to the minimum balance.
+	return ch.HostAmount + 4*ch.baseReserve()
 }
 
 func (ch *Channel) fundingFeeAmount() xlm.Amount {
@@ -296,6 +322,12 @@ func isSetupState(state State) bool {
 	return false
 }
 
+// IsForceClosing reports whether the channel is being force-closed,
+// with its funds locked until settlement.
+func (ch *Channel) IsForceClosing() bool {
+	return isForceCloseState(ch.State)
+}
+
 func isForceCloseState(state State) bool {
 	switch state {
 	case AwaitingRatchet, AwaitingSettlementMintime, AwaitingSettlement:
@@ -0,0 +1,18 @@
+package fsm
+
+// Memo types.
+const (
+	MemoText   = "text"
+	MemoID     = "id"
+	MemoHash   = "hash"
+	MemoReturn = "return" // only seen on incoming payments
+)
+
+// Memo is the memo of a wallet payment's transaction.
+type Memo struct {
+	Type string
+
+	// Value is the memo text, the decimal ID,
+	// or the hex-encoded hash.
+	Value string
+}
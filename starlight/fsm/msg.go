@@ -58,6 +58,8 @@ type ChannelProposeMsg struct {
 	HostAmount         xlm.Amount
 	Feerate            xlm.Amount
 	FundingTime        time.Time
+	Passphrase         string     // network passphrase
+	BaseReserve        xlm.Amount // network base reserve
 }
 
 // ChannelAcceptMsg contains Signatures for Guest accepting a proposal.
@@ -135,7 +137,7 @@ func (u *Updater) handlePaymentCompleteMsg(m *Message) error {
 	}
 	u.C.CurrentSettleWithGuestTx = u.C.CounterpartyLatestSettleWithGuestTx
 	u.C.CurrentSettleWithHostTx = u.C.CounterpartyLatestSettleWithHostTx
-	err = u.C.signRatchetTx(ratchetTx, complete.SenderRatchetSig, u.Seed)
+	err = u.C.signRatchetTx(ratchetTx, complete.SenderRatchetSig, u.Signer)
 	if err != nil {
 		return err
 	}
@@ -214,11 +216,11 @@ func (u *Updater) handlePaymentAcceptMsg(m *Message) error {
 
 	// Sets the counterparty and latest settlement txes
 	err = u.C.setLatestSettlementTxes(guestTx, hostTx, recipientSettleWithGuestSig,
-		accept.RecipientSettleWithHostSig, u.Seed)
+		accept.RecipientSettleWithHostSig, u.Signer)
 	if err != nil {
 		return err
 	}
-	err = u.C.signRatchetTx(ratchetTx, accept.RecipientRatchetSig, u.Seed)
+	err = u.C.signRatchetTx(ratchetTx, accept.RecipientRatchetSig, u.Signer)
 	if err != nil {
 		return err
 	}
@@ -239,6 +241,12 @@ func (u *Updater) handleChannelProposeMsg(m *Message) error {
 		u.debugf("dropped message: proposed guest acct %s doesn't match channel guest acct %s", propose.GuestAcct.Address(), u.C.GuestAcct.Address())
 		return nil
 	}
+	if propose.Passphrase != u.Passphrase {
+		return errors.Wrapf(ErrWrongNetwork, "channel proposed on %q, want %q", propose.Passphrase, u.Passphrase)
+	}
+	if propose.BaseReserve != u.BaseReserve {
+		return errors.Wrapf(ErrWrongNetwork, "channel proposed with base reserve %s, want %s", propose.BaseReserve, u.BaseReserve)
+	}
 
 	var EscrowAcct AccountID
 	err := EscrowAcct.SetAddress(string(m.ChannelID))
@@ -264,6 +272,7 @@ func (u *Updater) handleChannelProposeMsg(m *Message) error {
 		GuestRatchetAcctSeqNum: u.C.GuestRatchetAcctSeqNum,
 		KeyIndex:               key.PrimaryAccountIndex,
 		Passphrase:             u.Passphrase,
+		BaseReserve:            u.BaseReserve,
 		CounterpartyAddress:    u.C.CounterpartyAddress,
 		ChannelFeerate:         propose.Feerate,
 	}
@@ -300,7 +309,7 @@ func (u *Updater) handleChannelAcceptMsg(m *Message) error {
 	}
 
 	// Set current ratchet tx
-	u.C.signRatchetTx(ratchetTx, accept.GuestRatchetRound1Sig, u.Seed)
+	u.C.signRatchetTx(ratchetTx, accept.GuestRatchetRound1Sig, u.Signer)
 
 	settleOnlyWithHostTx, err := buildSettleOnlyWithHostTx(u.C, u.C.FundingTime)
 	if err != nil {
@@ -310,7 +319,7 @@ func (u *Updater) handleChannelAcceptMsg(m *Message) error {
 		return errors.Wrap(err, "invalid signature on round 1 settlement tx")
 	}
 	// Set current settlement tx
-	u.C.setLatestSettlementTxes(nil, settleOnlyWithHostTx, nil, accept.GuestSettleOnlyWithHostSig, u.Seed)
+	u.C.setLatestSettlementTxes(nil, settleOnlyWithHostTx, nil, accept.GuestSettleOnlyWithHostSig, u.Signer)
 
 	return u.transitionTo(AwaitingFunding)
 }
@@ -422,7 +431,7 @@ func (u *Updater) handlePaymentProposeMsg(m *Message) error {
 			u.C.PendingAmountReceived = payment.PaymentAmount
 		}
 		u.C.setCounterpartySettlementTxes(settleWithGuestTx, settleWithHostTx,
-			payment.SenderSettleWithGuestSig, payment.SenderSettleWithHostSig, u.Seed)
+			payment.SenderSettleWithGuestSig, payment.SenderSettleWithHostSig, u.Signer)
 		u.C.PendingPaymentTime = payment.PaymentTime
 		u.C.RoundNumber++
 		return u.transitionTo(PaymentAccepted)
@@ -489,15 +498,14 @@ func (m *Message) bytesToSign() ([]byte, error) {
 	return json.Marshal(msgcopy)
 }
 
-func (m *Message) signMsg(seed []byte) (*Message, error) {
-	if seed == nil {
+func (m *Message) signMsg(signer key.Signer) (*Message, error) {
+	if signer == nil {
 		return nil, errNoSeed
 	}
 	bytes, err := m.bytesToSign()
 	if err != nil {
 		return nil, err
 	}
-	kp := key.DeriveAccountPrimary(seed)
-	m.Signature, err = kp.Sign(bytes)
+	m.Signature, err = signer.SignMessage(bytes)
 	return m, err
 }
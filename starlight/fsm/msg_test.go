@@ -8,6 +8,7 @@ import (
 	"github.com/stellar/go/xdr"
 
 	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/key"
 	"github.com/interstellar/starlight/worizon/xlm"
 )
 
@@ -19,14 +20,14 @@ func TestHandleChannelProposeMsg(t *testing.T) {
 	ch.Role = Guest
 	ch.KeyIndex = 0
 	h := createTestHost()
-	m, err := createChannelProposeMsg([]byte(guestSeed), ch, h)
+	m, err := createChannelProposeMsg(key.SeedSigner(guestSeed), ch, h)
 	if err != nil {
 		t.Fatal(err)
 	}
 	u := &Updater{
 		C:          ch,
 		O:          ono{},
-		Seed:       []byte(seed),
+		Signer:     key.SeedSigner(seed),
 		H:          h,
 		Passphrase: ch.Passphrase,
 	}
@@ -42,6 +43,18 @@ func TestHandleChannelProposeMsg(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	u.Passphrase = "Other Network"
+	err = u.handleChannelProposeMsg(m)
+	if errors.Root(err) != ErrWrongNetwork {
+		t.Fatalf("got error %v for another network, want %s", err, ErrWrongNetwork)
+	}
+	u.Passphrase = ch.Passphrase
+	u.BaseReserve = ch.BaseReserve + 1
+	err = u.handleChannelProposeMsg(m)
+	if errors.Root(err) != ErrWrongNetwork {
+		t.Fatalf("got error %v for another base reserve, want %s", err, ErrWrongNetwork)
+	}
+	u.BaseReserve = ch.BaseReserve
 	err = u.handleChannelProposeMsg(m)
 	if err != nil {
 		t.Fatal(err)
@@ -83,7 +96,7 @@ func TestHandleChannelAcceptMessage(t *testing.T) {
 	}
 	ch.Role = Guest
 	ch.KeyIndex = 0 // this is the KeyIndex for all the Guest's channels
-	m, err := createChannelAcceptMsg([]byte(guestSeed), ch, ch.FundingTime)
+	m, err := createChannelAcceptMsg(key.SeedSigner(guestSeed), ch, ch.FundingTime)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -93,7 +106,7 @@ func TestHandleChannelAcceptMessage(t *testing.T) {
 		O:          ono{},
 		H:          h,
 		LedgerTime: ch.FundingTime,
-		Seed:       []byte(guestSeed),
+		Signer:     key.SeedSigner(guestSeed),
 	}
 	u.transitionTo(Start)
 	if err != nil {
@@ -123,7 +136,7 @@ func TestHandleChannelAcceptMessage(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	m, err = createChannelAcceptMsg([]byte(""), ch, ch.FundingTime)
+	m, err = createChannelAcceptMsg(key.SeedSigner(""), ch, ch.FundingTime)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -311,22 +324,22 @@ func TestHandlePaymentProposeMessage(t *testing.T) {
 			guestChannel.Role = Guest
 			guestChannel.KeyIndex = 0
 			u.C = guestChannel
-			u.Seed = []byte(guestSeed)
+			u.Signer = key.SeedSigner(guestSeed)
 			err = u.transitionTo(Open)
 			if err != nil {
 				t.Fatal(err)
 			}
 
 			var sender, recipient *Channel
-			var senderSeed, recipientSeed []byte
+			var senderSeed, recipientSeed key.Signer
 
 			switch c.handler {
 			case Host:
-				sender, senderSeed = guestChannel, []byte(guestSeed)
-				recipient, recipientSeed = hostChannel, []byte(hostSeed)
+				sender, senderSeed = guestChannel, key.SeedSigner(guestSeed)
+				recipient, recipientSeed = hostChannel, key.SeedSigner(hostSeed)
 			case Guest:
-				sender, senderSeed = hostChannel, []byte(hostSeed)
-				recipient, recipientSeed = guestChannel, []byte(guestSeed)
+				sender, senderSeed = hostChannel, key.SeedSigner(hostSeed)
+				recipient, recipientSeed = guestChannel, key.SeedSigner(guestSeed)
 			}
 			command := &Command{
 				Name:   ChannelPay,
@@ -336,7 +349,7 @@ func TestHandlePaymentProposeMessage(t *testing.T) {
 			h := createTestHost()
 
 			u.C = sender
-			u.Seed = senderSeed
+			u.Signer = senderSeed
 			u.H = h
 			err = channelPayFn(command, u)
 			if err != nil {
@@ -355,7 +368,7 @@ func TestHandlePaymentProposeMessage(t *testing.T) {
 				C:          recipient,
 				O:          ono{},
 				LedgerTime: sender.PendingPaymentTime.Add(time.Minute),
-				Seed:       recipientSeed,
+				Signer:     recipientSeed,
 			}
 
 			if c.handlerUFunc != nil {
@@ -526,15 +539,15 @@ func TestHandlePaymentAcceptMessage(t *testing.T) {
 			guestChannel.KeyIndex = 0
 
 			var sender, recipient *Channel
-			var senderSeed, recipientSeed []byte
+			var senderSeed, recipientSeed key.Signer
 
 			switch c.sender {
 			case Guest:
-				sender, senderSeed = guestChannel, []byte(guestSeed)
-				recipient, recipientSeed = hostChannel, []byte(hostSeed)
+				sender, senderSeed = guestChannel, key.SeedSigner(guestSeed)
+				recipient, recipientSeed = hostChannel, key.SeedSigner(hostSeed)
 			case Host:
-				sender, senderSeed = hostChannel, []byte(hostSeed)
-				recipient, recipientSeed = guestChannel, []byte(guestSeed)
+				sender, senderSeed = hostChannel, key.SeedSigner(hostSeed)
+				recipient, recipientSeed = guestChannel, key.SeedSigner(guestSeed)
 			}
 			payCmd := &Command{
 				Name:   ChannelPay,
@@ -544,10 +557,10 @@ func TestHandlePaymentAcceptMessage(t *testing.T) {
 			h := createTestHost()
 
 			u = &Updater{
-				C:    sender,
-				O:    ono{},
-				H:    h,
-				Seed: senderSeed,
+				C:      sender,
+				O:      ono{},
+				H:      h,
+				Signer: senderSeed,
 			}
 
 			err = channelPayFn(payCmd, u)
@@ -562,7 +575,7 @@ func TestHandlePaymentAcceptMessage(t *testing.T) {
 				C:          recipient,
 				O:          ono{},
 				LedgerTime: sender.PendingPaymentTime.Add(time.Minute),
-				Seed:       recipientSeed,
+				Signer:     recipientSeed,
 			}
 			err = u.handlePaymentProposeMsg(proposalMsg)
 			if err != nil {
@@ -581,7 +594,7 @@ func TestHandlePaymentAcceptMessage(t *testing.T) {
 				c.msgFunc(acceptMsg.PaymentAcceptMsg)
 			}
 			u.C = sender
-			u.Seed = senderSeed
+			u.Signer = senderSeed
 			err = u.handlePaymentAcceptMsg(acceptMsg)
 
 			if errors.Root(err) != c.wantErr {
@@ -723,15 +736,15 @@ func TestHandlePaymentCompleteMessage(t *testing.T) {
 			guestChannel.KeyIndex = 0
 
 			var sender, recipient *Channel
-			var senderSeed, recipientSeed []byte
+			var senderSeed, recipientSeed key.Signer
 
 			switch c.recipient {
 			case Host:
-				sender, senderSeed = guestChannel, []byte(guestSeed)
-				recipient, recipientSeed = hostChannel, []byte(hostSeed)
+				sender, senderSeed = guestChannel, key.SeedSigner(guestSeed)
+				recipient, recipientSeed = hostChannel, key.SeedSigner(hostSeed)
 			case Guest:
-				sender, senderSeed = hostChannel, []byte(hostSeed)
-				recipient, recipientSeed = guestChannel, []byte(guestSeed)
+				sender, senderSeed = hostChannel, key.SeedSigner(hostSeed)
+				recipient, recipientSeed = guestChannel, key.SeedSigner(guestSeed)
 			}
 			payCmd := &Command{
 				Name:   ChannelPay,
@@ -744,7 +757,7 @@ func TestHandlePaymentCompleteMessage(t *testing.T) {
 				O:          ono{},
 				H:          h,
 				LedgerTime: sender.PendingPaymentTime.Add(time.Minute),
-				Seed:       senderSeed,
+				Signer:     senderSeed,
 			}
 			err = channelPayFn(payCmd, u)
 			if err != nil {
@@ -755,7 +768,7 @@ func TestHandlePaymentCompleteMessage(t *testing.T) {
 				t.Error(err)
 			}
 			u.C = recipient
-			u.Seed = recipientSeed
+			u.Signer = recipientSeed
 			err = u.handlePaymentProposeMsg(proposalMsg)
 			if err != nil {
 				t.Error(err)
@@ -767,7 +780,7 @@ func TestHandlePaymentCompleteMessage(t *testing.T) {
 			}
 
 			u.C = sender
-			u.Seed = senderSeed
+			u.Signer = senderSeed
 			err = u.handlePaymentAcceptMsg(acceptMsg)
 			if err != nil {
 				t.Error(err)
@@ -784,7 +797,7 @@ func TestHandlePaymentCompleteMessage(t *testing.T) {
 				c.msgFunc(completeMsg.PaymentCompleteMsg)
 			}
 			u.C = recipient
-			u.Seed = recipientSeed
+			u.Signer = recipientSeed
 			err = u.handlePaymentCompleteMsg(completeMsg)
 			if errors.Root(err) != c.wantErr {
 				t.Errorf("got error %v, want %v", err, c.wantErr)
@@ -885,16 +898,16 @@ func TestHandleCloseMsg(t *testing.T) {
 			guestChannel.KeyIndex = 0
 
 			var sender, recipient *Channel
-			var senderSeed, recipientSeed []byte
+			var senderSeed, recipientSeed key.Signer
 
 			switch c.handler {
 			case Host:
-				sender, senderSeed = guestChannel, []byte(guestSeed)
-				recipient, recipientSeed = hostChannel, []byte(hostSeed)
+				sender, senderSeed = guestChannel, key.SeedSigner(guestSeed)
+				recipient, recipientSeed = hostChannel, key.SeedSigner(hostSeed)
 				recipient.PendingAmountSent = 0
 			case Guest:
-				sender, senderSeed = hostChannel, []byte(hostSeed)
-				recipient, recipientSeed = guestChannel, []byte(guestSeed)
+				sender, senderSeed = hostChannel, key.SeedSigner(hostSeed)
+				recipient, recipientSeed = guestChannel, key.SeedSigner(guestSeed)
 				recipient.PendingAmountSent = 0
 			}
 
@@ -909,7 +922,7 @@ func TestHandleCloseMsg(t *testing.T) {
 				O:          ono{},
 				H:          h,
 				LedgerTime: sender.PendingPaymentTime,
-				Seed:       senderSeed,
+				Signer:     senderSeed,
 			}
 			err = channelPayFn(payCmd, u)
 			if err != nil {
@@ -921,7 +934,7 @@ func TestHandleCloseMsg(t *testing.T) {
 			}
 			u.C = recipient
 			u.LedgerTime = sender.PendingPaymentTime.Add(time.Minute)
-			u.Seed = recipientSeed
+			u.Signer = recipientSeed
 			err = u.handlePaymentProposeMsg(proposalMsg)
 			if err != nil {
 				t.Error(err)
@@ -933,7 +946,7 @@ func TestHandleCloseMsg(t *testing.T) {
 			}
 
 			u.C = sender
-			u.Seed = senderSeed
+			u.Signer = senderSeed
 			err = u.handlePaymentAcceptMsg(acceptMsg)
 			if err != nil {
 				t.Error(err)
@@ -944,7 +957,7 @@ func TestHandleCloseMsg(t *testing.T) {
 				t.Error(err)
 			}
 			u.C = recipient
-			u.Seed = recipientSeed
+			u.Signer = recipientSeed
 			err = u.handlePaymentCompleteMsg(completeMsg)
 
 			m, err := createCloseMsg(senderSeed, sender)
@@ -960,7 +973,7 @@ func TestHandleCloseMsg(t *testing.T) {
 			}
 
 			u.C = recipient
-			u.Seed = recipientSeed
+			u.Signer = recipientSeed
 			err = u.handleCloseMsg(m)
 			if errors.Root(err) != c.wantErr {
 				t.Errorf("got error %v, want %v", err, c.wantErr)
@@ -980,9 +993,9 @@ func TestMessageAuthentication(t *testing.T) {
 	recipient.KeyIndex = 0
 	recipient.Role = Guest
 	u := &Updater{
-		C:    recipient,
-		O:    ono{},
-		Seed: []byte(guestSeed),
+		C:      recipient,
+		O:      ono{},
+		Signer: key.SeedSigner(guestSeed),
 	}
 	sender, err := createTestChannel()
 	if err != nil {
@@ -990,7 +1003,7 @@ func TestMessageAuthentication(t *testing.T) {
 	}
 	sender.Role = Host
 	h := createTestHost()
-	m, err := createChannelProposeMsg([]byte(hostSeed), sender, h)
+	m, err := createChannelProposeMsg(key.SeedSigner(hostSeed), sender, h)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -998,7 +1011,7 @@ func TestMessageAuthentication(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	m, err = createChannelProposeMsg([]byte(guestSeed), sender, h)
+	m, err = createChannelProposeMsg(key.SeedSigner(guestSeed), sender, h)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1016,9 +1029,9 @@ func TestMessageVersion(t *testing.T) {
 	recipient.KeyIndex = 0
 	recipient.Role = Guest
 	u := &Updater{
-		C:    recipient,
-		O:    ono{},
-		Seed: []byte(guestSeed),
+		C:      recipient,
+		O:      ono{},
+		Signer: key.SeedSigner(guestSeed),
 	}
 	sender, err := createTestChannel()
 	if err != nil {
@@ -1026,7 +1039,7 @@ func TestMessageVersion(t *testing.T) {
 	}
 	sender.Role = Host
 	h := createTestHost()
-	m, err := createChannelProposeMsg([]byte(hostSeed), sender, h)
+	m, err := createChannelProposeMsg(key.SeedSigner(hostSeed), sender, h)
 	if err != nil {
 		t.Fatal(err)
 	}
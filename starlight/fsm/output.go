@@ -21,13 +21,13 @@ type Outputter interface {
 	OutputTx(xdr.TransactionEnvelope)
 }
 
-func publishFundingTx(seed []byte, ch *Channel, o Outputter, h *WalletAcct) error {
+func publishFundingTx(signer key.Signer, ch *Channel, o Outputter, h *WalletAcct) error {
 	tx, err := buildFundingTx(ch, h)
 	if err != nil {
 		return err
 	}
 	ch.FundingTxSeqnum = h.Seqnum
-	env, err := txSig(tx, seed, key.PrimaryAccountIndex, ch.KeyIndex, ch.KeyIndex+1, ch.KeyIndex+2)
+	env, err := txSig(tx, signer, key.PrimaryAccountIndex, ch.KeyIndex, ch.KeyIndex+1, ch.KeyIndex+2)
 	if err != nil {
 		return err
 	}
@@ -36,12 +36,12 @@ func publishFundingTx(seed []byte, ch *Channel, o Outputter, h *WalletAcct) erro
 	return nil
 }
 
-func publishCleanupTx(seed []byte, ch *Channel, o Outputter, h *WalletAcct) error {
+func publishCleanupTx(signer key.Signer, ch *Channel, o Outputter, h *WalletAcct) error {
 	tx, err := buildCleanupTx(ch, h)
 	if err != nil {
 		return err
 	}
-	env, err := txSig(tx, seed, key.PrimaryAccountIndex, ch.KeyIndex, ch.KeyIndex+1, ch.KeyIndex+2)
+	env, err := txSig(tx, signer, key.PrimaryAccountIndex, ch.KeyIndex, ch.KeyIndex+1, ch.KeyIndex+2)
 	if err != nil {
 		return err
 	}
@@ -49,12 +49,12 @@ func publishCleanupTx(seed []byte, ch *Channel, o Outputter, h *WalletAcct) erro
 	return nil
 }
 
-func publishCoopCloseTx(seed []byte, ch *Channel, o Outputter, h *WalletAcct) error {
+func publishCoopCloseTx(signer key.Signer, ch *Channel, o Outputter, h *WalletAcct) error {
 	coopCloseTx, err := buildCooperativeCloseTx(ch)
 	if err != nil {
 		return err
 	}
-	channelCoopCloseSig, err := detachedSig(coopCloseTx.TX, seed, ch.Passphrase, ch.KeyIndex)
+	channelCoopCloseSig, err := detachedSig(coopCloseTx.TX, signer, ch.Passphrase, ch.KeyIndex)
 	if err != nil {
 		return err
 	}
@@ -65,12 +65,12 @@ func publishCoopCloseTx(seed []byte, ch *Channel, o Outputter, h *WalletAcct) er
 	return nil
 }
 
-func publishTopUpTx(seed []byte, ch *Channel, o Outputter, h *WalletAcct) error {
+func publishTopUpTx(signer key.Signer, ch *Channel, o Outputter, h *WalletAcct) error {
 	tx, err := buildTopUpTx(ch, h)
 	if err != nil {
 		return err
 	}
-	env, err := txSig(tx, seed, key.PrimaryAccountIndex)
+	env, err := txSig(tx, signer, key.PrimaryAccountIndex)
 	if err != nil {
 		return err
 	}
@@ -78,7 +78,7 @@ func publishTopUpTx(seed []byte, ch *Channel, o Outputter, h *WalletAcct) error
 	return nil
 }
 
-func createPaymentCompleteMsg(seed []byte, ch *Channel) (*Message, error) {
+func createPaymentCompleteMsg(signer key.Signer, ch *Channel) (*Message, error) {
 	var ratchetAccount AccountID
 	var ratchetSeqNum xdr.SequenceNumber
 	switch ch.Role {
@@ -93,7 +93,7 @@ func createPaymentCompleteMsg(seed []byte, ch *Channel) (*Message, error) {
 	if err != nil {
 		return nil, err
 	}
-	senderRatchetSig, err := detachedSig(senderRatchetTx.TX, seed, ch.Passphrase, ch.KeyIndex)
+	senderRatchetSig, err := detachedSig(senderRatchetTx.TX, signer, ch.Passphrase, ch.KeyIndex)
 	if err != nil {
 		return nil, err
 	}
@@ -106,11 +106,11 @@ func createPaymentCompleteMsg(seed []byte, ch *Channel) (*Message, error) {
 		Version: version,
 		MsgNum:  ch.LastMsgIndex + 1,
 	}
-	return m.signMsg(seed)
+	return m.signMsg(signer)
 }
 
-func sendPaymentCompleteMsg(seed []byte, ch *Channel, o Outputter) error {
-	m, err := createPaymentCompleteMsg(seed, ch)
+func sendPaymentCompleteMsg(signer key.Signer, ch *Channel, o Outputter) error {
+	m, err := createPaymentCompleteMsg(signer, ch)
 	if err != nil {
 		return err
 	}
@@ -118,12 +118,12 @@ func sendPaymentCompleteMsg(seed []byte, ch *Channel, o Outputter) error {
 	return nil
 }
 
-func publishSetupAccountTxes(seed []byte, ch *Channel, o Outputter, h *WalletAcct) error {
+func publishSetupAccountTxes(signer key.Signer, ch *Channel, o Outputter, h *WalletAcct) error {
 	hostRatchetTx, err := buildSetupAccountTx(ch, ch.HostRatchetAcct, h.Seqnum-2)
 	if err != nil {
 		return err
 	}
-	hostRatchet, err := txSig(hostRatchetTx, seed, key.PrimaryAccountIndex)
+	hostRatchet, err := txSig(hostRatchetTx, signer, key.PrimaryAccountIndex)
 	if err != nil {
 		return err
 	}
@@ -133,7 +133,7 @@ func publishSetupAccountTxes(seed []byte, ch *Channel, o Outputter, h *WalletAcc
 	if err != nil {
 		return err
 	}
-	guestRatchet, err := txSig(guestRatchetTx, seed, key.PrimaryAccountIndex)
+	guestRatchet, err := txSig(guestRatchetTx, signer, key.PrimaryAccountIndex)
 	if err != nil {
 		return err
 	}
@@ -143,7 +143,7 @@ func publishSetupAccountTxes(seed []byte, ch *Channel, o Outputter, h *WalletAcc
 	if err != nil {
 		return err
 	}
-	escrow, err := txSig(escrowTx, seed, key.PrimaryAccountIndex)
+	escrow, err := txSig(escrowTx, signer, key.PrimaryAccountIndex)
 	if err != nil {
 		return err
 	}
@@ -152,7 +152,7 @@ func publishSetupAccountTxes(seed []byte, ch *Channel, o Outputter, h *WalletAcc
 	return nil
 }
 
-func createChannelProposeMsg(seed []byte, ch *Channel, h *WalletAcct) (*Message, error) {
+func createChannelProposeMsg(signer key.Signer, ch *Channel, h *WalletAcct) (*Message, error) {
 	m := &Message{
 		ChannelID: ch.ID,
 		ChannelProposeMsg: &ChannelProposeMsg{
@@ -166,15 +166,17 @@ func createChannelProposeMsg(seed []byte, ch *Channel, h *WalletAcct) (*Message,
 			FundingTime:        ch.FundingTime,
 			BaseSequenceNumber: xdr.SequenceNumber(ch.BaseSequenceNumber),
 			Feerate:            ch.ChannelFeerate,
+			Passphrase:         ch.Passphrase,
+			BaseReserve:        ch.BaseReserve,
 		},
 		Version: version,
 		MsgNum:  ch.LastMsgIndex + 1,
 	}
-	return m.signMsg(seed)
+	return m.signMsg(signer)
 }
 
-func sendChannelProposeMsg(seed []byte, ch *Channel, o Outputter, h *WalletAcct) error {
-	m, err := createChannelProposeMsg(seed, ch, h)
+func sendChannelProposeMsg(signer key.Signer, ch *Channel, o Outputter, h *WalletAcct) error {
+	m, err := createChannelProposeMsg(signer, ch, h)
 	if err != nil {
 		return err
 	}
@@ -182,7 +184,7 @@ func sendChannelProposeMsg(seed []byte, ch *Channel, o Outputter, h *WalletAcct)
 	return nil
 }
 
-func createPaymentProposeMsg(seed []byte, ch *Channel) (*Message, error) {
+func createPaymentProposeMsg(signer key.Signer, ch *Channel) (*Message, error) {
 	// We copy the Channel to construct signatures with updated PaymentAmount values.
 	ch2 := *ch
 	switch ch.Role {
@@ -200,7 +202,7 @@ func createPaymentProposeMsg(seed []byte, ch *Channel) (*Message, error) {
 		if err != nil {
 			return nil, err
 		}
-		settleWithHostSig, err = detachedSig(settleOnlyWithHostTx.TX, seed, ch2.Passphrase, ch2.KeyIndex)
+		settleWithHostSig, err = detachedSig(settleOnlyWithHostTx.TX, signer, ch2.Passphrase, ch2.KeyIndex)
 		if err != nil {
 			return nil, err
 		}
@@ -209,7 +211,7 @@ func createPaymentProposeMsg(seed []byte, ch *Channel) (*Message, error) {
 		if err != nil {
 			return nil, err
 		}
-		settleWithGuestSig, err = detachedSig(settleWithGuestTx.TX, seed, ch2.Passphrase, ch2.KeyIndex)
+		settleWithGuestSig, err = detachedSig(settleWithGuestTx.TX, signer, ch2.Passphrase, ch2.KeyIndex)
 		if err != nil {
 			return nil, err
 		}
@@ -217,7 +219,7 @@ func createPaymentProposeMsg(seed []byte, ch *Channel) (*Message, error) {
 		if err != nil {
 			return nil, err
 		}
-		settleWithHostSig, err = detachedSig(settleWithHostTx.TX, seed, ch2.Passphrase, ch2.KeyIndex)
+		settleWithHostSig, err = detachedSig(settleWithHostTx.TX, signer, ch2.Passphrase, ch2.KeyIndex)
 		if err != nil {
 			return nil, err
 		}
@@ -234,11 +236,11 @@ func createPaymentProposeMsg(seed []byte, ch *Channel) (*Message, error) {
 		Version: version,
 		MsgNum:  ch.LastMsgIndex + 1,
 	}
-	return m.signMsg(seed)
+	return m.signMsg(signer)
 }
 
-func sendPaymentProposeMsg(seed []byte, ch *Channel, o Outputter) error {
-	m, err := createPaymentProposeMsg(seed, ch)
+func sendPaymentProposeMsg(signer key.Signer, ch *Channel, o Outputter) error {
+	m, err := createPaymentProposeMsg(signer, ch)
 	if err != nil {
 		return err
 	}
@@ -246,7 +248,7 @@ func sendPaymentProposeMsg(seed []byte, ch *Channel, o Outputter) error {
 	return nil
 }
 
-func createPaymentAcceptMsg(seed []byte, ch *Channel) (*Message, error) {
+func createPaymentAcceptMsg(signer key.Signer, ch *Channel) (*Message, error) {
 	var ratchetAccount AccountID
 	var ratchetSeqNum xdr.SequenceNumber
 	switch ch.Role {
@@ -261,7 +263,7 @@ func createPaymentAcceptMsg(seed []byte, ch *Channel) (*Message, error) {
 	if err != nil {
 		return nil, err
 	}
-	ratchetTxSig, err := detachedSig(ratchetTx.TX, seed, ch.Passphrase, ch.KeyIndex)
+	ratchetTxSig, err := detachedSig(ratchetTx.TX, signer, ch.Passphrase, ch.KeyIndex)
 	if err != nil {
 		return nil, err
 	}
@@ -278,13 +280,13 @@ func createPaymentAcceptMsg(seed []byte, ch *Channel) (*Message, error) {
 	var settleWithGuestSig *xdr.DecoratedSignature
 	if guestAmount != 0 {
 		settleWithGuestSig = new(xdr.DecoratedSignature)
-		*settleWithGuestSig, err = detachedSig(&ch.CounterpartyLatestSettleWithGuestTx.Tx, seed, ch.Passphrase, ch.KeyIndex)
+		*settleWithGuestSig, err = detachedSig(&ch.CounterpartyLatestSettleWithGuestTx.Tx, signer, ch.Passphrase, ch.KeyIndex)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	settleWithHostSig, err := detachedSig(&ch.CounterpartyLatestSettleWithHostTx.Tx, seed, ch.Passphrase, ch.KeyIndex)
+	settleWithHostSig, err := detachedSig(&ch.CounterpartyLatestSettleWithHostTx.Tx, signer, ch.Passphrase, ch.KeyIndex)
 	if err != nil {
 		return nil, err
 	}
@@ -299,11 +301,11 @@ func createPaymentAcceptMsg(seed []byte, ch *Channel) (*Message, error) {
 		Version: version,
 		MsgNum:  ch.LastMsgIndex + 1,
 	}
-	return m.signMsg(seed)
+	return m.signMsg(signer)
 }
 
-func sendPaymentAcceptMsg(seed []byte, ch *Channel, o Outputter) error {
-	m, err := createPaymentAcceptMsg(seed, ch)
+func sendPaymentAcceptMsg(signer key.Signer, ch *Channel, o Outputter) error {
+	m, err := createPaymentAcceptMsg(signer, ch)
 	if err != nil {
 		return err
 	}
@@ -311,12 +313,12 @@ func sendPaymentAcceptMsg(seed []byte, ch *Channel, o Outputter) error {
 	return nil
 }
 
-func createChannelAcceptMsg(seed []byte, ch *Channel, ledgerTime time.Time) (*Message, error) {
+func createChannelAcceptMsg(signer key.Signer, ch *Channel, ledgerTime time.Time) (*Message, error) {
 	settleOnlyWithHostTx, err := buildSettleOnlyWithHostTx(ch, ch.FundingTime)
 	if err != nil {
 		return nil, err
 	}
-	settleOnlyWithHostSig, err := detachedSig(settleOnlyWithHostTx.TX, seed, ch.Passphrase, ch.KeyIndex)
+	settleOnlyWithHostSig, err := detachedSig(settleOnlyWithHostTx.TX, signer, ch.Passphrase, ch.KeyIndex)
 	if err != nil {
 		return nil, err
 	}
@@ -324,7 +326,7 @@ func createChannelAcceptMsg(seed []byte, ch *Channel, ledgerTime time.Time) (*Me
 	if err != nil {
 		return nil, err
 	}
-	ratchetTxSig, err := detachedSig(ratchetTx.TX, seed, ch.Passphrase, ch.KeyIndex)
+	ratchetTxSig, err := detachedSig(ratchetTx.TX, signer, ch.Passphrase, ch.KeyIndex)
 	if err != nil {
 		return nil, err
 	}
@@ -337,11 +339,11 @@ func createChannelAcceptMsg(seed []byte, ch *Channel, ledgerTime time.Time) (*Me
 		Version: version,
 		MsgNum:  ch.LastMsgIndex + 1,
 	}
-	return m.signMsg(seed)
+	return m.signMsg(signer)
 }
 
-func sendChannelAcceptMsg(seed []byte, ch *Channel, o Outputter, ledgerTime time.Time) error {
-	m, err := createChannelAcceptMsg(seed, ch, ledgerTime)
+func sendChannelAcceptMsg(signer key.Signer, ch *Channel, o Outputter, ledgerTime time.Time) error {
+	m, err := createChannelAcceptMsg(signer, ch, ledgerTime)
 	if err != nil {
 		return err
 	}
@@ -349,12 +351,12 @@ func sendChannelAcceptMsg(seed []byte, ch *Channel, o Outputter, ledgerTime time
 	return nil
 }
 
-func createCloseMsg(seed []byte, ch *Channel) (*Message, error) {
+func createCloseMsg(signer key.Signer, ch *Channel) (*Message, error) {
 	coopCloseTx, err := buildCooperativeCloseTx(ch)
 	if err != nil {
 		return nil, err
 	}
-	coopCloseSig, err := detachedSig(coopCloseTx.TX, seed, ch.Passphrase, ch.KeyIndex)
+	coopCloseSig, err := detachedSig(coopCloseTx.TX, signer, ch.Passphrase, ch.KeyIndex)
 	if err != nil {
 		return nil, err
 	}
@@ -366,11 +368,11 @@ func createCloseMsg(seed []byte, ch *Channel) (*Message, error) {
 		Version: version,
 		MsgNum:  ch.LastMsgIndex + 1,
 	}
-	return m.signMsg(seed)
+	return m.signMsg(signer)
 }
 
-func sendCloseMsg(seed []byte, ch *Channel, o Outputter) error {
-	m, err := createCloseMsg(seed, ch)
+func sendCloseMsg(signer key.Signer, ch *Channel, o Outputter) error {
+	m, err := createCloseMsg(signer, ch)
 	if err != nil {
 		return err
 	}
@@ -35,13 +35,13 @@ func (u *Updater) transitionTo(newState State) error {
 	case AwaitingCleanup:
 		// Charge cleanup tx fees.
 		u.H.NativeBalance -= 3 * u.C.HostFeerate
-		return publishCleanupTx(u.Seed, u.C, u.O, u.H)
+		return publishCleanupTx(u.Signer, u.C, u.O, u.H)
 
 	case AwaitingClose:
 		if u.C.CounterpartyCoopCloseSig.Signature != nil {
-			return publishCoopCloseTx(u.Seed, u.C, u.O, u.H)
+			return publishCoopCloseTx(u.Signer, u.C, u.O, u.H)
 		}
-		return sendCloseMsg(u.Seed, u.C, u.O)
+		return sendCloseMsg(u.Signer, u.C, u.O)
 
 	case AwaitingFunding:
 		switch u.C.Role {
@@ -49,14 +49,14 @@ func (u *Updater) transitionTo(newState State) error {
 			if u.C.PrevState != Start {
 				return ErrUnexpectedState
 			}
-			err := sendChannelAcceptMsg(u.Seed, u.C, u.O, u.LedgerTime)
+			err := sendChannelAcceptMsg(u.Signer, u.C, u.O, u.LedgerTime)
 			if err != nil {
 				return err
 			}
 			// timer gets set
 
 		case Host:
-			return publishFundingTx(u.Seed, u.C, u.O, u.H)
+			return publishFundingTx(u.Signer, u.C, u.O, u.H)
 		}
 
 	case AwaitingPaymentMerge:
@@ -75,7 +75,7 @@ func (u *Updater) transitionTo(newState State) error {
 		// timer gets set
 
 	case ChannelProposed:
-		return sendChannelProposeMsg(u.Seed, u.C, u.O, u.H)
+		return sendChannelProposeMsg(u.Signer, u.C, u.O, u.H)
 
 	case Closed:
 		return nil // nothing to do
@@ -84,21 +84,21 @@ func (u *Updater) transitionTo(newState State) error {
 		switch u.C.PrevState {
 		case Open:
 			if u.C.TopUpAmount != 0 && u.C.Role == Host {
-				return publishTopUpTx(u.Seed, u.C, u.O, u.H)
+				return publishTopUpTx(u.Signer, u.C, u.O, u.H)
 			}
 
 		case PaymentProposed:
-			return sendPaymentCompleteMsg(u.Seed, u.C, u.O)
+			return sendPaymentCompleteMsg(u.Signer, u.C, u.O)
 		}
 
 	case PaymentAccepted:
-		return sendPaymentAcceptMsg(u.Seed, u.C, u.O)
+		return sendPaymentAcceptMsg(u.Signer, u.C, u.O)
 
 	case PaymentProposed:
-		return sendPaymentProposeMsg(u.Seed, u.C, u.O)
+		return sendPaymentProposeMsg(u.Signer, u.C, u.O)
 
 	case SettingUp:
-		return publishSetupAccountTxes(u.Seed, u.C, u.O, u.H)
+		return publishSetupAccountTxes(u.Signer, u.C, u.O, u.H)
 	}
 	return nil
 }
@@ -5,7 +5,6 @@ import (
 
 	b "github.com/stellar/go/build"
 	"github.com/stellar/go/keypair"
-	"github.com/stellar/go/network"
 	"github.com/stellar/go/xdr"
 
 	"github.com/interstellar/starlight/errors"
@@ -29,21 +28,21 @@ var txHandlerFuncs = []func(*Updater, *worizon.Tx, bool) (bool, error){
 func handleSetupAccountTx(u *Updater, tx *worizon.Tx, success bool) (bool, error) {
 	// ignore the first two SetupAccountTxs
 	if txMatches(tx, u.C.HostAcct,
-		createAccountOp(u.C.HostAcct, u.C.HostRatchetAcct, xlm.Lumen),
+		createAccountOp(u.C.HostAcct, u.C.HostRatchetAcct, 2*u.C.baseReserve()),
 	) || txMatches(tx, u.C.HostAcct,
-		createAccountOp(u.C.HostAcct, u.C.GuestRatchetAcct, xlm.Lumen),
+		createAccountOp(u.C.HostAcct, u.C.GuestRatchetAcct, 2*u.C.baseReserve()),
 	) {
 		return true, nil
 	}
 	if !txMatches(tx, u.C.HostAcct,
-		createAccountOp(u.C.HostAcct, u.C.EscrowAcct, xlm.Lumen),
+		createAccountOp(u.C.HostAcct, u.C.EscrowAcct, 2*u.C.baseReserve()),
 	) {
 		return false, nil
 	}
 
 	if !success {
-		// unreserve the HostAccount's one lumen
-		u.H.NativeBalance += xlm.Lumen
+		// unreserve the escrow account's starting balance
+		u.H.NativeBalance += 2 * u.C.baseReserve()
 	}
 
 	if u.C.Role == Guest && u.C.State == AwaitingFunding {
@@ -71,7 +70,7 @@ var (
 // MatchesFundingTx reports whether a transaction is the funding transaction for the channel.
 func MatchesFundingTx(c *Channel, tx *worizon.Tx) bool {
 	return txMatches(tx, c.HostAcct,
-		paymentOp(c.HostAcct, c.EscrowAcct, c.HostAmount+500*xlm.Millilumen+8*c.ChannelFeerate),
+		paymentOp(c.HostAcct, c.EscrowAcct, c.HostAmount+c.baseReserve()+8*c.ChannelFeerate),
 		xdr.Operation{
 			SourceAccount: c.EscrowAcct.XDR(),
 			Body: xdr.OperationBody{
@@ -90,7 +89,7 @@ func MatchesFundingTx(c *Channel, tx *worizon.Tx) bool {
 				},
 			},
 		},
-		paymentOp(c.HostAcct, c.GuestRatchetAcct, xlm.Lumen+c.ChannelFeerate),
+		paymentOp(c.HostAcct, c.GuestRatchetAcct, 2*c.baseReserve()+c.ChannelFeerate),
 		xdr.Operation{
 			SourceAccount: c.GuestRatchetAcct.XDR(),
 			Body: xdr.OperationBody{
@@ -125,7 +124,7 @@ func MatchesFundingTx(c *Channel, tx *worizon.Tx) bool {
 				},
 			},
 		},
-		paymentOp(c.HostAcct, c.HostRatchetAcct, 500*xlm.Millilumen+c.ChannelFeerate),
+		paymentOp(c.HostAcct, c.HostRatchetAcct, c.baseReserve()+c.ChannelFeerate),
 		xdr.Operation{
 			SourceAccount: c.HostRatchetAcct.XDR(),
 			Body: xdr.OperationBody{
@@ -473,25 +472,16 @@ func verifySig(tx *b.TransactionBuilder, pubkey keypair.KP, signature xdr.Decora
 	return pubkey.Verify(hash[:], signature.Signature)
 }
 
-func txSig(tx *b.TransactionBuilder, seed []byte, indices ...uint32) (b.TransactionEnvelopeBuilder, error) {
-	if seed == nil {
+func txSig(tx *b.TransactionBuilder, signer key.Signer, indices ...uint32) (b.TransactionEnvelopeBuilder, error) {
+	if signer == nil {
 		return b.TransactionEnvelopeBuilder{}, errNoSeed
 	}
-	var secrets []string
-	for _, index := range indices {
-		secrets = append(secrets, key.DeriveAccount(seed, index).Seed())
-	}
-	return tx.Sign(secrets...)
+	return key.SignEnvelope(signer, tx, indices...)
 }
 
-func detachedSig(tx *xdr.Transaction, seed []byte, passphrase string, i uint32) (xdr.DecoratedSignature, error) {
-	if seed == nil {
+func detachedSig(tx *xdr.Transaction, signer key.Signer, passphrase string, i uint32) (xdr.DecoratedSignature, error) {
+	if signer == nil {
 		return xdr.DecoratedSignature{}, errNoSeed
 	}
-	txhash, err := network.HashTransaction(tx, passphrase)
-	if err != nil {
-		return xdr.DecoratedSignature{}, err
-	}
-	kp := key.DeriveAccount(seed, i)
-	return kp.SignDecorated(txhash[:])
+	return signer.SignTx(tx, passphrase, i)
 }
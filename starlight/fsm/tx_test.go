@@ -183,7 +183,7 @@ func TestHandleRatchetTx(t *testing.T) {
 		C:          ch,
 		O:          ono{},
 		LedgerTime: now,
-		Seed:       []byte(seed),
+		Signer:     key.SeedSigner(seed),
 	}
 	ok, err := handleRatchetTx(u, tx, true)
 	if err != nil {
@@ -305,10 +305,10 @@ func TestUpdateFailedSetupAccountTx(t *testing.T) {
 	}
 	h := createTestHost()
 	u := &Updater{
-		C:    ch,
-		O:    ono{},
-		H:    h,
-		Seed: []byte(seed),
+		C:      ch,
+		O:      ono{},
+		H:      h,
+		Signer: key.SeedSigner(seed),
 	}
 	err = u.transitionTo(SettingUp)
 	if err != nil {
@@ -346,10 +346,10 @@ func TestUpdateFailedFundingTx(t *testing.T) {
 	}
 	h := createTestHost()
 	u := &Updater{
-		C:    ch,
-		O:    ono{},
-		H:    h,
-		Seed: []byte(seed),
+		C:      ch,
+		O:      ono{},
+		H:      h,
+		Signer: key.SeedSigner(seed),
 	}
 	err = u.transitionTo(AwaitingFunding)
 	if err != nil {
@@ -395,10 +395,10 @@ func TestUpdateFailedRatchetTx(t *testing.T) {
 	}
 	h := createTestHost()
 	u := &Updater{
-		C:    ch,
-		O:    ono{},
-		H:    h,
-		Seed: []byte(seed),
+		C:      ch,
+		O:      ono{},
+		H:      h,
+		Signer: key.SeedSigner(seed),
 	}
 	err = u.transitionTo(AwaitingFunding)
 	if err != nil {
@@ -482,7 +482,7 @@ func TestDetachedSig(t *testing.T) {
 	xdr.SafeUnmarshalBase64(builderB64, &builder)
 	var wantDecSig xdr.DecoratedSignature
 	xdr.SafeUnmarshalBase64(sigB64, &wantDecSig)
-	gotDecSig, err := detachedSig(builder.TX, []byte(seed), ch.Passphrase, 0)
+	gotDecSig, err := detachedSig(builder.TX, key.SeedSigner(seed), ch.Passphrase, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -499,7 +499,7 @@ func TestDetachedSig(t *testing.T) {
 	if err == nil {
 		t.Fatal("detachedSig returned ok on nil seed")
 	}
-	gotDecSig, err = detachedSig(builder.TX, []byte(seed), ch.Passphrase, 1)
+	gotDecSig, err = detachedSig(builder.TX, key.SeedSigner(seed), ch.Passphrase, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -519,7 +519,7 @@ func TestTxSig(t *testing.T) {
 	if err == nil {
 		t.Fatal("txSig returned ok on nil seed")
 	}
-	env, err := txSig(&builder, []byte(seed), 0)
+	env, err := txSig(&builder, key.SeedSigner(seed), 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -545,7 +545,7 @@ func TestVerifyTxSig(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	eb, err := txSig(builder, testSeed, 0)
+	eb, err := txSig(builder, key.SeedSigner(testSeed), 0)
 	if err != nil {
 		t.Fatal(err)
 	}
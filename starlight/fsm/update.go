@@ -8,7 +8,9 @@ import (
 	"github.com/stellar/go/xdr"
 
 	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/key"
 	"github.com/interstellar/starlight/worizon"
+	"github.com/interstellar/starlight/worizon/xlm"
 )
 
 // Updater contains the state necessary to effect a state transition in a channel.
@@ -16,10 +18,14 @@ type Updater struct {
 	C          *Channel
 	O          Outputter
 	H          *WalletAcct
-	Seed       []byte
+	Signer     key.Signer
 	LedgerTime time.Time
 	Passphrase string
 
+	// BaseReserve is the network's base reserve,
+	// recorded in new channels.
+	BaseReserve xlm.Amount
+
 	debug bool
 }
 
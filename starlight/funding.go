@@ -0,0 +1,255 @@
+package starlight
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	b "github.com/stellar/go/build"
+	"github.com/stellar/go/keypair"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/net"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/keyfile"
+	"github.com/interstellar/starlight/starlight/internal/update"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+// A FundingSource gets a newly configured agent's
+// wallet account created on the ledger.
+// See WithFunding.
+//
+// Unless another source is in use,
+// the agent asks the friendbot in its configuration.
+//
+// The set of sources is closed:
+// use Friendbot, Sponsor, SponsorFile, or ExternalFunding.
+type FundingSource interface {
+	// fund makes one attempt to get acct created,
+	// returning nil once it exists.
+	// The agent retries with backoff until it succeeds.
+	fund(g *Agent, acct string) error
+
+	// String describes the source in warnings.
+	String() string
+}
+
+// Friendbot returns a FundingSource
+// that asks the friendbot at url,
+// such as https://friendbot.stellar.org/,
+// to create and fund the account.
+func Friendbot(url string) FundingSource {
+	return friendbot(url)
+}
+
+type friendbot string
+
+func (f friendbot) String() string {
+	return "friendbot at " + string(f)
+}
+
+func (f friendbot) fund(g *Agent, acct string) error {
+	faucetURL := string(f) + "?addr=" + acct
+	resp, err := g.httpclient.Get(faucetURL)
+	if err != nil {
+		return err
+	}
+	if resp.Body != nil {
+		defer resp.Body.Close()
+	}
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	var v struct {
+		Detail      string
+		ResultCodes json.RawMessage `json:"result_codes"`
+	}
+	jErr := json.NewDecoder(resp.Body).Decode(&v)
+	if jErr != nil {
+		return fmt.Errorf("bad http status %d from faucet at %s", resp.StatusCode, faucetURL)
+	}
+	return fmt.Errorf("faucet at %s: %s (%s); http status %d", faucetURL, v.Detail, v.ResultCodes, resp.StatusCode)
+}
+
+// Sponsor returns a FundingSource
+// that creates the account with amount lumens
+// from the sponsor account whose secret seed
+// (a strkey beginning with S) is seed.
+// The sponsor account pays the transaction fee.
+func Sponsor(seed string, amount xlm.Amount) (FundingSource, error) {
+	kp, err := keypair.Parse(seed)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing sponsor seed")
+	}
+	full, ok := kp.(*keypair.Full)
+	if !ok {
+		return nil, errors.New("sponsor key is not a secret seed")
+	}
+	return &sponsor{kp: full, amount: amount}, nil
+}
+
+// SponsorFile is like Sponsor,
+// but reads the sponsor's secret seed from the file at path.
+// Trailing whitespace in the file is ignored.
+// The file must not be accessible to group or other users.
+func SponsorFile(path string, amount xlm.Amount) (FundingSource, error) {
+	seed, err := keyfile.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	return Sponsor(seed, amount)
+}
+
+type sponsor struct {
+	kp     *keypair.Full
+	amount xlm.Amount
+}
+
+func (s *sponsor) String() string {
+	return "sponsor account " + s.kp.Address()
+}
+
+func (s *sponsor) fund(g *Agent, acct string) error {
+	// An earlier attempt may have succeeded
+	// without our hearing about it.
+	exists, err := g.accountExists(acct)
+	if err != nil || exists {
+		return err
+	}
+	var (
+		passphrase string
+		feerate    xlm.Amount
+	)
+	db.View(g.db, func(root *db.Root) error {
+		passphrase = g.passphrase(root)
+		feerate = xlm.Amount(root.Agent().Config().HostFeerate())
+		return nil
+	})
+	seqnum, err := g.wclient.SequenceForAccount(s.kp.Address())
+	if err != nil {
+		return errors.Wrap(err, "getting sponsor sequence number")
+	}
+	btx, err := b.Transaction(
+		b.Network{Passphrase: passphrase},
+		b.SourceAccount{AddressOrSeed: s.kp.Address()},
+		b.Sequence{Sequence: uint64(seqnum) + 1},
+		b.BaseFee{Amount: uint64(feerate)},
+		b.CreateAccount(
+			b.Destination{AddressOrSeed: acct},
+			b.NativeAmount{Amount: s.amount.HorizonString()},
+		),
+	)
+	if err != nil {
+		return err
+	}
+	env, err := btx.Sign(s.kp.Seed())
+	if err != nil {
+		return err
+	}
+	envStr, err := env.Base64()
+	if err != nil {
+		return err
+	}
+	_, err = g.wclient.SubmitTx(envStr)
+	return errors.Wrap(err, "submitting sponsor tx")
+}
+
+// ExternalFunding returns a FundingSource
+// that waits for someone else to create the account,
+// for example by sending lumens to it from another wallet.
+func ExternalFunding() FundingSource {
+	return externalFunding{}
+}
+
+type externalFunding struct{}
+
+func (externalFunding) String() string {
+	return "an external payment"
+}
+
+func (externalFunding) fund(g *Agent, acct string) error {
+	exists, err := g.accountExists(acct)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errNotFunded
+	}
+	return nil
+}
+
+// WithFunding makes the agent get its wallet account
+// created by s, instead of by the friendbot in its configuration.
+func WithFunding(s FundingSource) Option {
+	return func(g *Agent) {
+		g.funding = s
+	}
+}
+
+// fundingSource returns the source of funds for the wallet account,
+// or nil if there is none.
+// Must be called from within a transaction.
+func (g *Agent) fundingSource(root *db.Root) FundingSource {
+	if g.funding != nil {
+		return g.funding
+	}
+	if u := root.Agent().Config().FriendbotURL(); u != "" {
+		return Friendbot(u)
+	}
+	if root.Agent().Config().NetworkPassphrase() == "" {
+		return Friendbot(testnetFriendbotURL) // configured before the network was
+	}
+	return nil
+}
+
+// fundWallet gets the wallet account acctID created
+// by the agent's funding source
+// and then closes g.wallet.
+// Funding sources are not 100% reliable
+// (the friendbot often times out),
+// so this tries indefinitely with backoff until success.
+func (g *Agent) fundWallet(acctID fsm.AccountID) {
+	backoff := &net.Backoff{Base: 100 * time.Millisecond}
+	acctIDStr := acctID.Address()
+
+	for counter := 0; ; counter++ {
+		var src FundingSource
+		db.View(g.db, func(root *db.Root) error {
+			src = g.fundingSource(root)
+			return nil
+		})
+		if counter == 1 {
+			warning := "no funding source for the wallet account, will retry until there is one"
+			if src != nil {
+				warning = fmt.Sprintf("wallet account not yet funded by %s, will retry until successful", src)
+			}
+			db.Update(g.db, func(root *db.Root) error {
+				g.putUpdate(root, &Update{
+					Type:    update.WarningType,
+					Warning: warning,
+				})
+				return nil
+			})
+		}
+
+		err := errors.New("no funding source")
+		if src != nil {
+			err = src.fund(g, acctIDStr)
+		}
+		if err != nil {
+			dur := backoff.Next()
+			g.debugf("funding %s failed, will retry in %s: %s", acctIDStr, dur, err)
+			g.sleep(dur)
+			if g.rootCtx.Err() != nil {
+				return
+			}
+			continue
+		}
+		close(g.wallet)
+		return
+	}
+}
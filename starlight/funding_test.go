@@ -0,0 +1,99 @@
+package starlight
+
+import (
+	"testing"
+
+	"github.com/stellar/go/clients/horizon"
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/key"
+	"github.com/interstellar/starlight/worizon/worizontest"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+func TestSponsorFunding(t *testing.T) {
+	sponsorKP := key.DeriveAccount([]byte("sponsor"), 0)
+	acct := key.DeriveAccount([]byte("wallet"), 0).Address()
+	fake := &worizontest.FakeHorizonClient{
+		Accounts: map[string]horizon.Account{sponsorKP.Address(): {}},
+	}
+	g, closer := startTestAgent(t, withFakeHorizon(fake))
+	defer closer()
+
+	if _, err := Sponsor(sponsorKP.Address(), xlm.Lumen); err == nil {
+		t.Error("got no error for a sponsor address, want error")
+	}
+	src, err := Sponsor(sponsorKP.Seed(), 100*xlm.Lumen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = src.fund(g, acct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envs := fake.TransactionEnvelopes()
+	if len(envs) != 1 {
+		t.Fatalf("got %d submitted txs, want 1", len(envs))
+	}
+	var env xdr.TransactionEnvelope
+	err = xdr.SafeUnmarshalBase64(envs[0], &env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := env.Tx.SourceAccount.Address(); got != sponsorKP.Address() {
+		t.Errorf("got source account %s, want sponsor %s", got, sponsorKP.Address())
+	}
+	op, ok := env.Tx.Operations[0].Body.GetCreateAccountOp()
+	if !ok || op.Destination.Address() != acct || xlm.Amount(op.StartingBalance) != 100*xlm.Lumen {
+		t.Errorf("got op %+v, want create account %s with 100 XLM", env.Tx.Operations[0].Body, acct)
+	}
+
+	// Once the account exists, there's nothing to submit.
+	fake.Accounts[acct] = horizon.Account{}
+	err = src.fund(g, acct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.TransactionEnvelopes()); n != 1 {
+		t.Errorf("got %d submitted txs, want 1", n)
+	}
+}
+
+func TestExternalFunding(t *testing.T) {
+	acct := key.DeriveAccount([]byte("wallet"), 0).Address()
+	fake := &worizontest.FakeHorizonClient{
+		Accounts: map[string]horizon.Account{},
+	}
+	g, closer := startTestAgent(t, withFakeHorizon(fake))
+	defer closer()
+
+	src := ExternalFunding()
+	if err := src.fund(g, acct); errors.Root(err) != errNotFunded {
+		t.Errorf("got error %v, want %s", err, errNotFunded)
+	}
+	fake.Accounts[acct] = horizon.Account{}
+	if err := src.fund(g, acct); err != nil {
+		t.Errorf("got error %s after funding", err)
+	}
+}
+
+func TestConfigInitFundingSource(t *testing.T) {
+	fake := &worizontest.FakeHorizonClient{
+		Accounts: map[string]horizon.Account{},
+	}
+	g, closer := startTestAgent(t, withFakeHorizon(fake), WithFunding(ExternalFunding()))
+	defer closer()
+
+	// The standalone network has no friendbot,
+	// but the wallet account can still be funded externally.
+	err := g.ConfigInit(&Config{
+		Username:          "alice",
+		Password:          "password",
+		HorizonURL:        testStandaloneURL,
+		NetworkPassphrase: testStandalonePassphrase,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
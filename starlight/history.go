@@ -0,0 +1,289 @@
+package starlight
+
+import (
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/update"
+)
+
+// defaultQueryLimit is the page size used when
+// UpdateQuery.Limit is not set.
+const defaultQueryLimit = 100
+
+// maxQueryLimit is the largest page size QueryUpdates returns;
+// a larger UpdateQuery.Limit is lowered to it.
+const maxQueryLimit = 1000
+
+// UpdateQuery selects updates from an agent's update log.
+// Each non-zero field narrows the result.
+type UpdateQuery struct {
+	ChannelID    string `json:",omitempty"`
+	Type         string `json:",omitempty"`
+	Command      string `json:",omitempty"` // fsm.CommandName of InputCommand
+	Counterparty string `json:",omitempty"` // account ID or Stellar address
+
+	// Start and End bound the UpdateLedgerTime
+	// of the selected updates to the half-open interval
+	// [Start, End).
+	Start time.Time `json:",omitempty"`
+	End   time.Time `json:",omitempty"`
+
+	// Cursor resumes a previous query;
+	// set it to the Cursor of the previous UpdatePage.
+	Cursor uint64 `json:",omitempty"`
+
+	// Limit is the maximum number of updates to return.
+	// Defaults to 100, and is at most 1000.
+	Limit int `json:",omitempty"`
+}
+
+// UpdatePage is one page of results from QueryUpdates.
+type UpdatePage struct {
+	Updates []*Update
+
+	// Cursor, if non-zero, is the cursor
+	// for the next page of results.
+	Cursor uint64 `json:",omitempty"`
+}
+
+// QueryUpdates returns, in order, the updates selected by q.
+func (g *Agent) QueryUpdates(q *UpdateQuery) (*UpdatePage, error) {
+	if q.Limit < 0 {
+		return nil, errors.Wrap(errInvalidInput, "negative limit")
+	}
+	if !q.End.IsZero() && q.End.Before(q.Start) {
+		return nil, errors.Wrap(errInvalidInput, "end before start")
+	}
+	limit := q.Limit
+	if limit == 0 {
+		limit = defaultQueryLimit
+	}
+	if limit > maxQueryLimit {
+		limit = maxQueryLimit
+	}
+
+	page := &UpdatePage{
+		Updates: make([]*Update, 0), // we want json "[]" not "null"
+	}
+	err := db.View(g.db, func(root *db.Root) error {
+		updates := root.Agent().Updates()
+		if updates.Bucket() == nil {
+			return nil
+		}
+
+		// Scan the smallest applicable set of update numbers.
+		// Updates in it are checked against the full query.
+		bu := updates.Bucket()
+		index := root.Agent().UpdateIndex()
+		switch {
+		case q.ChannelID != "":
+			bu = index.Channel().GetByString(q.ChannelID).Bucket()
+		case q.Counterparty != "":
+			bu = index.Counterparty().GetByString(q.Counterparty).Bucket()
+		case q.Command != "":
+			bu = index.Command().GetByString(q.Command).Bucket()
+		case q.Type != "":
+			bu = index.Type().GetByString(q.Type).Bucket()
+		}
+		if bu == nil {
+			return nil
+		}
+
+		from := q.Cursor + 1
+		if !q.Start.IsZero() {
+			// Update ledger times never decrease,
+			// so the log is sorted by time as well as number.
+			// Archiving can leave gaps;
+			// each probe uses the first update at or after i.
+			last := updates.Bucket().Sequence()
+			c := updates.Bucket().Cursor()
+			n := uint64(sort.Search(int(last), func(i int) bool {
+				k := make([]byte, 8)
+				binary.BigEndian.PutUint64(k, uint64(i+1))
+				k, _ = c.Seek(k)
+				if k == nil {
+					return true
+				}
+				ev := updates.Get(binary.BigEndian.Uint64(k))
+				return !ev.UpdateLedgerTime.Before(q.Start)
+			})) + 1
+			if n > from {
+				from = n
+			}
+		}
+
+		c := bu.Cursor()
+		k := make([]byte, 8)
+		binary.BigEndian.PutUint64(k, from)
+		for k, _ = c.Seek(k); k != nil; k, _ = c.Next() {
+			n := binary.BigEndian.Uint64(k)
+			ev := updates.Get(n)
+			if !q.End.IsZero() && !ev.UpdateLedgerTime.Before(q.End) {
+				break
+			}
+			if !q.matches(ev) {
+				continue
+			}
+			if len(page.Updates) == limit {
+				page.Cursor = page.Updates[limit-1].UpdateNum
+				break
+			}
+			page.Updates = append(page.Updates, ev)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (q *UpdateQuery) matches(ev *Update) bool {
+	keys := indexKeys(ev)
+	if q.ChannelID != "" && keys.channel != q.ChannelID {
+		return false
+	}
+	if q.Type != "" && keys.typ != q.Type {
+		return false
+	}
+	if q.Command != "" && keys.command != q.Command {
+		return false
+	}
+	if q.Counterparty != "" {
+		found := false
+		for _, cp := range keys.counterparties {
+			found = found || cp == q.Counterparty
+		}
+		if !found {
+			return false
+		}
+	}
+	if !q.Start.IsZero() && ev.UpdateLedgerTime.Before(q.Start) {
+		return false
+	}
+	return true
+}
+
+type updateKeys struct {
+	channel, typ, command string
+	counterparties        []string
+}
+
+// indexKeys returns the values under which ev is indexed.
+func indexKeys(ev *Update) *updateKeys {
+	keys := &updateKeys{typ: string(ev.Type)}
+	var self string
+	if ev.Account != nil {
+		self = ev.Account.ID
+	}
+	addCounterparty := func(addr string) {
+		if addr == "" || addr == self {
+			return
+		}
+		for _, cp := range keys.counterparties {
+			if cp == addr {
+				return
+			}
+		}
+		keys.counterparties = append(keys.counterparties, addr)
+	}
+
+	if ev.InputCommand != nil {
+		keys.command = string(ev.InputCommand.Name)
+		addCounterparty(ev.InputCommand.Recipient)
+		for _, p := range ev.InputCommand.Payments {
+			addCounterparty(p.Recipient)
+		}
+	}
+	if c := ev.Channel; c != nil {
+		keys.channel = c.ID
+		addCounterparty(c.CounterpartyAddress)
+		self = c.HostAcct.Address()
+		if c.Role == fsm.Guest {
+			self = c.GuestAcct.Address()
+			addCounterparty(c.HostAcct.Address())
+		} else {
+			addCounterparty(c.GuestAcct.Address())
+		}
+	}
+	if ev.InputTx != nil && ev.InputTx.Env != nil && ev.Type == update.AccountType {
+		tx := &ev.InputTx.Env.Tx
+		if ev.OpIndex < len(tx.Operations) {
+			op := tx.Operations[ev.OpIndex]
+			if op.SourceAccount != nil {
+				addCounterparty(op.SourceAccount.Address())
+			} else {
+				addCounterparty(tx.SourceAccount.Address())
+			}
+			addCounterparty(opDestination(op))
+		}
+	}
+	return keys
+}
+
+// opDestination returns the account credited by op,
+// if there is one.
+func opDestination(op xdr.Operation) string {
+	switch op.Body.Type {
+	case xdr.OperationTypeCreateAccount:
+		return op.Body.CreateAccountOp.Destination.Address()
+	case xdr.OperationTypePayment:
+		return op.Body.PaymentOp.Destination.Address()
+	case xdr.OperationTypeAccountMerge:
+		return op.Body.Destination.Address()
+	}
+	return ""
+}
+
+// indexUpdate adds ev to the update indexes.
+func indexUpdate(root *db.Root, ev *Update) error {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, ev.UpdateNum)
+
+	index := root.Agent().UpdateIndex()
+	keys := indexKeys(ev)
+	sets := []*db.UpdateSet{index.Type().GetByString(keys.typ)}
+	if keys.channel != "" {
+		sets = append(sets, index.Channel().GetByString(keys.channel))
+	}
+	if keys.command != "" {
+		sets = append(sets, index.Command().GetByString(keys.command))
+	}
+	for _, cp := range keys.counterparties {
+		sets = append(sets, index.Counterparty().GetByString(cp))
+	}
+	for _, set := range sets {
+		err := set.Bucket().Put(k, []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	index.PutLastIndexed(ev.UpdateNum)
+	return nil
+}
+
+// reindexUpdates adds to the update indexes
+// any updates that are not yet in them,
+// such as those recorded before the indexes existed.
+func reindexUpdates(root *db.Root) error {
+	updates := root.Agent().Updates()
+	last := updates.Bucket().Sequence()
+	for n := root.Agent().UpdateIndex().LastIndexed() + 1; n <= last; n++ {
+		ev := updates.Get(n)
+		if ev.UpdateNum == 0 {
+			continue // not present
+		}
+		err := indexUpdate(root, ev)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
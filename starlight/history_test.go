@@ -0,0 +1,103 @@
+package starlight
+
+import (
+	"testing"
+	"time"
+
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/update"
+)
+
+func TestQueryUpdates(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Updates 2 through 7 alternate between two channels.
+	err = db.Update(g.db, func(root *db.Root) error {
+		for i := 0; i < 6; i++ {
+			ch := &fsm.Channel{ID: "chan1", CounterpartyAddress: "bob*starlight.com"}
+			if i%2 == 1 {
+				ch = &fsm.Channel{ID: "chan2", CounterpartyAddress: "carol*starlight.com"}
+			}
+			ev := &Update{
+				Type:    update.ChannelType,
+				Channel: ch,
+			}
+			if i == 4 {
+				ev.InputCommand = &fsm.Command{Name: fsm.ChannelPay}
+			}
+			g.putUpdate(root, ev)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		q    UpdateQuery
+		want []uint64
+		next uint64
+	}{
+		{"all", UpdateQuery{}, []uint64{1, 2, 3, 4, 5, 6, 7}, 0},
+		{"type", UpdateQuery{Type: "init"}, []uint64{1}, 0},
+		{"channel", UpdateQuery{ChannelID: "chan1"}, []uint64{2, 4, 6}, 0},
+		{"counterparty", UpdateQuery{Counterparty: "carol*starlight.com"}, []uint64{3, 5, 7}, 0},
+		{"command", UpdateQuery{Command: string(fsm.ChannelPay)}, []uint64{6}, 0},
+		{"combined", UpdateQuery{ChannelID: "chan1", Command: string(fsm.ChannelPay)}, []uint64{6}, 0},
+		{"first page", UpdateQuery{ChannelID: "chan2", Limit: 2}, []uint64{3, 5}, 5},
+		{"second page", UpdateQuery{ChannelID: "chan2", Limit: 2, Cursor: 5}, []uint64{7}, 0},
+		{"future", UpdateQuery{Start: time.Now().Add(time.Hour)}, nil, 0},
+		{"unknown channel", UpdateQuery{ChannelID: "chan3"}, nil, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			page, err := g.QueryUpdates(&c.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []uint64
+			for _, ev := range page.Updates {
+				got = append(got, ev.UpdateNum)
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("got updates %v, want %v", got, c.want)
+			}
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Fatalf("got updates %v, want %v", got, c.want)
+				}
+			}
+			if page.Cursor != c.next {
+				t.Errorf("got cursor %d, want %d", page.Cursor, c.next)
+			}
+		})
+	}
+	// A larger limit is lowered to maxQueryLimit.
+	err = db.Update(g.db, func(root *db.Root) error {
+		for i := 0; i < maxQueryLimit; i++ {
+			g.putUpdate(root, &Update{Type: update.WarningType})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := g.QueryUpdates(&UpdateQuery{Limit: 10 * maxQueryLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Updates) != maxQueryLimit || page.Cursor == 0 {
+		t.Errorf("got %d updates and cursor %d, want %d updates and a cursor", len(page.Updates), page.Cursor, maxQueryLimit)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/interstellar/starlight/errors"
 	"github.com/interstellar/starlight/net/http/httpjson"
 	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/signer"
 )
 
 // TODO(vniu): refactor github.com/interstellar/starlight/net/httperror to avoid
@@ -70,12 +71,31 @@ func init() {
 	errorFormatter.add(errEmptyIssuer, 400, "no issuer specified", false)
 	errorFormatter.add(errAcctsSame, 400, "same host and guest accounts", false)
 	errorFormatter.add(errNotFunded, 500, "agent not yet funded", true)
+	errorFormatter.add(signer.ErrRefused, 403, "signature refused by signer policy", false)
+	errorFormatter.add(errLocked, 500, "seed unavailable, log in first", true)
 	errorFormatter.add(errInvalidAddress, 400, "invalid address", false)
+	errorFormatter.add(errNoPath, 400, "no payment path found", true)
+	errorFormatter.add(errInvalidMemo, 400, "invalid memo", false)
+	errorFormatter.add(errInvalidMnemonic, 400, "invalid mnemonic", false)
+	errorFormatter.add(errNoDestination, 400, "destination account does not exist", false)
+	errorFormatter.add(errBelowMinBalance, 400, "amount below minimum account balance", false)
+
+	// Webhooks
+	errorFormatter.add(errInvalidURL, 400, "invalid URL", false)
+	errorFormatter.add(errNoWebhook, 404, "webhook not found", false)
+
+	// Federation
+	errorFormatter.add(errAliasExists, 400, "alias exists", false)
+	errorFormatter.add(errNoAlias, 404, "alias not found", false)
+
+	// Schedules
+	errorFormatter.add(errNoSchedule, 404, "schedule not found", false)
 
 	// Message errors
 	errorFormatter.add(errExists, 400, "channel already exists", false)
 	errorFormatter.add(errChannelExistsRetriable, 400, "channel already exists, in setting up state", true)
 	errorFormatter.add(errInvalidChannelID, 400, "invalid channel ID", false)
+	errorFormatter.add(errNoSignedRound, 400, "no completed round to close with", false)
 	errorFormatter.add(errFetchingAccounts, 400, "error fetching sequence numbers for accounts", false)
 	errorFormatter.add(errRemoteGuestMessage, 400, "received RPC message from guest", false)
 
@@ -89,11 +109,14 @@ func init() {
 	errorFormatter.add(errEmptyConfigEdit, 400, "empty configuration edit", false)
 	errorFormatter.add(errNotConfigured, 500, "not configured", true)
 	errorFormatter.add(errPasswordsDontMatch, 400, "passwords don't match", false)
+	errorFormatter.add(errRemoteSigner, 400, "seed held by remote signer", false)
+	errorFormatter.add(errWrongNetwork, 400, "horizon is on the wrong network", false)
 
 	// FSM errors
 	errorFormatter.add(fsm.ErrInvalidVersion, 400, "invalid message version", false)
 	errorFormatter.add(fsm.ErrChannelExists, 400, "channel proposed already exists", false)
 	errorFormatter.add(fsm.ErrUnusedSettleWithGuestSig, 400, "unused settle with guest sig", false)
+	errorFormatter.add(fsm.ErrWrongNetwork, 400, "channel proposed on a different network", false)
 	errorFormatter.add(fsm.ErrUnexpectedState, 400, "unexpected state", true)
 	errorFormatter.add(fsm.ErrInsufficientFunds, 400, "insufficient funds", true)
 }
@@ -0,0 +1,29 @@
+package alias
+
+import (
+	"encoding/json"
+
+	"github.com/interstellar/starlight/starlight/fsm"
+)
+
+// Alias is an additional federation name for an agent's account.
+type Alias struct {
+	// Name is the part of the federation address before the "*".
+	Name string
+
+	// Memo, if set, is returned in federation responses for Name,
+	// so senders attach it to payments made to the alias.
+	Memo *fsm.Memo `json:",omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. Required for genbolt.
+func (a *Alias) MarshalJSON() ([]byte, error) {
+	type t Alias
+	return json.Marshal((*t)(a))
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Required for genbolt.
+func (a *Alias) UnmarshalJSON(b []byte) error {
+	type t Alias
+	return json.Unmarshal(b, (*t)(a))
+}
@@ -0,0 +1,41 @@
+// Package keyfile reads secrets, such as passwords and seeds,
+// from files that only their owner may access.
+package keyfile
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/interstellar/starlight/errors"
+)
+
+// ErrInsecure is returned for a key file
+// that group or other users may access.
+var ErrInsecure = errors.New("key file accessible to other users")
+
+// Read returns the contents of the file at path,
+// without trailing whitespace.
+// It returns an error wrapping ErrInsecure
+// if the file is accessible to group or other users.
+// The mode is checked on the open file,
+// so it is the mode of the file read.
+func Read(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return "", errors.Wrapf(ErrInsecure, "%s has mode %s", path, info.Mode().Perm())
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), " \t\r\n"), nil
+}
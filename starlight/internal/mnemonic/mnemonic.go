@@ -0,0 +1,101 @@
+// Package mnemonic encodes secret entropy as a list of words
+// for writing down, following BIP-39.
+// See https://github.com/bitcoin/bips/blob/master/bip-0039.mediawiki.
+//
+// Unlike BIP-39 wallets, Starlight uses the entropy itself
+// as its seed; there is no passphrase or key stretching.
+package mnemonic
+
+import (
+	"crypto/sha256"
+	"strings"
+
+	"github.com/interstellar/starlight/errors"
+)
+
+// Errors returned by Decode.
+var (
+	ErrLength   = errors.New("mnemonic has wrong number of words")
+	ErrWord     = errors.New("unknown mnemonic word")
+	ErrChecksum = errors.New("mnemonic checksum mismatch")
+)
+
+var wordIndex = make(map[string]int, len(english))
+
+func init() {
+	for i, w := range english {
+		wordIndex[w] = i
+	}
+}
+
+// Encode returns the mnemonic for entropy,
+// whose length must be a multiple of 4 bytes
+// between 16 and 32.
+func Encode(entropy []byte) string {
+	n := len(entropy)
+	if n < 16 || n > 32 || n%4 != 0 {
+		panic("mnemonic: bad entropy length")
+	}
+	// Each word holds 11 bits
+	// of entropy followed by n/4 checksum bits.
+	sum := sha256.Sum256(entropy)
+	bits := append(append([]byte{}, entropy...), sum[0])
+	nwords := (n*8 + n/4) / 11
+	words := make([]string, nwords)
+	for i := range words {
+		words[i] = english[readBits(bits, i*11)]
+	}
+	return strings.Join(words, " ")
+}
+
+// Decode returns the entropy encoded by mnemonic.
+// Words may be separated by any whitespace
+// and are not case-sensitive.
+func Decode(mnemonic string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	nwords := len(words)
+	if nwords < 12 || nwords > 24 || nwords%3 != 0 {
+		return nil, errors.Wrapf(ErrLength, "got %d", nwords)
+	}
+	n := nwords * 11 * 32 / 33 / 8 // entropy bytes
+	bits := make([]byte, n+1)
+	for i, w := range words {
+		v, ok := wordIndex[w]
+		if !ok {
+			return nil, errors.Wrap(ErrWord, w)
+		}
+		writeBits(bits, i*11, v)
+	}
+	entropy := bits[:n]
+	sum := sha256.Sum256(entropy)
+	nsum := uint(n / 4)
+	mask := byte(0xff) << (8 - nsum)
+	if bits[n]&mask != sum[0]&mask {
+		return nil, ErrChecksum
+	}
+	return entropy, nil
+}
+
+// readBits returns the 11 bits of b starting at bit offset.
+func readBits(b []byte, offset int) int {
+	var v int
+	for i := 0; i < 11; i++ {
+		bit := offset + i
+		v <<= 1
+		if b[bit/8]&(0x80>>uint(bit%8)) != 0 {
+			v |= 1
+		}
+	}
+	return v
+}
+
+// writeBits stores the low 11 bits of v in b
+// starting at bit offset.
+func writeBits(b []byte, offset, v int) {
+	for i := 0; i < 11; i++ {
+		bit := offset + i
+		if v&(1<<uint(10-i)) != 0 {
+			b[bit/8] |= 0x80 >> uint(bit%8)
+		}
+	}
+}
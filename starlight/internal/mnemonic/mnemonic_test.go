@@ -0,0 +1,78 @@
+package mnemonic
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/interstellar/starlight/errors"
+)
+
+func TestWordlist(t *testing.T) {
+	sum := sha256.Sum256([]byte(strings.Join(english, "\n") + "\n"))
+	const want = "2f5eed53a4727b4bf8880d8f3f199efc90e58503646d9ff8eff3a2ed3b24dbda"
+	if got := hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("got wordlist hash %s, want %s", got, want)
+	}
+}
+
+// Test vectors from BIP-39.
+var vectors = []struct {
+	entropy, mnemonic string
+}{
+	{
+		"00000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+	},
+	{
+		"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		"legal winner thank year wave sausage worth useful legal winner thank yellow",
+	},
+	{
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+	},
+	{
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+	},
+	{
+		"68a79eaca2324873eacc50cb9c6eca8cc68ea5d936f98787c60c7ebc74e6ce7c",
+		"hamster diagram private dutch cause delay private meat slide toddler razor book happy fancy gospel tennis maple dilemma loan word shrug inflict delay length",
+	},
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, v := range vectors {
+		entropy, _ := hex.DecodeString(v.entropy)
+		if got := Encode(entropy); got != v.mnemonic {
+			t.Errorf("Encode(%s) = %q, want %q", v.entropy, got, v.mnemonic)
+		}
+		got, err := Decode(strings.ToUpper(v.mnemonic))
+		if err != nil {
+			t.Errorf("Decode(%q): %s", v.mnemonic, err)
+			continue
+		}
+		if !bytes.Equal(got, entropy) {
+			t.Errorf("Decode(%q) = %x, want %s", v.mnemonic, got, v.entropy)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := []struct {
+		mnemonic string
+		want     error
+	}{
+		{"abandon abandon abandon", ErrLength},
+		{strings.Repeat("abandon ", 11) + "bogus", ErrWord},
+		{strings.Repeat("abandon ", 12), ErrChecksum},
+	}
+	for _, c := range cases {
+		if _, err := Decode(c.mnemonic); errors.Root(err) != c.want {
+			t.Errorf("Decode(%q): got error %v, want %s", c.mnemonic, err, c.want)
+		}
+	}
+}
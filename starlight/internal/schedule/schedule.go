@@ -0,0 +1,78 @@
+package schedule
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+// Schedule kinds.
+const (
+	// Wallet schedules make wallet payments
+	// to a Stellar account ID or federation address.
+	Wallet = "wallet"
+
+	// Channel schedules make payments over a channel.
+	Channel = "channel"
+)
+
+// Schedule is a recurring payment run by the agent.
+type Schedule struct {
+	ID   string
+	Kind string
+
+	// Recipient is the account ID or federation address
+	// for wallet schedules, and the channel ID for channel schedules.
+	Recipient string
+	Amount    xlm.Amount
+
+	// AssetCode and Issuer are empty for lumens.
+	// Channel schedules always pay lumens.
+	AssetCode string `json:",omitempty"`
+	Issuer    string `json:",omitempty"`
+
+	Interval time.Duration
+
+	// Next is the ledger time of the next payment.
+	Next time.Time
+
+	// Count is the number of payments to make,
+	// or 0 for no limit.
+	Count uint64 `json:",omitempty"`
+
+	// Runs is the number of payments made so far,
+	// including one in progress.
+	Runs uint64
+
+	Paused bool `json:",omitempty"`
+}
+
+// Done reports whether s has made all its payments.
+func (s *Schedule) Done() bool {
+	return s.Count > 0 && s.Runs >= s.Count
+}
+
+// Advance sets s.Next to the first time after now
+// in the sequence of payment times.
+// Payment times missed while s was paused
+// (or the agent was down) are skipped.
+func (s *Schedule) Advance(now time.Time) {
+	if s.Next.After(now) {
+		return
+	}
+	n := now.Sub(s.Next)/s.Interval + 1
+	s.Next = s.Next.Add(n * s.Interval)
+}
+
+// MarshalJSON implements json.Marshaler. Required for genbolt.
+func (s *Schedule) MarshalJSON() ([]byte, error) {
+	type t Schedule
+	return json.Marshal((*t)(s))
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Required for genbolt.
+func (s *Schedule) UnmarshalJSON(b []byte) error {
+	type t Schedule
+	return json.Unmarshal(b, (*t)(s))
+}
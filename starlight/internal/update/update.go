@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/schedule"
 	"github.com/interstellar/starlight/worizon"
 	"github.com/interstellar/starlight/worizon/xlm"
 )
@@ -21,6 +22,7 @@ const (
 	WarningType   Type = "warning"
 	TxSuccessType Type = "tx_success"
 	TxFailureType Type = "tx_failed"
+	ScheduleType  Type = "schedule"
 )
 
 // Update is a record of some state change in a Starlight agent that should be reflected to the user.
@@ -69,13 +71,50 @@ type Update struct {
 	// which particular operation was responsible for the state change.
 	OpIndex int
 
+	// ScheduleRun is set when Type is schedule.
+	ScheduleRun *ScheduleRun `json:",omitempty"`
+
+	// Memo is the transaction memo, if any,
+	// of an incoming wallet payment.
+	Memo *fsm.Memo `json:",omitempty"`
+
 	Warning string
 
+	// OpResults is set on tx_success and tx_failed updates
+	// for wallet transactions carrying several payments.
+	OpResults []*OpResult `json:",omitempty"`
+
 	// if this update included an outgoing transaction from the wallet account,
 	// this is its sequence number (as a string, so JS can read it)
 	PendingSequence string
 }
 
+// ScheduleRun describes one execution of a payment schedule.
+type ScheduleRun struct {
+	// Schedule is the schedule's state after the execution.
+	Schedule *schedule.Schedule
+
+	// Due is the ledger time the payment was scheduled for.
+	Due time.Time
+
+	// Error says why the payment could not be made, if it could not.
+	Error string `json:",omitempty"`
+}
+
+// OpResult is the outcome of one payment
+// in a wallet transaction carrying several.
+type OpResult struct {
+	OpIndex   int
+	Recipient string
+	Success   bool
+	Code      string // the operation's result code
+
+	// Resubmitted is set when the payment did not fail itself,
+	// but its transaction failed because of another payment.
+	// It has been resubmitted in a new transaction.
+	Resubmitted bool `json:",omitempty"`
+}
+
 // Account is the identity and balance of a Stellar account, for use in updates.
 // TODO(debnil): Change Balance to NativeBalance later; will break front-end.
 type Account struct {
@@ -92,6 +131,10 @@ type Config struct {
 	Password   string `json:",omitempty"` // always "[redacted]" if set
 	HorizonURL string `json:",omitempty"`
 
+	NetworkPassphrase string     `json:",omitempty"`
+	BaseReserve       xlm.Amount `json:",omitempty"`
+	FriendbotURL      string     `json:",omitempty"`
+
 	MaxRoundDurMins   int64      `json:",omitempty"`
 	FinalityDelayMins int64      `json:",omitempty"`
 	ChannelFeerate    xlm.Amount `json:",omitempty"`
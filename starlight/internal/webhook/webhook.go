@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/update"
+)
+
+// Webhook is an HTTP callback URL registered to receive
+// a signed POST for each update of the selected types.
+type Webhook struct {
+	ID  string
+	URL string
+
+	// Types lists the update types delivered to URL,
+	// and may also include ChannelPaymentIn.
+	// If empty, every update is delivered.
+	Types []string
+
+	// Secret is the key used to sign each delivery.
+	// The signature, in header Starlight-Signature,
+	// is the hex-encoded HMAC-SHA256 of the request body.
+	// It is empty in webhooks listed after creation.
+	Secret string `json:",omitempty"`
+}
+
+// ChannelPaymentIn can be listed in Types
+// to select the channel updates that complete
+// an incoming channel payment,
+// without the rest of the channel updates.
+const ChannelPaymentIn = "channel_payment_in"
+
+// Matches reports whether ev should be delivered to w.
+func (w *Webhook) Matches(ev *update.Update) bool {
+	if len(w.Types) == 0 {
+		return true
+	}
+	for _, t := range w.Types {
+		if t == string(ev.Type) || (t == ChannelPaymentIn && isChannelPaymentIn(ev)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isChannelPaymentIn reports whether ev completes
+// an incoming channel payment.
+// The payee accepts a payment in PaymentAccepted
+// and returns to Open when the payer completes it.
+func isChannelPaymentIn(ev *update.Update) bool {
+	return ev.Type == update.ChannelType &&
+		ev.Channel != nil &&
+		ev.Channel.PrevState == fsm.PaymentAccepted &&
+		ev.Channel.State == fsm.Open
+}
+
+// Sign returns the signature of body under w's secret.
+func (w *Webhook) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// MarshalJSON implements json.Marshaler. Required for genbolt.
+func (w *Webhook) MarshalJSON() ([]byte, error) {
+	type t Webhook
+	return json.Marshal((*t)(w))
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Required for genbolt.
+func (w *Webhook) UnmarshalJSON(b []byte) error {
+	type t Webhook
+	return json.Unmarshal(b, (*t)(w))
+}
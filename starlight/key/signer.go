@@ -0,0 +1,65 @@
+package key
+
+import (
+	b "github.com/stellar/go/build"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+)
+
+// A Signer signs with the account keys derived from a seed.
+// It lets the seed be kept out of the process
+// that needs the signatures,
+// for instance in a separate signer daemon.
+type Signer interface {
+	// Address returns the address of the account key at index i.
+	Address(i uint32) (string, error)
+
+	// SignTx returns the signature of tx,
+	// on the network with the given passphrase,
+	// by the account key at index i.
+	SignTx(tx *xdr.Transaction, passphrase string, i uint32) (xdr.DecoratedSignature, error)
+
+	// SignMessage returns the signature of msg
+	// by the primary account key.
+	SignMessage(msg []byte) ([]byte, error)
+}
+
+// SeedSigner is a Signer that derives keys from the seed it holds.
+type SeedSigner []byte
+
+// Address implements Signer.
+func (s SeedSigner) Address(i uint32) (string, error) {
+	return DeriveAccount(s, i).Address(), nil
+}
+
+// SignTx implements Signer.
+func (s SeedSigner) SignTx(tx *xdr.Transaction, passphrase string, i uint32) (xdr.DecoratedSignature, error) {
+	txhash, err := network.HashTransaction(tx, passphrase)
+	if err != nil {
+		return xdr.DecoratedSignature{}, err
+	}
+	return DeriveAccount(s, i).SignDecorated(txhash[:])
+}
+
+// SignMessage implements Signer.
+func (s SeedSigner) SignMessage(msg []byte) ([]byte, error) {
+	return DeriveAccountPrimary(s).Sign(msg)
+}
+
+// SignEnvelope returns an envelope holding tx
+// and its signatures by s with the account keys at indices.
+func SignEnvelope(s Signer, tx *b.TransactionBuilder, indices ...uint32) (b.TransactionEnvelopeBuilder, error) {
+	var env b.TransactionEnvelopeBuilder
+	err := env.Mutate(tx)
+	if err != nil {
+		return env, err
+	}
+	for _, i := range indices {
+		sig, err := s.SignTx(tx.TX, tx.NetworkPassphrase, i)
+		if err != nil {
+			return env, err
+		}
+		env.E.Signatures = append(env.E.Signatures, sig)
+	}
+	return env, nil
+}
@@ -22,6 +22,11 @@ func (g *Agent) debugf(f string, a ...interface{}) {
 	}
 }
 
+// SetDebug turns on the agent's debug logging if debug is true,
+// and names the agent in its log lines.
+//
+// Deprecated: use WithDebug,
+// which takes effect before the agent starts.
 func (g *Agent) SetDebug(debug bool, name string) {
 	g.debug = debug
 	g.name = name
@@ -0,0 +1,62 @@
+package starlight
+
+import (
+	"encoding/hex"
+	"strconv"
+
+	b "github.com/stellar/go/build"
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/fsm"
+)
+
+// Memo is the memo of a wallet payment's transaction.
+// Its Type is "text", "id", or "hash".
+type Memo = fsm.Memo
+
+// maxMemoText is the most bytes a text memo can hold.
+const maxMemoText = 28
+
+// memoMutator validates m and returns the mutator
+// that sets it on a transaction.
+func memoMutator(m *Memo) (b.TransactionMutator, error) {
+	switch m.Type {
+	case fsm.MemoText:
+		if len(m.Value) > maxMemoText {
+			return nil, errors.Wrapf(errInvalidMemo, "text longer than %d bytes", maxMemoText)
+		}
+		return b.MemoText{Value: m.Value}, nil
+	case fsm.MemoID:
+		id, err := strconv.ParseUint(m.Value, 10, 64)
+		if err != nil {
+			return nil, errors.Sub(errInvalidMemo, err)
+		}
+		return b.MemoID{Value: id}, nil
+	case fsm.MemoHash:
+		var hash xdr.Hash
+		v, err := hex.DecodeString(m.Value)
+		if err != nil || len(v) != len(hash) {
+			return nil, errors.Wrap(errInvalidMemo, "hash must be 32 hex-encoded bytes")
+		}
+		copy(hash[:], v)
+		return b.MemoHash{Value: hash}, nil
+	}
+	return nil, errors.Wrapf(errInvalidMemo, "unknown type %q", m.Type)
+}
+
+// memoFromXDR converts a transaction's memo.
+// It returns nil if the transaction has none.
+func memoFromXDR(m xdr.Memo) *Memo {
+	switch m.Type {
+	case xdr.MemoTypeMemoText:
+		return &Memo{Type: fsm.MemoText, Value: *m.Text}
+	case xdr.MemoTypeMemoId:
+		return &Memo{Type: fsm.MemoID, Value: strconv.FormatUint(uint64(*m.Id), 10)}
+	case xdr.MemoTypeMemoHash:
+		return &Memo{Type: fsm.MemoHash, Value: hex.EncodeToString(m.Hash[:])}
+	case xdr.MemoTypeMemoReturn:
+		return &Memo{Type: fsm.MemoReturn, Value: hex.EncodeToString(m.RetHash[:])}
+	}
+	return nil
+}
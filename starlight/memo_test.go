@@ -0,0 +1,111 @@
+package starlight
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	b "github.com/stellar/go/build"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+func TestMemo(t *testing.T) {
+	valid := []*Memo{
+		{Type: fsm.MemoText, Value: "deposit 1234"},
+		{Type: fsm.MemoID, Value: "18446744073709551615"},
+		{Type: fsm.MemoHash, Value: strings.Repeat("ab", 32)},
+	}
+	for _, m := range valid {
+		mut, err := memoMutator(m)
+		if err != nil {
+			t.Errorf("%s memo: %s", m.Type, err)
+			continue
+		}
+		tx, err := b.Transaction(b.TestNetwork, b.Sequence{Sequence: 1}, mut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := memoFromXDR(tx.TX.Memo); !reflect.DeepEqual(got, m) {
+			t.Errorf("got memo %+v, want %+v", got, m)
+		}
+	}
+
+	invalid := []*Memo{
+		{Type: fsm.MemoText, Value: strings.Repeat("x", 29)},
+		{Type: fsm.MemoID, Value: "-1"},
+		{Type: fsm.MemoHash, Value: "abcd"},
+		{Type: fsm.MemoHash, Value: strings.Repeat("ab", 33)},
+		{Type: fsm.MemoHash, Value: strings.Repeat("zz", 32)},
+		{Type: fsm.MemoReturn, Value: strings.Repeat("ab", 32)},
+	}
+	for _, m := range invalid {
+		if _, err := memoMutator(m); errors.Root(err) != errInvalidMemo {
+			t.Errorf("%s memo %q: got error %v, want %s", m.Type, m.Value, err, errInvalidMemo)
+		}
+	}
+}
+
+func TestWalletPayMemo(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		w := root.Agent().Wallet()
+		w.NativeBalance = 50 * xlm.Lumen
+		root.Agent().PutWallet(w)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := randomAddress(t)
+	err = g.DoWalletPay(dest, uint64(xlm.Lumen), "", "", &Memo{Type: fsm.MemoText, Value: strings.Repeat("x", 29)})
+	if errors.Root(err) != errInvalidMemo {
+		t.Errorf("got error %v, want %s", err, errInvalidMemo)
+	}
+	memo := &Memo{Type: fsm.MemoID, Value: "42"}
+	err = g.DoWalletPay(dest, uint64(xlm.Lumen), "", "", memo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cmd *fsm.Command
+	db.View(g.db, func(root *db.Root) error {
+		updates := root.Agent().Updates()
+		cmd = updates.Get(updates.Bucket().Sequence()).InputCommand
+		return nil
+	})
+	if cmd == nil || !reflect.DeepEqual(cmd.Memo, memo) {
+		t.Errorf("got command %+v, want memo %+v", cmd, memo)
+	}
+
+	// The federation server requires a memo on payments to carol.
+	err = g.DoWalletPay("carol*starlight.com", uint64(xlm.Lumen), "", "", memo)
+	if errors.Root(err) != errInvalidMemo {
+		t.Errorf("got error %v paying carol with the wrong memo, want %s", err, errInvalidMemo)
+	}
+	err = g.DoWalletPay("carol*starlight.com", uint64(xlm.Lumen), "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.View(g.db, func(root *db.Root) error {
+		updates := root.Agent().Updates()
+		cmd = updates.Get(updates.Bucket().Sequence()).InputCommand
+		return nil
+	})
+	want := &Memo{Type: fsm.MemoID, Value: "7"}
+	if cmd == nil || !reflect.DeepEqual(cmd.Memo, want) {
+		t.Errorf("got command %+v, want memo %+v", cmd, want)
+	}
+}
@@ -0,0 +1,238 @@
+package starlight
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/interstellar/starlight/metrics"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/taskbasket"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+// agentMetrics holds the counters and histograms
+// an agent keeps as it runs.
+// Gauges are computed from the agent's state
+// each time they are reported.
+type agentMetrics struct {
+	reg metrics.Registry
+
+	rounds       *metrics.Histogram
+	payments     *metrics.Counter
+	volume       *metrics.Counter
+	txFailures   *metrics.Counter
+	roundStartMu sync.Mutex
+	roundStart   map[string]time.Time // by channel ID
+}
+
+// roundBuckets are the upper bounds, in seconds,
+// of the round duration histogram.
+var roundBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+func newAgentMetrics(g *Agent) *agentMetrics {
+	m := &agentMetrics{
+		rounds: metrics.NewHistogram(
+			"starlight_round_duration_seconds",
+			"Time from proposing or accepting a payment to the channel reopening.",
+			roundBuckets,
+		),
+		payments: metrics.NewCounter(
+			"starlight_payments_total",
+			"Channel payments completed, by direction.",
+			"direction",
+		),
+		volume: metrics.NewCounter(
+			"starlight_payment_volume_lumens_total",
+			"Lumens paid in completed channel payments, by direction.",
+			"direction",
+		),
+		txFailures: metrics.NewCounter(
+			"starlight_tx_submit_failures_total",
+			"Transactions rejected by Horizon, by result code.",
+			"code",
+		),
+		roundStart: make(map[string]time.Time),
+	}
+	m.reg.Register(
+		metrics.NewGaugeFunc(
+			"starlight_channels",
+			"Channels, by state and role.",
+			[]string{"state", "role"},
+			g.channelGauge,
+		),
+		m.rounds,
+		m.payments,
+		m.volume,
+		metrics.NewGaugeFunc(
+			"starlight_taskbasket_pending_tasks",
+			"Pending taskbasket tasks, by type and number of retries.",
+			[]string{"type", "retries"},
+			g.taskGauge,
+		),
+		metrics.NewGaugeFunc(
+			"starlight_horizon_lag_seconds",
+			"How far the last ledger seen from Horizon is behind the wall clock.",
+			nil,
+			g.horizonLagGauge,
+		),
+		m.txFailures,
+		metrics.NewGaugeFunc(
+			"starlight_updates",
+			"Updates in the agent's update log.",
+			nil,
+			g.updatesGauge,
+		),
+	)
+	return m
+}
+
+// MetricsHandler returns an http.Handler
+// serving g's metrics in the Prometheus text format.
+func (g *Agent) MetricsHandler() http.Handler {
+	return &g.metrics.reg
+}
+
+// observeChannel records metrics for a change
+// in a channel's state from prev to c.State,
+// and in its local balance from prevLocal.
+// It must be called after the change commits.
+func (m *agentMetrics) observeChannel(now time.Time, c *fsm.Channel, prev fsm.State, prevLocal xlm.Amount) {
+	m.roundStartMu.Lock()
+	defer m.roundStartMu.Unlock()
+	switch {
+	case prev == fsm.Open && isPaymentState(c.State):
+		m.roundStart[c.ID] = now
+	case isPaymentState(prev) && c.State == fsm.Open:
+		if start, ok := m.roundStart[c.ID]; ok {
+			m.rounds.Observe(now.Sub(start).Seconds())
+		}
+		delete(m.roundStart, c.ID)
+		switch delta := localAmount(c) - prevLocal; {
+		case delta < 0:
+			m.payments.Inc("sent")
+			m.volume.Add(lumens(-delta), "sent")
+		case delta > 0:
+			m.payments.Inc("received")
+			m.volume.Add(lumens(delta), "received")
+		}
+	case !isPaymentState(c.State):
+		delete(m.roundStart, c.ID)
+	}
+}
+
+func isPaymentState(s fsm.State) bool {
+	switch s {
+	case fsm.PaymentProposed, fsm.PaymentAccepted, fsm.AwaitingPaymentMerge:
+		return true
+	}
+	return false
+}
+
+// localAmount returns the agent's balance in c.
+func localAmount(c *fsm.Channel) xlm.Amount {
+	if c.Role == fsm.Host {
+		return c.HostAmount
+	}
+	return c.GuestAmount
+}
+
+func lumens(a xlm.Amount) float64 {
+	return float64(a) / float64(xlm.Lumen)
+}
+
+func (g *Agent) channelGauge(set func(float64, ...string)) {
+	type key struct {
+		state fsm.State
+		role  fsm.Role
+	}
+	counts := make(map[key]int)
+	err := db.View(g.db, func(root *db.Root) error {
+		chans := root.Agent().Channels()
+		if chans.Bucket() == nil {
+			return nil
+		}
+		return chans.Bucket().ForEach(func(k, _ []byte) error {
+			c := chans.Get(k)
+			counts[key{c.State, c.Role}]++
+			return nil
+		})
+	})
+	if err != nil {
+		g.debugf("counting channels: %s", err)
+		return
+	}
+	for k, n := range counts {
+		set(float64(n), string(k.state), string(k.role))
+	}
+}
+
+func (g *Agent) taskGauge(set func(float64, ...string)) {
+	var tb *taskbasket.TB
+	db.View(g.db, func(root *db.Root) error {
+		tb = g.tb // synchronized with db.Update
+		return nil
+	})
+	if tb == nil {
+		return
+	}
+	type key struct{ typ, retries string }
+	counts := make(map[key]int)
+	tb.Pending(func(t taskbasket.Task, retries int) {
+		counts[key{taskType(t), retryBucket(retries)}]++
+	})
+	for k, n := range counts {
+		set(float64(n), k.typ, k.retries)
+	}
+}
+
+func taskType(t taskbasket.Task) string {
+	switch t.(type) {
+	case *TbTx:
+		return "tx"
+	case *TbMsg:
+		return "msg"
+	case *TbHook:
+		return "hook"
+	}
+	return "unknown"
+}
+
+// retryBucket groups retry counts
+// so that a task retrying for a long time
+// does not make a new series on each retry.
+func retryBucket(n int) string {
+	switch {
+	case n == 0:
+		return "0"
+	case n <= 3:
+		return "1-3"
+	case n <= 15:
+		return "4-15"
+	}
+	return "16+"
+}
+
+func (g *Agent) horizonLagGauge(set func(float64, ...string)) {
+	var configured bool
+	db.View(g.db, func(root *db.Root) error {
+		configured = g.isReadyConfigured(root)
+		return nil
+	})
+	if !configured {
+		return
+	}
+	if now := g.wclient.Now(); !now.IsZero() {
+		set(g.clock.Now().Sub(now).Seconds())
+	}
+}
+
+func (g *Agent) updatesGauge(set func(float64, ...string)) {
+	db.View(g.db, func(root *db.Root) error {
+		if bu := root.Agent().Updates().Bucket(); bu != nil {
+			set(float64(bu.Stats().KeyN))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,90 @@
+package starlight
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+func TestMetrics(t *testing.T) {
+	g, cleanup := startTestAgent(t)
+	defer cleanup()
+
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "password",
+		HorizonURL: testHorizonURL,
+	}, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		g.putChannel(root, "chan1", &fsm.Channel{ID: "chan1", State: fsm.Open, Role: fsm.Host})
+		g.putChannel(root, "chan2", &fsm.Channel{ID: "chan2", State: fsm.Open, Role: fsm.Host})
+		g.putChannel(root, "chan3", &fsm.Channel{ID: "chan3", State: fsm.PaymentAccepted, Role: fsm.Guest})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A payment round sent by the host, then one it received.
+	start := time.Now()
+	c := &fsm.Channel{ID: "chan1", Role: fsm.Host, HostAmount: 100 * xlm.Lumen}
+	c.State = fsm.PaymentProposed
+	g.metrics.observeChannel(start, c, fsm.Open, c.HostAmount)
+	c.State, c.HostAmount = fsm.Open, 90*xlm.Lumen
+	g.metrics.observeChannel(start.Add(2*time.Second), c, fsm.PaymentProposed, 100*xlm.Lumen)
+	c.State = fsm.PaymentAccepted
+	g.metrics.observeChannel(start, c, fsm.Open, c.HostAmount)
+	c.State, c.HostAmount = fsm.Open, 92*xlm.Lumen
+	g.metrics.observeChannel(start.Add(100*time.Millisecond), c, fsm.AwaitingPaymentMerge, 90*xlm.Lumen)
+
+	rec := httptest.NewRecorder()
+	g.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	got := rec.Body.String()
+	for _, want := range []string{
+		`starlight_channels{state="Open",role="Host"} 2`,
+		`starlight_channels{state="PaymentAccepted",role="Guest"} 1`,
+		`starlight_round_duration_seconds_bucket{le="0.1"} 1`,
+		`starlight_round_duration_seconds_bucket{le="2.5"} 2`,
+		`starlight_round_duration_seconds_count 2`,
+		`starlight_payments_total{direction="received"} 1`,
+		`starlight_payments_total{direction="sent"} 1`,
+		`starlight_payment_volume_lumens_total{direction="received"} 2`,
+		`starlight_payment_volume_lumens_total{direction="sent"} 10`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("metrics missing %q:\n%s", want, got)
+		}
+	}
+	// Funding the wallet may add updates at any time.
+	if !strings.Contains(got, "\nstarlight_updates ") {
+		t.Errorf("metrics missing starlight_updates:\n%s", got)
+	}
+}
+
+func TestRetryBucket(t *testing.T) {
+	cases := []struct {
+		n    int
+		want string
+	}{
+		{0, "0"},
+		{1, "1-3"},
+		{3, "1-3"},
+		{4, "4-15"},
+		{15, "4-15"},
+		{16, "16+"},
+		{1000, "16+"},
+	}
+	for _, c := range cases {
+		if got := retryBucket(c.n); got != c.want {
+			t.Errorf("retryBucket(%d) = %q, want %q", c.n, got, c.want)
+		}
+	}
+}
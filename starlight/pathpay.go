@@ -0,0 +1,338 @@
+package starlight
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/stellar/go/amount"
+	b "github.com/stellar/go/build"
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/update"
+	"github.com/interstellar/starlight/worizon"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+// maxSlippage is the largest slippage limit,
+// in basis points, accepted by DoWalletPathPay.
+const maxSlippage = 10000
+
+// maxSendAmount returns the most a path payment
+// estimated to cost estimate may spend,
+// allowing for slippage basis points more,
+// which must be at most maxSlippage.
+// The result must fit in a Stellar amount, an int64.
+func maxSendAmount(estimate uint64, slippage uint32) (uint64, error) {
+	// Split estimate so multiplying by slippage can't overflow.
+	extra := estimate/10000*uint64(slippage) + estimate%10000*uint64(slippage)/10000
+	if estimate > math.MaxInt64 || extra > math.MaxInt64-estimate {
+		return 0, errors.Wrapf(errInvalidInput, "maximum cost of %d with slippage %d is out of range", estimate, slippage)
+	}
+	return estimate + extra, nil
+}
+
+// PaymentPath is a way for the wallet to deliver a payment
+// by sending a different asset from the one the recipient receives,
+// as found by path discovery.
+type PaymentPath struct {
+	// SendAssetCode and SendIssuer are empty for lumens.
+	SendAssetCode string `json:",omitempty"`
+	SendIssuer    string `json:",omitempty"`
+
+	// SendAmount is the estimated cost of the payment,
+	// in stroops of the send asset.
+	SendAmount uint64
+
+	// Path lists the intermediate assets, if any,
+	// in the form used for wallet balances.
+	Path []string
+
+	path []b.Asset
+}
+
+// FindPaymentPaths returns the ways the wallet can pay amount
+// of the asset given by assetCode and issuer (empty for lumens)
+// to dest.
+// Only paths that start from lumens
+// or an asset the wallet holds are returned.
+func (g *Agent) FindPaymentPaths(dest string, amount uint64, assetCode, issuer string) ([]*PaymentPath, error) {
+	if dest == "" {
+		return nil, errEmptyAddress
+	}
+	if amount == 0 {
+		return nil, errEmptyAmount
+	}
+	if assetCode == "" && issuer != "" {
+		return nil, errEmptyAsset
+	}
+	if assetCode != "" && issuer == "" {
+		return nil, errEmptyIssuer
+	}
+	var (
+		source string
+		w      *fsm.WalletAcct
+	)
+	err := db.View(g.db, func(root *db.Root) error {
+		if !g.isReadyConfigured(root) {
+			return errNotConfigured
+		}
+		source = root.Agent().PrimaryAcct().Address()
+		w = root.Agent().Wallet()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	hpaths, err := g.wclient.FindPaths(worizon.PathQuery{
+		Source:        source,
+		Destination:   dest,
+		DestAssetCode: assetCode,
+		DestIssuer:    issuer,
+		DestAmount:    xlm.Amount(amount).HorizonString(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "finding payment paths")
+	}
+	paths := make([]*PaymentPath, 0) // we want json "[]" not "null"
+	for _, hp := range hpaths {
+		p, err := paymentPath(hp)
+		if err != nil {
+			g.debugf("skipping payment path: %s", err)
+			continue
+		}
+		if p.SendAssetCode != "" && p.SendIssuer != source {
+			asset, err := b.CreditAsset(p.SendAssetCode, p.SendIssuer).ToXDR()
+			if err != nil {
+				continue
+			}
+			if bal, ok := w.Balances[asset.String()]; !ok || !bal.Authorized {
+				continue
+			}
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// DoWalletPathPay pays amount of the asset given by assetCode and issuer
+// (empty for lumens) to dest, sending the asset given by
+// sendAssetCode and sendIssuer (empty for lumens)
+// through the cheapest path found by path discovery.
+// The payment fails, rather than spending more,
+// if its cost rises by more than slippage basis points
+// over the path's estimate before it executes.
+//
+// The wallet's balance of the send asset is debited by the maximum cost
+// until the payment succeeds or fails.
+func (g *Agent) DoWalletPathPay(dest string, amount uint64, assetCode, issuer, sendAssetCode, sendIssuer string, slippage uint32) error {
+	if sendAssetCode == "" && sendIssuer != "" {
+		return errEmptyAsset
+	}
+	if sendAssetCode != "" && sendIssuer == "" {
+		return errEmptyIssuer
+	}
+	if slippage > maxSlippage {
+		return errors.Wrapf(errInvalidInput, "slippage %d exceeds %d basis points", slippage, maxSlippage)
+	}
+	paths, err := g.FindPaymentPaths(dest, amount, assetCode, issuer)
+	if err != nil {
+		return err
+	}
+	var best *PaymentPath
+	for _, p := range paths {
+		if p.SendAssetCode != sendAssetCode || p.SendIssuer != sendIssuer {
+			continue
+		}
+		if best == nil || p.SendAmount < best.SendAmount {
+			best = p
+		}
+	}
+	if best == nil {
+		return errNoPath
+	}
+	sendMax, err := maxSendAmount(best.SendAmount, slippage)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(g.db, func(root *db.Root) error {
+		if !root.Agent().Ready() {
+			return errAgentClosing
+		}
+		w := root.Agent().Wallet()
+		hostAcct := root.Agent().PrimaryAcct()
+		hostFeerate := xlm.Amount(root.Agent().Config().HostFeerate())
+
+		sendAsset := b.NativeAsset()
+		if sendAssetCode == "" {
+			if w.NativeBalance <= xlm.Amount(sendMax)+hostFeerate {
+				return errors.Wrap(errInsufficientBalance, "XLM amount for payment and fees")
+			}
+			w.NativeBalance -= xlm.Amount(sendMax)
+		} else {
+			if w.NativeBalance <= hostFeerate {
+				return errors.Wrap(errInsufficientBalance, "XLM balance for host fee")
+			}
+			sendAsset = b.CreditAsset(sendAssetCode, sendIssuer)
+			// Assets the wallet issues itself are not debited.
+			if sendIssuer != hostAcct.Address() {
+				xasset, err := sendAsset.ToXDR()
+				if err != nil {
+					return errors.Sub(errInvalidAsset, err)
+				}
+				assetStr := xasset.String()
+				currBalance, ok := w.Balances[assetStr]
+				if !ok {
+					return errors.Wrap(errInvalidAsset, fmt.Sprintf("no trustline exists for asset %s, issuer %s", sendAssetCode, sendIssuer))
+				}
+				if !currBalance.Authorized {
+					return errors.New(fmt.Sprintf("unauthorized trustline for %s", assetStr))
+				}
+				if currBalance.Amount < sendMax {
+					return errors.Wrap(errInsufficientBalance, "asset amount for payment")
+				}
+				currBalance.Amount -= sendMax
+				w.Balances[assetStr] = currBalance
+			}
+		}
+		w.NativeBalance -= hostFeerate
+		w.Seqnum++
+		root.Agent().PutWallet(w)
+
+		var destAmount b.PaymentMutator = b.NativeAmount{Amount: xlm.Amount(amount).HorizonString()}
+		if assetCode != "" {
+			destAmount = b.CreditAmount{
+				Code:   assetCode,
+				Issuer: issuer,
+				Amount: xlm.Amount(amount).HorizonString(),
+			}
+		}
+		btx, err := b.Transaction(
+			b.Network{Passphrase: g.passphrase(root)},
+			b.SourceAccount{AddressOrSeed: hostAcct.Address()},
+			b.Sequence{Sequence: uint64(w.Seqnum)},
+			b.Payment(
+				b.SourceAccount{AddressOrSeed: hostAcct.Address()},
+				b.Destination{AddressOrSeed: dest},
+				destAmount,
+				b.PayWithPath{
+					Asset:     sendAsset,
+					MaxAmount: xlm.Amount(sendMax).HorizonString(),
+					Path:      best.path,
+				},
+			),
+		)
+		if err != nil {
+			return err
+		}
+		env, err := g.signWallet(btx)
+		if err != nil {
+			return err
+		}
+		time := g.wclient.Now()
+		g.putUpdate(root, &Update{
+			Type: update.AccountType,
+			Account: &update.Account{
+				ID:       hostAcct.Address(),
+				Balance:  uint64(w.NativeBalance),
+				Balances: w.Balances,
+				Reserve:  uint64(w.Reserve),
+			},
+			InputCommand: &fsm.Command{
+				Name:          fsm.Pay,
+				Amount:        xlm.Amount(amount),
+				Recipient:     dest,
+				Time:          time,
+				AssetCode:     assetCode,
+				Issuer:        issuer,
+				SendAssetCode: sendAssetCode,
+				SendIssuer:    sendIssuer,
+				SendMax:       xlm.Amount(sendMax),
+			},
+			InputLedgerTime: time,
+			PendingSequence: strconv.FormatInt(int64(w.Seqnum), 10),
+		})
+		return g.addTxTask(root.Tx(), walletBucket, *env.E)
+	})
+}
+
+// paymentPath converts a path found by Horizon.
+func paymentPath(hp worizon.Path) (*PaymentPath, error) {
+	sendAmount, err := amount.Parse(hp.SourceAmount)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing source amount")
+	}
+	p := &PaymentPath{
+		SendAmount: uint64(sendAmount),
+		Path:       make([]string, 0, len(hp.Path)),
+	}
+	if hp.SourceAssetType != "native" {
+		p.SendAssetCode = hp.SourceAssetCode
+		p.SendIssuer = hp.SourceAssetIssuer
+	}
+	for _, ha := range hp.Path {
+		asset := b.NativeAsset()
+		if ha.Type != "native" {
+			asset = b.CreditAsset(ha.Code, ha.Issuer)
+		}
+		xasset, err := asset.ToXDR()
+		if err != nil {
+			return nil, errors.Wrap(err, "converting path asset")
+		}
+		p.Path = append(p.Path, xasset.String())
+		p.path = append(p.path, asset)
+	}
+	return p, nil
+}
+
+// creditWallet adds amount of asset to w.
+// The asset's trustline is created if it does not exist.
+// Assets issued by the wallet's own account, acctID, are not tracked:
+// payments of them back to the issuer disappear.
+func creditWallet(w *fsm.WalletAcct, acctID string, asset xdr.Asset, amount xdr.Int64) {
+	if asset.Type == xdr.AssetTypeAssetTypeNative {
+		w.NativeBalance += xlm.Amount(amount)
+		return
+	}
+	var issuer string
+	asset.MustExtract(new(string), nil, &issuer)
+	if issuer == acctID {
+		return
+	}
+	if w.Balances == nil {
+		w.Balances = make(map[string]fsm.Balance)
+	}
+	assetStr := asset.String()
+	currBalance, ok := w.Balances[assetStr]
+	if !ok {
+		currBalance = fsm.Balance{
+			Asset:      asset,
+			Authorized: true,
+		}
+	}
+	currBalance.Amount += uint64(amount)
+	w.Balances[assetStr] = currBalance
+}
+
+// pathPaymentSent returns the amount of op's send asset
+// spent by a successful path payment with result res.
+func pathPaymentSent(op *xdr.PathPaymentOp, res *xdr.PathPaymentResultSuccess) xdr.Int64 {
+	if len(res.Offers) == 0 {
+		// No offers were crossed:
+		// the send and destination assets are the same.
+		return res.Last.Amount
+	}
+	var sent xdr.Int64
+	for _, atom := range res.Offers {
+		// Offers are recorded from the seller's side.
+		// What an offer bought in the send asset, the payment spent.
+		if atom.AssetBought.Equals(op.SendAsset) {
+			sent += atom.AmountBought
+		}
+	}
+	return sent
+}
@@ -0,0 +1,199 @@
+package starlight
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stellar/go/clients/horizon"
+	"github.com/stellar/go/keypair"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/worizon/worizontest"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+const testIssuer = "GDSRO6H2YM6MC6ZO7KORPJXSTUMBMT3E7MZ66CFVNMUAULFG6G2OP32I"
+
+func TestWalletPathPay(t *testing.T) {
+	g, closer := startTestAgent(t, withFakeHorizon(&worizontest.FakeHorizonClient{
+		Paths: []hProtocol.Path{
+			{
+				SourceAssetType:        "native",
+				SourceAmount:           "10.0000000",
+				DestinationAssetType:   "credit_alphanum4",
+				DestinationAssetCode:   "USD",
+				DestinationAssetIssuer: testIssuer,
+				DestinationAmount:      "1.0000000",
+			},
+			{
+				SourceAssetType:        "native",
+				SourceAmount:           "12.0000000",
+				DestinationAssetType:   "credit_alphanum4",
+				DestinationAssetCode:   "USD",
+				DestinationAssetIssuer: testIssuer,
+				DestinationAmount:      "1.0000000",
+				Path:                   []horizon.Asset{{Type: "credit_alphanum4", Code: "EUR", Issuer: testIssuer}},
+			},
+			{
+				// The wallet holds no EUR, so this path is skipped.
+				SourceAssetType:        "credit_alphanum4",
+				SourceAssetCode:        "EUR",
+				SourceAssetIssuer:      testIssuer,
+				SourceAmount:           "0.9000000",
+				DestinationAssetType:   "credit_alphanum4",
+				DestinationAssetCode:   "USD",
+				DestinationAssetIssuer: testIssuer,
+				DestinationAmount:      "1.0000000",
+			},
+		},
+	}))
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		w := root.Agent().Wallet()
+		w.NativeBalance = 50 * xlm.Lumen
+		root.Agent().PutWallet(w)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDest := randomAddress(t)
+	paths, err := g.FindPaymentPaths(testDest, uint64(xlm.Lumen), "USD", testIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("got %d paths, want 2", len(paths))
+	}
+	if got, want := paths[1].Path, []string{"credit_alphanum4/EUR/" + testIssuer}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("got path %v, want %v", got, want)
+	}
+
+	err = g.DoWalletPathPay(testDest, uint64(xlm.Lumen), "USD", testIssuer, "EUR", testIssuer, 100)
+	if err != errNoPath {
+		t.Errorf("got error %v paying with EUR, want %s", err, errNoPath)
+	}
+	err = g.DoWalletPathPay(testDest, uint64(xlm.Lumen), "USD", testIssuer, "", "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cheapest path costs 10 XLM; 1% slippage allows 10.1.
+	sendMax := 10*xlm.Lumen + xlm.Lumen/10
+	var (
+		w           *fsm.WalletAcct
+		cmd         *fsm.Command
+		hostFeerate xlm.Amount
+	)
+	db.View(g.db, func(root *db.Root) error {
+		w = root.Agent().Wallet()
+		hostFeerate = xlm.Amount(root.Agent().Config().HostFeerate())
+		updates := root.Agent().Updates()
+		cmd = updates.Get(updates.Bucket().Sequence()).InputCommand
+		return nil
+	})
+	if want := 50*xlm.Lumen - sendMax - hostFeerate; w.NativeBalance != want {
+		t.Errorf("got balance %s, want %s", w.NativeBalance, want)
+	}
+	if cmd == nil || cmd.SendMax != sendMax || cmd.AssetCode != "USD" {
+		t.Errorf("got command %+v, want path payment with SendMax %s", cmd, sendMax)
+	}
+}
+
+func TestPathPaymentSent(t *testing.T) {
+	var usd, eur xdr.Asset
+	usd.SetCredit("USD", mustAccountID(t, testIssuer))
+	eur.SetCredit("EUR", mustAccountID(t, testIssuer))
+	native := xdr.Asset{Type: xdr.AssetTypeAssetTypeNative}
+
+	op := &xdr.PathPaymentOp{
+		SendAsset:  native,
+		SendMax:    xdr.Int64(10 * xlm.Lumen),
+		DestAsset:  usd,
+		DestAmount: xdr.Int64(xlm.Lumen),
+		Path:       []xdr.Asset{eur},
+	}
+	res := &xdr.PathPaymentResultSuccess{
+		Offers: []xdr.ClaimOfferAtom{
+			{AssetSold: eur, AmountSold: 5, AssetBought: native, AmountBought: xdr.Int64(4 * xlm.Lumen)},
+			{AssetSold: eur, AmountSold: 5, AssetBought: native, AmountBought: xdr.Int64(5 * xlm.Lumen)},
+			{AssetSold: usd, AmountSold: xdr.Int64(xlm.Lumen), AssetBought: eur, AmountBought: 10},
+		},
+		Last: xdr.SimplePaymentResult{Asset: usd, Amount: xdr.Int64(xlm.Lumen)},
+	}
+	if got, want := pathPaymentSent(op, res), xdr.Int64(9*xlm.Lumen); got != want {
+		t.Errorf("got %d sent, want %d", got, want)
+	}
+
+	w := &fsm.WalletAcct{Balances: make(map[string]fsm.Balance)}
+	wallet := randomAddress(t)
+	creditWallet(w, wallet, native, op.SendMax-pathPaymentSent(op, res))
+	creditWallet(w, wallet, usd, op.DestAmount)
+	creditWallet(w, wallet, usd, op.DestAmount)
+	if w.NativeBalance != xlm.Lumen {
+		t.Errorf("got native balance %s, want %s", w.NativeBalance, xlm.Lumen)
+	}
+	if got := w.Balances[usd.String()].Amount; got != uint64(2*xlm.Lumen) {
+		t.Errorf("got USD balance %d, want %d", got, 2*xlm.Lumen)
+	}
+
+	// The issuer's own asset is not tracked.
+	creditWallet(w, testIssuer, eur, 10)
+	if _, ok := w.Balances[eur.String()]; ok {
+		t.Error("got balance for the wallet's own asset")
+	}
+}
+
+func TestMaxSendAmount(t *testing.T) {
+	cases := []struct {
+		estimate uint64
+		slippage uint32
+		want     uint64
+		ok       bool
+	}{
+		{1000, 0, 1000, true},
+		{1000, 100, 1010, true},
+		{1000, 10000, 2000, true},
+		{9999, 1, 9999, true}, // rounds down
+		{math.MaxInt64 / 2, 10000, math.MaxInt64 - 1, true},
+		{math.MaxInt64 / 3 * 2, 5000, math.MaxInt64 - 1, true},
+		{math.MaxInt64/2 + 1, 10000, 0, false},
+		{math.MaxInt64, 1, 0, false},
+		{math.MaxUint64, 0, 0, false},
+	}
+	for _, c := range cases {
+		got, err := maxSendAmount(c.estimate, c.slippage)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("maxSendAmount(%d, %d) = %d, %v; want %d (ok %t)", c.estimate, c.slippage, got, err, c.want, c.ok)
+		}
+	}
+}
+
+func mustAccountID(t *testing.T, address string) xdr.AccountId {
+	var id xdr.AccountId
+	err := id.SetAddress(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func randomAddress(t *testing.T) string {
+	kp, err := keypair.Random()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kp.Address()
+}
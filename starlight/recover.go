@@ -0,0 +1,237 @@
+package starlight
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/stellar/go/amount"
+	b "github.com/stellar/go/build"
+	"github.com/stellar/go/clients/horizon"
+	"github.com/stellar/go/xdr"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/mnemonic"
+	"github.com/interstellar/starlight/starlight/internal/update"
+	"github.com/interstellar/starlight/starlight/key"
+	"github.com/interstellar/starlight/worizon"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+// recoveryGapLimit is the number of consecutive unused key indexes
+// after which ConfigRecover stops looking for channel accounts.
+// Each channel takes three key indexes,
+// and the accounts of closed channels are merged away,
+// so used indexes can be far apart.
+const recoveryGapLimit = 300
+
+// Recovery describes an agent restored by ConfigRecover.
+type Recovery struct {
+	PrimaryAcct string
+
+	// Funded reports whether the wallet account
+	// exists on the ledger.
+	Funded bool
+
+	// Accounts lists the accounts derived from the seed
+	// for channels (escrow and ratchet accounts)
+	// that still exist on the ledger.
+	Accounts []*RecoveredAccount
+
+	// ScannedTo is the last key index searched.
+	// Accounts at later indexes are not found;
+	// recover again with a larger maxKeyIndex to look further.
+	ScannedTo uint32
+}
+
+// RecoveredAccount is a channel account found by ConfigRecover.
+type RecoveredAccount struct {
+	KeyIndex uint32
+	ID       string
+	Balance  xlm.Amount
+}
+
+// ExportMnemonic returns the mnemonic phrase
+// encoding the agent's seed,
+// for writing down as a backup.
+// ConfigRecover restores an agent from it.
+// The login password is required.
+func (g *Agent) ExportMnemonic(password string) (string, error) {
+	var seed []byte
+	err := db.View(g.db, func(root *db.Root) error {
+		if !g.isReadyConfigured(root) {
+			return errNotConfigured
+		}
+		if g.remote != nil {
+			return errRemoteSigner
+		}
+		digest := root.Agent().Config().PwHash()
+		if bcrypt.CompareHashAndPassword(digest, []byte(password)) != nil {
+			return errors.Wrap(errInvalidPassword, "wrong password")
+		}
+		seed = openBox(root.Agent().EncryptedSeed(), []byte(password))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if seed == nil {
+		return "", errors.Wrap(errInvalidPassword, "cannot decrypt seed")
+	}
+	return mnemonic.Encode(seed), nil
+}
+
+// ConfigRecover is like ConfigInit,
+// but restores the seed from phrase,
+// as returned by ExportMnemonic,
+// instead of generating a new one.
+//
+// If the wallet account exists on the ledger,
+// its balances and sequence number are loaded from Horizon.
+// Channel accounts derived from the seed
+// are searched for on the ledger and reported,
+// at every key index through maxKeyIndex
+// and then until recoveryGapLimit indexes in a row are unused.
+// Their channels cannot be restored,
+// but any escrow accounts found
+// still hold funds to be settled with the counterparty.
+func (g *Agent) ConfigRecover(c *Config, hostURL, phrase string, maxKeyIndex uint32) (*Recovery, error) {
+	var configured bool
+	db.View(g.db, func(root *db.Root) error {
+		configured = g.isReadyConfigured(root)
+		return nil
+	})
+	if configured {
+		return nil, errAlreadyConfigured
+	}
+	seed, err := mnemonic.Decode(phrase)
+	if err != nil {
+		return nil, errors.Sub(errInvalidMnemonic, err)
+	}
+	if len(seed) != 32 {
+		return nil, errors.Wrap(errInvalidMnemonic, "want 24 words")
+	}
+	err = g.loadNetwork(c)
+	if err != nil {
+		return nil, err
+	}
+	// WARNING: this software is not compatible with Stellar mainnet.
+	g.wclient.SetURL(c.HorizonURL)
+
+	rec := &Recovery{
+		PrimaryAcct: key.DeriveAccountPrimary(seed).Address(),
+		Accounts:    make([]*RecoveredAccount, 0), // we want json "[]" not "null"
+	}
+	acct, err := g.loadAccountIfExists(rec.PrimaryAcct)
+	if err != nil {
+		return nil, err
+	}
+	var funded *fsm.WalletAcct
+	if acct != nil {
+		funded, err = walletFromHorizon(acct, c.BaseReserve)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading wallet account")
+		}
+		rec.Funded = true
+	}
+
+	nextKeyIndex := uint32(1)
+	for i, gap := uint32(1), 0; i <= maxKeyIndex || gap < recoveryGapLimit; i++ {
+		rec.ScannedTo = i
+		id := key.DeriveAccount(seed, i).Address()
+		acct, err := g.loadAccountIfExists(id)
+		if err != nil {
+			return nil, err
+		}
+		if acct == nil {
+			gap++
+			continue
+		}
+		gap = 0
+		nextKeyIndex = i + 1
+		native, err := acct.GetNativeBalance()
+		if err != nil {
+			return nil, err
+		}
+		bal, err := amount.Parse(native)
+		if err != nil {
+			return nil, err
+		}
+		rec.Accounts = append(rec.Accounts, &RecoveredAccount{
+			KeyIndex: i,
+			ID:       id,
+			Balance:  xlm.Amount(bal),
+		})
+	}
+
+	err = g.configInit(c, hostURL, seed, funded, nextKeyIndex)
+	if err != nil {
+		return nil, err
+	}
+	if len(rec.Accounts) > 0 {
+		err = db.Update(g.db, func(root *db.Root) error {
+			g.putUpdate(root, &Update{
+				Type:    update.WarningType,
+				Warning: fmt.Sprintf("recovered %d channel accounts still on the ledger; their channels must be settled with the counterparty", len(rec.Accounts)),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+// loadAccountIfExists loads the Stellar account id,
+// returning nil if it does not exist.
+func (g *Agent) loadAccountIfExists(id string) (*worizon.Account, error) {
+	acct, err := g.wclient.LoadAccount(id)
+	if herr, ok := err.(*horizon.Error); ok && herr.Response != nil && herr.Response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading account %s", id)
+	}
+	return &acct, nil
+}
+
+// walletFromHorizon returns the wallet state
+// of the existing account acct,
+// on a network with the given base reserve.
+// The transaction stream resumes from the present.
+func walletFromHorizon(acct *worizon.Account, baseReserve xlm.Amount) (*fsm.WalletAcct, error) {
+	seqnum, err := strconv.ParseInt(acct.Sequence, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing sequence number")
+	}
+	w := &fsm.WalletAcct{
+		Reserve:  xlm.Amount(2+acct.SubentryCount) * baseReserve,
+		Seqnum:   xdr.SequenceNumber(seqnum),
+		Cursor:   "now",
+		Balances: make(map[string]fsm.Balance),
+	}
+	for _, hb := range acct.Balances {
+		bal, err := amount.Parse(hb.Balance)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing balance")
+		}
+		if hb.Type == "native" {
+			w.NativeBalance = xlm.Amount(bal) - w.Reserve
+			continue
+		}
+		asset, err := b.CreditAsset(hb.Code, hb.Issuer).ToXDR()
+		if err != nil {
+			return nil, errors.Wrap(err, "converting asset")
+		}
+		w.Balances[asset.String()] = fsm.Balance{
+			Asset:      asset,
+			Amount:     uint64(bal),
+			Authorized: true,
+		}
+	}
+	return w, nil
+}
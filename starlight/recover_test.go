@@ -0,0 +1,125 @@
+package starlight
+
+import (
+	"testing"
+
+	"github.com/stellar/go/clients/horizon"
+	"github.com/stellar/go/protocols/horizon/base"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/key"
+	"github.com/interstellar/starlight/worizon"
+	"github.com/interstellar/starlight/worizon/worizontest"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+func TestConfigRecover(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.ExportMnemonic("wrong"); errors.Root(err) != errInvalidPassword {
+		t.Errorf("got error %v, want %s", err, errInvalidPassword)
+	}
+	phrase, err := g.ExportMnemonic("passw0rd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	primary := key.DeriveAccountPrimary(g.seed).Address()
+	escrow := key.DeriveAccount(g.seed, 4).Address()
+	// Past more empty indexes than a few closed channels leave.
+	ratchet := key.DeriveAccount(g.seed, 101).Address()
+	// Past the gap limit, but within the requested scan.
+	late := key.DeriveAccount(g.seed, 450).Address()
+	g2, closer2 := startTestAgent(t)
+	defer closer2()
+	g2.wclient = worizon.NewClient(horizonHTTP{}, &worizontest.FakeHorizonClient{
+		Accounts: map[string]horizon.Account{
+			primary: {
+				Sequence:      "123",
+				SubentryCount: 1,
+				Balances: []horizon.Balance{
+					{Balance: "100.0000000", Asset: base.Asset{Type: "native"}},
+					{Balance: "2.5000000", Asset: base.Asset{Type: "credit_alphanum4", Code: "USD", Issuer: testIssuer}},
+				},
+			},
+			escrow: {
+				Balances: []horizon.Balance{
+					{Balance: "10.0000000", Asset: base.Asset{Type: "native"}},
+				},
+			},
+			ratchet: {
+				Balances: []horizon.Balance{
+					{Balance: "1.0000000", Asset: base.Asset{Type: "native"}},
+				},
+			},
+			late: {
+				Balances: []horizon.Balance{
+					{Balance: "1.0000000", Asset: base.Asset{Type: "native"}},
+				},
+			},
+		},
+	})
+
+	c := &Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}
+	if _, err := g2.ConfigRecover(c, "", "abandon abandon abandon", 0); errors.Root(err) != errInvalidMnemonic {
+		t.Errorf("got error %v, want %s", err, errInvalidMnemonic)
+	}
+	rec, err := g2.ConfigRecover(c, "", phrase, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.PrimaryAcct != primary || !rec.Funded {
+		t.Errorf("got recovery %+v, want funded account %s", rec, primary)
+	}
+	if len(rec.Accounts) != 3 ||
+		rec.Accounts[0].ID != escrow || rec.Accounts[0].KeyIndex != 4 || rec.Accounts[0].Balance != 10*xlm.Lumen ||
+		rec.Accounts[1].ID != ratchet || rec.Accounts[1].KeyIndex != 101 ||
+		rec.Accounts[2].ID != late || rec.Accounts[2].KeyIndex != 450 {
+		t.Errorf("got recovered accounts %+v, want %s at index 4, %s at 101, and %s at 450", rec.Accounts, escrow, ratchet, late)
+	}
+	if want := uint32(450 + recoveryGapLimit); rec.ScannedTo != want {
+		t.Errorf("got scan to index %d, want %d", rec.ScannedTo, want)
+	}
+	if _, err := g2.ConfigRecover(c, "", phrase, 0); err != errAlreadyConfigured {
+		t.Errorf("got error %v recovering again, want %s", err, errAlreadyConfigured)
+	}
+
+	var (
+		w    *fsm.WalletAcct
+		next uint32
+	)
+	db.View(g2.db, func(root *db.Root) error {
+		w = root.Agent().Wallet()
+		next = root.Agent().NextKeypathIndex()
+		return nil
+	})
+	if w.Seqnum != 123 {
+		t.Errorf("got seqnum %d, want 123", w.Seqnum)
+	}
+	if want := 3 * fsm.DefaultBaseReserve; w.Reserve != want {
+		t.Errorf("got reserve %s, want %s", w.Reserve, want)
+	}
+	if want := 100*xlm.Lumen - 3*fsm.DefaultBaseReserve; w.NativeBalance != want {
+		t.Errorf("got native balance %s, want %s", w.NativeBalance, want)
+	}
+	if len(w.Balances) != 1 {
+		t.Errorf("got balances %+v, want USD trustline", w.Balances)
+	}
+	if next != 451 {
+		t.Errorf("got next key index %d, want 451", next)
+	}
+}
@@ -0,0 +1,305 @@
+package starlight
+
+import (
+	"encoding/hex"
+	"time"
+
+	b "github.com/stellar/go/build"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/schedule"
+	"github.com/interstellar/starlight/starlight/internal/update"
+)
+
+// Schedule is a recurring payment made by an agent.
+type Schedule = schedule.Schedule
+
+// minScheduleInterval is the shortest interval
+// accepted by AddSchedule.
+const minScheduleInterval = time.Minute
+
+// AddSchedule registers s to pay s.Amount to s.Recipient
+// every s.Interval, starting at s.Next
+// (or one interval from now if s.Next is zero),
+// until it has made s.Count payments or is canceled.
+// Payment times are measured in ledger time.
+//
+// Wallet schedules may pay any asset
+// to an account ID or federation address.
+// Channel schedules pay lumens over the channel
+// whose ID is s.Recipient.
+//
+// The returned Schedule has its ID set.
+func (g *Agent) AddSchedule(s *Schedule) (*Schedule, error) {
+	switch s.Kind {
+	case schedule.Wallet, schedule.Channel:
+	default:
+		return nil, errors.Wrapf(errInvalidInput, "unknown schedule kind %s", s.Kind)
+	}
+	if s.Recipient == "" {
+		return nil, errEmptyAddress
+	}
+	if s.Amount <= 0 {
+		return nil, errEmptyAmount
+	}
+	if s.Interval < minScheduleInterval {
+		return nil, errors.Wrapf(errInvalidInput, "interval shorter than %s", minScheduleInterval)
+	}
+	if s.AssetCode == "" && s.Issuer != "" {
+		return nil, errEmptyAsset
+	}
+	if s.AssetCode != "" && s.Issuer == "" {
+		return nil, errEmptyIssuer
+	}
+	if s.Kind == schedule.Channel && s.AssetCode != "" {
+		return nil, errors.Wrap(errInvalidAsset, "channel schedules pay lumens")
+	}
+	if s.AssetCode != "" {
+		_, err := b.CreditAsset(s.AssetCode, s.Issuer).ToXDR()
+		if err != nil {
+			return nil, errors.Sub(errInvalidAsset, err)
+		}
+	}
+
+	id := make([]byte, 16)
+	randRead(id)
+	sched := *s
+	sched.ID = hex.EncodeToString(id)
+	sched.Runs = 0
+	sched.Paused = false
+	now := g.wclient.Now()
+	if sched.Next.IsZero() {
+		sched.Next = now.Add(sched.Interval)
+	}
+
+	err := db.Update(g.db, func(root *db.Root) error {
+		if !g.isReadyConfigured(root) {
+			return errNotConfigured
+		}
+		if sched.Kind == schedule.Channel && g.getChannel(root, sched.Recipient).ID == "" {
+			return errInvalidChannelID
+		}
+		root.Agent().Schedules().PutByString(sched.ID, &sched)
+		g.startSchedule(root, &sched)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sched, nil
+}
+
+// PauseSchedule stops the schedule with the given ID
+// from making payments until it is resumed.
+func (g *Agent) PauseSchedule(id string) error {
+	return g.updateSchedule(id, func(root *db.Root, s *Schedule) error {
+		s.Paused = true
+		g.stopTimer(root, ScheduleTimer, s.ID)
+		return nil
+	})
+}
+
+// ResumeSchedule restarts the paused schedule with the given ID.
+// Payments due while it was paused are skipped.
+func (g *Agent) ResumeSchedule(id string) error {
+	return g.updateSchedule(id, func(root *db.Root, s *Schedule) error {
+		if !s.Paused {
+			return nil
+		}
+		s.Paused = false
+		s.Advance(g.wclient.Now())
+		g.startSchedule(root, s)
+		return nil
+	})
+}
+
+// CancelSchedule removes the schedule with the given ID.
+// It makes no further payments.
+func (g *Agent) CancelSchedule(id string) error {
+	return db.Update(g.db, func(root *db.Root) error {
+		bu := root.Agent().Schedules().Bucket()
+		if bu.Get([]byte(id)) == nil {
+			return errNoSchedule
+		}
+		g.stopTimer(root, ScheduleTimer, id)
+		return bu.Delete([]byte(id))
+	})
+}
+
+// Schedules returns the registered payment schedules.
+func (g *Agent) Schedules() []*Schedule {
+	scheds := make([]*Schedule, 0) // we want json "[]" not "null"
+	err := db.View(g.db, func(root *db.Root) error {
+		bu := root.Agent().Schedules().Bucket()
+		if bu == nil {
+			return nil
+		}
+		return bu.ForEach(func(k, _ []byte) error {
+			scheds = append(scheds, root.Agent().Schedules().Get(k))
+			return nil
+		})
+	})
+	if err != nil {
+		panic(err) // only errors here are bugs
+	}
+	return scheds
+}
+
+// updateSchedule applies f to the schedule with the given ID
+// and stores the result.
+func (g *Agent) updateSchedule(id string, f func(*db.Root, *Schedule) error) error {
+	return db.Update(g.db, func(root *db.Root) error {
+		s := root.Agent().Schedules().GetByString(id)
+		if s.ID == "" {
+			return errNoSchedule
+		}
+		err := f(root, s)
+		if err != nil {
+			return err
+		}
+		root.Agent().Schedules().PutByString(s.ID, s)
+		return nil
+	})
+}
+
+// startSchedules starts a timer for each active schedule.
+// Must be called from within an update transaction.
+func (g *Agent) startSchedules(root *db.Root) error {
+	scheds := root.Agent().Schedules()
+	bu := scheds.Bucket()
+	if bu == nil {
+		return nil
+	}
+	var active []*Schedule
+	err := bu.ForEach(func(k, _ []byte) error {
+		s := scheds.Get(k)
+		if !s.Paused && !s.Done() {
+			active = append(active, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, s := range active {
+		g.startSchedule(root, s)
+	}
+	return nil
+}
+
+// startSchedule arranges for s to make its next payment
+// at ledger time s.Next,
+// replacing any timer already set for it.
+// Must be called from within an update transaction.
+func (g *Agent) startSchedule(root *db.Root, s *Schedule) {
+	id, due := s.ID, s.Next
+	g.setTimer(root, ScheduleTimer, id, due, func() {
+		g.runSchedule(id, due)
+	})
+}
+
+// runSchedule makes the payment due at time due
+// for the schedule with the given ID,
+// records the result as an update,
+// and starts the timer for the schedule's next payment.
+// It does nothing if the schedule was canceled or paused,
+// or has been rescheduled, since the timer was set.
+func (g *Agent) runSchedule(id string, due time.Time) {
+	s, err := g.claimRun(id, due)
+	if err != nil {
+		g.debugf("advancing schedule %s: %s", id, err)
+		return
+	}
+	if s == nil {
+		return
+	}
+
+	payErr := g.paySchedule(s)
+	if payErr != nil {
+		g.debugf("schedule %s payment: %s", id, payErr)
+	}
+
+	err = g.recordRun(id, due, s.Next, payErr)
+	if err != nil {
+		g.debugf("recording schedule %s run: %s", id, err)
+	}
+}
+
+// claimRun advances the schedule with the given ID
+// past the payment due at time due,
+// counting the payment as made, and returns it.
+// This happens before paying,
+// so that a crash during the payment,
+// or before its result is recorded,
+// skips this installment after a restart
+// instead of paying it twice,
+// and a schedule never pays more than its Count.
+// It returns nil if the payment is no longer due.
+func (g *Agent) claimRun(id string, due time.Time) (*Schedule, error) {
+	var s *Schedule
+	err := db.Update(g.db, func(root *db.Root) error {
+		s = root.Agent().Schedules().GetByString(id)
+		if s.ID == "" || s.Paused || s.Done() || !s.Next.Equal(due) {
+			s = nil
+			return nil
+		}
+		s.Advance(g.wclient.Now())
+		s.Runs++
+		root.Agent().Schedules().PutByString(s.ID, s)
+		return nil
+	})
+	return s, err
+}
+
+// recordRun records the result of the payment
+// claimed by claimRun, which set the schedule's next time to next.
+// If the payment failed, it is no longer counted.
+func (g *Agent) recordRun(id string, due, next time.Time, payErr error) error {
+	return db.Update(g.db, func(root *db.Root) error {
+		s := root.Agent().Schedules().GetByString(id)
+		if s.ID == "" {
+			return nil // canceled during the payment
+		}
+		if payErr != nil && s.Runs > 0 {
+			s.Runs--
+			root.Agent().Schedules().PutByString(s.ID, s)
+		}
+
+		run := &update.ScheduleRun{
+			Schedule: s,
+			Due:      due,
+		}
+		if payErr != nil {
+			run.Error = payErr.Error()
+		}
+		g.putUpdate(root, &Update{
+			Type:            update.ScheduleType,
+			ScheduleRun:     run,
+			InputLedgerTime: g.wclient.Now(),
+		})
+
+		// If the schedule was edited during the payment,
+		// the edit took care of its timer.
+		if s.Next.Equal(next) && !s.Paused && !s.Done() {
+			g.startSchedule(root, s)
+		}
+		return nil
+	})
+}
+
+// paySchedule makes one payment for s.
+func (g *Agent) paySchedule(s *Schedule) error {
+	switch s.Kind {
+	case schedule.Wallet:
+		return g.DoWalletPay(s.Recipient, uint64(s.Amount), s.AssetCode, s.Issuer, nil)
+	case schedule.Channel:
+		return g.DoCommand(s.Recipient, &fsm.Command{
+			Name:   fsm.ChannelPay,
+			Amount: s.Amount,
+			Time:   g.wclient.Now(),
+		})
+	}
+	return errors.Wrapf(errInvalidInput, "unknown schedule kind %s", s.Kind)
+}
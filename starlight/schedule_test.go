@@ -0,0 +1,215 @@
+package starlight
+
+import (
+	"testing"
+	"time"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/internal/schedule"
+	"github.com/interstellar/starlight/starlight/internal/update"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+func TestSchedule(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		w := root.Agent().Wallet()
+		w.NativeBalance = 50 * xlm.Lumen
+		root.Agent().PutWallet(w)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := randomAddress(t)
+	_, err = g.AddSchedule(&Schedule{Kind: schedule.Wallet, Recipient: dest, Amount: xlm.Lumen, Interval: time.Second})
+	if errors.Root(err) != errInvalidInput {
+		t.Errorf("got error %v for short interval, want %s", err, errInvalidInput)
+	}
+	_, err = g.AddSchedule(&Schedule{Kind: schedule.Channel, Recipient: "bogus", Amount: xlm.Lumen, Interval: time.Hour})
+	if errors.Root(err) != errInvalidChannelID {
+		t.Errorf("got error %v for unknown channel, want %s", err, errInvalidChannelID)
+	}
+
+	due := g.wclient.Now()
+	s, err := g.AddSchedule(&Schedule{
+		Kind:      schedule.Wallet,
+		Recipient: dest,
+		Amount:    xlm.Lumen,
+		Interval:  24 * time.Hour,
+		Next:      due,
+		Count:     2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Schedules(); len(got) != 1 || got[0].ID != s.ID {
+		t.Fatalf("got schedules %+v, want [%s]", got, s.ID)
+	}
+
+	// A paused schedule makes no payments.
+	err = g.PauseSchedule(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.runSchedule(s.ID, due)
+	if got := g.Schedules()[0]; got.Runs != 0 || !got.Paused {
+		t.Errorf("got schedule %+v after paused run, want no runs", got)
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		s := root.Agent().Schedules().GetByString(s.ID)
+		s.Paused = false
+		root.Agent().Schedules().PutByString(s.ID, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g.runSchedule(s.ID, due)
+	var (
+		ev  *Update
+		bal xlm.Amount
+	)
+	db.View(g.db, func(root *db.Root) error {
+		bal = root.Agent().Wallet().NativeBalance
+		updates := root.Agent().Updates()
+		ev = updates.Get(updates.Bucket().Sequence())
+		return nil
+	})
+	if ev.Type != update.ScheduleType || ev.ScheduleRun == nil {
+		t.Fatalf("got update %+v, want schedule run", ev)
+	}
+	if run := ev.ScheduleRun; run.Error != "" || run.Schedule.Runs != 1 || !run.Due.Equal(due) {
+		t.Errorf("got schedule run %+v, want one successful run due at %s", run, due)
+	}
+	if want := due.Add(24 * time.Hour); !ev.ScheduleRun.Schedule.Next.Equal(want) {
+		t.Errorf("got next run at %s, want %s", ev.ScheduleRun.Schedule.Next, want)
+	}
+	if bal >= 49*xlm.Lumen {
+		t.Errorf("got balance %s, want payment debited", bal)
+	}
+
+	// A stale timer does not pay again.
+	g.runSchedule(s.ID, due)
+	if got := g.Schedules()[0]; got.Runs != 1 {
+		t.Errorf("got %d runs after stale timer, want 1", got.Runs)
+	}
+
+	err = g.CancelSchedule(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Schedules(); len(got) != 0 {
+		t.Errorf("got schedules %+v after cancel, want none", got)
+	}
+	if err := g.CancelSchedule(s.ID); err != errNoSchedule {
+		t.Errorf("got error %v canceling twice, want %s", err, errNoSchedule)
+	}
+	if err := g.ResumeSchedule(s.ID); err != errNoSchedule {
+		t.Errorf("got error %v resuming canceled schedule, want %s", err, errNoSchedule)
+	}
+}
+
+func TestScheduleCrash(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		w := root.Agent().Wallet()
+		w.NativeBalance = 50 * xlm.Lumen
+		root.Agent().PutWallet(w)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due := g.wclient.Now()
+	s, err := g.AddSchedule(&Schedule{
+		Kind:      schedule.Wallet,
+		Recipient: randomAddress(t),
+		Amount:    xlm.Lumen,
+		Interval:  24 * time.Hour,
+		Next:      due,
+		Count:     1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The agent pays and crashes before recording the run.
+	claimed, err := g.claimRun(s.ID, due)
+	if err != nil || claimed == nil {
+		t.Fatalf("claiming run: got %v, %v", claimed, err)
+	}
+	err = g.paySchedule(claimed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart, the schedule is done.
+	err = db.Update(g.db, func(root *db.Root) error {
+		g.stopTimers()
+		return g.startSchedules(root)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Timers(); len(got) != 0 {
+		t.Errorf("got timers %+v after restart, want none", got)
+	}
+	if got := g.Schedules()[0]; got.Runs != 1 || !got.Done() {
+		t.Errorf("got schedule %+v after restart, want done after 1 run", got)
+	}
+
+	// A failed payment is not counted.
+	s, err = g.AddSchedule(&Schedule{
+		Kind:      schedule.Wallet,
+		Recipient: randomAddress(t),
+		Amount:    100 * xlm.Lumen,
+		Interval:  24 * time.Hour,
+		Next:      due,
+		Count:     1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.runSchedule(s.ID, due)
+	for _, got := range g.Schedules() {
+		if got.ID == s.ID && got.Runs != 0 {
+			t.Errorf("got %d runs after failed payment, want 0", got.Runs)
+		}
+	}
+}
+
+func TestScheduleAdvance(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &Schedule{Interval: time.Hour, Next: start}
+	s.Advance(start.Add(-time.Minute))
+	if !s.Next.Equal(start) {
+		t.Errorf("got next %s before due, want %s", s.Next, start)
+	}
+	s.Advance(start.Add(150 * time.Minute))
+	if want := start.Add(3 * time.Hour); !s.Next.Equal(want) {
+		t.Errorf("got next %s, want %s", s.Next, want)
+	}
+}
@@ -0,0 +1,180 @@
+package starlight
+
+import (
+	"os"
+	"path/filepath"
+
+	b "github.com/stellar/go/build"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/internal/keyfile"
+	"github.com/interstellar/starlight/starlight/key"
+)
+
+// A SeedProvider supplies the agent's secret entropy seed
+// without a login,
+// so an agent can sign again after a restart
+// before anyone logs in.
+// See Unlock.
+type SeedProvider interface {
+	// Seed returns the seed for the agent
+	// whose primary account is acct.
+	// Providers that unseal the database's copy
+	// of the seed use encrypted;
+	// others may ignore it.
+	Seed(acct string, encrypted []byte) ([]byte, error)
+}
+
+// SeedProviderFunc adapts an ordinary function to a SeedProvider.
+type SeedProviderFunc func(acct string, encrypted []byte) ([]byte, error)
+
+// Seed implements SeedProvider.
+func (f SeedProviderFunc) Seed(acct string, encrypted []byte) ([]byte, error) {
+	return f(acct, encrypted)
+}
+
+// Unlock gets the agent's seed from p,
+// allowing private-key operations to proceed
+// as if the user had logged in.
+// It does nothing if the seed is already available
+// or if the agent has not been configured.
+// It is an error if p's seed does not belong to the agent.
+func (g *Agent) Unlock(p SeedProvider) error {
+	var (
+		acct      string
+		encrypted []byte
+		unlocked  bool
+	)
+	err := db.View(g.db, func(root *db.Root) error {
+		if !g.isReadyConfigured(root) {
+			return nil
+		}
+		acct = root.Agent().PrimaryAcct().Address()
+		encrypted = root.Agent().EncryptedSeed()
+		unlocked = g.signer() != nil
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if acct == "" || unlocked {
+		return nil
+	}
+	seed, err := p.Seed(acct, encrypted)
+	if err != nil {
+		return errors.Wrap(err, "getting seed")
+	}
+	if seed == nil || key.DeriveAccountPrimary(seed).Address() != acct {
+		return errWrongSeed
+	}
+	return db.Update(g.db, func(root *db.Root) error {
+		if g.seed == nil {
+			g.seed = seed
+			g.logf("seed unlocked")
+			g.resumeTimeouts(root)
+		}
+		return nil
+	})
+}
+
+// PasswordSeed returns a SeedProvider
+// that unseals the database's copy of the seed
+// with the login password, as Authenticate does.
+func PasswordSeed(password string) SeedProvider {
+	return SeedProviderFunc(func(_ string, encrypted []byte) ([]byte, error) {
+		seed := openBox(encrypted, []byte(password))
+		if seed == nil {
+			return nil, errWrongSeed
+		}
+		return seed, nil
+	})
+}
+
+// KeyFileSeed returns a SeedProvider
+// that reads the login password from the file at path
+// and unseals the seed with it.
+// Trailing whitespace in the file is ignored.
+// The file must not be accessible to group or other users.
+func KeyFileSeed(path string) SeedProvider {
+	return SeedProviderFunc(func(acct string, encrypted []byte) ([]byte, error) {
+		password, err := keyfile.Read(path)
+		if err != nil {
+			return nil, err
+		}
+		return PasswordSeed(password).Seed(acct, encrypted)
+	})
+}
+
+// CredentialSeed returns a SeedProvider
+// that unseals the seed with the login password
+// from the systemd credential name,
+// or, if there is no such credential,
+// from the environment variable name.
+// The environment variable is unset once read.
+func CredentialSeed(name string) SeedProvider {
+	return SeedProviderFunc(func(acct string, encrypted []byte) ([]byte, error) {
+		if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return KeyFileSeed(path).Seed(acct, encrypted)
+			}
+		}
+		password, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, errors.Wrapf(errNoCredential, "%s", name)
+		}
+		os.Unsetenv(name)
+		return PasswordSeed(password).Seed(acct, encrypted)
+	})
+}
+
+// UseSigner makes the agent sign with s,
+// such as a signer.Client for a signer daemon
+// holding the seed in another process,
+// instead of with its own copy of the seed.
+// Logging in no longer decrypts the seed.
+// It is an error if the agent is not configured
+// or if s's primary account does not belong to the agent.
+func (g *Agent) UseSigner(s key.Signer) error {
+	return db.Update(g.db, func(root *db.Root) error {
+		if !g.isReadyConfigured(root) {
+			return errNotConfigured
+		}
+		addr, err := s.Address(key.PrimaryAccountIndex)
+		if err != nil {
+			return errors.Wrap(err, "getting signer address")
+		}
+		if addr != root.Agent().PrimaryAcct().Address() {
+			return errWrongSeed
+		}
+		g.remote = s
+		g.seed = nil
+		g.logf("using remote signer")
+		g.resumeTimeouts(root)
+		return nil
+	})
+}
+
+// signer returns the Signer for the agent's keys,
+// or nil if the seed is unavailable.
+// Must be called from within a transaction.
+func (g *Agent) signer() key.Signer {
+	if g.remote != nil {
+		return g.remote
+	}
+	if g.seed != nil {
+		return key.SeedSigner(g.seed)
+	}
+	return nil
+}
+
+// signWallet signs btx with the primary account key.
+// Must be called from within an update transaction.
+func (g *Agent) signWallet(btx *b.TransactionBuilder) (b.TransactionEnvelopeBuilder, error) {
+	s := g.signer()
+	if s == nil {
+		return b.TransactionEnvelopeBuilder{}, errLocked
+	}
+	return key.SignEnvelope(s, btx, key.PrimaryAccountIndex)
+}
@@ -0,0 +1,110 @@
+package starlight
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/key"
+)
+
+func TestUnlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	err = ioutil.WriteFile(keyFile, []byte("passw0rd\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	looseKeyFile := filepath.Join(dir, "loose")
+	err = ioutil.WriteFile(looseKeyFile, []byte("passw0rd\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("STARLIGHT_TEST_PASSWORD", "passw0rd")
+
+	cases := []struct {
+		name string
+		p    SeedProvider
+		err  error
+	}{
+		{"password", PasswordSeed("passw0rd"), nil},
+		{"wrong password", PasswordSeed("bogus"), errWrongSeed},
+		{"key file", KeyFileSeed(keyFile), nil},
+		{"loose key file", KeyFileSeed(looseKeyFile), errInsecureKeyFile},
+		{"credential", CredentialSeed("STARLIGHT_TEST_PASSWORD"), nil},
+		{"missing credential", CredentialSeed("STARLIGHT_TEST_PASSWORD"), errNoCredential},
+		{"wrong seed", SeedProviderFunc(func(string, []byte) ([]byte, error) {
+			return make([]byte, 32), nil
+		}), errWrongSeed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g, closer := startTestAgent(t)
+			defer closer()
+			err := g.ConfigInit(&Config{
+				Username:   "alice",
+				Password:   "passw0rd",
+				HorizonURL: testHorizonURL,
+			}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			g.mustDeauthenticate()
+
+			err = g.Unlock(c.p)
+			if errors.Root(err) != c.err {
+				t.Fatalf("got error %v, want %v", err, c.err)
+			}
+			if unlocked := g.seed != nil; unlocked != (c.err == nil) {
+				t.Errorf("got unlocked %t, want %t", unlocked, c.err == nil)
+			}
+		})
+	}
+}
+
+func TestUseSigner(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	if err := g.UseSigner(key.SeedSigner(nil)); err != errNotConfigured {
+		t.Errorf("got error %v, want %s", err, errNotConfigured)
+	}
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := g.seed
+
+	if err := g.UseSigner(key.SeedSigner([]byte("wrong"))); err != errWrongSeed {
+		t.Errorf("got error %v, want %s", err, errWrongSeed)
+	}
+	err = g.UseSigner(key.SeedSigner(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.seed != nil {
+		t.Error("agent still holds the seed")
+	}
+	if !g.Authenticate("alice", "passw0rd") {
+		t.Fatal("login failed")
+	}
+	if g.seed != nil {
+		t.Error("login decrypted the seed")
+	}
+	if g.isLocked() {
+		t.Error("agent locked with remote signer")
+	}
+	if _, err := g.ExportMnemonic("passw0rd"); err != errRemoteSigner {
+		t.Errorf("got error %v, want %s", err, errRemoteSigner)
+	}
+}
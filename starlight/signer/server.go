@@ -0,0 +1,373 @@
+package signer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/key"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+// DefaultKeyIndexes is the number of account keys
+// a Server derives in advance
+// if its KeyIndexes field is zero.
+const DefaultKeyIndexes = 1000
+
+// DefaultPeriod is the spending limit period
+// used if a Policy's Period is zero.
+const DefaultPeriod = 24 * time.Hour
+
+// Policy restricts what a Server will sign.
+//
+// Whatever its policy, a Server signs only channel messages
+// and transactions made of the operations Starlight builds:
+// creating accounts, payments, path payments, merges,
+// trustlines, sequence bumps,
+// and setting options on channel accounts.
+// It never changes the primary account's signers,
+// thresholds, or flags.
+type Policy struct {
+	// Limit, if positive, is the most lumens
+	// the primary account may send in any Period,
+	// including to fund channels.
+	// Only lumens count toward the limit:
+	// payments of other assets, and path payments
+	// that send them, are restricted only by Destinations.
+	// While a limit is set,
+	// the primary account may be merged only
+	// into an account in Destinations.
+	Limit  xlm.Amount
+	Period time.Duration
+
+	// Destinations, if non-empty, lists the accounts,
+	// besides the agent's own accounts,
+	// that the primary account and the derived channel accounts
+	// may send to, merge into, or add as signers.
+	// Channel counterparties must be listed
+	// for channels to open and settle.
+	Destinations map[string]bool
+}
+
+// Server signs requests from Clients
+// with the keys derived from Seed.
+type Server struct {
+	Seed   []byte
+	Policy Policy
+
+	// Audit, if non-nil, receives a line of JSON
+	// describing each request and its outcome.
+	Audit io.Writer
+
+	// KeyIndexes is the number of account keys
+	// whose addresses are derived in advance,
+	// to recognize the agent's own accounts
+	// as payment destinations.
+	// Keys requested by the agent are added as they're seen.
+	KeyIndexes uint32
+
+	once    sync.Once
+	primary string
+
+	mu      sync.Mutex
+	derived map[string]bool
+	spends  []spend
+}
+
+type spend struct {
+	at     time.Time
+	txhash [32]byte
+	amount xlm.Amount
+}
+
+// AuditEntry is the JSON object written to a Server's audit log.
+type AuditEntry struct {
+	Time   time.Time
+	Op     string
+	Index  uint32
+	TxHash string     `json:",omitempty"`
+	Spend  xlm.Amount `json:",omitempty"`
+	Result string     // "ok", "refused", or "error"
+	Reason string     `json:",omitempty"`
+}
+
+func (s *Server) init() {
+	s.once.Do(func() {
+		n := s.KeyIndexes
+		if n == 0 {
+			n = DefaultKeyIndexes
+		}
+		s.primary = key.DeriveAccountPrimary(s.Seed).Address()
+		s.derived = make(map[string]bool, n)
+		for i := uint32(0); i < n; i++ {
+			s.derived[key.DeriveAccount(s.Seed, i).Address()] = true
+		}
+	})
+}
+
+// Serve accepts connections on l
+// and handles a request on each.
+// It returns when l's Accept method fails.
+func (s *Server) Serve(l net.Listener) error {
+	s.init()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		log.Printf("signer: reading request: %s", err)
+		return
+	}
+	var req Request
+	resp := new(Response)
+	err = json.Unmarshal(line, &req)
+	if err != nil {
+		resp.Error = "decoding request: " + err.Error()
+	} else {
+		resp = s.Do(&req)
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
+
+// Do handles req and returns the response,
+// logging it to the audit log.
+func (s *Server) Do(req *Request) *Response {
+	s.init()
+	entry := &AuditEntry{
+		Time:   time.Now(),
+		Op:     req.Op,
+		Index:  req.Index,
+		Result: "ok",
+	}
+	resp, err := s.do(req, entry)
+	if err != nil {
+		resp = &Response{Error: err.Error()}
+		entry.Result = "error"
+		if errors.Root(err) == ErrRefused {
+			resp.Refused = true
+			entry.Result = "refused"
+		}
+		entry.Reason = err.Error()
+	}
+	s.audit(entry)
+	return resp
+}
+
+func (s *Server) do(req *Request, entry *AuditEntry) (*Response, error) {
+	switch req.Op {
+	case OpAddress:
+		return &Response{Address: s.address(req.Index)}, nil
+	case OpSignMessage:
+		err := checkMessage(req.Message)
+		if err != nil {
+			return nil, err
+		}
+		sig, err := key.SeedSigner(s.Seed).SignMessage(req.Message)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{MsgSig: sig}, nil
+	case OpSignTx:
+		var tx xdr.Transaction
+		err := xdr.SafeUnmarshalBase64(req.Tx, &tx)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding transaction")
+		}
+		txhash, err := network.HashTransaction(&tx, req.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		entry.TxHash = hex.EncodeToString(txhash[:])
+		s.address(req.Index)
+		entry.Spend, err = s.check(&tx, req.Index, txhash, entry.Time)
+		if err != nil {
+			return nil, err
+		}
+		sig, err := key.SeedSigner(s.Seed).SignTx(&tx, req.Passphrase, req.Index)
+		if err != nil {
+			return nil, err
+		}
+		sigstr, err := xdr.MarshalBase64(sig)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Signature: sigstr}, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", req.Op)
+}
+
+// checkMessage returns an error wrapping ErrRefused
+// unless msg is the signed form of a channel message,
+// as the agent sends to its counterparties.
+// Anything else, such as a transaction hash,
+// could be used in place of a signature the policy forbids.
+func checkMessage(msg []byte) error {
+	var m fsm.Message
+	err := json.Unmarshal(msg, &m)
+	if err != nil {
+		return errors.Wrap(ErrRefused, "not a channel message")
+	}
+	var n int
+	for _, p := range []bool{
+		m.ChannelProposeMsg != nil,
+		m.ChannelAcceptMsg != nil,
+		m.PaymentProposeMsg != nil,
+		m.PaymentAcceptMsg != nil,
+		m.PaymentCompleteMsg != nil,
+		m.CloseMsg != nil,
+	} {
+		if p {
+			n++
+		}
+	}
+	if m.ChannelID == "" || m.Signature != nil || n != 1 {
+		return errors.Wrap(ErrRefused, "malformed channel message")
+	}
+	b, err := json.Marshal(m)
+	if err != nil || !bytes.Equal(b, msg) {
+		return errors.Wrap(ErrRefused, "non-canonical channel message")
+	}
+	return nil
+}
+
+// address returns the address of the key at index i,
+// remembering it as one of the agent's own accounts.
+func (s *Server) address(i uint32) string {
+	addr := key.DeriveAccount(s.Seed, i).Address()
+	s.mu.Lock()
+	s.derived[addr] = true
+	s.mu.Unlock()
+	return addr
+}
+
+// check returns an error wrapping ErrRefused
+// if the policy forbids signing tx with the key at index i.
+// Otherwise it returns the lumens tx sends from the primary account,
+// counting them against the spending limit
+// if i is the primary key's index.
+func (s *Server) check(tx *xdr.Transaction, i uint32, txhash [32]byte, now time.Time) (xlm.Amount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total xlm.Amount
+	for _, op := range tx.Operations {
+		src := tx.SourceAccount.Address()
+		if op.SourceAccount != nil {
+			src = op.SourceAccount.Address()
+		}
+		fromPrimary := src == s.primary
+		fromOwn := fromPrimary || s.derived[src]
+
+		var (
+			dest   string
+			amount xlm.Amount
+		)
+		switch op.Body.Type {
+		case xdr.OperationTypeCreateAccount:
+			o := op.Body.MustCreateAccountOp()
+			dest = o.Destination.Address()
+			amount = xlm.Amount(o.StartingBalance)
+		case xdr.OperationTypePayment:
+			o := op.Body.MustPaymentOp()
+			dest = o.Destination.Address()
+			if o.Asset.Type == xdr.AssetTypeAssetTypeNative {
+				amount = xlm.Amount(o.Amount)
+			}
+		case xdr.OperationTypePathPayment:
+			o := op.Body.MustPathPaymentOp()
+			dest = o.Destination.Address()
+			if o.SendAsset.Type == xdr.AssetTypeAssetTypeNative {
+				amount = xlm.Amount(o.SendMax)
+			}
+		case xdr.OperationTypeAccountMerge:
+			d := op.Body.MustDestination()
+			dest = d.Address()
+			if fromPrimary && s.Policy.Limit > 0 && !s.Policy.Destinations[dest] {
+				return 0, errors.Wrapf(ErrRefused, "merging primary account into %s", dest)
+			}
+		case xdr.OperationTypeSetOptions:
+			o := op.Body.MustSetOptionsOp()
+			if fromPrimary && (o.Signer != nil || o.MasterWeight != nil ||
+				o.LowThreshold != nil || o.MedThreshold != nil || o.HighThreshold != nil ||
+				o.SetFlags != nil || o.ClearFlags != nil || o.InflationDest != nil) {
+				return 0, errors.Wrap(ErrRefused, "changing primary account options")
+			}
+			if o.Signer != nil {
+				dest = o.Signer.Key.Address()
+			}
+		case xdr.OperationTypeChangeTrust, xdr.OperationTypeBumpSequence:
+		default:
+			return 0, errors.Wrapf(ErrRefused, "operation type %s", op.Body.Type)
+		}
+
+		if !fromOwn || dest == "" || dest == s.primary {
+			continue
+		}
+		if len(s.Policy.Destinations) > 0 && !s.derived[dest] && !s.Policy.Destinations[dest] {
+			return 0, errors.Wrapf(ErrRefused, "destination %s", dest)
+		}
+		if fromPrimary {
+			total += amount
+		}
+	}
+
+	if i != key.PrimaryAccountIndex || s.Policy.Limit <= 0 || total == 0 {
+		return total, nil
+	}
+	period := s.Policy.Period
+	if period == 0 {
+		period = DefaultPeriod
+	}
+	var spent xlm.Amount
+	recent := s.spends[:0]
+	for _, sp := range s.spends {
+		if sp.at.Before(now.Add(-period)) {
+			continue
+		}
+		if sp.txhash == txhash {
+			return total, nil // already counted
+		}
+		recent = append(recent, sp)
+		spent += sp.amount
+	}
+	s.spends = recent
+	if spent+total > s.Policy.Limit {
+		return 0, errors.Wrapf(ErrRefused, "spending limit: %s sent in the last %s", spent, period)
+	}
+	s.spends = append(s.spends, spend{at: now, txhash: txhash, amount: total})
+	return total, nil
+}
+
+func (s *Server) audit(e *AuditEntry) {
+	if s.Audit == nil {
+		return
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Audit.Write(append(b, '\n'))
+}
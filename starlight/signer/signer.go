@@ -0,0 +1,147 @@
+// Package signer keeps a Starlight agent's seed
+// in a separate process from the agent.
+//
+// A Server holds the seed and signs on request
+// over a local socket, subject to a Policy,
+// and keeps an audit log of every request.
+// A Client is the agent's side of the connection;
+// it implements key.Signer.
+//
+// The protocol is one request and one response per connection,
+// each a single line holding a JSON object.
+// See Request and Response.
+package signer
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/internal/keyfile"
+	"github.com/interstellar/starlight/starlight/internal/mnemonic"
+	"github.com/interstellar/starlight/starlight/key"
+)
+
+// Request operations.
+const (
+	OpAddress     = "address"
+	OpSignTx      = "sign-tx"
+	OpSignMessage = "sign-message"
+)
+
+// ErrRefused is returned when the signer's policy
+// forbids a signature.
+var ErrRefused = errors.New("signature refused by policy")
+
+// timeout bounds an exchange with the signer.
+const timeout = 10 * time.Second
+
+// Request is a request to the signer.
+type Request struct {
+	Op         string
+	Index      uint32 // for OpAddress and OpSignTx
+	Passphrase string // for OpSignTx
+	Tx         string // base64 XDR transaction, for OpSignTx
+	Message    []byte // for OpSignMessage
+}
+
+// Response is the signer's reply to a Request.
+type Response struct {
+	Address   string
+	Signature string // base64 XDR decorated signature, for OpSignTx
+	MsgSig    []byte // for OpSignMessage
+	Refused   bool
+	Error     string
+}
+
+// Client is a key.Signer
+// that asks a Server listening on a Unix socket to sign.
+type Client struct {
+	Path string
+}
+
+var _ key.Signer = (*Client)(nil)
+
+// Address implements key.Signer.
+func (c *Client) Address(i uint32) (string, error) {
+	resp, err := c.do(&Request{Op: OpAddress, Index: i})
+	if err != nil {
+		return "", err
+	}
+	return resp.Address, nil
+}
+
+// SignTx implements key.Signer.
+func (c *Client) SignTx(tx *xdr.Transaction, passphrase string, i uint32) (xdr.DecoratedSignature, error) {
+	var sig xdr.DecoratedSignature
+	txstr, err := xdr.MarshalBase64(tx)
+	if err != nil {
+		return sig, err
+	}
+	resp, err := c.do(&Request{
+		Op:         OpSignTx,
+		Index:      i,
+		Passphrase: passphrase,
+		Tx:         txstr,
+	})
+	if err != nil {
+		return sig, err
+	}
+	err = xdr.SafeUnmarshalBase64(resp.Signature, &sig)
+	return sig, errors.Wrap(err, "decoding signature")
+}
+
+// SignMessage implements key.Signer.
+func (c *Client) SignMessage(msg []byte) ([]byte, error) {
+	resp, err := c.do(&Request{Op: OpSignMessage, Message: msg})
+	if err != nil {
+		return nil, err
+	}
+	return resp.MsgSig, nil
+}
+
+func (c *Client) do(req *Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", c.Path, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	err = json.NewEncoder(conn).Encode(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "writing signer request")
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "reading signer response")
+	}
+	resp := new(Response)
+	err = json.Unmarshal(line, resp)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding signer response")
+	}
+	if resp.Refused {
+		return nil, errors.Sub(ErrRefused, errors.New(resp.Error))
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// ReadSeedFile returns the seed encoded by the mnemonic
+// in the file at path,
+// as returned by the agent's config-init or export-mnemonic.
+// The file must not be accessible to group or other users.
+func ReadSeedFile(path string) ([]byte, error) {
+	phrase, err := keyfile.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	return mnemonic.Decode(phrase)
+}
@@ -0,0 +1,172 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	b "github.com/stellar/go/build"
+	"github.com/stellar/go/network"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/key"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+func TestSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	seed := make([]byte, 32)
+	seed[0] = 1
+	allowed := key.DeriveAccount([]byte("allowed"), 0).Address()
+	other := key.DeriveAccount([]byte("other"), 0).Address()
+	var audit bytes.Buffer
+	s := &Server{
+		Seed: seed,
+		Policy: Policy{
+			Limit:        15 * xlm.Lumen,
+			Destinations: map[string]bool{allowed: true},
+		},
+		Audit:      &audit,
+		KeyIndexes: 10,
+	}
+	go s.Serve(l)
+	c := &Client{Path: path}
+
+	primary, err := c.Address(key.PrimaryAccountIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := key.DeriveAccountPrimary(seed).Address(); primary != want {
+		t.Errorf("got primary address %s, want %s", primary, want)
+	}
+	escrow, _ := key.SeedSigner(seed).Address(4)
+
+	cases := []struct {
+		name string
+		op   b.TransactionMutator
+		want error
+	}{
+		{"allowed destination", b.Payment(b.Destination{AddressOrSeed: allowed}, b.NativeAmount{Amount: "10"}), nil},
+		{"own account", b.CreateAccount(b.Destination{AddressOrSeed: escrow}, b.NativeAmount{Amount: "1"}), nil},
+		{"other destination", b.Payment(b.Destination{AddressOrSeed: other}, b.NativeAmount{Amount: "1"}), ErrRefused},
+		{"over limit", b.Payment(b.Destination{AddressOrSeed: allowed}, b.NativeAmount{Amount: "5"}), ErrRefused},
+		{"add signer", b.SetOptions(b.AddSigner(other, 1)), ErrRefused},
+		{"home domain", b.SetOptions(b.HomeDomain("example.com")), nil},
+		{"merge", b.AccountMerge(b.Destination{AddressOrSeed: allowed}), nil},
+	}
+	for i, tc := range cases {
+		tx, err := b.Transaction(
+			b.Network{Passphrase: network.TestNetworkPassphrase},
+			b.SourceAccount{AddressOrSeed: primary},
+			b.Sequence{Sequence: uint64(i + 1)},
+			tc.op,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env, err := key.SignEnvelope(c, tx, key.PrimaryAccountIndex)
+		if errors.Root(err) != tc.want {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, tc.want)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		want, err := key.SignEnvelope(key.SeedSigner(seed), tx, key.PrimaryAccountIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(env.E.Signatures[0].Signature, want.E.Signatures[0].Signature) {
+			t.Errorf("%s: got wrong signature", tc.name)
+		}
+	}
+
+	// Derived channel accounts are held to the same destinations.
+	escrowCases := []struct {
+		name string
+		op   b.TransactionMutator
+		want error
+	}{
+		{"escrow to primary", b.Payment(b.Destination{AddressOrSeed: primary}, b.NativeAmount{Amount: "1"}), nil},
+		{"escrow to allowed", b.Payment(b.Destination{AddressOrSeed: allowed}, b.NativeAmount{Amount: "100"}), nil},
+		{"escrow to other", b.Payment(b.Destination{AddressOrSeed: other}, b.NativeAmount{Amount: "1"}), ErrRefused},
+		{"escrow merge", b.AccountMerge(b.Destination{AddressOrSeed: other}), ErrRefused},
+		{"escrow add other signer", b.SetOptions(b.AddSigner(other, 1)), ErrRefused},
+		{"escrow add allowed signer", b.SetOptions(b.AddSigner(allowed, 1)), nil},
+	}
+	for i, tc := range escrowCases {
+		tx, err := b.Transaction(
+			b.Network{Passphrase: network.TestNetworkPassphrase},
+			b.SourceAccount{AddressOrSeed: escrow},
+			b.Sequence{Sequence: uint64(i + 1)},
+			tc.op,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = key.SignEnvelope(c, tx, 4)
+		if errors.Root(err) != tc.want {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	msg, err := json.Marshal(fsm.Message{ChannelID: escrow, MsgNum: 1, CloseMsg: &fsm.CloseMsg{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgsig, err := c.SignMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.DeriveAccountPrimary(seed).Verify(msg, msgsig); err != nil {
+		t.Errorf("verifying message signature: %s", err)
+	}
+
+	// A transaction hash signed as a message
+	// would be a valid signature on the transaction.
+	tx, err := b.Transaction(
+		b.Network{Passphrase: network.TestNetworkPassphrase},
+		b.SourceAccount{AddressOrSeed: primary},
+		b.Sequence{Sequence: 100},
+		b.Payment(b.Destination{AddressOrSeed: other}, b.NativeAmount{Amount: "100"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txhash, err := tx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	badMsgs := [][]byte{
+		txhash[:],
+		[]byte("hello"),
+		[]byte(`{"ChannelID":"x"}`),
+		append(msg, ' '),
+	}
+	for _, m := range badMsgs {
+		_, err = c.SignMessage(m)
+		if errors.Root(err) != ErrRefused {
+			t.Errorf("SignMessage(%q): got error %v, want %v", m, err, ErrRefused)
+		}
+	}
+
+	if got, want := bytes.Count(audit.Bytes(), []byte("\n")), 1+len(cases)+len(escrowCases)+1+len(badMsgs); got != want {
+		t.Errorf("got %d audit entries, want %d", got, want)
+	}
+}
@@ -9,16 +9,22 @@ import (
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	bolt "github.com/coreos/bbolt"
 	"github.com/stellar/go/network"
 	"github.com/stellar/go/xdr"
 
+	"github.com/interstellar/starlight/clock"
 	"github.com/interstellar/starlight/worizon"
 	"github.com/interstellar/starlight/worizon/worizontest"
+	"github.com/interstellar/starlight/worizon/xlm"
 )
 
-func startTestAgent(t *testing.T) (*Agent, func()) {
+// startTestAgent starts an agent on a temporary database
+// with a fake Horizon and peers,
+// then applies opts.
+func startTestAgent(t *testing.T, opts ...Option) (*Agent, func()) {
 	f, err := ioutil.TempFile("", "starlight")
 	if err != nil {
 		t.Fatal(err)
@@ -29,12 +35,11 @@ func startTestAgent(t *testing.T) (*Agent, func()) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	g, err := StartAgent(context.Background(), db)
+	opts = append([]Option{withFakeHorizon(new(worizontest.FakeHorizonClient))}, opts...)
+	g, err := StartAgent(context.Background(), db, opts...)
 	if err != nil {
 		t.Fatal(err)
 	}
-	g.wclient = worizon.NewClient(horizonHTTP{}, &worizontest.FakeHorizonClient{})
-	g.httpclient.Transport = agentHTTP{}
 	cleanup := func() {
 		g.CloseWait()
 		db.Close()
@@ -43,6 +48,40 @@ func startTestAgent(t *testing.T) (*Agent, func()) {
 	return g, cleanup
 }
 
+// withFakeHorizon makes an agent talk to Horizon with h
+// and to peers with agentHTTP.
+func withFakeHorizon(h *worizontest.FakeHorizonClient) Option {
+	return WithNetwork(worizon.NewClient(horizonHTTP{}, h), agentHTTP{})
+}
+
+// manualClock returns a manual clock set to start
+// and an option that puts an agent on it,
+// with a fake Horizon that closes a ledger
+// at the clock's time as it advances.
+func manualClock(start time.Time) (*clock.Manual, Option) {
+	clk := clock.NewManual(start)
+	return clk, func(g *Agent) {
+		withFakeHorizon(&worizontest.FakeHorizonClient{Clock: clk})(g)
+		WithClock(clk)(g)
+	}
+}
+
+// advanceUntil advances clk in small steps,
+// letting agents and ledger streams keep up,
+// until cond returns true.
+// It fails t if that takes more than max.
+func advanceUntil(t *testing.T, clk *clock.Manual, max time.Duration, cond func() bool) {
+	t.Helper()
+	const step = 30 * time.Second // less than worizon's ledger timeout
+	for d := time.Duration(0); !cond(); d += step {
+		if d > max {
+			t.Fatalf("condition not met after %s", max)
+		}
+		clk.Advance(step)
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
 type agentHTTP struct{}
 
 func (a agentHTTP) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -61,7 +100,14 @@ func (a agentHTTP) RoundTrip(req *http.Request) (*http.Response, error) {
 				Body:       ioutil.NopCloser(bytes.NewBufferString("ok")),
 			}, nil
 		}
-	case "friendbot.stellar.org":
+		if req.URL.Path == "/hook" && req.Header.Get("Starlight-Signature") != "" {
+			return &http.Response{
+				StatusCode: 200,
+				Header:     make(http.Header),
+				Body:       ioutil.NopCloser(bytes.NewBufferString("ok")),
+			}, nil
+		}
+	case "friendbot.stellar.org", "friendbot.standalone.test":
 		return &http.Response{
 			StatusCode: 200,
 			Header:     make(http.Header),
@@ -125,6 +171,21 @@ func mockFederation(req *http.Request) (*http.Response, error) {
 			StatusCode: 200,
 			Body:       ioutil.NopCloser(bytes.NewBuffer(buf)),
 		}, nil
+	case "carol*starlight.com":
+		// Payments to carol need a memo.
+		buf, err := json.Marshal(map[string]string{
+			"stellar_address": q,
+			"account_id":      "GBOJVRYHEQRGBQDUT6B5C6HJYHVSY2LP65DRYJRXZWR2QZHTXFS3W4KL",
+			"memo_type":       "id",
+			"memo":            "7",
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBuffer(buf)),
+		}, nil
 	case "bob*localhost:7000":
 		var acct xdr.AccountId
 		acct.SetAddress("GAIPBPU6OC4JGYLQ4WI6LFYECMN43RVK3EI7N3TL3CVVM6MBIC2QART2")
@@ -149,22 +210,52 @@ func mockFederation(req *http.Request) (*http.Response, error) {
 
 type horizonHTTP struct{}
 
+// A private network served by horizonHTTP.
+const (
+	testStandaloneURL        = "https://horizon.standalone.test"
+	testStandalonePassphrase = "Standalone Network ; February 2017"
+	testStandaloneReserve    = xlm.Lumen
+)
+
 func (h horizonHTTP) RoundTrip(req *http.Request) (*http.Response, error) {
 	// WARNING: this software is not compatible with Stellar mainnet.
-	if req.Host == "horizon-testnet.stellar.org" || req.Host == "new-horizon-testnet.stellar.org" {
-		if (req.URL.Path == "" && req.Method == "GET") || (req.URL.Path == "/transactions" && req.Method == "POST") {
-			buf, err := json.Marshal(map[string]string{
-				"horizon_version":    "test",
-				"network_passphrase": network.TestNetworkPassphrase,
-			})
-			if err != nil {
-				panic(err)
-			}
-			return &http.Response{
-				StatusCode: 200,
-				Body:       ioutil.NopCloser(bytes.NewBuffer(buf)),
-			}, nil
+	var (
+		root        = map[string]interface{}{"horizon_version": "test"}
+		baseReserve = 500 * xlm.Millilumen
+	)
+	switch req.Host {
+	case "horizon-testnet.stellar.org", "new-horizon-testnet.stellar.org":
+		root["network_passphrase"] = network.TestNetworkPassphrase
+		root["_links"] = map[string]interface{}{
+			"friendbot": map[string]interface{}{"href": "https://friendbot.stellar.org/{?addr}", "templated": true},
 		}
+	case "horizon.standalone.test":
+		root["network_passphrase"] = testStandalonePassphrase
+		baseReserve = testStandaloneReserve
+	default:
+		return nil, errors.New("not implemented")
 	}
-	return nil, errors.New("not implemented")
+	var v interface{}
+	switch {
+	case (req.URL.Path == "" && req.Method == "GET") || (req.URL.Path == "/transactions" && req.Method == "POST"):
+		v = root
+	case req.URL.Path == "/ledgers" && req.Method == "GET":
+		v = map[string]interface{}{
+			"_embedded": map[string]interface{}{
+				"records": []interface{}{
+					map[string]interface{}{"sequence": 1, "base_reserve_in_stroops": baseReserve},
+				},
+			},
+		}
+	default:
+		return nil, errors.New("not implemented")
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewBuffer(buf)),
+	}, nil
 }
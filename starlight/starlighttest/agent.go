@@ -14,11 +14,21 @@ import (
 // purposes, but with requests made to a live
 // testnet Horizon.
 func StartTestnetAgent(ctx context.Context, t *testing.T, dbpath string) *starlight.Agent {
+	return startAgent(ctx, t, openDB(t, dbpath))
+}
+
+func openDB(t *testing.T, dbpath string) *bolt.DB {
 	db, err := bolt.Open(filepath.Join(dbpath), 0600, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	g, err := starlight.StartAgent(ctx, db)
+	return db
+}
+
+// startAgent starts an agent on db,
+// which may hold the state of an earlier agent.
+func startAgent(ctx context.Context, t *testing.T, db *bolt.DB, opts ...starlight.Option) *starlight.Agent {
+	g, err := starlight.StartAgent(ctx, db, opts...)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,325 @@
+package starlighttest
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/interstellar/starlight/starlight"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+// maxFaultFees bounds the fees the guest and host pay,
+// between them, from wallet funding to channel close.
+const maxFaultFees = 1 * xlm.Lumen
+
+// A faultRun is a channel between a guest and a host
+// on a localNet whose peer messages can go wrong.
+type faultRun struct {
+	t           *testing.T
+	ctx         context.Context
+	local       *localNet
+	guest, host *Starlightd
+	chanID      string
+	guestStart  xlm.Amount // guest's wallet balance once the channel is open
+
+	// The last views of the channel before it closed.
+	lastGuest, lastHost *starlight.ChannelBalance
+}
+
+// faultTest opens a channel between a guest and a host
+// and calls f to make payments on it
+// while the network misbehaves.
+// Once f returns, faultTest heals the network
+// and checks that the two agents come to agree on the channel,
+// or both force-close it,
+// and that closing it loses no funds.
+func faultTest(t *testing.T, f func(r *faultRun)) {
+	if *testnet {
+		t.Skip("skipping fault injection on the testnet.")
+	}
+	itest(t, func(ctx context.Context, guest, host *Starlightd) {
+		r := &faultRun{
+			t:     t,
+			ctx:   ctx,
+			local: guest.local,
+			guest: guest,
+			host:  host,
+		}
+		for _, s := range channelCreationSteps(guest, host, 1, 1, channelFundingAmount) {
+			testStep(ctx, t, s, &r.chanID)
+		}
+		r.guestStart = r.ledgerBalance(guest)
+		r.observe()
+
+		f(r)
+
+		r.local.setFaults(nil)
+		r.settle()
+		r.checkFunds()
+	})
+}
+
+// channel returns s's view of the channel.
+// An agent forgets a channel once it is closed.
+func (r *faultRun) channel(s *Starlightd) *starlight.ChannelBalance {
+	bs, err := s.g.BalanceSheet()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	for _, c := range bs.Channels {
+		if c.ID == r.chanID {
+			return c
+		}
+	}
+	return &starlight.ChannelBalance{ID: r.chanID, State: fsm.Closed}
+}
+
+// observe returns both views of the channel,
+// remembering the last ones before it closed.
+func (r *faultRun) observe() (guest, host *starlight.ChannelBalance) {
+	guest, host = r.channel(r.guest), r.channel(r.host)
+	if guest.State != fsm.Closed {
+		r.lastGuest = guest
+	}
+	if host.State != fsm.Closed {
+		r.lastHost = host
+	}
+	return guest, host
+}
+
+// pay has from pay amount over the channel
+// once both ends are open, between rounds,
+// and reports whether the payment completed:
+// both ends came to agree on the channel
+// with amount moved away from from.
+// Under faults, the channel may not reopen in time,
+// or the payment may be refused or lost;
+// that is logged, not treated as an error.
+func (r *faultRun) pay(from *Starlightd, amount xlm.Amount) bool {
+	var before xlm.Amount
+	for i := 0; ; i++ {
+		guest, host := r.observe()
+		if guest.State == fsm.Open && host.State == fsm.Open {
+			before = r.balance(from, guest, host)
+			break
+		}
+		if i == 100 {
+			r.t.Logf("%s: channel not open, skipping payment of %s", from.name, amount)
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	err := from.g.DoCommand(r.chanID, &fsm.Command{
+		Name:   fsm.ChannelPay,
+		Amount: amount,
+	})
+	if err != nil {
+		r.t.Logf("%s: channel pay %s: %s", from.name, amount, err)
+		return false
+	}
+	for i := 0; i < 100; i++ {
+		guest, host := r.observe()
+		if agree(guest, host) && r.balance(from, guest, host) == before-amount {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	r.t.Logf("%s: channel payment of %s did not complete", from.name, amount)
+	return false
+}
+
+// balance returns from's balance in the channel
+// given the guest's and host's views of it.
+func (r *faultRun) balance(from *Starlightd, guest, host *starlight.ChannelBalance) xlm.Amount {
+	if from == r.guest {
+		return guest.Local
+	}
+	return host.Local
+}
+
+// crashAndReboot crashes s
+// and reboots it after downtime.
+func (r *faultRun) crashAndReboot(s *Starlightd, downtime time.Duration) {
+	r.t.Logf("crash: %s", s.name)
+	s.crash()
+	time.Sleep(downtime)
+	s.reboot(r.ctx, r.t)
+}
+
+// settle waits for the guest and host to agree
+// on the channel and then closes it cooperatively,
+// or waits for them both to finish force-closing it.
+// When they are slow to do either,
+// it moves ledger time forward
+// so that round timeouts and settlement delays expire.
+func (r *faultRun) settle() {
+	closing := false
+	start := time.Now()
+	for {
+		guest, host := r.observe()
+		switch {
+		case guest.State == fsm.Closed && host.State == fsm.Closed:
+			return
+		case !closing && agree(guest, host):
+			err := r.guest.g.DoCommand(r.chanID, &fsm.Command{Name: fsm.CloseChannel})
+			if err != nil {
+				r.t.Fatal(err)
+			}
+			closing = true
+			start = time.Now()
+		case time.Since(start) > time.Minute:
+			r.t.Fatalf("channel did not settle:\nguest %+v\nhost %+v", guest, host)
+		case time.Since(start) > 10*time.Second:
+			r.local.sim.Advance(time.Minute)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// agree reports whether the guest's and host's views
+// of a channel are both open and consistent.
+func agree(guest, host *starlight.ChannelBalance) bool {
+	return guest.State == fsm.Open && host.State == fsm.Open &&
+		guest.Local == host.Remote && guest.Remote == host.Local &&
+		guest.Local+guest.Remote == channelFundingAmount
+}
+
+// checkFunds checks that no funds were lost
+// once the channel closed:
+// the guest's wallet gained its balance in the channel,
+// and the agents lost nothing else but fees.
+// After a force close,
+// the guest's balance may be from the guest's last view
+// or the host's, if the two differed.
+func (r *faultRun) checkFunds() {
+	lo, hi := r.lastGuest.Local, r.lastHost.Remote
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	guestBal, hostBal := r.ledgerBalance(r.guest), r.ledgerBalance(r.host)
+	if got := guestBal - r.guestStart; got < lo || got > hi {
+		if lo == hi {
+			r.t.Errorf("guest got %s from the channel, want %s", got, lo)
+		} else {
+			r.t.Errorf("guest got %s from the channel, want between %s and %s", got, lo, hi)
+		}
+	}
+	fees := 2*friendbotAmount - guestBal - hostBal
+	if fees < 0 || fees > maxFaultFees {
+		r.t.Errorf("guest and host spent %s on fees, want at most %s", fees, maxFaultFees)
+	}
+}
+
+func (r *faultRun) ledgerBalance(s *Starlightd) xlm.Amount {
+	bs, err := s.g.BalanceSheet()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	acct, err := s.g.LoadAccount(bs.Wallet.ID)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	balStr, err := acct.GetNativeBalance()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	bal, err := xlm.Parse(balStr)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return bal
+}
+
+func TestFaults(t *testing.T) {
+	for f := drop; f < numFaults; f++ {
+		f := f
+		t.Run(f.String(), func(t *testing.T) {
+			faultTest(t, func(r *faultRun) {
+				r.local.setFaults(scriptedFaults(t, f, f, f, deliver, f, f, f))
+				paid := r.pay(r.host, paymentAmount)
+				paid = r.pay(r.guest, paymentAmount/2) || paid
+				paid = r.pay(r.host, paymentAmount) || paid
+				if !paid {
+					t.Errorf("no payment completed under %s faults", f)
+				}
+			})
+		})
+	}
+}
+
+func TestCrashRestart(t *testing.T) {
+	for _, name := range []string{"guest", "host"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			faultTest(t, func(r *faultRun) {
+				s := r.guest
+				if name == "host" {
+					s = r.host
+				}
+				paid := r.pay(r.host, paymentAmount)
+				r.crashAndReboot(s, time.Second)
+				paid = r.pay(r.guest, paymentAmount/2) || paid
+				r.crashAndReboot(s, time.Second)
+				paid = r.pay(r.host, paymentAmount) || paid
+				if !paid {
+					t.Errorf("no payment completed with %s crashing", name)
+				}
+			})
+		})
+	}
+}
+
+// TestLockedTimeout reboots the host without logging in
+// and checks that it still force-closes the channel,
+// with no seed, once the round times out.
+func TestLockedTimeout(t *testing.T) {
+	faultTest(t, func(r *faultRun) {
+		r.pay(r.host, paymentAmount)
+		r.t.Log("crash: host")
+		r.host.crash()
+		r.host.rebootLocked(r.ctx, r.t)
+		start := time.Now()
+		for {
+			_, host := r.observe()
+			if host.State == fsm.Closed {
+				return
+			}
+			if time.Since(start) > time.Minute {
+				r.t.Fatalf("locked host did not close the channel: %+v", host)
+			}
+			r.local.sim.Advance(time.Minute)
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+}
+
+// TestRandomFaults makes payments both ways
+// with faults picked at random,
+// including crashes of either agent.
+// Run it with -faultseed to try other faults.
+func TestRandomFaults(t *testing.T) {
+	t.Logf("fault seed %d", *faultSeed)
+	faultTest(t, func(r *faultRun) {
+		plan := randomFaults(t, *faultSeed, 0.3)
+		r.local.setFaults(plan)
+		rng := rand.New(rand.NewSource(*faultSeed))
+		for i := 0; i < 10; i++ {
+			if rng.Intn(2) == 0 && r.lastGuest.Local >= paymentAmount/2 {
+				r.pay(r.guest, paymentAmount/2)
+			} else {
+				r.pay(r.host, paymentAmount)
+			}
+			if rng.Float64() < 0.2 {
+				s := r.guest
+				if rng.Intn(2) == 0 {
+					s = r.host
+				}
+				r.crashAndReboot(s, time.Duration(rng.Intn(3))*time.Second)
+			}
+		}
+		t.Logf("faults: %v", plan.summary())
+	})
+}
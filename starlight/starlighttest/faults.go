@@ -0,0 +1,261 @@
+package starlighttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A fault is something that can go wrong
+// with a message between two agents.
+type fault int
+
+const (
+	deliver   fault = iota // nothing goes wrong
+	drop                   // the message is lost on the way
+	loseReply              // the message arrives, but the reply is lost
+	duplicate              // the message arrives twice
+	delay                  // the message arrives late
+	reorder                // the message arrives after the next one
+	numFaults
+)
+
+var faultNames = [...]string{
+	deliver:   "deliver",
+	drop:      "drop",
+	loseReply: "lose reply",
+	duplicate: "duplicate",
+	delay:     "delay",
+	reorder:   "reorder",
+}
+
+func (f fault) String() string {
+	return faultNames[f]
+}
+
+const (
+	// faultDelay is how long a delayed message takes.
+	faultDelay = 2 * time.Second
+
+	// reorderTimeout is how long a reordered message
+	// waits for a message to overtake it.
+	reorderTimeout = 5 * time.Second
+)
+
+// A faultPlan decides what goes wrong
+// with each peer message on a localNet.
+// Messages from host to guest are requests
+// to the guest's /starlight/message;
+// messages from guest to host are responses
+// to the host's long polls of the guest's /api/messages.
+// Other requests, such as those to Horizon,
+// are delivered faithfully.
+type faultPlan struct {
+	t *testing.T
+
+	mu     sync.Mutex
+	script []fault                        // the faults for the next messages, in order
+	rng    *rand.Rand                     // if set, picks faults once script runs out
+	rate   float64                        // the chance that rng picks a fault for a message
+	held   map[*localHost][]chan struct{} // reordered messages, by recipient
+	counts [numFaults]int
+}
+
+// scriptedFaults returns a plan
+// that applies the given faults, in order,
+// to the next peer messages,
+// and then delivers the rest faithfully.
+func scriptedFaults(t *testing.T, script ...fault) *faultPlan {
+	return &faultPlan{
+		t:      t,
+		script: script,
+		held:   make(map[*localHost][]chan struct{}),
+	}
+}
+
+// randomFaults returns a plan
+// that picks a fault at random
+// for a fraction rate of peer messages,
+// using a random source seeded with seed.
+func randomFaults(t *testing.T, seed int64, rate float64) *faultPlan {
+	return &faultPlan{
+		t:    t,
+		rng:  rand.New(rand.NewSource(seed)),
+		rate: rate,
+		held: make(map[*localHost][]chan struct{}),
+	}
+}
+
+// isPeerMsg reports whether req carries
+// a message between two agents.
+func isPeerMsg(req *http.Request) bool {
+	switch req.URL.Path {
+	case "/starlight/message", "/api/messages":
+		return true
+	}
+	return false
+}
+
+// next picks the fault for a message to h.
+func (p *faultPlan) next(h *localHost, req *http.Request) fault {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f := deliver
+	if len(p.script) > 0 {
+		f, p.script = p.script[0], p.script[1:]
+	} else if p.rng != nil && p.rng.Float64() < p.rate {
+		f = fault(1 + p.rng.Intn(int(numFaults)-1))
+	}
+	p.counts[f]++
+	if f != deliver {
+		p.t.Logf("fault: %s %s%s", f, h.name, req.URL.Path)
+	}
+	return f
+}
+
+// summary reports how many messages got each fault.
+func (p *faultPlan) summary() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m := make(map[string]int)
+	for f, n := range p.counts {
+		m[fault(f).String()] = n
+	}
+	return m
+}
+
+func (p *faultPlan) roundTrip(h *localHost, req *http.Request) (*http.Response, error) {
+	if req.URL.Path == "/api/messages" {
+		return p.poll(h, req)
+	}
+	return p.send(h, req)
+}
+
+// send delivers a message from host to guest.
+func (p *faultPlan) send(h *localHost, req *http.Request) (*http.Response, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	withBody := func() *http.Request {
+		r := req.WithContext(req.Context())
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return r
+	}
+
+	var resp *http.Response
+	switch p.next(h, req) {
+	case drop:
+		return nil, errReset(h)
+	case loseReply:
+		h.serve(withBody())
+		return nil, errReset(h)
+	case duplicate:
+		resp, err = h.serve(withBody())
+		h.serve(withBody())
+	case delay:
+		select {
+		case <-time.After(faultDelay):
+		case <-h.down:
+			return nil, errReset(h)
+		}
+		resp, err = h.serve(withBody())
+	case reorder:
+		if !p.hold(h) {
+			return nil, errReset(h)
+		}
+		return h.serve(withBody())
+	default:
+		resp, err = h.serve(withBody())
+	}
+	p.release(h)
+	return resp, err
+}
+
+// hold waits until another message to h is delivered,
+// or reorderTimeout passes,
+// or p is healed.
+// It reports false if h goes down in the meantime.
+func (p *faultPlan) hold(h *localHost) bool {
+	c := make(chan struct{})
+	p.mu.Lock()
+	p.held[h] = append(p.held[h], c)
+	p.mu.Unlock()
+	select {
+	case <-c:
+	case <-time.After(reorderTimeout):
+	case <-h.down:
+		return false
+	}
+	return true
+}
+
+// release lets the messages held for h go on,
+// now that a later message has overtaken them.
+func (p *faultPlan) release(h *localHost) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.held[h] {
+		close(c)
+	}
+	delete(p.held, h)
+}
+
+// releaseAll lets all held messages go on.
+func (p *faultPlan) releaseAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for h, cs := range p.held {
+		for _, c := range cs {
+			close(c)
+		}
+		delete(p.held, h)
+	}
+}
+
+// poll delivers the messages, if any,
+// in the response to a long poll from host to guest.
+// Polling does not change the guest's state,
+// so losing the request is the same as losing the reply,
+// and reordering happens within a single response.
+func (p *faultPlan) poll(h *localHost, req *http.Request) (*http.Response, error) {
+	resp, err := h.serve(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	var msgs []json.RawMessage
+	err = json.NewDecoder(resp.Body).Decode(&msgs)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) > 0 {
+		switch p.next(h, req) {
+		case drop, loseReply:
+			return nil, errReset(h)
+		case duplicate:
+			msgs = append(msgs, msgs...)
+		case delay:
+			select {
+			case <-time.After(faultDelay):
+			case <-h.down:
+				return nil, errReset(h)
+			}
+		case reorder:
+			for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+				msgs[i], msgs[j] = msgs[j], msgs[i]
+			}
+		}
+	}
+	b, err := json.Marshal(msgs)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	resp.ContentLength = int64(len(b))
+	return resp, nil
+}
@@ -4,10 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
-	"net"
 	"net/http"
-	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/interstellar/starlight/starlight/fsm"
@@ -20,12 +19,21 @@ const (
 	topUpAmount          = 500 * xlm.Stroop
 )
 
+// testLocalNet returns a new localNet for a test,
+// or nil if tests run on the testnet.
+func testLocalNet() *localNet {
+	if *testnet {
+		return nil
+	}
+	return newLocalNet()
+}
+
 // itest runs an guest-and-host integration test.
 func itest(t *testing.T, f func(ctx context.Context, guest, host *Starlightd)) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode.")
 	}
-	testdir, err := ioutil.TempDir("", t.Name())
+	testdir, err := ioutil.TempDir("", strings.Replace(t.Name(), "/", "_", -1))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -33,10 +41,15 @@ func itest(t *testing.T, f func(ctx context.Context, guest, host *Starlightd)) {
 
 	ctx := context.Background()
 
-	guest := start(ctx, t, testdir, "guest")
+	local := testLocalNet()
+	if local != nil {
+		defer local.Close()
+	}
+
+	guest := start(ctx, t, local, testdir, "guest")
 	defer guest.Close()
 
-	host := start(ctx, t, testdir, "host")
+	host := start(ctx, t, local, testdir, "host")
 	defer host.Close()
 
 	f(ctx, guest, host)
@@ -159,11 +172,16 @@ func TestCleanup(t *testing.T) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	guest := testServer("guest")
-	defer guest.Close()
+	local := testLocalNet()
+	if local != nil {
+		defer local.Close()
+	}
+
+	guest, stopGuest := testServer(local, "guest")
+	defer stopGuest()
 
-	host := start(ctx, t, testdir, "host")
-	defer host.server.Close()
+	host := start(ctx, t, local, testdir, "host")
+	defer host.stop()
 
 	steps := cleanupSteps(guest, host, 0, 0, channelFundingAmount)
 	var channelID string
@@ -183,8 +201,7 @@ func TestPaymentMerge(t *testing.T) {
 		}
 
 		// Shut down the guest server and have both parties make channel payments
-		address := guest.address
-		guest.server.Close()
+		guest.stop()
 
 		hostPayment := paymentAmount + 1*xlm.Lumen
 		guestPayment := paymentAmount
@@ -200,14 +217,10 @@ func TestPaymentMerge(t *testing.T) {
 		})
 
 		// Restart the guest server
-		guest.server = httptest.NewUnstartedServer(guest.handler)
-		l, err := net.Listen("tcp", address)
+		err := guest.restart()
 		if err != nil {
 			t.Fatal(err)
 		}
-		guest.server.Listener.Close()
-		guest.server.Listener = l
-		guest.server.Start()
 
 		steps = paymentMergeResolutionSteps(guest, host, hostPayment-guestPayment)
 		for _, s := range steps {
@@ -0,0 +1,193 @@
+package starlighttest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/network"
+
+	"github.com/interstellar/starlight/starlight"
+	"github.com/interstellar/starlight/worizon"
+	"github.com/interstellar/starlight/worizon/worizontest"
+)
+
+// horizonHost is the host name
+// under which a localNet serves its simulated Horizon.
+const horizonHost = "horizon.test"
+
+// A localNet stands in for the internet and the Stellar testnet
+// in offline tests.
+// Agents reach each other, and Horizon,
+// through its RoundTrip method,
+// which dispatches each request by host name
+// to an http.Handler in the same process.
+// Messages between agents can be made to go wrong
+// with setFaults.
+// Its ledger is a worizontest.Simulator,
+// whose time moves forward a second
+// for each second of real time,
+// and further when a test calls Advance.
+type localNet struct {
+	sim  *worizontest.Simulator
+	stop chan struct{}
+
+	mu     sync.Mutex
+	hosts  map[string]*localHost
+	faults *faultPlan // nil when the network is healthy
+}
+
+// A localHost is an http.Handler serving a host name on a localNet.
+type localHost struct {
+	name string
+	h    http.Handler
+	down chan struct{} // closed when the host is removed
+	wg   sync.WaitGroup
+}
+
+func newLocalNet() *localNet {
+	n := &localNet{
+		sim:   worizontest.NewSimulator(network.TestNetworkPassphrase, time.Now()),
+		stop:  make(chan struct{}),
+		hosts: make(map[string]*localHost),
+	}
+	n.handle(horizonHost, n.sim)
+	go n.tick()
+	return n
+}
+
+func (n *localNet) tick() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			n.sim.Advance(time.Second)
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+// Close stops n's ledger clock.
+func (n *localNet) Close() {
+	close(n.stop)
+}
+
+// horizonURL is the Horizon URL for agents on n.
+func (n *localNet) horizonURL() string {
+	return "https://" + horizonHost + "/"
+}
+
+// handle makes h serve requests for host.
+func (n *localNet) handle(host string, h http.Handler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.hosts[host] = &localHost{name: host, h: h, down: make(chan struct{})}
+}
+
+// remove takes host off n,
+// so that requests for it fail
+// as if its server were down.
+// Requests in flight to host fail too;
+// remove waits for their handlers to return.
+func (n *localNet) remove(host string) {
+	n.mu.Lock()
+	h := n.hosts[host]
+	delete(n.hosts, host)
+	n.mu.Unlock()
+	if h != nil {
+		close(h.down)
+		h.wg.Wait()
+	}
+}
+
+// setFaults makes p decide what happens
+// to peer messages on n.
+// A nil p heals the network.
+func (n *localNet) setFaults(p *faultPlan) {
+	n.mu.Lock()
+	old := n.faults
+	n.faults = p
+	n.mu.Unlock()
+	if old != nil {
+		old.releaseAll()
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+// The URL scheme is ignored.
+func (n *localNet) RoundTrip(req *http.Request) (*http.Response, error) {
+	n.mu.Lock()
+	h := n.hosts[req.URL.Host]
+	if h != nil {
+		h.wg.Add(1)
+	}
+	p := n.faults
+	n.mu.Unlock()
+	if h == nil {
+		return nil, fmt.Errorf("dial tcp %s: connection refused", req.URL.Host)
+	}
+	defer h.wg.Done()
+	if p != nil && isPeerMsg(req) {
+		return p.roundTrip(h, req)
+	}
+	return h.serve(req)
+}
+
+// serve has h handle req as if it came over the network.
+// If h is removed in the meantime,
+// the request's context is canceled
+// and serve returns an error.
+func (h *localHost) serve(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-h.down:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Make req look like it came from a server.
+	sreq := req.WithContext(ctx)
+	if sreq.Host == "" {
+		sreq.Host = req.URL.Host
+	}
+	sreq.RequestURI = req.URL.RequestURI()
+	if sreq.Body == nil {
+		sreq.Body = http.NoBody
+	}
+	w := httptest.NewRecorder()
+	h.h.ServeHTTP(w, sreq)
+	select {
+	case <-h.down:
+		return nil, errReset(h)
+	default:
+	}
+	return w.Result(), nil
+}
+
+func errReset(h *localHost) error {
+	return fmt.Errorf("read tcp %s: connection reset by peer", h.name)
+}
+
+// network returns an option for starlight.StartAgent
+// that puts the agent on n.
+func (n *localNet) network() starlight.Option {
+	return starlight.WithNetwork(worizon.NewClient(n, n.sim), n)
+}
+
+// funding returns an option for starlight.StartAgent
+// that has the agent get its wallet funded by n's root account.
+func (n *localNet) funding() (starlight.Option, error) {
+	sponsor, err := starlight.Sponsor(n.sim.Master().Seed(), friendbotAmount)
+	if err != nil {
+		return nil, err
+	}
+	return starlight.WithFunding(sponsor), nil
+}
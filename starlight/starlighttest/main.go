@@ -5,13 +5,11 @@ import "flag"
 var (
 	// HorizonURL is the testnet Horizon URL used for testing.
 	HorizonURL = flag.String("horizon", "https://horizon-testnet.stellar.org/", "horizon URL")
+	testnet    = flag.Bool("testnet", false, "run integration tests against the live testnet at -horizon instead of in-process")
 	debug      = flag.Bool("debug", false, "log verbose debugging output")
+	faultSeed  = flag.Int64("faultseed", 1, "random seed for TestRandomFaults")
 )
 
-func init() {
-	flag.Parse()
-}
-
 func SetDebug(d bool) {
 	debug = &d
 }
@@ -6,12 +6,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	bolt "github.com/coreos/bbolt"
+
 	"github.com/interstellar/starlight/starlight"
 	"github.com/interstellar/starlight/starlight/fsm"
 	"github.com/interstellar/starlight/starlight/walletrpc"
@@ -20,9 +23,12 @@ import (
 
 // Starlightd is an in-memory starlight agent with HTTP endpoints for protocol messages and UI commands.
 type Starlightd struct {
+	name          string
 	g             *starlight.Agent
+	db            *bolt.DB
 	handler       http.Handler
-	server        *httptest.Server
+	server        *httptest.Server // nil on a localNet
+	local         *localNet        // nil on the testnet
 	cookie        string
 	address       string
 	accountID     string
@@ -35,7 +41,7 @@ type Starlightd struct {
 
 // StartServer starts a Startlightd instance.
 func StartServer(ctx context.Context, testdir, name string) *Starlightd {
-	return start(ctx, nil, testdir, name)
+	return start(ctx, nil, nil, testdir, name)
 }
 
 // Address returns the (trimmed) URL of the Starlightd server.
@@ -46,31 +52,131 @@ func (s *Starlightd) Address() string {
 // Close releases the resources associated with s.
 func (s *Starlightd) Close() {
 	s.g.Close() // TODO(bobg): This should be CloseWait, but that's much slower. Figure out why!
-	s.server.Close()
+	s.stop()
 }
 
-func start(ctx context.Context, t *testing.T, testdir, name string) *Starlightd {
-	g := StartTestnetAgent(ctx, t, fmt.Sprintf("%s/testdb_%s", testdir, name))
-	g.SetDebug(*debug, name)
+// start starts a Starlightd instance on local,
+// or on the testnet if local is nil.
+func start(ctx context.Context, t *testing.T, local *localNet, testdir, name string) *Starlightd {
 	s := &Starlightd{
-		g:             g,
+		name:          name,
+		db:            openDB(t, fmt.Sprintf("%s/testdb_%s", testdir, name)),
+		local:         local,
 		nextUpdateNum: 1,
 	}
-	s.handler = logWrapper(walletrpc.Handler(s.g), name)
+	s.startAgent(ctx, t)
+	if local != nil {
+		s.address = name + ".test"
+		local.handle(s.address, s.handler)
+		return s
+	}
 	s.server = httptest.NewServer(s.handler)
 	s.address = strings.TrimPrefix(s.server.URL, "http://")
 	return s
 }
 
-func testServer(name string) *httptest.Server {
+// startAgent starts an agent on s's database
+// and makes it handle s's HTTP requests.
+func (s *Starlightd) startAgent(ctx context.Context, t *testing.T) {
+	opts := []starlight.Option{starlight.WithDebug(*debug, s.name)}
+	if s.local != nil {
+		funding, err := s.local.funding()
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts = append(opts, s.local.network(), funding)
+	}
+	s.g = startAgent(ctx, t, s.db, opts...)
+	s.handler = logWrapper(walletrpc.Handler(s.g), s.name)
+}
+
+// crash stops s abruptly, as if its process had died.
+// Its server goes down, failing any requests in flight,
+// and its agent stops,
+// leaving only what it had stored in its database.
+func (s *Starlightd) crash() {
+	s.stop()
+	s.g.CloseWait()
+}
+
+// reboot brings s back up after a crash,
+// with a new agent on the same database,
+// and logs in to it again.
+func (s *Starlightd) reboot(ctx context.Context, t *testing.T) {
+	s.rebootLocked(ctx, t)
+	testStep(ctx, t, step{
+		name:  s.name + " login after reboot",
+		agent: s,
+		path:  "/api/login",
+		body:  fmt.Sprintf(`{"Username":"%s","Password":"password"}`, s.name),
+	}, nil)
+}
+
+// rebootLocked brings s back up after a crash,
+// with a new agent on the same database,
+// but doesn't log in, leaving its seed locked.
+func (s *Starlightd) rebootLocked(ctx context.Context, t *testing.T) {
+	s.startAgent(ctx, t)
+	err := s.restart()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// horizonURL returns the Horizon URL s should be configured with.
+func (s *Starlightd) horizonURL() string {
+	if s.local != nil {
+		return s.local.horizonURL()
+	}
+	return *HorizonURL
+}
+
+// stop stops serving HTTP requests to s,
+// as if its server had gone down.
+func (s *Starlightd) stop() {
+	if s.local != nil {
+		s.local.remove(s.address)
+		return
+	}
+	s.server.Close()
+}
+
+// restart resumes serving HTTP requests to s
+// at the same address.
+func (s *Starlightd) restart() error {
+	if s.local != nil {
+		s.local.handle(s.address, s.handler)
+		return nil
+	}
+	s.server = httptest.NewUnstartedServer(s.handler)
+	l, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return err
+	}
+	s.server.Listener.Close()
+	s.server.Listener = l
+	s.server.Start()
+	return nil
+}
+
+// testServer starts a fake peer named name
+// on local, or on a loopback port if local is nil.
+// It returns the peer's address
+// and a function that stops it.
+func testServer(local *localNet, name string) (address string, stop func()) {
 	mux := new(http.ServeMux)
 	mux.HandleFunc("/starlight/message", testHandleMsg)
 	mux.HandleFunc("/federation", testHandleFed)
 	mux.HandleFunc("/.well-known/stellar.toml", testHandleTOML)
 	mux.HandleFunc("/api/messages", testPollMessages)
 	handler := logWrapper(mux, name)
+	if local != nil {
+		address = name + ".test"
+		local.handle(address, handler)
+		return address, func() { local.remove(address) }
+	}
 	server := httptest.NewServer(handler)
-	return server
+	return strings.TrimPrefix(server.URL, "http://"), server.Close
 }
 
 func testPollMessages(w http.ResponseWriter, req *http.Request) {
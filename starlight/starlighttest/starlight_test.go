@@ -25,7 +25,12 @@ func TestAgentRequest(t *testing.T) {
 
 	ctx := context.Background()
 
-	alice := start(ctx, t, testdir, "test")
+	local := testLocalNet()
+	if local != nil {
+		defer local.Close()
+	}
+
+	alice := start(ctx, t, local, testdir, "test")
 	defer alice.Close()
 
 	steps := []step{
@@ -40,7 +45,7 @@ func TestAgentRequest(t *testing.T) {
 				"Password":"password",
 				"HorizonURL":"%s",
 				"Public":true
-			}`, *HorizonURL),
+			}`, alice.horizonURL()),
 		}, {
 			name:  "get init update",
 			agent: alice,
@@ -28,6 +28,11 @@ const (
 	baseReserve     = 500 * xlm.Millilumen
 )
 
+// settlementWait is how far ledger time must move
+// after a force close, with 1-minute rounds and finality delay,
+// to pass the settlement mintime.
+const settlementWait = 5 * time.Minute
+
 type step struct {
 	name           string
 	agent          *Starlightd
@@ -43,6 +48,11 @@ type step struct {
 	hostDelta      xlm.Amount
 	guestDelta     xlm.Amount
 	reserveDelta   xlm.Amount
+
+	// advance is how far to move ledger time forward
+	// before polling for update, on a localNet.
+	// On the testnet, the step waits for real time to pass instead.
+	advance time.Duration
 }
 
 func (s step) logf(f string, a ...interface{}) {
@@ -157,7 +167,7 @@ func channelCreationSteps(guest, host *Starlightd, maxRoundDurMins, finalityDela
 				"MaxRoundDurMins": %d,
 				"FinalityDelayMins": %d,
 				"Public":true
-			}`, *HorizonURL, maxRoundDurMins, finalityDelayMins),
+			}`, guest.horizonURL(), maxRoundDurMins, finalityDelayMins),
 		}, {
 			name:  "guest config init update",
 			agent: guest,
@@ -181,7 +191,7 @@ func channelCreationSteps(guest, host *Starlightd, maxRoundDurMins, finalityDela
 				"HostFeerate": %d,
 				"ChannelFeerate":%d,
 				"Public":true
-			}`, *HorizonURL, maxRoundDurMins, finalityDelayMins, hostFeerate, channelFeerate),
+			}`, host.horizonURL(), maxRoundDurMins, finalityDelayMins, hostFeerate, channelFeerate),
 		}, {
 			name:  "host config init update",
 			agent: host,
@@ -566,8 +576,9 @@ func hostForceCloseStepsNoGuestBalance(guest, host *Starlightd, channelFundingAm
 		}, {
 			// host waits until settlement mintime, then transitions to
 			// awaiting settlement
-			name:  "host force close state transition awaiting settlement",
-			agent: host,
+			name:    "host force close state transition awaiting settlement",
+			agent:   host,
+			advance: settlementWait,
 			update: &update.Update{
 				Type: update.ChannelType,
 				Channel: &fsm.Channel{
@@ -662,8 +673,9 @@ func hostForceCloseStepsSettleWithGuest(guest, host *Starlightd, channelFundingA
 		}, {
 			// host waits until settlement mintime, then transitions to
 			// awaiting settlement
-			name:  "host force close state transition awaiting settlement",
-			agent: host,
+			name:    "host force close state transition awaiting settlement",
+			agent:   host,
+			advance: settlementWait,
 			update: &update.Update{
 				Type: update.ChannelType,
 				Channel: &fsm.Channel{
@@ -892,7 +904,7 @@ func loginSteps(guest, host *Starlightd) []step {
 	}
 }
 
-func cleanupSteps(guest *httptest.Server, host *Starlightd, maxRoundDurMins, finalityDelayMins int, channelFundingAmount xlm.Amount) []step {
+func cleanupSteps(guestAddr string, host *Starlightd, maxRoundDurMins, finalityDelayMins int, channelFundingAmount xlm.Amount) []step {
 	return []step{
 		{
 			name:  "host config init",
@@ -910,7 +922,7 @@ func cleanupSteps(guest *httptest.Server, host *Starlightd, maxRoundDurMins, fin
 				"HostFeerate": %d,
 				"ChannelFeerate":%d,
 				"Public":true
-			}`, *HorizonURL, maxRoundDurMins, finalityDelayMins, hostFeerate, channelFeerate),
+			}`, host.horizonURL(), maxRoundDurMins, finalityDelayMins, hostFeerate, channelFeerate),
 		}, {
 			name:  "host config init update",
 			agent: host,
@@ -937,7 +949,7 @@ func cleanupSteps(guest *httptest.Server, host *Starlightd, maxRoundDurMins, fin
 			body: fmt.Sprintf(`{
 				"GuestAddr": "guest*%s",
 				"HostAmount": %d
-			}`, strings.TrimPrefix(guest.URL, "http://"), channelFundingAmount),
+			}`, guestAddr, channelFundingAmount),
 		}, {
 			name:  "host channel creation setting up update",
 			agent: host,
@@ -1031,9 +1043,18 @@ func cleanupSteps(guest *httptest.Server, host *Starlightd, maxRoundDurMins, fin
 
 func checkUpdate(ctx context.Context, s step, channelID *string) error {
 	backoff := net.Backoff{Base: 10 * time.Second}
+	tries := 10
+	if s.agent.local != nil {
+		// Updates come quickly without a real network.
+		backoff.Base = 100 * time.Millisecond
+		tries = 20
+		if s.advance > 0 {
+			s.agent.local.sim.Advance(s.advance)
+		}
+	}
 	found := false
 	updateNum := s.agent.nextUpdateNum
-	for i := 0; i < 10 && !found; i++ {
+	for i := 0; i < tries && !found; i++ {
 		body := fmt.Sprintf(`{"From": %d}`, updateNum)
 		s.debugf("polling /api/updates %d", updateNum)
 		resp := post(ctx, s.agent.handler, s.agent.address, "/api/updates", body, s.agent.cookie)
@@ -9,13 +9,15 @@ import (
 
 	bolt "github.com/coreos/bbolt"
 
+	"github.com/interstellar/starlight/clock"
 	"github.com/interstellar/starlight/net"
 )
 
 // Task is an item in a TB.
 // The TB runs the task via its Run method.
 // If that returns an error,
-// it is retried after an interval.
+// it is retried after an interval
+// measured by the TB's clock.
 type Task interface {
 	// Run runs the task once.
 	// It is called repeatedly by a running taskbasket,
@@ -46,16 +48,27 @@ type TB struct {
 	bucket []byte
 	codec  Codec
 	ch     chan pair
+	done   chan struct{} // closed when Run returns
 	wg     *sync.WaitGroup
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	pending map[string]*pending // running tasks, by key
+}
+
+type pending struct {
+	t       Task
+	retries int
 }
 
-// New creates a new taskbasket.
+// New creates a new taskbasket
+// that times retries with clk.
 // It launches goroutines for any tasks already existing in the db.
-func New(ctx context.Context, db *bolt.DB, bucket []byte, codec Codec) (*TB, error) {
+func New(ctx context.Context, db *bolt.DB, bucket []byte, codec Codec, clk clock.Clock) (*TB, error) {
 	var tb *TB
 	err := db.Update(func(tx *bolt.Tx) error {
 		var err error
-		tb, err = NewTx(ctx, tx, db, bucket, codec)
+		tb, err = NewTx(ctx, tx, db, bucket, codec, clk)
 		return err
 	})
 	return tb, err
@@ -63,13 +76,16 @@ func New(ctx context.Context, db *bolt.DB, bucket []byte, codec Codec) (*TB, err
 
 // NewTx creates a new taskbasket in the context of an existing bolt Update transaction.
 // It launches goroutines for any tasks already exiting in the db.
-func NewTx(ctx context.Context, tx *bolt.Tx, db *bolt.DB, bucket []byte, codec Codec) (*TB, error) {
+func NewTx(ctx context.Context, tx *bolt.Tx, db *bolt.DB, bucket []byte, codec Codec, clk clock.Clock) (*TB, error) {
 	tb := &TB{
-		db:     db,
-		bucket: bucket,
-		codec:  codec,
-		ch:     make(chan pair),
-		wg:     new(sync.WaitGroup),
+		db:      db,
+		bucket:  bucket,
+		codec:   codec,
+		ch:      make(chan pair),
+		done:    make(chan struct{}),
+		wg:      new(sync.WaitGroup),
+		clock:   clk,
+		pending: make(map[string]*pending),
 	}
 
 	var tasks []pair
@@ -84,6 +100,9 @@ func NewTx(ctx context.Context, tx *bolt.Tx, db *bolt.DB, bucket []byte, codec C
 		if err != nil {
 			return err
 		}
+		// Bolt's k is only valid during the transaction,
+		// and the task runs after it.
+		k = append([]byte(nil), k...)
 		tasks = append(tasks, pair{k: k, t: t})
 		return nil
 	})
@@ -120,6 +139,9 @@ func (tb *TB) Add(t Task) error {
 // It is persisted to the database and processed when the transaction commits.
 // Note that if TB.Run has not been called,
 // this function can block.
+// If TB.Run has returned,
+// the task stays in the database
+// for the next taskbasket on it to run.
 func (tb *TB) AddTx(tx *bolt.Tx, t Task) error {
 	bits, err := tb.codec.Encode(t)
 	if err != nil {
@@ -139,7 +161,10 @@ func (tb *TB) AddTx(tx *bolt.Tx, t Task) error {
 		return err
 	}
 	tx.OnCommit(func() {
-		tb.ch <- pair{k: key, t: t}
+		select {
+		case tb.ch <- pair{k: key, t: t}:
+		case <-tb.done:
+		}
 	})
 	return nil
 }
@@ -153,6 +178,7 @@ func (tb *TB) Run(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
+			close(tb.done)
 			tb.wg.Wait()
 			return
 
@@ -163,6 +189,17 @@ func (tb *TB) Run(ctx context.Context) {
 	}
 }
 
+// Pending calls f for each task tb is running,
+// with the number of times the task has failed so far.
+// It must not call tb's methods.
+func (tb *TB) Pending(f func(t Task, retries int)) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	for _, p := range tb.pending {
+		f(p.t, p.retries)
+	}
+}
+
 // Function runTask runs forever,
 // retrying t.Run until it returns nil or until the context is canceled.
 // If t.Run succeeds,
@@ -170,13 +207,27 @@ func (tb *TB) Run(ctx context.Context) {
 func (tb *TB) runTask(ctx context.Context, key []byte, t Task) {
 	defer tb.wg.Done()
 
+	p, pkey := &pending{t: t}, string(key)
+	tb.mu.Lock()
+	tb.pending[pkey] = p
+	tb.mu.Unlock()
+	defer func() {
+		tb.mu.Lock()
+		delete(tb.pending, pkey)
+		tb.mu.Unlock()
+	}()
+
 	backoff := net.Backoff{Base: time.Second}
 	for {
 		err := t.Run(ctx)
 		if err != nil {
+			tb.mu.Lock()
+			p.retries++
+			tb.mu.Unlock()
+
 			// Start this timer first,
 			// so timing is as right as possible even if the db update takes long.
-			timer := time.NewTimer(backoff.Next())
+			timer := tb.clock.NewTimer(backoff.Next())
 
 			// Write the possibly updated task back to the db.
 			bits, err := tb.codec.Encode(t)
@@ -197,7 +248,7 @@ func (tb *TB) runTask(ctx context.Context, key []byte, t Task) {
 				timer.Stop()
 				return
 
-			case <-timer.C:
+			case <-timer.C():
 				continue
 			}
 		}
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	bolt "github.com/coreos/bbolt"
+
+	"github.com/interstellar/starlight/clock"
 )
 
 const testBucket = "testbucket"
@@ -75,7 +77,7 @@ func TestTaskbasket(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	tb, err := New(ctx, db, []byte(testBucket), codec)
+	tb, err := New(ctx, db, []byte(testBucket), codec, clock.Real)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -146,7 +148,7 @@ func TestTaskbasket(t *testing.T) {
 
 	forceFailures = false
 
-	tb, err = New(ctx, db, []byte(testBucket), codec)
+	tb, err = New(ctx, db, []byte(testBucket), codec, clock.Real)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -193,3 +195,188 @@ func TestTaskbasket(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRetryClock(t *testing.T) {
+	f, err := ioutil.TempFile("", "TestRetryClock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := f.Name()
+	f.Close()
+	defer os.Remove(f.Name())
+
+	db, err := bolt.Open(filename, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	forceFailures := true
+	ch := make(chan *testTask)
+	codec := &testCodec{
+		ch:       ch,
+		failflag: &forceFailures,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := clock.NewManual(time.Now())
+	tb, err := New(ctx, db, []byte(testBucket), codec, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go tb.Run(ctx)
+
+	err = tb.Add(&testTask{ch: ch, failflag: &forceFailures})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+
+	// The retry waits for the clock, not for real time.
+	for clk.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-ch:
+		t.Fatal("task retried before the clock advanced")
+	case <-time.After(100 * time.Millisecond):
+	}
+	clk.Advance(2 * time.Second) // past the first backoff, with jitter
+	select {
+	case tt := <-ch:
+		if n := atomic.LoadInt32(&tt.Failures); n != 2 {
+			t.Errorf("got %d failures, want 2", n)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for retry")
+	}
+	cancel()
+	tb.wg.Wait()
+}
+
+func TestAddAfterRun(t *testing.T) {
+	f, err := ioutil.TempFile("", "TestAddAfterRun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := f.Name()
+	f.Close()
+	defer os.Remove(f.Name())
+
+	db, err := bolt.Open(filename, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	forceFailures := false
+	ch := make(chan *testTask, 1)
+	codec := &testCodec{
+		ch:       ch,
+		failflag: &forceFailures,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tb, err := New(ctx, db, []byte(testBucket), codec, clock.Real)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran := make(chan struct{})
+	go func() {
+		tb.Run(ctx)
+		close(ran)
+	}()
+	cancel()
+	<-ran
+
+	// Adding a task to a stopped taskbasket does not block,
+	// and the next taskbasket on the db runs it.
+	err = tb.Add(&testTask{ch: ch, failflag: &forceFailures})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	tb, err = New(ctx, db, []byte(testBucket), codec, clock.Real)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go tb.Run(ctx)
+	select {
+	case tt := <-ch:
+		if !tt.Succeeded {
+			t.Error("task did not succeed")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for task")
+	}
+	cancel()
+	tb.wg.Wait() // before the db closes
+}
+
+func TestPending(t *testing.T) {
+	f, err := ioutil.TempFile("", "TestPending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := f.Name()
+	f.Close()
+	defer os.Remove(f.Name())
+
+	db, err := bolt.Open(filename, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	forceFailures := true
+	ch := make(chan *testTask)
+	codec := &testCodec{
+		ch:       ch,
+		failflag: &forceFailures,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := clock.NewManual(time.Now())
+	tb, err := New(ctx, db, []byte(testBucket), codec, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go tb.Run(ctx)
+
+	err = tb.Add(&testTask{ch: ch, failflag: &forceFailures})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+	for clk.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	var n, retries int
+	tb.Pending(func(task Task, r int) {
+		n++
+		retries = r
+	})
+	if n != 1 || retries != 1 {
+		t.Errorf("got %d pending tasks with %d retries, want 1 with 1", n, retries)
+	}
+
+	forceFailures = false
+	clk.Advance(2 * time.Second)
+	<-ch
+	for deadline := time.Now().Add(10 * time.Second); ; {
+		n = 0
+		tb.Pending(func(Task, int) { n++ })
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d pending tasks after success, want 0", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -20,7 +20,6 @@ import (
 	"github.com/interstellar/starlight/starlight/internal/update"
 	"github.com/interstellar/starlight/starlight/taskbasket"
 	"github.com/interstellar/starlight/worizon"
-	"github.com/interstellar/starlight/worizon/xlm"
 )
 
 type tbCodec struct {
@@ -28,8 +27,9 @@ type tbCodec struct {
 }
 
 type encodedTask struct {
-	*TbTx  `json:",omitempty"`
-	*TbMsg `json:",omitempty"`
+	*TbTx   `json:",omitempty"`
+	*TbMsg  `json:",omitempty"`
+	*TbHook `json:",omitempty"`
 }
 
 // Encode implements taskbasket.Codec.Encode.
@@ -41,6 +41,8 @@ func (c tbCodec) Encode(t taskbasket.Task) ([]byte, error) {
 		et.TbTx = t
 	case *TbMsg:
 		et.TbMsg = t
+	case *TbHook:
+		et.TbHook = t
 	default:
 		return nil, fmt.Errorf("unknown task type %T", t)
 	}
@@ -62,6 +64,9 @@ func (c tbCodec) Decode(b []byte) (taskbasket.Task, error) {
 	case et.TbMsg != nil:
 		et.TbMsg.g = c.g
 		return et.TbMsg, nil
+	case et.TbHook != nil:
+		et.TbHook.g = c.g
+		return et.TbHook, nil
 	}
 
 	return nil, errors.New("empty task")
@@ -74,6 +79,31 @@ type TbTx struct {
 	g      *Agent
 	ChanID string // Starlight channel ID, or "wallet" for wallet txs
 	E      xdr.TransactionEnvelope
+
+	// Batch marks a transaction of DoWalletBatchPay.
+	Batch bool `json:",omitempty"`
+
+	// Next holds the transactions to submit after E,
+	// in order, once E is done.
+	// They have the sequence numbers following E's.
+	Next []xdr.TransactionEnvelope `json:",omitempty"`
+}
+
+// queueNext queues a task for the first of t's Next transactions,
+// followed by the rest and then by more.
+// Must be called from within an update transaction.
+func (t *TbTx) queueNext(root *db.Root, more ...xdr.TransactionEnvelope) error {
+	next := append(t.Next[:len(t.Next):len(t.Next)], more...)
+	if len(next) == 0 {
+		return nil
+	}
+	return t.g.tb.AddTx(root.Tx(), &TbTx{
+		g:      t.g,
+		ChanID: t.ChanID,
+		E:      next[0],
+		Batch:  t.Batch,
+		Next:   next[1:],
+	})
 }
 
 // Run implements taskbasket.Task.Run.
@@ -127,15 +157,37 @@ func (t *TbTx) Run(ctx context.Context) error {
 			t.g.debugf("unmarshaling TransactionResult: %s", err)
 			return err // will retry
 		}
+		t.g.metrics.txFailures.Inc(tr.Result.Code.String())
 
-		if !isRetriableSubmitErr(t.g, &t.E.Tx, &tr, submitErr) {
+		if !isRetriableSubmitErr(t.g, &t.E.Tx, &tr, submitErr) || (isWalletTx && t.Batch && isBatchFailure(&tr)) {
 			if isWalletTx {
 				err = db.Update(t.g.db, func(root *db.Root) error {
 					walletAddr := root.Agent().PrimaryAcct().Address()
 					isWalletSrcTx := t.E.Tx.SourceAccount.Address() == walletAddr
 
+					// When some payments in a batch fail,
+					// the others are resubmitted, and remain debited.
+					// If the wallet can't pay the fee to resubmit them,
+					// they are refunded too.
+					var (
+						resubmit []int
+						pending  = make(map[int]bool)
+					)
 					w := root.Agent().Wallet()
-					for _, op := range t.E.Tx.Operations {
+					if t.Batch {
+						resubmit = resubmittablePayments(&tr)
+						if w.NativeBalance < resubmitFee(root, len(resubmit)) {
+							resubmit = nil
+						}
+						for _, i := range resubmit {
+							pending[i] = true
+						}
+					}
+
+					for i, op := range t.E.Tx.Operations {
+						if pending[i] {
+							continue
+						}
 						if op.SourceAccount == nil && !isWalletSrcTx {
 							continue
 						}
@@ -146,27 +198,27 @@ func (t *TbTx) Run(ctx context.Context) error {
 						// TODO(debnil): Check error and update Authorized field.
 						case xdr.OperationTypePayment:
 							paymentOp := op.Body.PaymentOp
-							var asset xdr.Asset
-							switch paymentOp.Asset.Type {
-							case xdr.AssetTypeAssetTypeCreditAlphanum12:
-								assetAlpha := paymentOp.Asset.AlphaNum12
-								asset.SetCredit(string(assetAlpha.AssetCode[:]), assetAlpha.Issuer)
-							case xdr.AssetTypeAssetTypeCreditAlphanum4:
-								assetAlpha := paymentOp.Asset.AlphaNum4
-								asset.SetCredit(string(assetAlpha.AssetCode[:]), assetAlpha.Issuer)
-							default:
-								w.NativeBalance += xlm.Amount(paymentOp.Amount)
-								continue
+							if paymentOp.Asset.Type != xdr.AssetTypeAssetTypeNative {
+								if _, ok := w.Balances[paymentOp.Asset.String()]; !ok {
+									t.g.logf("could not find trustline for asset %s in payment op", paymentOp.Asset.String())
+									continue
+								}
 							}
-							assetStr := asset.String()
-							var currBalance fsm.Balance
-							if currBalance, ok := w.Balances[assetStr]; ok {
-								currBalance.Amount += uint64(paymentOp.Amount)
-							} else {
-								t.g.logf("could not find trustline for asset %s in payment op", assetStr)
-								continue
+							creditWallet(w, walletAddr, paymentOp.Asset, paymentOp.Amount)
+						case xdr.OperationTypeCreateAccount:
+							createAccountOp := op.Body.CreateAccountOp
+							creditWallet(w, walletAddr, xdr.Asset{Type: xdr.AssetTypeAssetTypeNative}, createAccountOp.StartingBalance)
+						case xdr.OperationTypePathPayment:
+							// The send asset was debited by SendMax
+							// when the payment was made.
+							pathPaymentOp := op.Body.PathPaymentOp
+							if pathPaymentOp.SendAsset.Type != xdr.AssetTypeAssetTypeNative {
+								if _, ok := w.Balances[pathPaymentOp.SendAsset.String()]; !ok {
+									t.g.logf("could not find trustline for asset %s in path payment op", pathPaymentOp.SendAsset.String())
+									continue
+								}
 							}
-							w.Balances[assetStr] = currBalance
+							creditWallet(w, walletAddr, pathPaymentOp.SendAsset, pathPaymentOp.SendMax)
 						case xdr.OperationTypeChangeTrust:
 							changeOp := op.Body.ChangeTrustOp
 							var asset xdr.Asset
@@ -185,15 +237,18 @@ func (t *TbTx) Run(ctx context.Context) error {
 							if changeOp.Limit != 0 {
 								assetStr := asset.String()
 								delete(w.Balances, assetStr)
-								w.NativeBalance += baseReserve
-								w.Reserve -= baseReserve
+								w.NativeBalance += t.g.baseReserve(root)
+								w.Reserve -= t.g.baseReserve(root)
 							}
 						default:
 							continue
 						}
 					}
 
-					root.Agent().PutWallet(w)
+					var opResults []*update.OpResult
+					if t.Batch {
+						opResults = batchOpResults(&t.E.Tx, &tr, resubmit)
+					}
 					t.g.putUpdate(root, &Update{
 						Type: update.TxFailureType,
 						InputTx: &worizon.Tx{
@@ -201,8 +256,18 @@ func (t *TbTx) Run(ctx context.Context) error {
 							Result: &tr,
 							SeqNum: strconv.FormatUint(uint64(t.E.Tx.SeqNum), 10),
 						},
+						OpResults: opResults,
 					})
-					return nil
+					var more []xdr.TransactionEnvelope
+					if len(resubmit) > 0 {
+						env, err := t.g.resubmitPayments(root, w, &t.E.Tx, resubmit)
+						if err != nil {
+							return err
+						}
+						more = append(more, env)
+					}
+					root.Agent().PutWallet(w)
+					return t.queueNext(root, more...)
 				})
 				if err != nil {
 					t.g.debugf("unreserving wallet funds after unretriable tx failure: %s", err)
@@ -221,8 +286,14 @@ func (t *TbTx) Run(ctx context.Context) error {
 			return t.g.updateChannel(t.ChanID, updateFromTxCaller(ftx))
 			// TODO(bobg): add a tx_failure Update for the UI to consume.
 		}
+		return submitErr
+	}
+	if len(t.Next) == 0 {
+		return nil
 	}
-	return submitErr
+	return db.Update(t.g.db, func(root *db.Root) error {
+		return t.queueNext(root)
+	})
 }
 
 // TbMsg is a taskbasket message-sending task.
@@ -417,8 +488,12 @@ func isRetriableOpResult(opRes xdr.OperationResult) bool {
 			case xdr.PathPaymentResultCodePathPaymentNoIssuer:
 				return false
 			case xdr.PathPaymentResultCodePathPaymentTooFewOffers:
+				// The path's liquidity, or its price within SendMax,
+				// is gone. A new payment must find a new path.
+				return false
 			case xdr.PathPaymentResultCodePathPaymentOfferCrossSelf:
 			case xdr.PathPaymentResultCodePathPaymentOverSendmax:
+				return false
 			}
 		}
 
@@ -0,0 +1,201 @@
+package starlight
+
+import (
+	"sort"
+	"time"
+
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/worizon"
+)
+
+// Timer kinds.
+const (
+	ChannelTimer  = "channel"  // a channel's FSM timeout
+	ScheduleTimer = "schedule" // a payment schedule's next payment
+)
+
+// A Timer is a pending ledger-time timer, as returned by Timers.
+type Timer struct {
+	Kind string    // ChannelTimer or ScheduleTimer
+	ID   string    // channel or schedule ID
+	Time time.Time // ledger time at which it fires
+}
+
+// An agent has at most one timer for each channel
+// and each schedule.
+type timerKey struct {
+	kind, id string
+}
+
+type agentTimer struct {
+	t   *worizon.Timer
+	gen uint64
+}
+
+// Timers returns the agent's pending timers,
+// in the order they will fire.
+//
+// Timers are not stored separately.
+// Each is derived from state already in the database,
+// such as the channel's TimerTime,
+// and is set again from it when the agent starts.
+func (g *Agent) Timers() []Timer {
+	timers := make([]Timer, 0) // we want json "[]" not "null"
+	g.timerMu.Lock()
+	for k, at := range g.timers {
+		timers = append(timers, Timer{Kind: k.kind, ID: k.id, Time: at.t.When()})
+	}
+	g.timerMu.Unlock()
+	sort.Slice(timers, func(i, j int) bool {
+		a, b := timers[i], timers[j]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.ID < b.ID
+	})
+	return timers
+}
+
+// setTimer arranges for f to be called
+// at the first ledger at or after time t,
+// once the current transaction commits.
+// It replaces any timer of the same kind and ID.
+// Must be called from within an update transaction.
+func (g *Agent) setTimer(root *db.Root, kind, id string, t time.Time, f func()) {
+	k := timerKey{kind, id}
+	g.timerGen++
+	gen := g.timerGen
+	root.Tx().OnCommit(func() {
+		g.timerMu.Lock()
+		defer g.timerMu.Unlock()
+		old := g.timers[k]
+		if old != nil {
+			// Commit handlers can run out of order.
+			// Don't let an older transaction's timer win.
+			if old.gen > gen {
+				return
+			}
+			old.t.Stop()
+		}
+		at := &agentTimer{gen: gen}
+		at.t = g.wclient.AfterFunc(t, func() {
+			g.timerMu.Lock()
+			if g.timers[k] == at {
+				delete(g.timers, k)
+			}
+			g.timerMu.Unlock()
+			f()
+		})
+		if g.timers == nil {
+			g.timers = make(map[timerKey]*agentTimer)
+		}
+		g.timers[k] = at
+	})
+}
+
+// stopTimer cancels the timer of the given kind and ID, if any,
+// once the current transaction commits.
+// Must be called from within an update transaction.
+func (g *Agent) stopTimer(root *db.Root, kind, id string) {
+	k := timerKey{kind, id}
+	g.timerGen++
+	gen := g.timerGen
+	root.Tx().OnCommit(func() {
+		g.timerMu.Lock()
+		defer g.timerMu.Unlock()
+		if old := g.timers[k]; old != nil && old.gen < gen {
+			old.t.Stop()
+			delete(g.timers, k)
+		}
+	})
+}
+
+// stopTimers cancels all of the agent's timers.
+func (g *Agent) stopTimers() {
+	g.timerMu.Lock()
+	defer g.timerMu.Unlock()
+	for k, at := range g.timers {
+		at.t.Stop()
+		delete(g.timers, k)
+	}
+}
+
+// syncChannelTimer sets or cancels the timer for channel c
+// to match c.TimerTime.
+// Must be called from within an update transaction.
+func (g *Agent) syncChannelTimer(root *db.Root, c *fsm.Channel) error {
+	t, err := c.TimerTime()
+	if err != nil {
+		return err
+	}
+	if t == nil || c.State == fsm.Closed {
+		g.stopTimer(root, ChannelTimer, c.ID)
+		return nil
+	}
+	chanID := c.ID
+	g.setTimer(root, ChannelTimer, chanID, *t, func() { g.channelTimeout(chanID) })
+	return nil
+}
+
+// channelTimeout delivers the current ledger time
+// to the FSM of channel chanID when its timer fires.
+// If that fails while the agent is locked,
+// it force-closes the channel with the transactions
+// from its latest completed round (see EmergencyClose).
+// A channel that has none, because it is still being set up,
+// times out again when the seed is next unlocked.
+func (g *Agent) channelTimeout(chanID string) {
+	err := g.updateChannel(chanID, func(_ *db.Root, updater *fsm.Updater, update *Update) error {
+		update.InputLedgerTime = g.wclient.Now()
+		return updater.Time()
+	})
+	if err == nil {
+		return
+	}
+	g.debugf("timer on channel %s: %s", chanID, err)
+	locked := g.isLocked()
+	g.mustDeauthenticate()
+	if !locked {
+		return
+	}
+	err = g.EmergencyClose(chanID)
+	if err == nil {
+		return
+	}
+	g.debugf("emergency close of channel %s: %s", chanID, err)
+	var unlocked bool
+	err = db.Update(g.db, func(*db.Root) error {
+		if g.signer() != nil {
+			unlocked = true // while we were closing
+			return nil
+		}
+		if g.stalled == nil {
+			g.stalled = make(map[string]bool)
+		}
+		g.stalled[chanID] = true
+		return nil
+	})
+	if err == nil && unlocked {
+		g.channelTimeout(chanID)
+	}
+}
+
+// resumeTimeouts runs again the channel timeouts
+// that failed for want of the seed,
+// once the current transaction commits.
+// Must be called from within an update transaction
+// that makes the seed available.
+func (g *Agent) resumeTimeouts(root *db.Root) {
+	stalled := g.stalled
+	g.stalled = nil
+	root.Tx().OnCommit(func() {
+		for chanID := range stalled {
+			chanID := chanID
+			g.allez(func() { g.channelTimeout(chanID) }, "channelTimeout")
+		}
+	})
+}
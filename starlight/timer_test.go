@@ -0,0 +1,245 @@
+package starlight
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/schedule"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+func TestScheduleTimers(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := g.wclient.Now().Add(time.Hour)
+	s, err := g.AddSchedule(&Schedule{
+		Kind:      schedule.Wallet,
+		Recipient: randomAddress(t),
+		Amount:    xlm.Lumen,
+		Interval:  24 * time.Hour,
+		Next:      next,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Timer{Kind: ScheduleTimer, ID: s.ID, Time: next}
+	if got := g.Timers(); len(got) != 1 || got[0] != want {
+		t.Fatalf("got timers %+v, want [%+v]", got, want)
+	}
+
+	err = g.PauseSchedule(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Timers(); len(got) != 0 {
+		t.Errorf("got timers %+v after pause, want none", got)
+	}
+
+	err = g.ResumeSchedule(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.ResumeSchedule(s.ID) // no-op
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Timers(); len(got) != 1 || got[0].ID != s.ID {
+		t.Errorf("got timers %+v after resume, want one for %s", got, s.ID)
+	}
+
+	err = g.CancelSchedule(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Timers(); len(got) != 0 {
+		t.Errorf("got timers %+v after cancel, want none", got)
+	}
+}
+
+func TestChannelTimer(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+
+	start := g.wclient.Now()
+	c := &fsm.Channel{
+		ID:               "chan1",
+		State:            fsm.Open,
+		PaymentTime:      start,
+		MaxRoundDuration: time.Hour,
+	}
+	syncTimer := func() {
+		err := db.Update(g.db, func(root *db.Root) error {
+			return g.syncChannelTimer(root, c)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Repeated updates leave a single timer,
+	// at the channel's current TimerTime.
+	syncTimer()
+	c.PaymentTime = start.Add(time.Minute)
+	syncTimer()
+	want := Timer{Kind: ChannelTimer, ID: "chan1", Time: start.Add(time.Minute + time.Hour)}
+	if got := g.Timers(); len(got) != 1 || got[0] != want {
+		t.Fatalf("got timers %+v, want [%+v]", got, want)
+	}
+
+	c.State = fsm.Closed
+	syncTimer()
+	if got := g.Timers(); len(got) != 0 {
+		t.Errorf("got timers %+v after close, want none", got)
+	}
+}
+
+func TestRoundTimeout(t *testing.T) {
+	clk, withClock := manualClock(time.Now())
+	g, closer := startTestAgent(t, withClock)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chanID := randomAddress(t)
+	signed := xdr.TransactionEnvelope{
+		Signatures: []xdr.DecoratedSignature{{Signature: []byte{1}}},
+	}
+	c := &fsm.Channel{
+		ID:                      chanID,
+		Role:                    fsm.Host,
+		State:                   fsm.Open,
+		PrevState:               fsm.Open,
+		PaymentTime:             clk.Now(),
+		MaxRoundDuration:        time.Hour,
+		HostAmount:              10 * xlm.Lumen,
+		CurrentRatchetTx:        signed,
+		CurrentSettleWithHostTx: signed,
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		w := root.Agent().Wallet()
+		w.Seqnum = 1
+		root.Agent().PutWallet(w)
+		g.putChannel(root, chanID, c)
+		return g.syncChannelTimer(root, c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := func() fsm.State {
+		var s fsm.State
+		db.View(g.db, func(root *db.Root) error {
+			s = g.getChannel(root, chanID).State
+			return nil
+		})
+		return s
+	}
+	advanceUntil(t, clk, 2*time.Hour, func() bool { return state() != fsm.Open })
+	if got := state(); got != fsm.AwaitingRatchet {
+		t.Errorf("got state %s after round timeout, want %s", got, fsm.AwaitingRatchet)
+	}
+	if now := g.wclient.Now(); now.Before(c.PaymentTime.Add(time.Hour)) {
+		t.Errorf("channel timed out at %s, before %s", now, c.PaymentTime.Add(time.Hour))
+	}
+}
+
+func TestTimeoutLocked(t *testing.T) {
+	clk, withClock := manualClock(time.Now())
+	g, closer := startTestAgent(t, withClock)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The host's channel proposal times out,
+	// and cleaning up needs the seed.
+	chanID := randomAddress(t)
+	c := &fsm.Channel{
+		ID:               chanID,
+		Role:             fsm.Host,
+		State:            fsm.ChannelProposed,
+		Passphrase:       network.TestNetworkPassphrase,
+		FundingTime:      clk.Now(),
+		MaxRoundDuration: time.Hour,
+		HostAmount:       10 * xlm.Lumen,
+	}
+	for _, acct := range []*fsm.AccountID{&c.HostAcct, &c.GuestAcct, &c.EscrowAcct, &c.HostRatchetAcct, &c.GuestRatchetAcct} {
+		err = acct.SetAddress(randomAddress(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		w := root.Agent().Wallet()
+		w.Seqnum = 1
+		w.NativeBalance = 100 * xlm.Lumen
+		root.Agent().PutWallet(w)
+		g.putChannel(root, chanID, c)
+		return g.syncChannelTimer(root, c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.mustDeauthenticate()
+
+	state := func() fsm.State {
+		var s fsm.State
+		db.View(g.db, func(root *db.Root) error {
+			s = g.getChannel(root, chanID).State
+			return nil
+		})
+		return s
+	}
+
+	// While locked, the timeout waits for the seed:
+	// with no completed round, there is nothing to close with.
+	advanceUntil(t, clk, 2*time.Hour, func() bool { return len(g.Timers()) == 0 })
+	for i := 0; i < 10; i++ {
+		clk.Advance(time.Minute)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := state(); got != fsm.ChannelProposed {
+		t.Fatalf("got state %s after timeout while locked, want %s", got, fsm.ChannelProposed)
+	}
+	var stalled bool
+	db.View(g.db, func(*db.Root) error {
+		stalled = g.stalled[chanID]
+		return nil
+	})
+	if !stalled {
+		t.Fatal("timeout not held for the seed")
+	}
+
+	if !g.Authenticate("alice", "passw0rd") {
+		t.Fatal("login failed")
+	}
+	advanceUntil(t, clk, time.Hour, func() bool { return state() != fsm.ChannelProposed })
+	if got := state(); got != fsm.AwaitingCleanup {
+		t.Errorf("got state %s after login, want %s", got, fsm.AwaitingCleanup)
+	}
+}
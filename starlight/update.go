@@ -61,6 +61,34 @@ func (g *Agent) Updates(a, b uint64) []*Update {
 	return updates
 }
 
+// NextUpdateNum returns the index of the first update
+// at or after i that is still in the log,
+// skipping past any that have been archived.
+// If there is none yet, it returns i
+// or the index the next update will get,
+// whichever is greater.
+func (g *Agent) NextUpdateNum(i uint64) uint64 {
+	n := i
+	err := db.View(g.db, func(root *db.Root) error {
+		bu := root.Agent().Updates().Bucket()
+		if bu == nil {
+			return nil
+		}
+		k := make([]byte, 8)
+		binary.BigEndian.PutUint64(k, i)
+		if k, _ = bu.Cursor().Seek(k); k != nil {
+			n = binary.BigEndian.Uint64(k)
+		} else if bu.Sequence() >= n {
+			n = bu.Sequence() + 1
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err) // only errors here are bugs
+	}
+	return n
+}
+
 // putUpdate assigns new values to ev.UpdateNum and ev.UpdateLedgerTime.
 func (g *Agent) putUpdate(root *db.Root, ev *Update) {
 	if ev.Account == nil {
@@ -74,6 +102,14 @@ func (g *Agent) putUpdate(root *db.Root, ev *Update) {
 	ev.UpdateLedgerTime = g.wclient.Now()
 	root.Agent().Updates().Add(ev, &ev.UpdateNum)
 	root.Tx().OnCommit(g.evcond.Broadcast)
+	err := indexUpdate(root, ev)
+	if err != nil {
+		g.logf("indexing update %d: %s", ev.UpdateNum, err)
+	}
+	err = g.addWebhookTasks(root, ev)
+	if err != nil {
+		g.logf("scheduling webhooks for update %d: %s", ev.UpdateNum, err)
+	}
 	b := new(bytes.Buffer)
 	json.NewEncoder(b).Encode(ev)
 	g.debugf("putUpdate: %s", string(b.Bytes()))
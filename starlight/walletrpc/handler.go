@@ -4,8 +4,12 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/json"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kr/session"
@@ -47,18 +51,41 @@ func Handler(g *starlight.Agent) http.Handler {
 
 	// Wallet RPCs. Add more here as necessary.
 	mux.Handle("/api/updates", wt.auth(wt.updates))
+	mux.Handle("/api/updates-stream", wt.auth(wt.updatesStream))
+	mux.Handle("/api/query-updates", wt.auth(wt.queryUpdates))
+	mux.Handle("/api/export-accounting", wt.auth(wt.exportAccounting))
+	mux.Handle("/api/balance-sheet", wt.auth(wt.balanceSheet))
 	mux.Handle("/api/config-edit", wt.auth(wt.configEdit))
+	mux.Handle("/api/export-mnemonic", wt.auth(wt.exportMnemonic))
 	mux.Handle("/api/logout", wt.auth(wt.logout))
 	mux.Handle("/api/do-create-channel", wt.auth(wt.doCreateChannel))
 	mux.Handle("/api/do-wallet-pay", wt.auth(wt.doWalletPay))
+	mux.Handle("/api/do-wallet-path-pay", wt.auth(wt.doWalletPathPay))
+	mux.Handle("/api/do-wallet-batch-pay", wt.auth(wt.doWalletBatchPay))
 	mux.Handle("/api/do-close-account", wt.auth(wt.doCloseAccount))
 	mux.Handle("/api/do-command", wt.auth(wt.doCommand))
+	mux.Handle("/api/do-emergency-close", wt.auth(wt.doEmergencyClose))
 	mux.Handle("/api/do-add-asset", wt.auth(wt.doAddAsset))
 	mux.Handle("/api/find-account", wt.auth(wt.findAccount))
+	mux.Handle("/api/find-payment-paths", wt.auth(wt.findPaymentPaths))
+	mux.Handle("/api/webhooks", wt.auth(wt.webhooks))
+	mux.Handle("/api/add-webhook", wt.auth(wt.addWebhook))
+	mux.Handle("/api/remove-webhook", wt.auth(wt.removeWebhook))
+	mux.Handle("/api/aliases", wt.auth(wt.aliases))
+	mux.Handle("/api/add-alias", wt.auth(wt.addAlias))
+	mux.Handle("/api/remove-alias", wt.auth(wt.removeAlias))
+	mux.Handle("/api/schedules", wt.auth(wt.schedules))
+	mux.Handle("/api/add-schedule", wt.auth(wt.addSchedule))
+	mux.Handle("/api/pause-schedule", wt.auth(wt.pauseSchedule))
+	mux.Handle("/api/resume-schedule", wt.auth(wt.resumeSchedule))
+	mux.Handle("/api/cancel-schedule", wt.auth(wt.cancelSchedule))
+	mux.Handle("/api/horizon-status", wt.auth(wt.horizonStatus))
+	mux.Handle("/api/timers", wt.auth(wt.timers))
 	// TODO(vniu): authenticate requests to the messages endpoint
 	mux.HandleFunc("/api/messages", wt.messages)
 	mux.HandleFunc("/api/login", wt.login)
 	mux.HandleFunc("/api/config-init", wt.configInit)
+	mux.HandleFunc("/api/config-recover", wt.configRecover)
 	mux.HandleFunc("/api/status", wt.status)
 
 	return mux
@@ -111,6 +138,161 @@ func (wt *wallet) updates(w http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(w).Encode(ev)
 }
 
+// Update streams stay open until the client goes away.
+// A comment line is sent as a heartbeat
+// whenever a stream has been idle for streamHeartbeat,
+// and each write must finish within streamWriteTimeout,
+// so a client that stops reading is dropped
+// rather than having its backlog buffered here.
+var (
+	streamHeartbeat    = 10 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+func (wt *wallet) updatesStream(w http.ResponseWriter, req *http.Request) {
+	// This is a server-sent events alternative to /api/updates.
+	// Each update is pushed as soon as it is committed, as an
+	// event whose id is its UpdateNum. The stream starts at the
+	// From query parameter, or, when an EventSource reconnects,
+	// just after the Last-Event-ID it reports.
+	from, err := streamStart(req)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	if _, ok := w.(http.Flusher); !ok {
+		starlight.WriteError(req, w, errors.New("streaming unsupported"))
+		return
+	}
+	ctx := req.Context()
+	rc := http.NewResponseController(w)
+
+	// send writes s and flushes it,
+	// replacing the global write timeout (15s)
+	// with a deadline for this write alone.
+	// Writers that don't support deadlines,
+	// such as httptest.ResponseRecorder, keep the global one.
+	send := func(s string) error {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		_, err := io.WriteString(w, s)
+		if err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// If the stream is cut off anyway,
+	// tell EventSource clients to reconnect right away,
+	// resuming where they left off.
+	if send("retry: 500\n\n") != nil {
+		return
+	}
+
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, streamHeartbeat)
+		wt.agent.WaitUpdate(waitCtx, from)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		// Skip over updates that have been archived
+		// (and, when From is 0, the nonexistent update 0),
+		// so a stretch of them doesn't stall the stream.
+		from = wt.agent.NextUpdateNum(from)
+		// Send at most 100 updates per write.
+		var buf strings.Builder
+		for _, ev := range wt.agent.Updates(from, from+100) {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(&buf, "id: %d\nevent: update\ndata: %s\n\n", ev.UpdateNum, data)
+			from = ev.UpdateNum + 1
+		}
+		if buf.Len() == 0 {
+			buf.WriteString(": heartbeat\n\n")
+		}
+		if send(buf.String()) != nil {
+			return
+		}
+	}
+}
+
+// streamStart returns the index of the first update
+// to send on an update stream.
+func streamStart(req *http.Request) (uint64, error) {
+	if id := req.Header.Get("Last-Event-ID"); id != "" {
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if n == math.MaxUint64 {
+			return 0, errors.New("Last-Event-ID out of range")
+		}
+		return n + 1, nil
+	}
+	if from := req.URL.Query().Get("From"); from != "" {
+		return strconv.ParseUint(from, 10, 64)
+	}
+	return 1, nil
+}
+
+func (wt *wallet) queryUpdates(w http.ResponseWriter, req *http.Request) {
+	var q starlight.UpdateQuery
+	err := json.NewDecoder(req.Body).Decode(&q)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	page, err := wt.agent.QueryUpdates(&q)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (wt *wallet) exportAccounting(w http.ResponseWriter, req *http.Request) {
+	var v struct {
+		Start, End time.Time
+		Format     string // "json" (the default) or "csv"
+	}
+	err := json.NewDecoder(req.Body).Decode(&v)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	if v.Format != "" && v.Format != "json" && v.Format != "csv" {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, errors.New("unknown format "+v.Format)))
+		return
+	}
+	entries, err := wt.agent.ExportAccounting(v.Start, v.End)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+		return
+	}
+	if v.Format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		starlight.WriteAccountingCSV(w, entries)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (wt *wallet) balanceSheet(w http.ResponseWriter, req *http.Request) {
+	bs, err := wt.agent.BalanceSheet()
+	if err != nil {
+		starlight.WriteError(req, w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bs)
+}
+
 func (wt *wallet) configEdit(w http.ResponseWriter, req *http.Request) {
 	var config starlight.Config
 	err := json.NewDecoder(req.Body).Decode(&config)
@@ -137,10 +319,59 @@ func (wt *wallet) configInit(w http.ResponseWriter, req *http.Request) {
 		starlight.WriteError(req, w, err)
 		return
 	}
+	mnemonic, err := wt.agent.ExportMnemonic(config.Password)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+		return
+	}
+	if net.IsLoopback(req.Host) {
+		wt.sess.Secure = false
+	}
+	session.Set(w, &struct{}{}, &wt.sess)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct{ Mnemonic string }{mnemonic})
+}
+
+func (wt *wallet) configRecover(w http.ResponseWriter, req *http.Request) {
+	var v struct {
+		starlight.Config
+		Mnemonic    string
+		MaxKeyIndex uint32
+	}
+	err := json.NewDecoder(req.Body).Decode(&v)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	rec, err := wt.agent.ConfigRecover(&v.Config, req.Host, v.Mnemonic, v.MaxKeyIndex)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+		return
+	}
 	if net.IsLoopback(req.Host) {
 		wt.sess.Secure = false
 	}
 	session.Set(w, &struct{}{}, &wt.sess)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
+
+func (wt *wallet) exportMnemonic(w http.ResponseWriter, req *http.Request) {
+	var v struct {
+		Password string
+	}
+	err := json.NewDecoder(req.Body).Decode(&v)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	mnemonic, err := wt.agent.ExportMnemonic(v.Password)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct{ Mnemonic string }{mnemonic})
 }
 
 func (wt *wallet) doCreateChannel(w http.ResponseWriter, req *http.Request) {
@@ -169,18 +400,76 @@ func (wt *wallet) doWalletPay(w http.ResponseWriter, req *http.Request) {
 		Amount    uint64
 		AssetCode string
 		Issuer    string
+		Memo      *starlight.Memo
+	}
+	err := json.NewDecoder(req.Body).Decode(&v)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	err = wt.agent.DoWalletPay(v.Dest, v.Amount, v.AssetCode, v.Issuer, v.Memo)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+	}
+}
+
+func (wt *wallet) doWalletPathPay(w http.ResponseWriter, req *http.Request) {
+	var v struct {
+		Dest          string
+		Amount        uint64
+		AssetCode     string
+		Issuer        string
+		SendAssetCode string
+		SendIssuer    string
+		Slippage      uint32 // basis points
+	}
+	err := json.NewDecoder(req.Body).Decode(&v)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	err = wt.agent.DoWalletPathPay(v.Dest, v.Amount, v.AssetCode, v.Issuer, v.SendAssetCode, v.SendIssuer, v.Slippage)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+	}
+}
+
+func (wt *wallet) doWalletBatchPay(w http.ResponseWriter, req *http.Request) {
+	var v struct {
+		Payments []*starlight.WalletPayment
 	}
 	err := json.NewDecoder(req.Body).Decode(&v)
 	if err != nil {
 		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
 		return
 	}
-	err = wt.agent.DoWalletPay(v.Dest, v.Amount, v.AssetCode, v.Issuer)
+	err = wt.agent.DoWalletBatchPay(v.Payments)
 	if err != nil {
 		starlight.WriteError(req, w, err)
 	}
 }
 
+func (wt *wallet) findPaymentPaths(w http.ResponseWriter, req *http.Request) {
+	var v struct {
+		Dest      string
+		Amount    uint64
+		AssetCode string
+		Issuer    string
+	}
+	err := json.NewDecoder(req.Body).Decode(&v)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	paths, err := wt.agent.FindPaymentPaths(v.Dest, v.Amount, v.AssetCode, v.Issuer)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(paths)
+}
+
 func (wt *wallet) doCloseAccount(w http.ResponseWriter, req *http.Request) {
 	var v struct {
 		Dest string
@@ -214,6 +503,21 @@ func (wt *wallet) doCommand(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func (wt *wallet) doEmergencyClose(w http.ResponseWriter, req *http.Request) {
+	var v struct {
+		ChannelID string
+	}
+	err := json.NewDecoder(req.Body).Decode(&v)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	err = wt.agent.EmergencyClose(v.ChannelID)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+	}
+}
+
 func (wt *wallet) findAccount(w http.ResponseWriter, req *http.Request) {
 	// TODO(debnil): Add unit test and needed framework for this and other wallet RPCs.
 	var v struct {
@@ -268,6 +572,133 @@ func (wt *wallet) doRemoveAsset(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func (wt *wallet) webhooks(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wt.agent.Webhooks())
+}
+
+func (wt *wallet) addWebhook(w http.ResponseWriter, req *http.Request) {
+	var v struct {
+		URL   string
+		Types []string
+	}
+	err := json.NewDecoder(req.Body).Decode(&v)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	hook, err := wt.agent.AddWebhook(v.URL, v.Types)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+func (wt *wallet) removeWebhook(w http.ResponseWriter, req *http.Request) {
+	var v struct {
+		ID string
+	}
+	err := json.NewDecoder(req.Body).Decode(&v)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	err = wt.agent.RemoveWebhook(v.ID)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+	}
+}
+
+func (wt *wallet) aliases(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wt.agent.Aliases())
+}
+
+func (wt *wallet) addAlias(w http.ResponseWriter, req *http.Request) {
+	var v struct {
+		Name string
+		Memo *starlight.Memo
+	}
+	err := json.NewDecoder(req.Body).Decode(&v)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	a, err := wt.agent.AddAlias(v.Name, v.Memo)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a)
+}
+
+func (wt *wallet) removeAlias(w http.ResponseWriter, req *http.Request) {
+	var v struct {
+		Name string
+	}
+	err := json.NewDecoder(req.Body).Decode(&v)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	err = wt.agent.RemoveAlias(v.Name)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+	}
+}
+
+func (wt *wallet) schedules(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wt.agent.Schedules())
+}
+
+func (wt *wallet) addSchedule(w http.ResponseWriter, req *http.Request) {
+	var v starlight.Schedule
+	err := json.NewDecoder(req.Body).Decode(&v)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	s, err := wt.agent.AddSchedule(&v)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+func (wt *wallet) pauseSchedule(w http.ResponseWriter, req *http.Request) {
+	wt.scheduleOp(w, req, wt.agent.PauseSchedule)
+}
+
+func (wt *wallet) resumeSchedule(w http.ResponseWriter, req *http.Request) {
+	wt.scheduleOp(w, req, wt.agent.ResumeSchedule)
+}
+
+func (wt *wallet) cancelSchedule(w http.ResponseWriter, req *http.Request) {
+	wt.scheduleOp(w, req, wt.agent.CancelSchedule)
+}
+
+// scheduleOp applies f to the schedule ID in the request body.
+func (wt *wallet) scheduleOp(w http.ResponseWriter, req *http.Request, f func(id string) error) {
+	var v struct {
+		ID string
+	}
+	err := json.NewDecoder(req.Body).Decode(&v)
+	if err != nil {
+		starlight.WriteError(req, w, errors.Sub(starlight.ErrUnmarshaling, err))
+		return
+	}
+	err = f(v.ID)
+	if err != nil {
+		starlight.WriteError(req, w, err)
+	}
+}
+
 func (wt *wallet) messages(w http.ResponseWriter, req *http.Request) {
 	var v struct {
 		ChannelID string `json:"channel_id"`
@@ -303,6 +734,16 @@ func (wt *wallet) status(w http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
+func (wt *wallet) horizonStatus(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wt.agent.HorizonStatus())
+}
+
+func (wt *wallet) timers(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wt.agent.Timers())
+}
+
 func (wt *wallet) login(w http.ResponseWriter, req *http.Request) {
 	var cred struct{ Username, Password string }
 	err := json.NewDecoder(req.Body).Decode(&cred)
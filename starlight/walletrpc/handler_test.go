@@ -0,0 +1,187 @@
+package walletrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+
+	"github.com/interstellar/starlight/starlight"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/internal/update"
+)
+
+func startTestAgent(t *testing.T) (*starlight.Agent, *bolt.DB, func()) {
+	f, err := ioutil.TempFile("", "walletrpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbfile := f.Name()
+	f.Close()
+	boltDB, err := bolt.Open(dbfile, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := starlight.StartAgent(context.Background(), boltDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		g.CloseWait()
+		boltDB.Close()
+		os.Remove(dbfile)
+	}
+	return g, boltDB, cleanup
+}
+
+func TestUpdatesStream(t *testing.T) {
+	g, boltDB, cleanup := startTestAgent(t)
+	defer cleanup()
+	wt := &wallet{agent: g}
+
+	// Updates 1-250, with 2-200 archived,
+	// leaving a gap wider than one batch.
+	err := db.Update(boltDB, func(root *db.Root) error {
+		updates := root.Agent().Updates()
+		for i := 0; i < 250; i++ {
+			ev := &update.Update{Type: update.WarningType}
+			updates.Add(ev, &ev.UpdateNum)
+		}
+		for n := uint64(2); n <= 200; n++ {
+			k := make([]byte, 8)
+			binary.BigEndian.PutUint64(k, n)
+			err := updates.Bucket().Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var afterGap []uint64
+	for n := uint64(201); n <= 250; n++ {
+		afterGap = append(afterGap, n)
+	}
+	cases := []struct {
+		query, lastEventID string
+		wantCode           int
+		want               []uint64
+	}{
+		{"", "", 200, append([]uint64{1}, afterGap...)},
+		{"?From=0", "", 200, append([]uint64{1}, afterGap...)},
+		{"?From=2", "", 200, afterGap},
+		{"?From=240", "", 200, afterGap[39:]},
+		{"?From=251", "", 200, nil},
+		{"", "1", 200, afterGap},
+		{"", "250", 200, nil},
+		{"", "18446744073709551615", 400, nil},
+		{"", "x", 400, nil},
+	}
+	for _, c := range cases {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		req := httptest.NewRequest("GET", "/api/updates-stream"+c.query, nil).WithContext(ctx)
+		if c.lastEventID != "" {
+			req.Header.Set("Last-Event-ID", c.lastEventID)
+		}
+		rec := httptest.NewRecorder()
+		wt.updatesStream(rec, req)
+		cancel()
+
+		if rec.Code != c.wantCode {
+			t.Errorf("%s (Last-Event-ID %q): got status %d, want %d", c.query, c.lastEventID, rec.Code, c.wantCode)
+			continue
+		}
+		if c.wantCode != 200 {
+			continue
+		}
+		var got []uint64
+		sc := bufio.NewScanner(rec.Body)
+		for sc.Scan() {
+			if !strings.HasPrefix(sc.Text(), "id: ") {
+				continue
+			}
+			n, err := strconv.ParseUint(strings.TrimPrefix(sc.Text(), "id: "), 10, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, n)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s (Last-Event-ID %q): got updates %v, want %v", c.query, c.lastEventID, got, c.want)
+		}
+	}
+}
+
+func TestUpdatesStreamHeartbeat(t *testing.T) {
+	defer func(d time.Duration) { streamHeartbeat = d }(streamHeartbeat)
+	streamHeartbeat = 50 * time.Millisecond
+
+	g, boltDB, cleanup := startTestAgent(t)
+	defer cleanup()
+	wt := &wallet{agent: g}
+
+	// The stream outlives the server's write timeout.
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(wt.updatesStream))
+	srv.Config.WriteTimeout = 200 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?From=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+
+	var heartbeats int
+	timeout := time.After(5 * time.Second)
+	added := time.After(500 * time.Millisecond)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("stream closed after %d heartbeats", heartbeats)
+			}
+			if line == ": heartbeat" {
+				heartbeats++
+			}
+			if line == "id: 1" {
+				if heartbeats == 0 {
+					t.Error("got no heartbeats while idle")
+				}
+				return
+			}
+		case <-added:
+			err := db.Update(boltDB, func(root *db.Root) error {
+				ev := &update.Update{Type: update.WarningType}
+				root.Agent().Updates().Add(ev, &ev.UpdateNum)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for update 1")
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package starlight
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/starlight/db"
+	"github.com/interstellar/starlight/starlight/internal/update"
+	"github.com/interstellar/starlight/starlight/internal/webhook"
+)
+
+// Webhook is an HTTP callback registered with an agent.
+type Webhook = webhook.Webhook
+
+// AddWebhook registers url to receive a signed POST
+// for each update whose type is in types,
+// or for every update if types is empty.
+// Types may also include webhook.ChannelPaymentIn
+// ("channel_payment_in"),
+// to receive just the channel updates
+// that complete incoming payments.
+// The returned Webhook includes the secret
+// receivers use to check the Starlight-Signature header.
+// This is the only time the secret is returned;
+// Webhooks leaves it out.
+func (g *Agent) AddWebhook(hookURL string, types []string) (*Webhook, error) {
+	u, err := url.Parse(hookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errInvalidURL
+	}
+	for _, typ := range types {
+		if typ == webhook.ChannelPaymentIn {
+			continue
+		}
+		switch update.Type(typ) {
+		case update.InitType, update.ConfigType, update.AccountType, update.ChannelType,
+			update.WarningType, update.TxSuccessType, update.TxFailureType, update.ScheduleType:
+		default:
+			return nil, errors.Wrapf(errInvalidInput, "unknown update type %s", typ)
+		}
+	}
+	id := make([]byte, 16)
+	randRead(id)
+	secret := make([]byte, 32)
+	randRead(secret)
+	w := &Webhook{
+		ID:     hex.EncodeToString(id),
+		URL:    hookURL,
+		Types:  types,
+		Secret: hex.EncodeToString(secret),
+	}
+	err = db.Update(g.db, func(root *db.Root) error {
+		if !g.isReadyConfigured(root) {
+			return errNotConfigured
+		}
+		root.Agent().Webhooks().PutByString(w.ID, w)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// RemoveWebhook unregisters the webhook with the given ID.
+// Pending deliveries to it are abandoned.
+func (g *Agent) RemoveWebhook(id string) error {
+	return db.Update(g.db, func(root *db.Root) error {
+		bu := root.Agent().Webhooks().Bucket()
+		if bu.Get([]byte(id)) == nil {
+			return errNoWebhook
+		}
+		return bu.Delete([]byte(id))
+	})
+}
+
+// Webhooks returns the registered webhooks,
+// without their secrets.
+func (g *Agent) Webhooks() []*Webhook {
+	hooks := make([]*Webhook, 0) // we want json "[]" not "null"
+	err := db.View(g.db, func(root *db.Root) error {
+		bu := root.Agent().Webhooks().Bucket()
+		if bu == nil {
+			return nil
+		}
+		return bu.ForEach(func(k, _ []byte) error {
+			w := root.Agent().Webhooks().Get(k)
+			w.Secret = ""
+			hooks = append(hooks, w)
+			return nil
+		})
+	})
+	if err != nil {
+		panic(err) // only errors here are bugs
+	}
+	return hooks
+}
+
+// addWebhookTasks schedules delivery of ev
+// to each webhook that has selected it.
+func (g *Agent) addWebhookTasks(root *db.Root, ev *Update) error {
+	if g.tb == nil {
+		return nil // not started yet, so nothing can be registered
+	}
+	bu := root.Agent().Webhooks().Bucket()
+	if bu == nil {
+		return nil
+	}
+	return bu.ForEach(func(k, _ []byte) error {
+		w := root.Agent().Webhooks().Get(k)
+		if !w.Matches(ev) {
+			return nil
+		}
+		t := &TbHook{
+			g:       g,
+			HookID:  w.ID,
+			Update:  ev,
+			Created: g.clock.Now(),
+		}
+		return g.tb.AddTx(root.Tx(), t)
+	})
+}
+
+// maxWebhookAge is how long a webhook delivery is retried
+// before it is dropped.
+const maxWebhookAge = 24 * time.Hour
+
+// TbHook is a taskbasket webhook-delivery task.
+type TbHook struct {
+	g       *Agent
+	HookID  string
+	Update  *Update
+	Created time.Time
+}
+
+// Run implements taskbasket.Task.Run.
+// Network errors and server errors are retried,
+// as are 408 and 429 responses,
+// for up to maxWebhookAge after the update.
+// Any other client error means the receiver rejected the update,
+// which retrying won't change,
+// so it is logged and the delivery dropped.
+func (h *TbHook) Run(ctx context.Context) error {
+	var w *Webhook
+	err := db.View(h.g.db, func(root *db.Root) error {
+		w = root.Agent().Webhooks().GetByString(h.HookID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if w.ID == "" {
+		h.g.debugf("webhook %s removed, dropping update %d", h.HookID, h.Update.UpdateNum)
+		return nil
+	}
+
+	body, err := json.Marshal(h.Update)
+	if err != nil {
+		// If the update cannot be marshaled, the implementation is broken.
+		return err
+	}
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Starlight-Signature", w.Sign(body))
+	req.Header.Set("Starlight-Update-Num", strconv.FormatUint(h.Update.UpdateNum, 10))
+
+	resp, err := h.g.httpclient.Do(req)
+	if err != nil {
+		h.g.debugf("error %s delivering update %d to %s", err, h.Update.UpdateNum, w.URL)
+		return h.retry(w, err)
+	}
+	defer resp.Body.Close()
+	switch code := resp.StatusCode; {
+	case code/100 == 2:
+		return nil
+	case code/100 == 4 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests:
+		h.g.logf("webhook %s rejected update %d with status %s, dropping it", w.ID, h.Update.UpdateNum, resp.Status)
+		return nil
+	}
+	return h.retry(w, errors.New("bad status "+resp.Status))
+}
+
+// retry returns err, so the delivery is retried,
+// unless it has been retried for maxWebhookAge,
+// in which case it logs err and returns nil.
+func (h *TbHook) retry(w *Webhook, err error) error {
+	if age := h.g.clock.Now().Sub(h.Created); age > maxWebhookAge {
+		h.g.logf("webhook %s failed to take update %d for %s, dropping it: %s", w.ID, h.Update.UpdateNum, age, err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+package starlight
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/interstellar/starlight/starlight/fsm"
+	"github.com/interstellar/starlight/starlight/internal/update"
+	"github.com/interstellar/starlight/starlight/internal/webhook"
+)
+
+func TestWebhook(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = g.AddWebhook("ftp://starlight.com/hook", nil)
+	if err != errInvalidURL {
+		t.Errorf("got error %v, want %s", err, errInvalidURL)
+	}
+	_, err = g.AddWebhook("https://starlight.com/hook", []string{"bogus"})
+	if err == nil {
+		t.Error("got no error for unknown update type")
+	}
+
+	w, err := g.AddWebhook("https://starlight.com/hook", []string{string(update.ChannelType)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Secret == "" {
+		t.Error("new webhook has no secret")
+	}
+	listed := *w
+	listed.Secret = ""
+	if got := g.Webhooks(); len(got) != 1 || !reflect.DeepEqual(got[0], &listed) {
+		t.Errorf("got webhooks %v, want [%v]", got, &listed)
+	}
+	if w.Matches(&Update{Type: update.AccountType}) || !w.Matches(&Update{Type: update.ChannelType}) {
+		t.Errorf("webhook with types %v matches wrong update types", w.Types)
+	}
+
+	h := &TbHook{
+		g:      g,
+		HookID: w.ID,
+		Update: &Update{Type: update.ChannelType, UpdateNum: 7},
+	}
+	codec := tbCodec{g: g}
+	bytes, err := codec.Encode(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := codec.Decode(bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, h) {
+		t.Fatalf("decoded webhook task doesn't match: want %#v, got %#v", h, got)
+	}
+
+	err = h.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.RemoveWebhook(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = g.RemoveWebhook(w.ID); err != errNoWebhook {
+		t.Errorf("got error %v, want %s", err, errNoWebhook)
+	}
+	err = h.Run(context.Background())
+	if err != nil {
+		t.Errorf("running task for removed webhook: %s", err)
+	}
+}
+
+func TestWebhookChannelPaymentIn(t *testing.T) {
+	w := &Webhook{Types: []string{webhook.ChannelPaymentIn}}
+	cases := []struct {
+		prev, state fsm.State
+		want        bool
+	}{
+		{fsm.PaymentAccepted, fsm.Open, true},  // payee completes
+		{fsm.PaymentProposed, fsm.Open, false}, // payer completes
+		{fsm.Open, fsm.PaymentAccepted, false},
+		{fsm.Open, fsm.PaymentProposed, false},
+	}
+	for _, c := range cases {
+		ev := &Update{Type: update.ChannelType, Channel: &fsm.Channel{PrevState: c.prev, State: c.state}}
+		if got := w.Matches(ev); got != c.want {
+			t.Errorf("%s -> %s: got match %t, want %t", c.prev, c.state, got, c.want)
+		}
+	}
+	if w.Matches(&Update{Type: update.AccountType}) {
+		t.Error("channel_payment_in webhook matches account update")
+	}
+}
+
+// statusHTTP answers every request with its status code.
+type statusHTTP int
+
+func (s statusHTTP) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: int(s),
+		Status:     http.StatusText(int(s)),
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func TestWebhookStatus(t *testing.T) {
+	g, closer := startTestAgent(t)
+	defer closer()
+	err := g.ConfigInit(&Config{
+		Username:   "alice",
+		Password:   "passw0rd",
+		HorizonURL: testHorizonURL,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := g.AddWebhook("https://starlight.com/hook", []string{webhook.ChannelPaymentIn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &TbHook{
+		g:       g,
+		HookID:  w.ID,
+		Update:  &Update{Type: update.ChannelType, UpdateNum: 7},
+		Created: g.clock.Now(),
+	}
+
+	cases := []struct {
+		code  int
+		retry bool
+	}{
+		{200, false},
+		{204, false},
+		{400, false},
+		{404, false},
+		{408, true},
+		{429, true},
+		{500, true},
+		{503, true},
+	}
+	for _, c := range cases {
+		g.httpclient.Transport = statusHTTP(c.code)
+		err := h.Run(context.Background())
+		if retry := err != nil; retry != c.retry {
+			t.Errorf("status %d: got error %v, want retry %t", c.code, err, c.retry)
+		}
+	}
+
+	// Past maxWebhookAge, the delivery is dropped.
+	h.Created = g.clock.Now().Add(-maxWebhookAge - time.Minute)
+	g.httpclient.Transport = statusHTTP(503)
+	if err := h.Run(context.Background()); err != nil {
+		t.Errorf("got error %v for an expired delivery, want nil", err)
+	}
+}
@@ -0,0 +1,230 @@
+package worizon
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/stellar/go/clients/horizon"
+
+	"github.com/interstellar/starlight/errors"
+)
+
+// ledgerTimeout is how long the active endpoint
+// may go without delivering a ledger
+// before the Client fails over to another.
+// Stellar closes a ledger every five seconds or so.
+var ledgerTimeout = time.Minute
+
+// maxStreamFailures is the number of consecutive stream errors
+// from the active endpoint
+// after which the Client fails over to another.
+const maxStreamFailures = 3
+
+var errStale = errors.New("no new ledger")
+
+// endpoint is one of a Client's Horizon servers.
+// Its mutable fields are protected by the Client's mu.
+type endpoint struct {
+	url string
+	h   horizonClient
+
+	failures   int // consecutive
+	lastErr    error
+	lastLedger time.Time // when it last delivered a ledger
+}
+
+// EndpointStatus reports the health of one of a Client's Horizon servers.
+type EndpointStatus struct {
+	URL        string
+	Active     bool
+	Failures   int       // consecutive failed requests
+	LastError  string    `json:",omitempty"`
+	LastLedger time.Time // when it last delivered a ledger
+}
+
+// SplitURLs splits s, a comma-separated list of Horizon URLs,
+// as accepted by SetURL.
+func SplitURLs(s string) []string {
+	var urls []string
+	for _, u := range strings.Split(s, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// Endpoints reports the health of c's Horizon servers,
+// in the order they were given.
+// Exactly one is active.
+func (c *Client) Endpoints() []EndpointStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var s []EndpointStatus
+	for i, ep := range c.endpoints {
+		st := EndpointStatus{
+			URL:        ep.url,
+			Active:     i == c.active,
+			Failures:   ep.failures,
+			LastLedger: ep.lastLedger,
+		}
+		if ep.lastErr != nil {
+			st.LastError = ep.lastErr.Error()
+		}
+		s = append(s, st)
+	}
+	return s
+}
+
+// current returns the active endpoint
+// and a channel that is closed when it changes.
+func (c *Client) current() (*endpoint, chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.endpoints) == 0 {
+		return nil, nil
+	}
+	return c.endpoints[c.active], c.changed
+}
+
+// do calls f with each endpoint's horizon client in turn,
+// beginning with the active one,
+// until f returns nil or an error that isn't the endpoint's fault.
+// If an endpoint other than the active one succeeds,
+// it becomes active.
+func (c *Client) do(f func(horizonClient) error) error {
+	c.mu.Lock()
+	eps, active := c.endpoints, c.active
+	c.mu.Unlock()
+	if len(eps) == 0 {
+		return errUninitialized
+	}
+	var err, activeErr error
+	for i := range eps {
+		ep := eps[(active+i)%len(eps)]
+		err = f(ep.h)
+		if isEndpointErr(err) {
+			c.record(ep, err)
+			if i == 0 {
+				activeErr = err
+			}
+			continue
+		}
+		c.record(ep, nil)
+		if i > 0 {
+			c.activate(eps[active], ep, activeErr)
+		}
+		return err
+	}
+	return err
+}
+
+// isEndpointErr reports whether err means
+// the Horizon server failed,
+// as opposed to rejecting the request.
+func isEndpointErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	herr, ok := errors.Root(err).(*horizon.Error)
+	if !ok {
+		return true // network error
+	}
+	return herr.Response == nil || herr.Response.StatusCode/100 == 5
+}
+
+// record notes the outcome of a request to ep.
+func (c *Client) record(ep *endpoint, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		ep.failures = 0
+		return
+	}
+	ep.failures++
+	ep.lastErr = err
+}
+
+// failover makes the endpoint after from active,
+// if from is still active,
+// preferring one that answers a health check.
+func (c *Client) failover(from *endpoint, reason error) {
+	c.mu.Lock()
+	eps := c.endpoints
+	if len(eps) < 2 || eps[c.active] != from {
+		c.mu.Unlock()
+		return
+	}
+	active := c.active
+	c.mu.Unlock()
+
+	next := eps[(active+1)%len(eps)]
+	for i := 1; i < len(eps); i++ {
+		ep := eps[(active+i)%len(eps)]
+		_, err := ep.h.Root()
+		c.record(ep, err)
+		if err == nil {
+			next = ep
+			break
+		}
+	}
+	c.activate(from, next, reason)
+}
+
+// activate makes endpoint to active
+// in place of from, if from is still active.
+// Streams restart on the new endpoint
+// at the cursors they had reached.
+func (c *Client) activate(from, to *endpoint, reason error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.endpoints) == 0 || c.endpoints[c.active] != from {
+		return
+	}
+	for i, ep := range c.endpoints {
+		if ep == to {
+			c.active = i
+			c.activeSince = c.clk().Now()
+			log.Printf("worizon: switching from %s to %s: %v", from.url, to.url, reason)
+			close(c.changed)
+			c.changed = make(chan struct{})
+			return
+		}
+	}
+}
+
+// watchLedgers fails over whenever the active endpoint
+// goes ledgerTimeout without delivering a ledger.
+// It runs forever in its own goroutine.
+func (c *Client) watchLedgers() {
+	for {
+		<-c.clk().NewTimer(ledgerTimeout / 4).C()
+		c.mu.Lock()
+		var (
+			ep    *endpoint
+			fresh time.Time
+		)
+		if len(c.endpoints) > 0 {
+			ep = c.endpoints[c.active]
+			fresh = c.activeSince
+			if ep.lastLedger.After(fresh) {
+				fresh = ep.lastLedger
+			}
+		}
+		c.mu.Unlock()
+		if ep == nil || c.clk().Now().Sub(fresh) < ledgerTimeout {
+			continue
+		}
+		log.Printf("warning: no ledger from horizon %s in >%s", ep.url, ledgerTimeout)
+		c.record(ep, errStale)
+		c.failover(ep, errStale)
+
+		// If there's nowhere else to go, warn again later.
+		c.mu.Lock()
+		if c.endpoints[c.active] == ep {
+			c.activeSince = c.clk().Now()
+		}
+		c.mu.Unlock()
+	}
+}
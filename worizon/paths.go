@@ -0,0 +1,92 @@
+package worizon
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/stellar/go/clients/horizon"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+
+	"github.com/interstellar/starlight/errors"
+)
+
+// Path is a route for a path payment, as found by Horizon.
+type Path = hProtocol.Path
+
+// PathQuery is a request for paths
+// that deliver DestAmount of an asset to a destination account.
+type PathQuery struct {
+	Source      string // account that will send the payment
+	Destination string
+
+	// DestAssetCode and DestIssuer are empty for lumens.
+	DestAssetCode string
+	DestIssuer    string
+
+	// DestAmount is in the format expected by Horizon,
+	// e.g. xlm.Amount.HorizonString.
+	DestAmount string
+}
+
+// pathClient adds path finding,
+// which package horizon does not implement,
+// to a horizon client.
+type pathClient struct {
+	*horizon.Client
+}
+
+// LoadPaths queries Horizon's /paths endpoint
+// with the query parameters in v.
+// The error can be (but is not necessarily)
+// an instance of horizon.Error.
+func (c pathClient) LoadPaths(v url.Values) ([]Path, error) {
+	resp, err := c.HTTP.Get(c.URL + "/paths?" + v.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		herr := &horizon.Error{Response: resp}
+		err = dec.Decode(&herr.Problem)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding horizon problem")
+		}
+		return nil, herr
+	}
+	var page struct {
+		Embedded struct {
+			Records []Path `json:"records"`
+		} `json:"_embedded"`
+	}
+	err = dec.Decode(&page)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding paths")
+	}
+	return page.Embedded.Records, nil
+}
+
+// FindPaths returns the paths by which q.Source
+// can pay q.DestAmount of the destination asset to q.Destination.
+func (c *Client) FindPaths(q PathQuery) (paths []Path, err error) {
+	v := make(url.Values)
+	v.Set("source_account", q.Source)
+	v.Set("destination_account", q.Destination)
+	v.Set("destination_amount", q.DestAmount)
+	if q.DestAssetCode == "" {
+		v.Set("destination_asset_type", "native")
+	} else {
+		typ := "credit_alphanum4"
+		if len(q.DestAssetCode) > 4 {
+			typ = "credit_alphanum12"
+		}
+		v.Set("destination_asset_type", typ)
+		v.Set("destination_asset_code", q.DestAssetCode)
+		v.Set("destination_asset_issuer", q.DestIssuer)
+	}
+	err = c.do(func(h horizonClient) error {
+		paths, err = h.LoadPaths(v)
+		return err
+	})
+	return paths, err
+}
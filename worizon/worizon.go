@@ -5,8 +5,11 @@ package worizon
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"sort"
 	"strings"
 	"sync"
@@ -16,13 +19,15 @@ import (
 	"github.com/stellar/go/network"
 	"github.com/stellar/go/xdr"
 
+	"github.com/interstellar/starlight/clock"
 	"github.com/interstellar/starlight/errors"
 	"github.com/interstellar/starlight/net"
+	"github.com/interstellar/starlight/worizon/xlm"
 )
 
 var (
 	errUninitialized = errors.New("uninitialized")
-	errMainnet       = errors.New("using mainnet instead of testnet")
+	errMainnet       = errors.New("Stellar mainnet is not supported")
 )
 
 // Alias some types that don't need to be wrapped.
@@ -46,43 +51,115 @@ type horizonClient interface {
 	StreamLedgers(ctx context.Context, cursor *Cursor, handler LedgerHandler) error
 	StreamTransactions(ctx context.Context, accountID string, cursor *Cursor, handler TransactionHandler) error
 	SubmitTransaction(txeBase64 string) (TxSuccess, error)
+	LoadPaths(v url.Values) ([]Path, error)
 }
 
 // Client is a wrapper for some of a horizon client's functionality.
+// It can use several Horizon servers,
+// failing over from one to the next
+// when the active one returns errors
+// or stops delivering new ledgers.
 // To initialize a Client, call SetURL on the zero value.
 // It is okay to call methods on Client concurrently.
 // A Client must not be copied after first use.
 type Client struct {
-	mu      sync.Mutex
-	changed chan struct{}
-	hclient horizonClient
-	now     time.Time // updated at each ledger close
-	timers  []*timer
-	http    horizon.HTTP
-
-	// initHorizon indicates whether the Client was initialized with a
-	// horizon client, in which case SetURL has no effect.
+	mu          sync.Mutex
+	changed     chan struct{} // closed when the active endpoint changes
+	endpoints   []*endpoint
+	active      int       // index in endpoints
+	activeSince time.Time // when endpoints[active] became active
+	now         time.Time // updated at each ledger close
+	timers      []*Timer  // sorted by time
+	http        horizon.HTTP
+
+	// clock measures real time, for failover and retries;
+	// nil means clock.Real. See SetClock.
+	clock clock.Clock
+
+	// initHorizon indicates whether the Client was initialized with
+	// horizon clients, in which case SetURL has no effect.
 	initHorizon bool
 
 	startClockOnce sync.Once
 }
 
-type timer struct {
+// A Timer calls a function at a given ledger time.
+// See AfterFunc.
+type Timer struct {
+	c *Client
 	t time.Time
 	f func()
 }
 
-func NewClient(rt http.RoundTripper, horizon horizonClient) *Client {
-	return &Client{
+// When returns the ledger time at which t fires.
+func (t *Timer) When() time.Time {
+	return t.t
+}
+
+// Stop prevents t from firing.
+// It returns true if the call stops t,
+// false if t already fired or was stopped.
+func (t *Timer) Stop() bool {
+	c := t.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, t2 := range c.timers {
+		if t2 == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// NewClient returns a Client using the given horizon clients,
+// in order of preference, with HTTP requests made by rt.
+// It is for tests;
+// if no horizon clients are given, call SetURL.
+func NewClient(rt http.RoundTripper, horizons ...horizonClient) *Client {
+	c := &Client{
 		http: &http.Client{
 			Transport: rt,
 		},
-		hclient:     horizon,
-		initHorizon: horizon != nil,
+		initHorizon: len(horizons) > 0,
+		changed:     make(chan struct{}),
+		activeSince: clock.Real.Now(),
 	}
+	for _, h := range horizons {
+		c.endpoints = append(c.endpoints, &endpoint{h: h})
+	}
+	return c
 }
 
-// SetURL sets the URL for c to url. It also starts the clock routine.
+// SetClock makes c measure real time with clk,
+// such as a clock.Manual in tests,
+// instead of the wall clock.
+// Ledger time still comes from Horizon.
+// SetClock must be called before any other method
+// except NewClient.
+func (c *Client) SetClock(clk clock.Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clk
+	c.activeSince = clk.Now()
+}
+
+// clk returns the clock c measures real time with.
+func (c *Client) clk() clock.Clock {
+	if c.clock == nil {
+		return clock.Real
+	}
+	return c.clock
+}
+
+// SetURL sets the URL for c to url,
+// which can be a comma-separated list of URLs
+// of Horizon servers on the same network,
+// in order of preference.
+// It also starts the clock routine.
+//
+// If the active server is still in the list,
+// it stays active.
 //
 // If a non-nil horizon client is provided in NewClient,
 // SetURL has no effect.
@@ -99,10 +176,25 @@ func (c *Client) SetURL(url string) {
 	if c.http == nil {
 		c.http = new(http.Client)
 	}
-	c.hclient = &horizon.Client{
-		URL:  strings.TrimRight(url, "/"),
-		HTTP: c.http,
+	var activeURL string
+	if len(c.endpoints) > 0 {
+		activeURL = c.endpoints[c.active].url
 	}
+	c.endpoints = nil
+	c.active = 0
+	for i, u := range SplitURLs(url) {
+		c.endpoints = append(c.endpoints, &endpoint{
+			url: u,
+			h: pathClient{&horizon.Client{
+				URL:  strings.TrimRight(u, "/"),
+				HTTP: c.http,
+			}},
+		})
+		if u == activeURL {
+			c.active = i
+		}
+	}
+	c.activeSince = c.clk().Now()
 	changed := c.changed
 	c.changed = make(chan struct{})
 
@@ -135,18 +227,60 @@ func (c *Client) ValidateURL(url string) error {
 	return err
 }
 
-// ValidateTestnetURL tests that the URL is a valid horizon URL
-// on the Stellar testnet by opening a test connection.
-func (c *Client) ValidateTestnetURL(url string) error {
+// Network describes the Stellar network
+// a Horizon server is connected to.
+type Network struct {
+	Passphrase string
+
+	// BaseReserve is the base reserve
+	// as of the latest ledger.
+	BaseReserve xlm.Amount
+
+	// FriendbotURL is the URL of the network's friendbot,
+	// without the addr query parameter,
+	// or "" if Horizon doesn't link to one.
+	FriendbotURL string
+}
+
+// LoadNetwork returns the network of the Horizon server at url.
+// WARNING: this software is not compatible with Stellar mainnet;
+// it is an error if the server is on the public network.
+func (c *Client) LoadNetwork(url string) (*Network, error) {
 	horizonClient := c.getHorizonClient(url)
 	root, err := horizonClient.Root()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if root.NetworkPassphrase == network.PublicNetworkPassphrase {
+		return nil, errMainnet
+	}
+	n := &Network{Passphrase: root.NetworkPassphrase}
+	if root.Links.Friendbot != nil {
+		n.FriendbotURL = strings.TrimSuffix(root.Links.Friendbot.Href, "{?addr}")
+	}
+
+	resp, err := horizonClient.HTTP.Get(strings.TrimSuffix(url, "/") + "/ledgers?order=desc&limit=1")
+	if err != nil {
+		return nil, errors.Wrap(err, "getting latest ledger")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("getting latest ledger: http status %d", resp.StatusCode)
 	}
-	if root.NetworkPassphrase != network.TestNetworkPassphrase {
-		return errMainnet
+	var page struct {
+		Embedded struct {
+			Records []Ledger
+		} `json:"_embedded"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding latest ledger")
 	}
-	return nil
+	if len(page.Embedded.Records) == 0 {
+		return nil, errors.New("no ledgers")
+	}
+	n.BaseReserve = xlm.Amount(page.Embedded.Records[0].BaseReserve)
+	return n, nil
 }
 
 // Now returns the time of the last seen ledger.
@@ -159,14 +293,19 @@ func (c *Client) Now() time.Time {
 
 // AfterFunc waits for a Stellar ledger at or after time t
 // to commit, and then calls f in its own goroutine.
-func (c *Client) AfterFunc(t time.Time, f func()) {
+// It returns a Timer that can be used to cancel the call.
+func (c *Client) AfterFunc(t time.Time, f func()) *Timer {
 	c.startClockOnce.Do(c.startClock)
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.timers = append(c.timers, &timer{t, f})
-	sort.Slice(c.timers, func(i, j int) bool {
-		return c.timers[i].t.Before(c.timers[j].t)
+	tm := &Timer{c: c, t: t, f: f}
+	i := sort.Search(len(c.timers), func(i int) bool {
+		return t.Before(c.timers[i].t)
 	})
+	c.timers = append(c.timers, nil)
+	copy(c.timers[i+1:], c.timers[i:])
+	c.timers[i] = tm
+	return tm
 }
 
 func (c *Client) startClock() {
@@ -175,9 +314,10 @@ func (c *Client) startClock() {
 	go func() {
 		ready := ready
 		ctx := context.Background()
-		err := c.streamLedgers(ctx, &now, func(l Ledger) {
+		err := c.streamLedgers(ctx, &now, func(ep *endpoint, l Ledger) {
 			c.mu.Lock()
 			defer c.mu.Unlock()
+			ep.lastLedger = c.clk().Now()
 			if l.ClosedAt.Before(c.now) {
 				return // don't let the timestamp go backward
 			}
@@ -200,6 +340,7 @@ func (c *Client) startClock() {
 			panic(err)
 		}
 	}()
+	go c.watchLedgers()
 	<-ready
 }
 
@@ -210,20 +351,15 @@ func (c *Client) startClock() {
 // If h returns a non-nil error,
 // StreamTxs returns it.
 // If the underlying call to StreamTransactions
-// returns an error, StreamTxs will retry.
+// returns an error, StreamTxs will retry,
+// failing over to another Horizon server
+// if the error persists.
 func (c *Client) StreamTxs(ctx context.Context, accountID string, cur Cursor, h func(Transaction) error) error {
-	c.mu.Lock()
-	hclient := c.hclient
-	c.mu.Unlock()
-
-	if hclient == nil {
-		return errUninitialized
-	}
-
-	return c.streamHorizon(ctx, &cur, func(ctx context.Context, cur *Cursor, backoff *net.Backoff) error {
+	return c.streamHorizon(ctx, &cur, func(ctx context.Context, ep *endpoint, cur *Cursor, backoff *net.Backoff) error {
 		ctx, cancel := context.WithCancel(ctx)
-		return hclient.StreamTransactions(ctx, accountID, cur, func(tx Transaction) {
+		return ep.h.StreamTransactions(ctx, accountID, cur, func(tx Transaction) {
 			backoff = &net.Backoff{Base: backoff.Base}
+			c.record(ep, nil)
 			handlerErr := h(tx)
 			if handlerErr != nil {
 				cancel()
@@ -233,52 +369,25 @@ func (c *Client) StreamTxs(ctx context.Context, accountID string, cur Cursor, h
 	})
 }
 
-func (c *Client) streamLedgers(ctx context.Context, cur *Cursor, h func(l Ledger)) error {
-	c.mu.Lock()
-	hclient := c.hclient
-	c.mu.Unlock()
-
-	if hclient == nil {
-		return errUninitialized
-	}
-
-	timer := time.NewTimer(time.Minute)
-
-	var timerMu sync.Mutex
-
-	go func() {
-		for {
-			select {
-			case <-timer.C:
-				log.Println("warning: no data returned from worizon streamLedgers in >1m")
-				timerMu.Lock()
-				if !timer.Stop() {
-					<-timer.C
-				}
-				timer.Reset(time.Minute)
-				timerMu.Unlock()
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
-
-	return c.streamHorizon(ctx, cur, func(ctx context.Context, cur *Cursor, backoff *net.Backoff) error {
-		return hclient.StreamLedgers(ctx, cur, func(l Ledger) {
-			timerMu.Lock()
-			if !timer.Stop() {
-				<-timer.C
-			}
-			timer.Reset(time.Minute)
-			timerMu.Unlock()
+func (c *Client) streamLedgers(ctx context.Context, cur *Cursor, h func(ep *endpoint, l Ledger)) error {
+	return c.streamHorizon(ctx, cur, func(ctx context.Context, ep *endpoint, cur *Cursor, backoff *net.Backoff) error {
+		return ep.h.StreamLedgers(ctx, cur, func(l Ledger) {
 			backoff = &net.Backoff{Base: backoff.Base}
-			h(l)
+			c.record(ep, nil)
+			h(ep, l)
 			*cur = Cursor(l.PT)
 		})
 	})
 }
 
-func (c *Client) streamHorizon(ctx context.Context, cur *Cursor, s func(context.Context, *Cursor, *net.Backoff) error) error {
+// streamHorizon calls s repeatedly with the active endpoint
+// until ctx is canceled.
+// When the active endpoint changes, s's context is canceled
+// and s is called again with the new one,
+// with cur where the previous call left off.
+// After maxStreamFailures consecutive errors
+// from the active endpoint, it fails over to another.
+func (c *Client) streamHorizon(ctx context.Context, cur *Cursor, s func(context.Context, *endpoint, *Cursor, *net.Backoff) error) error {
 	origCtx := ctx
 
 	// The base amount of time to wait between retries of the streaming callback s.
@@ -289,11 +398,8 @@ func (c *Client) streamHorizon(ctx context.Context, cur *Cursor, s func(context.
 	backoff := &net.Backoff{Base: baseBackoff}
 
 	for {
-		c.mu.Lock()
-		hclient := c.hclient
-		changed := c.changed
-		c.mu.Unlock()
-		if hclient == nil {
+		ep, changed := c.current()
+		if ep == nil {
 			return errUninitialized
 		}
 		ctx, cancel := context.WithCancel(ctx)
@@ -304,13 +410,25 @@ func (c *Client) streamHorizon(ctx context.Context, cur *Cursor, s func(context.
 			case <-ctx.Done():
 			}
 		}()
-		streamErr := s(ctx, cur, backoff)
+		streamErr := s(ctx, ep, cur, backoff)
+		switchedEndpoint := ctx.Err() != nil && origCtx.Err() == nil
+		cancel()
 
 		if origCtx.Err() == nil {
-			if ctx.Err() != nil || streamErr != nil {
+			if switchedEndpoint {
+				continue
+			}
+			if streamErr != nil {
+				c.record(ep, streamErr)
+				c.mu.Lock()
+				failures := ep.failures
+				c.mu.Unlock()
+				if failures >= maxStreamFailures {
+					c.failover(ep, streamErr)
+				}
 				dur := backoff.Next()
-				log.Printf("received error %s streaming from horizon, retrying in %s", streamErr, dur)
-				time.Sleep(dur)
+				log.Printf("received error %s streaming from horizon %s, retrying in %s", streamErr, ep.url, dur)
+				clock.Sleep(origCtx, c.clk(), dur) // if canceled, the next s returns
 				continue
 			}
 		}
@@ -324,35 +442,31 @@ func (c *Client) streamHorizon(ctx context.Context, cur *Cursor, s func(context.
 
 // SequenceForAccount implements SequenceProvider
 // from package github.com/stellar/go/build.
-func (c *Client) SequenceForAccount(accountID string) (xdr.SequenceNumber, error) {
-	c.mu.Lock()
-	hclient := c.hclient
-	c.mu.Unlock()
-	if hclient == nil {
-		return 0, errUninitialized
-	}
-	return hclient.SequenceForAccount(accountID)
+func (c *Client) SequenceForAccount(accountID string) (seqnum xdr.SequenceNumber, err error) {
+	err = c.do(func(h horizonClient) error {
+		seqnum, err = h.SequenceForAccount(accountID)
+		return err
+	})
+	return seqnum, err
 }
 
 // SubmitTx submits a transaction to the network.
+// If the active Horizon server fails,
+// the transaction is submitted to the others in turn.
 // The returned error can be (but is not necessarily)
 // an instance of horizon.Error.
 func (c *Client) SubmitTx(envXdr string) (response TxSuccess, err error) {
-	c.mu.Lock()
-	hclient := c.hclient
-	c.mu.Unlock()
-	if hclient == nil {
-		return TxSuccess{}, errUninitialized
-	}
-	return hclient.SubmitTransaction(envXdr)
+	err = c.do(func(h horizonClient) error {
+		response, err = h.SubmitTransaction(envXdr)
+		return err
+	})
+	return response, err
 }
 
-func (c *Client) LoadAccount(id string) (Account, error) {
-	c.mu.Lock()
-	hclient := c.hclient
-	c.mu.Unlock()
-	if hclient == nil {
-		return Account{}, errUninitialized
-	}
-	return hclient.LoadAccount(id)
+func (c *Client) LoadAccount(id string) (acct Account, err error) {
+	err = c.do(func(h horizonClient) error {
+		acct, err = h.LoadAccount(id)
+		return err
+	})
+	return acct, err
 }
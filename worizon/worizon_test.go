@@ -1,8 +1,14 @@
 package worizon
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/stellar/go/clients/horizon"
+
+	"github.com/interstellar/starlight/clock"
 	"github.com/interstellar/starlight/worizon/worizontest"
 )
 
@@ -13,3 +19,155 @@ func TestNow(t *testing.T) {
 		t.Error("got zero time")
 	}
 }
+
+// downHorizon is a horizon client whose server is unreachable.
+type downHorizon struct {
+	*worizontest.FakeHorizonClient
+}
+
+var errDown = errors.New("connection refused")
+
+func (downHorizon) Root() (horizon.Root, error) { return horizon.Root{}, errDown }
+
+func (downHorizon) SubmitTransaction(string) (horizon.TransactionSuccess, error) {
+	return horizon.TransactionSuccess{}, errDown
+}
+
+func (downHorizon) StreamTransactions(context.Context, string, *horizon.Cursor, horizon.TransactionHandler) error {
+	return errDown
+}
+
+// cursorHorizon records the cursor its stream is started at.
+type cursorHorizon struct {
+	*worizontest.FakeHorizonClient
+	cursors chan horizon.Cursor
+}
+
+func (h cursorHorizon) StreamTransactions(ctx context.Context, acct string, cur *horizon.Cursor, f horizon.TransactionHandler) error {
+	h.cursors <- *cur
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestFailoverSubmit(t *testing.T) {
+	good := &worizontest.FakeHorizonClient{}
+	c := NewClient(nil, downHorizon{new(worizontest.FakeHorizonClient)}, good)
+	_, err := c.SubmitTx("tx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(good.TransactionEnvelopes()); n != 1 {
+		t.Errorf("got %d txs submitted to the second endpoint, want 1", n)
+	}
+	eps := c.Endpoints()
+	if eps[0].Active || !eps[1].Active {
+		t.Errorf("got endpoints %+v, want the second active", eps)
+	}
+	if eps[0].Failures != 1 || eps[0].LastError != errDown.Error() {
+		t.Errorf("got first endpoint %+v, want 1 failure", eps[0])
+	}
+
+	// A rejected request is not the server's fault.
+	good.NotFound = map[string]bool{"G": true}
+	if _, err := c.LoadAccount("G"); err == nil {
+		t.Error("got no error loading missing account")
+	}
+	if eps := c.Endpoints(); !eps[1].Active || eps[1].Failures != 0 {
+		t.Errorf("got endpoints %+v, want the second active and healthy", eps)
+	}
+}
+
+func TestFailoverStream(t *testing.T) {
+	cursors := make(chan horizon.Cursor, 1)
+	c := NewClient(nil,
+		downHorizon{new(worizontest.FakeHorizonClient)},
+		cursorHorizon{new(worizontest.FakeHorizonClient), cursors},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.StreamTxs(ctx, "G", "12345", func(Transaction) error { return nil })
+
+	select {
+	case cur := <-cursors:
+		if cur != "12345" {
+			t.Errorf("got cursor %s after failover, want 12345", cur)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for failover")
+	}
+	if eps := c.Endpoints(); !eps[1].Active || eps[0].Failures < maxStreamFailures {
+		t.Errorf("got endpoints %+v, want the second active", eps)
+	}
+}
+
+// tickingHorizon is a horizon client that closes a ledger
+// every few milliseconds.
+type tickingHorizon struct {
+	*worizontest.FakeHorizonClient
+}
+
+func (tickingHorizon) StreamLedgers(ctx context.Context, cur *horizon.Cursor, f horizon.LedgerHandler) error {
+	for ctx.Err() == nil {
+		f(horizon.Ledger{ClosedAt: time.Now()})
+		time.Sleep(10 * time.Millisecond)
+	}
+	return ctx.Err()
+}
+
+func TestAfterFuncStop(t *testing.T) {
+	wor := NewClient(nil, tickingHorizon{&worizontest.FakeHorizonClient{}})
+
+	later := wor.AfterFunc(wor.Now().Add(time.Hour), func() {
+		t.Error("stopped timer fired")
+	})
+	fired := make(chan struct{})
+	soon := wor.AfterFunc(wor.Now(), func() { close(fired) })
+	if !later.Stop() {
+		t.Error("got false stopping a pending timer, want true")
+	}
+	if later.Stop() {
+		t.Error("got true stopping a stopped timer, want false")
+	}
+
+	select {
+	case <-fired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timer did not fire")
+	}
+	if soon.Stop() {
+		t.Error("got true stopping a fired timer, want false")
+	}
+}
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewManual(start)
+	wor := NewClient(nil, &worizontest.FakeHorizonClient{Clock: clk})
+	wor.SetClock(clk)
+	if got := wor.Now(); !got.Equal(start) {
+		t.Fatalf("got time %s, want %s", got, start)
+	}
+
+	fired := make(chan struct{})
+	wor.AfterFunc(start.Add(time.Hour), func() { close(fired) })
+
+	// Move time a minute at a time,
+	// giving the ledger stream a chance to wait for the clock.
+	for i := 0; ; i++ {
+		if i > 1000 {
+			t.Fatal("timer did not fire")
+		}
+		select {
+		case <-fired:
+		case <-time.After(5 * time.Millisecond):
+			clk.Advance(time.Minute)
+			continue
+		}
+		break
+	}
+	if now := wor.Now(); now.Before(start.Add(time.Hour)) {
+		t.Errorf("timer fired at %s, before %s", now, start.Add(time.Hour))
+	}
+}
+
+var _ horizonClient = (*worizontest.Simulator)(nil)
@@ -0,0 +1,518 @@
+package worizontest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+// Signature thresholds, indexes into account.thresholds.
+const (
+	low = iota
+	medium
+	high
+)
+
+// maxSigners is the most signers an account may have
+// besides its master key.
+const maxSigners = 20
+
+// apply applies the transaction in env, whose hash is hash,
+// to the ledger that closes next.
+// It reports whether the transaction is included in that ledger,
+// which it is if it got as far as applying its operations,
+// even if they failed.
+// Must be called with s.mu held.
+func (s *Simulator) apply(env *xdr.TransactionEnvelope, hash [32]byte) (xdr.TransactionResult, bool) {
+	tx := &env.Tx
+	fee := xlm.Amount(tx.Fee)
+	fail := func(code xdr.TransactionResultCode) (xdr.TransactionResult, bool) {
+		return xdr.TransactionResult{
+			FeeCharged: xdr.Int64(fee),
+			Result:     xdr.TransactionResultResult{Code: code},
+		}, false
+	}
+
+	src := s.accounts[tx.SourceAccount.Address()]
+	if src == nil {
+		return fail(xdr.TransactionResultCodeTxNoAccount)
+	}
+	if len(tx.Operations) == 0 {
+		return fail(xdr.TransactionResultCodeTxMissingOperation)
+	}
+	if tb := tx.TimeBounds; tb != nil {
+		now := uint64(s.now.Unix())
+		if uint64(tb.MinTime) > now {
+			return fail(xdr.TransactionResultCodeTxTooEarly)
+		}
+		if tb.MaxTime != 0 && uint64(tb.MaxTime) < now {
+			return fail(xdr.TransactionResultCodeTxTooLate)
+		}
+	}
+	if fee < s.baseFee*xlm.Amount(len(tx.Operations)) {
+		return fail(xdr.TransactionResultCodeTxInsufficientFee)
+	}
+	if tx.SeqNum != src.seq+1 {
+		return fail(xdr.TransactionResultCodeTxBadSeq)
+	}
+	if !s.authorized(src, low, hash, env.Signatures) {
+		return fail(xdr.TransactionResultCodeTxBadAuth)
+	}
+	if src.balance-src.minBalance(s.baseReserve, 0) < fee {
+		return fail(xdr.TransactionResultCodeTxInsufficientBalance)
+	}
+
+	// From here on, the transaction is in the ledger.
+	src.balance -= fee
+	src.seq = tx.SeqNum
+
+	// Signatures are checked against the state before any operation,
+	// as in stellar-core.
+	results := make([]xdr.OperationResult, len(tx.Operations))
+	ok := true
+	for i, op := range tx.Operations {
+		opSrc := src
+		if op.SourceAccount != nil {
+			opSrc = s.accounts[op.SourceAccount.Address()]
+		}
+		switch {
+		case opSrc == nil:
+			results[i] = xdr.OperationResult{Code: xdr.OperationResultCodeOpNoAccount}
+			ok = false
+		case !s.authorized(opSrc, opThreshold(&op), hash, env.Signatures):
+			results[i] = xdr.OperationResult{Code: xdr.OperationResultCodeOpBadAuth}
+			ok = false
+		}
+	}
+
+	if ok {
+		st := &applyState{
+			sim:      s,
+			accounts: make(map[string]*account),
+			ledger:   s.nextLedger(),
+		}
+		for i, op := range tx.Operations {
+			opSrc := tx.SourceAccount.Address()
+			if op.SourceAccount != nil {
+				opSrc = op.SourceAccount.Address()
+			}
+			results[i] = st.applyOp(opSrc, &op.Body)
+			if results[i].Code != xdr.OperationResultCodeOpInner || !opSucceeded(results[i].Tr) {
+				ok = false
+			}
+		}
+		if ok {
+			st.commit()
+		}
+	}
+
+	code := xdr.TransactionResultCodeTxSuccess
+	if !ok {
+		code = xdr.TransactionResultCodeTxFailed
+	}
+	return xdr.TransactionResult{
+		FeeCharged: xdr.Int64(fee),
+		Result: xdr.TransactionResultResult{
+			Code:    code,
+			Results: &results,
+		},
+	}, true
+}
+
+// opThreshold returns the signature threshold
+// needed by op's source account.
+func opThreshold(op *xdr.Operation) int {
+	switch op.Body.Type {
+	case xdr.OperationTypeAccountMerge:
+		return high
+	case xdr.OperationTypeBumpSequence, xdr.OperationTypeAllowTrust:
+		return low
+	case xdr.OperationTypeSetOptions:
+		o := op.Body.SetOptionsOp
+		if o.MasterWeight != nil || o.LowThreshold != nil || o.MedThreshold != nil ||
+			o.HighThreshold != nil || o.Signer != nil {
+			return high
+		}
+	}
+	return medium
+}
+
+// authorized reports whether sigs, over hash,
+// carry enough weight to meet a's given threshold.
+// At least one signature with nonzero weight is always needed.
+func (s *Simulator) authorized(a *account, threshold int, hash [32]byte, sigs []xdr.DecoratedSignature) bool {
+	needed := int(a.thresholds[threshold])
+	if needed == 0 {
+		needed = 1
+	}
+	weights := map[string]byte{a.id: a.masterWeight}
+	for k, w := range a.signers {
+		weights[k] = w
+	}
+	total := 0
+	for signer, w := range weights {
+		if w == 0 {
+			continue
+		}
+		kp, err := keypair.Parse(signer)
+		if err != nil {
+			continue
+		}
+		hint := kp.Hint()
+		for _, sig := range sigs {
+			if sig.Hint == xdr.SignatureHint(hint) && kp.Verify(hash[:], sig.Signature) == nil {
+				total += int(w)
+				break
+			}
+		}
+	}
+	return total >= needed
+}
+
+func opSucceeded(tr *xdr.OperationResultTr) bool {
+	switch tr.Type {
+	case xdr.OperationTypeCreateAccount:
+		return tr.CreateAccountResult.Code == xdr.CreateAccountResultCodeCreateAccountSuccess
+	case xdr.OperationTypePayment:
+		return tr.PaymentResult.Code == xdr.PaymentResultCodePaymentSuccess
+	case xdr.OperationTypePathPayment:
+		return tr.PathPaymentResult.Code == xdr.PathPaymentResultCodePathPaymentSuccess
+	case xdr.OperationTypeSetOptions:
+		return tr.SetOptionsResult.Code == xdr.SetOptionsResultCodeSetOptionsSuccess
+	case xdr.OperationTypeChangeTrust:
+		return tr.ChangeTrustResult.Code == xdr.ChangeTrustResultCodeChangeTrustSuccess
+	case xdr.OperationTypeAccountMerge:
+		return tr.AccountMergeResult.Code == xdr.AccountMergeResultCodeAccountMergeSuccess
+	case xdr.OperationTypeBumpSequence:
+		return tr.BumpSeqResult.Code == xdr.BumpSequenceResultCodeBumpSequenceSuccess
+	}
+	return false
+}
+
+// applyState holds the accounts changed
+// by the operations of one transaction,
+// so they can be discarded if any operation fails.
+type applyState struct {
+	sim      *Simulator
+	accounts map[string]*account // nil means deleted
+	ledger   int32
+}
+
+// get returns the account with the given ID, or nil.
+func (st *applyState) get(id string) *account {
+	if a, ok := st.accounts[id]; ok {
+		return a
+	}
+	a := st.sim.accounts[id]
+	if a != nil {
+		a = a.clone()
+		st.accounts[id] = a
+	}
+	return a
+}
+
+func (st *applyState) commit() {
+	for id, a := range st.accounts {
+		if a == nil {
+			delete(st.sim.accounts, id)
+		} else {
+			st.sim.accounts[id] = a
+		}
+	}
+}
+
+func (st *applyState) applyOp(srcID string, body *xdr.OperationBody) xdr.OperationResult {
+	src := st.get(srcID)
+	if src == nil {
+		return xdr.OperationResult{Code: xdr.OperationResultCodeOpNoAccount}
+	}
+	tr := xdr.OperationResultTr{Type: body.Type}
+	switch body.Type {
+	case xdr.OperationTypeCreateAccount:
+		tr.CreateAccountResult = &xdr.CreateAccountResult{Code: st.createAccount(src, body.CreateAccountOp)}
+	case xdr.OperationTypePayment:
+		tr.PaymentResult = &xdr.PaymentResult{Code: st.payment(src, body.PaymentOp)}
+	case xdr.OperationTypePathPayment:
+		tr.PathPaymentResult = st.pathPayment(src, body.PathPaymentOp)
+	case xdr.OperationTypeSetOptions:
+		tr.SetOptionsResult = &xdr.SetOptionsResult{Code: st.setOptions(src, body.SetOptionsOp)}
+	case xdr.OperationTypeChangeTrust:
+		tr.ChangeTrustResult = &xdr.ChangeTrustResult{Code: st.changeTrust(src, body.ChangeTrustOp)}
+	case xdr.OperationTypeAccountMerge:
+		tr.AccountMergeResult = st.accountMerge(src, body.Destination.Address())
+	case xdr.OperationTypeBumpSequence:
+		tr.BumpSeqResult = &xdr.BumpSequenceResult{Code: st.bumpSequence(src, body.BumpSequenceOp)}
+	default:
+		return xdr.OperationResult{Code: xdr.OperationResultCodeOpNotSupported}
+	}
+	return xdr.OperationResult{Code: xdr.OperationResultCodeOpInner, Tr: &tr}
+}
+
+func (st *applyState) createAccount(src *account, op *xdr.CreateAccountOp) xdr.CreateAccountResultCode {
+	amt := xlm.Amount(op.StartingBalance)
+	dest := op.Destination.Address()
+	switch {
+	case amt <= 0 || dest == src.id:
+		return xdr.CreateAccountResultCodeCreateAccountMalformed
+	case st.get(dest) != nil:
+		return xdr.CreateAccountResultCodeCreateAccountAlreadyExist
+	case amt < 2*st.sim.baseReserve:
+		return xdr.CreateAccountResultCodeCreateAccountLowReserve
+	case src.balance-src.minBalance(st.sim.baseReserve, 0) < amt:
+		return xdr.CreateAccountResultCodeCreateAccountUnderfunded
+	}
+	src.balance -= amt
+	st.accounts[dest] = newAccount(dest, amt, xdr.SequenceNumber(st.ledger)<<32)
+	return xdr.CreateAccountResultCodeCreateAccountSuccess
+}
+
+// Outcomes of transfer, mapped to each payment op's result codes.
+const (
+	transferOK = iota
+	transferMalformed
+	transferNoDestination
+	transferNoIssuer
+	transferSrcNoTrust
+	transferNoTrust
+	transferUnderfunded
+	transferLineFull
+)
+
+// transfer moves amt of asset from src to the account destID.
+func (st *applyState) transfer(src *account, destID string, asset xdr.Asset, amt xdr.Int64) int {
+	if amt <= 0 {
+		return transferMalformed
+	}
+	dest := st.get(destID)
+	if dest == nil {
+		return transferNoDestination
+	}
+	if asset.Type == xdr.AssetTypeAssetTypeNative {
+		if src.balance-src.minBalance(st.sim.baseReserve, 0) < xlm.Amount(amt) {
+			return transferUnderfunded
+		}
+		src.balance -= xlm.Amount(amt)
+		dest.balance += xlm.Amount(amt)
+		return transferOK
+	}
+
+	var typ, code, issuer string
+	asset.MustExtract(&typ, &code, &issuer)
+	if st.get(issuer) == nil {
+		return transferNoIssuer
+	}
+	key := asset.String()
+	// Issuers send and receive their own assets without trustlines.
+	srcLine, destLine := src.lines[key], dest.lines[key]
+	if src.id != issuer {
+		if srcLine == nil {
+			return transferSrcNoTrust
+		}
+		if srcLine.balance < amt {
+			return transferUnderfunded
+		}
+	}
+	if dest.id != issuer {
+		if destLine == nil {
+			return transferNoTrust
+		}
+		if destLine.balance+amt > destLine.limit {
+			return transferLineFull
+		}
+	}
+	if srcLine != nil && src.id != issuer {
+		srcLine.balance -= amt
+	}
+	if destLine != nil && dest.id != issuer {
+		destLine.balance += amt
+	}
+	return transferOK
+}
+
+func (st *applyState) payment(src *account, op *xdr.PaymentOp) xdr.PaymentResultCode {
+	switch st.transfer(src, op.Destination.Address(), op.Asset, op.Amount) {
+	case transferMalformed:
+		return xdr.PaymentResultCodePaymentMalformed
+	case transferNoDestination:
+		return xdr.PaymentResultCodePaymentNoDestination
+	case transferNoIssuer:
+		return xdr.PaymentResultCodePaymentNoIssuer
+	case transferSrcNoTrust:
+		return xdr.PaymentResultCodePaymentSrcNoTrust
+	case transferNoTrust:
+		return xdr.PaymentResultCodePaymentNoTrust
+	case transferUnderfunded:
+		return xdr.PaymentResultCodePaymentUnderfunded
+	case transferLineFull:
+		return xdr.PaymentResultCodePaymentLineFull
+	}
+	return xdr.PaymentResultCodePaymentSuccess
+}
+
+func (st *applyState) pathPayment(src *account, op *xdr.PathPaymentOp) *xdr.PathPaymentResult {
+	res := new(xdr.PathPaymentResult)
+	switch {
+	case op.DestAmount <= 0 || op.SendMax <= 0:
+		res.Code = xdr.PathPaymentResultCodePathPaymentMalformed
+		return res
+	case !op.SendAsset.Equals(op.DestAsset):
+		// No order book, so no conversion.
+		res.Code = xdr.PathPaymentResultCodePathPaymentTooFewOffers
+		return res
+	case op.DestAmount > op.SendMax:
+		res.Code = xdr.PathPaymentResultCodePathPaymentOverSendmax
+		return res
+	}
+	switch st.transfer(src, op.Destination.Address(), op.DestAsset, op.DestAmount) {
+	case transferNoDestination:
+		res.Code = xdr.PathPaymentResultCodePathPaymentNoDestination
+	case transferNoIssuer:
+		res.Code = xdr.PathPaymentResultCodePathPaymentNoIssuer
+		res.NoIssuer = &op.DestAsset
+	case transferSrcNoTrust:
+		res.Code = xdr.PathPaymentResultCodePathPaymentSrcNoTrust
+	case transferNoTrust:
+		res.Code = xdr.PathPaymentResultCodePathPaymentNoTrust
+	case transferUnderfunded:
+		res.Code = xdr.PathPaymentResultCodePathPaymentUnderfunded
+	case transferLineFull:
+		res.Code = xdr.PathPaymentResultCodePathPaymentLineFull
+	default:
+		res.Code = xdr.PathPaymentResultCodePathPaymentSuccess
+		res.Success = &xdr.PathPaymentResultSuccess{
+			Last: xdr.SimplePaymentResult{
+				Destination: op.Destination,
+				Asset:       op.DestAsset,
+				Amount:      op.DestAmount,
+			},
+		}
+	}
+	return res
+}
+
+func (st *applyState) setOptions(src *account, op *xdr.SetOptionsOp) xdr.SetOptionsResultCode {
+	for _, t := range []*xdr.Uint32{op.MasterWeight, op.LowThreshold, op.MedThreshold, op.HighThreshold} {
+		if t != nil && *t > 255 {
+			return xdr.SetOptionsResultCodeSetOptionsThresholdOutOfRange
+		}
+	}
+	if op.InflationDest != nil {
+		if st.get(op.InflationDest.Address()) == nil {
+			return xdr.SetOptionsResultCodeSetOptionsInvalidInflation
+		}
+		src.inflationDest = op.InflationDest.Address()
+	}
+	if op.SetFlags != nil {
+		src.flags |= uint32(*op.SetFlags)
+	}
+	if op.ClearFlags != nil {
+		src.flags &^= uint32(*op.ClearFlags)
+	}
+	if op.MasterWeight != nil {
+		src.masterWeight = byte(*op.MasterWeight)
+	}
+	if op.LowThreshold != nil {
+		src.thresholds[low] = byte(*op.LowThreshold)
+	}
+	if op.MedThreshold != nil {
+		src.thresholds[medium] = byte(*op.MedThreshold)
+	}
+	if op.HighThreshold != nil {
+		src.thresholds[high] = byte(*op.HighThreshold)
+	}
+	if op.HomeDomain != nil {
+		src.homeDomain = string(*op.HomeDomain)
+	}
+	if sg := op.Signer; sg != nil {
+		if sg.Key.Type != xdr.SignerKeyTypeSignerKeyTypeEd25519 || sg.Weight > 255 {
+			return xdr.SetOptionsResultCodeSetOptionsBadSigner
+		}
+		key := sg.Key.Address()
+		if key == src.id {
+			return xdr.SetOptionsResultCodeSetOptionsBadSigner
+		}
+		_, exists := src.signers[key]
+		switch {
+		case sg.Weight == 0:
+			delete(src.signers, key)
+		case exists:
+			src.signers[key] = byte(sg.Weight)
+		case len(src.signers) >= maxSigners:
+			return xdr.SetOptionsResultCodeSetOptionsTooManySigners
+		case src.balance < src.minBalance(st.sim.baseReserve, 1):
+			return xdr.SetOptionsResultCodeSetOptionsLowReserve
+		default:
+			src.signers[key] = byte(sg.Weight)
+		}
+	}
+	return xdr.SetOptionsResultCodeSetOptionsSuccess
+}
+
+func (st *applyState) changeTrust(src *account, op *xdr.ChangeTrustOp) xdr.ChangeTrustResultCode {
+	if op.Line.Type == xdr.AssetTypeAssetTypeNative || op.Limit < 0 {
+		return xdr.ChangeTrustResultCodeChangeTrustMalformed
+	}
+	var typ, code, issuer string
+	op.Line.MustExtract(&typ, &code, &issuer)
+	if issuer == src.id {
+		return xdr.ChangeTrustResultCodeChangeTrustSelfNotAllowed
+	}
+	key := op.Line.String()
+	line := src.lines[key]
+	switch {
+	case line != nil && op.Limit < line.balance:
+		return xdr.ChangeTrustResultCodeChangeTrustInvalidLimit
+	case line != nil && op.Limit == 0:
+		delete(src.lines, key)
+	case line != nil:
+		line.limit = op.Limit
+	case op.Limit == 0:
+		return xdr.ChangeTrustResultCodeChangeTrustInvalidLimit
+	case st.get(issuer) == nil:
+		return xdr.ChangeTrustResultCodeChangeTrustNoIssuer
+	case src.balance < src.minBalance(st.sim.baseReserve, 1):
+		return xdr.ChangeTrustResultCodeChangeTrustLowReserve
+	default:
+		src.lines[key] = &trustline{asset: op.Line, limit: op.Limit}
+	}
+	return xdr.ChangeTrustResultCodeChangeTrustSuccess
+}
+
+func (st *applyState) accountMerge(src *account, destID string) *xdr.AccountMergeResult {
+	res := new(xdr.AccountMergeResult)
+	dest := st.get(destID)
+	switch {
+	case destID == src.id:
+		res.Code = xdr.AccountMergeResultCodeAccountMergeMalformed
+	case dest == nil:
+		res.Code = xdr.AccountMergeResultCodeAccountMergeNoAccount
+	case len(src.lines) > 0:
+		res.Code = xdr.AccountMergeResultCodeAccountMergeHasSubEntries
+	default:
+		bal := xdr.Int64(src.balance)
+		dest.balance += src.balance
+		st.accounts[src.id] = nil
+		res.Code = xdr.AccountMergeResultCodeAccountMergeSuccess
+		res.SourceAccountBalance = &bal
+	}
+	return res
+}
+
+func (st *applyState) bumpSequence(src *account, op *xdr.BumpSequenceOp) xdr.BumpSequenceResultCode {
+	if op.BumpTo < 0 {
+		return xdr.BumpSequenceResultCodeBumpSequenceBadSeq
+	}
+	if op.BumpTo > src.seq {
+		src.seq = op.BumpTo
+	}
+	return xdr.BumpSequenceResultCodeBumpSequenceSuccess
+}
+
+func sha256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
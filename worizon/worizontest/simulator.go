@@ -0,0 +1,603 @@
+package worizontest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/clients/horizon"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/protocols/horizon/base"
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+// Network parameters used by NewSimulator.
+const (
+	DefaultBaseReserve = 500 * xlm.Millilumen
+	DefaultBaseFee     = 100 * xlm.Stroop
+)
+
+// rootBalance is the native balance of a Simulator's root account
+// in its genesis ledger.
+const rootBalance = 100000000000 * xlm.Lumen
+
+// A Simulator is an in-memory Stellar ledger.
+// It implements the Horizon client methods used by worizon.Client,
+// so agents can run whole channel lifecycles without a network.
+//
+// Each submitted transaction that gets into the ledger
+// closes a new ledger of its own, at the simulator's current time.
+// Time moves only when Advance is called.
+//
+// Transactions are checked for sequence numbers, time bounds,
+// fees, and signatures against the thresholds of the source accounts,
+// and may contain create-account, payment, path payment
+// (without conversion, since there is no order book),
+// set-options (with ed25519 signers only), account-merge,
+// bump-sequence and change-trust operations.
+// Other operations fail with op_not_supported.
+//
+// It is okay to call methods on Simulator concurrently.
+type Simulator struct {
+	passphrase  string
+	baseReserve xlm.Amount
+	baseFee     xlm.Amount
+	master      *keypair.Full
+
+	mu       sync.Mutex
+	changed  chan struct{} // closed when a ledger closes
+	now      time.Time
+	accounts map[string]*account
+	ledgers  []horizon.Ledger // ledgers[i].Sequence == i+1
+	txs      []*txRecord
+}
+
+type txRecord struct {
+	htx          horizon.Transaction
+	participants map[string]bool
+}
+
+// NewSimulator returns a Simulator for the network
+// with the given passphrase, with time starting at start.
+// Its genesis ledger holds only the root account,
+// which has all the lumens and is controlled by Master.
+func NewSimulator(passphrase string, start time.Time) *Simulator {
+	s := &Simulator{
+		passphrase:  passphrase,
+		baseReserve: DefaultBaseReserve,
+		baseFee:     DefaultBaseFee,
+		master:      keypair.Master(passphrase).(*keypair.Full),
+		changed:     make(chan struct{}),
+		now:         start.Truncate(time.Second),
+		accounts:    make(map[string]*account),
+	}
+	s.accounts[s.master.Address()] = newAccount(s.master.Address(), rootBalance, 0)
+	s.closeLedger(0)
+	return s
+}
+
+// Passphrase returns the passphrase of s's network.
+func (s *Simulator) Passphrase() string {
+	return s.passphrase
+}
+
+// BaseReserve returns the base reserve of s's network.
+func (s *Simulator) BaseReserve() xlm.Amount {
+	return s.baseReserve
+}
+
+// Master returns the keypair controlling s's root account.
+func (s *Simulator) Master() *keypair.Full {
+	return s.master
+}
+
+// Now returns the close time of the latest ledger.
+func (s *Simulator) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now
+}
+
+// Advance moves s's time forward by d
+// and closes an empty ledger at the new time.
+func (s *Simulator) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d).Truncate(time.Second)
+	s.closeLedger(0)
+}
+
+// Fund pays amount lumens from the root account to addr,
+// creating the account if necessary.
+func (s *Simulator) Fund(addr string, amt xlm.Amount) error {
+	s.mu.Lock()
+	_, exists := s.accounts[addr]
+	seq := s.accounts[s.master.Address()].seq
+	s.mu.Unlock()
+
+	var dest xdr.AccountId
+	err := dest.SetAddress(addr)
+	if err != nil {
+		return err
+	}
+	op := xdr.Operation{Body: xdr.OperationBody{
+		Type: xdr.OperationTypeCreateAccount,
+		CreateAccountOp: &xdr.CreateAccountOp{
+			Destination:     dest,
+			StartingBalance: xdr.Int64(amt),
+		},
+	}}
+	if exists {
+		op.Body = xdr.OperationBody{
+			Type: xdr.OperationTypePayment,
+			PaymentOp: &xdr.PaymentOp{
+				Destination: dest,
+				Asset:       xdr.Asset{Type: xdr.AssetTypeAssetTypeNative},
+				Amount:      xdr.Int64(amt),
+			},
+		}
+	}
+	var src xdr.AccountId
+	err = src.SetAddress(s.master.Address())
+	if err != nil {
+		return err
+	}
+	env := xdr.TransactionEnvelope{Tx: xdr.Transaction{
+		SourceAccount: src,
+		Fee:           xdr.Uint32(s.baseFee),
+		SeqNum:        seq + 1,
+		Operations:    []xdr.Operation{op},
+	}}
+	hash, err := network.HashTransaction(&env.Tx, s.passphrase)
+	if err != nil {
+		return err
+	}
+	sig, err := s.master.SignDecorated(hash[:])
+	if err != nil {
+		return err
+	}
+	env.Signatures = append(env.Signatures, sig)
+	envStr, err := xdr.MarshalBase64(env)
+	if err != nil {
+		return err
+	}
+	_, err = s.SubmitTransaction(envStr)
+	return err
+}
+
+// closeLedger appends a ledger with ntx transactions
+// closed at s.now and wakes up streams.
+// Must be called with s.mu held.
+func (s *Simulator) closeLedger(ntx int) {
+	seq := int32(len(s.ledgers) + 1)
+	hash := sha256Hex(strconv.Itoa(int(seq)) + s.passphrase)
+	l := horizon.Ledger{
+		ID:               hash,
+		PT:               strconv.FormatInt(int64(seq)<<32, 10),
+		Hash:             hash,
+		Sequence:         seq,
+		TransactionCount: int32(ntx),
+		ClosedAt:         s.now,
+		BaseFee:          int32(s.baseFee),
+		BaseReserve:      int32(s.baseReserve),
+	}
+	if seq > 1 {
+		l.PrevHash = s.ledgers[seq-2].Hash
+	}
+	s.ledgers = append(s.ledgers, l)
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// nextLedger returns the sequence number
+// of the ledger that closes next.
+// Must be called with s.mu held.
+func (s *Simulator) nextLedger() int32 {
+	return int32(len(s.ledgers) + 1)
+}
+
+func (s *Simulator) Root() (horizon.Root, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var r horizon.Root
+	r.NetworkPassphrase = s.passphrase
+	r.HorizonSequence = int32(len(s.ledgers))
+	r.CoreSequence = int32(len(s.ledgers))
+	return r, nil
+}
+
+// ServeHTTP serves the parts of the Horizon HTTP API
+// that agents read before they have a client for a server:
+// the root resource, and the latest ledger
+// from /ledgers?order=desc&limit=1.
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var v interface{}
+	switch req.URL.Path {
+	case "", "/":
+		v, _ = s.Root()
+	case "/ledgers":
+		if req.FormValue("order") != "desc" || req.FormValue("limit") != "1" {
+			http.Error(w, "only order=desc&limit=1 is supported", http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		latest := s.ledgers[len(s.ledgers)-1]
+		s.mu.Unlock()
+		var page struct {
+			Embedded struct {
+				Records []horizon.Ledger `json:"records"`
+			} `json:"_embedded"`
+		}
+		page.Embedded.Records = []horizon.Ledger{latest}
+		v = page
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", "application/hal+json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Simulator) LoadAccount(accountID string) (horizon.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.accounts[accountID]
+	if !ok {
+		return horizon.Account{}, notFound()
+	}
+	return a.horizon(), nil
+}
+
+func (s *Simulator) SequenceForAccount(accountID string) (xdr.SequenceNumber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.accounts[accountID]
+	if !ok {
+		return 0, notFound()
+	}
+	return a.seq, nil
+}
+
+// LoadPaths returns no paths.
+// The simulator has no order book.
+func (s *Simulator) LoadPaths(v url.Values) ([]hProtocol.Path, error) {
+	return nil, nil
+}
+
+// StreamLedgers calls handler with each ledger after cursor
+// until ctx is canceled.
+// Unlike Horizon, for cursor "now" it begins with the latest ledger,
+// so that clients don't wait for time to be advanced
+// to learn the current ledger time.
+func (s *Simulator) StreamLedgers(ctx context.Context, cursor *horizon.Cursor, handler horizon.LedgerHandler) error {
+	s.mu.Lock()
+	next := 0
+	if cursor != nil && *cursor == "now" {
+		next = len(s.ledgers) - 1
+	} else if cursor != nil && *cursor != "" {
+		pt, err := strconv.ParseInt(string(*cursor), 10, 64)
+		if err != nil {
+			s.mu.Unlock()
+			return errors.Wrap(err, "parsing cursor")
+		}
+		next = int(pt >> 32) // ledger pt>>32 is at index pt>>32 - 1
+	}
+	s.mu.Unlock()
+
+	for {
+		s.mu.Lock()
+		ledgers := s.ledgers[next:]
+		next = len(s.ledgers)
+		changed := s.changed
+		s.mu.Unlock()
+
+		for _, l := range ledgers {
+			handler(l)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
+
+// StreamTransactions calls handler with each transaction
+// after cursor that affects accountID,
+// including failed transactions,
+// until ctx is canceled.
+func (s *Simulator) StreamTransactions(ctx context.Context, accountID string, cursor *horizon.Cursor, handler horizon.TransactionHandler) error {
+	s.mu.Lock()
+	next := 0
+	if cursor != nil && *cursor == "now" {
+		next = len(s.txs)
+	} else if cursor != nil && *cursor != "" {
+		pt, err := strconv.ParseInt(string(*cursor), 10, 64)
+		if err != nil {
+			s.mu.Unlock()
+			return errors.Wrap(err, "parsing cursor")
+		}
+		next = sort.Search(len(s.txs), func(i int) bool {
+			return mustParsePT(s.txs[i].htx.PT) > pt
+		})
+	}
+	s.mu.Unlock()
+
+	for {
+		s.mu.Lock()
+		txs := s.txs[next:]
+		next = len(s.txs)
+		changed := s.changed
+		s.mu.Unlock()
+
+		for _, tx := range txs {
+			if tx.participants[accountID] {
+				handler(tx.htx)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
+
+// SubmitTransaction applies the transaction in txeBase64
+// in a new ledger.
+// As with Horizon, a transaction that fails
+// produces a *horizon.Error with the result XDR in its extras;
+// if it failed only in its operations,
+// it is still included in the ledger
+// and its fee is charged.
+func (s *Simulator) SubmitTransaction(txeBase64 string) (horizon.TransactionSuccess, error) {
+	var env xdr.TransactionEnvelope
+	err := xdr.SafeUnmarshalBase64(txeBase64, &env)
+	if err != nil {
+		return horizon.TransactionSuccess{}, badRequest("transaction_malformed", "Transaction Malformed", nil)
+	}
+	hash, err := network.HashTransaction(&env.Tx, s.passphrase)
+	if err != nil {
+		return horizon.TransactionSuccess{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, included := s.apply(&env, hash)
+	resultStr, err := xdr.MarshalBase64(result)
+	if err != nil {
+		return horizon.TransactionSuccess{}, err
+	}
+	extras := map[string]string{
+		"envelope_xdr": txeBase64,
+		"result_xdr":   resultStr,
+	}
+	if !included {
+		return horizon.TransactionSuccess{}, badRequest("transaction_failed", "Transaction Failed", extras)
+	}
+
+	ledger := s.nextLedger()
+	htx := horizon.Transaction{
+		ID:              hex.EncodeToString(hash[:]),
+		PT:              strconv.FormatInt(int64(ledger)<<32|1<<12, 10),
+		Hash:            hex.EncodeToString(hash[:]),
+		Ledger:          ledger,
+		LedgerCloseTime: s.now,
+		Account:         env.Tx.SourceAccount.Address(),
+		AccountSequence: strconv.FormatInt(int64(env.Tx.SeqNum), 10),
+		FeePaid:         int32(result.FeeCharged),
+		OperationCount:  int32(len(env.Tx.Operations)),
+		EnvelopeXdr:     txeBase64,
+		ResultXdr:       resultStr,
+	}
+	htx.MemoType, htx.Memo = memoStrings(env.Tx.Memo)
+	for _, sig := range env.Signatures {
+		htx.Signatures = append(htx.Signatures, base64.StdEncoding.EncodeToString(sig.Signature))
+	}
+	s.txs = append(s.txs, &txRecord{htx: htx, participants: participants(&env.Tx)})
+	s.closeLedger(1)
+
+	if result.Result.Code != xdr.TransactionResultCodeTxSuccess {
+		return horizon.TransactionSuccess{}, badRequest("transaction_failed", "Transaction Failed", extras)
+	}
+	return horizon.TransactionSuccess{
+		Hash:   htx.Hash,
+		Ledger: ledger,
+		Env:    txeBase64,
+		Result: resultStr,
+	}, nil
+}
+
+// participants returns the accounts affected by tx,
+// as Horizon reports them.
+func participants(tx *xdr.Transaction) map[string]bool {
+	p := map[string]bool{tx.SourceAccount.Address(): true}
+	for _, op := range tx.Operations {
+		if op.SourceAccount != nil {
+			p[op.SourceAccount.Address()] = true
+		}
+		switch op.Body.Type {
+		case xdr.OperationTypeCreateAccount:
+			p[op.Body.CreateAccountOp.Destination.Address()] = true
+		case xdr.OperationTypePayment:
+			p[op.Body.PaymentOp.Destination.Address()] = true
+		case xdr.OperationTypePathPayment:
+			p[op.Body.PathPaymentOp.Destination.Address()] = true
+		case xdr.OperationTypeAccountMerge:
+			p[op.Body.Destination.Address()] = true
+		}
+	}
+	return p
+}
+
+func memoStrings(m xdr.Memo) (typ, value string) {
+	switch m.Type {
+	case xdr.MemoTypeMemoText:
+		return "text", *m.Text
+	case xdr.MemoTypeMemoId:
+		return "id", strconv.FormatUint(uint64(*m.Id), 10)
+	case xdr.MemoTypeMemoHash:
+		return "hash", base64.StdEncoding.EncodeToString(m.Hash[:])
+	case xdr.MemoTypeMemoReturn:
+		return "return", base64.StdEncoding.EncodeToString(m.RetHash[:])
+	}
+	return "none", ""
+}
+
+func mustParsePT(pt string) int64 {
+	n, err := strconv.ParseInt(pt, 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func notFound() error {
+	return &horizon.Error{
+		Response: &http.Response{StatusCode: http.StatusNotFound},
+		Problem:  horizon.Problem{Status: http.StatusNotFound, Title: "Resource Missing"},
+	}
+}
+
+func badRequest(typ, title string, extras map[string]string) error {
+	herr := &horizon.Error{
+		Response: &http.Response{StatusCode: http.StatusBadRequest},
+		Problem: horizon.Problem{
+			Type:   typ,
+			Title:  title,
+			Status: http.StatusBadRequest,
+			Extras: make(map[string]json.RawMessage),
+		},
+	}
+	for k, v := range extras {
+		herr.Problem.Extras[k], _ = json.Marshal(v)
+	}
+	return herr
+}
+
+// account is the simulated ledger state of a Stellar account.
+type account struct {
+	id            string
+	balance       xlm.Amount
+	seq           xdr.SequenceNumber
+	masterWeight  byte
+	thresholds    [3]byte // low, medium, high
+	signers       map[string]byte
+	lines         map[string]*trustline // keyed by asset string
+	homeDomain    string
+	inflationDest string
+	flags         uint32
+}
+
+type trustline struct {
+	asset   xdr.Asset
+	balance xdr.Int64
+	limit   xdr.Int64
+}
+
+func newAccount(id string, balance xlm.Amount, seq xdr.SequenceNumber) *account {
+	return &account{
+		id:           id,
+		balance:      balance,
+		seq:          seq,
+		masterWeight: 1,
+		signers:      make(map[string]byte),
+		lines:        make(map[string]*trustline),
+	}
+}
+
+func (a *account) clone() *account {
+	a2 := *a
+	a2.signers = make(map[string]byte)
+	for k, w := range a.signers {
+		a2.signers[k] = w
+	}
+	a2.lines = make(map[string]*trustline)
+	for k, l := range a.lines {
+		l2 := *l
+		a2.lines[k] = &l2
+	}
+	return &a2
+}
+
+func (a *account) subentries() int {
+	return len(a.signers) + len(a.lines)
+}
+
+// minBalance returns the smallest native balance a may hold
+// with the given number of extra subentries.
+func (a *account) minBalance(reserve xlm.Amount, extra int) xlm.Amount {
+	return xlm.Amount(2+a.subentries()+extra) * reserve
+}
+
+func (a *account) horizon() horizon.Account {
+	var h horizon.Account
+	h.ID = a.id
+	h.AccountID = a.id
+	h.PT = a.id
+	h.Sequence = strconv.FormatInt(int64(a.seq), 10)
+	h.SubentryCount = int32(a.subentries())
+	h.HomeDomain = a.homeDomain
+	h.InflationDestination = a.inflationDest
+	h.Thresholds.LowThreshold = a.thresholds[0]
+	h.Thresholds.MedThreshold = a.thresholds[1]
+	h.Thresholds.HighThreshold = a.thresholds[2]
+	h.Flags.AuthRequired = a.flags&uint32(xdr.AccountFlagsAuthRequiredFlag) != 0
+	h.Flags.AuthRevocable = a.flags&uint32(xdr.AccountFlagsAuthRevocableFlag) != 0
+
+	h.Balances = append(h.Balances, hProtocol.Balance{
+		Balance: a.balance.HorizonString(),
+		Asset:   base.Asset{Type: "native"},
+	})
+	var keys []string
+	for k := range a.lines {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		l := a.lines[k]
+		var typ, code, issuer string
+		l.asset.MustExtract(&typ, &code, &issuer)
+		h.Balances = append(h.Balances, hProtocol.Balance{
+			Balance: amount.String(l.balance),
+			Limit:   amount.String(l.limit),
+			Asset:   base.Asset{Type: typ, Code: code, Issuer: issuer},
+		})
+	}
+
+	// Horizon lists the master key even when its weight is zero.
+	h.Signers = append(h.Signers, hProtocol.Signer{
+		PublicKey: a.id,
+		Key:       a.id,
+		Weight:    int32(a.masterWeight),
+		Type:      "ed25519_public_key",
+	})
+	keys = keys[:0]
+	for k := range a.signers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		h.Signers = append(h.Signers, hProtocol.Signer{
+			PublicKey: k,
+			Key:       k,
+			Weight:    int32(a.signers[k]),
+			Type:      "ed25519_public_key",
+		})
+	}
+	return h
+}
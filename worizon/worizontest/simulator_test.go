@@ -0,0 +1,307 @@
+package worizontest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	b "github.com/stellar/go/build"
+	"github.com/stellar/go/clients/horizon"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/errors"
+	"github.com/interstellar/starlight/worizon/xlm"
+)
+
+const testPassphrase = "Simulator Test Network"
+
+func testKeypair(name string) *keypair.Full {
+	return keypair.Master(name).(*keypair.Full)
+}
+
+// submit builds a transaction from src with the given sequence number
+// and operations, signs it with signers, and submits it to s,
+// returning the transaction result.
+func submit(t *testing.T, s *Simulator, src string, seq xdr.SequenceNumber, signers []string, ops ...b.TransactionMutator) (xdr.TransactionResult, error) {
+	t.Helper()
+	args := []b.TransactionMutator{
+		b.Network{Passphrase: testPassphrase},
+		b.SourceAccount{AddressOrSeed: src},
+		b.Sequence{Sequence: uint64(seq)},
+		b.BaseFee{Amount: 100},
+	}
+	tx, err := b.Transaction(append(args, ops...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := tx.Sign(signers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envStr, err := env.Base64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result xdr.TransactionResult
+	succ, submitErr := s.SubmitTransaction(envStr)
+	resultStr := succ.Result
+	if herr, ok := submitErr.(*horizon.Error); ok {
+		resultStr, err = herr.ResultString()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = xdr.SafeUnmarshalBase64(resultStr, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result, submitErr
+}
+
+func balance(t *testing.T, s *Simulator, acct string) xlm.Amount {
+	t.Helper()
+	a, err := s.LoadAccount(acct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bal, err := a.GetNativeBalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	amt, err := xlm.Parse(bal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amt
+}
+
+func TestSimulatorPayment(t *testing.T) {
+	s := NewSimulator(testPassphrase, time.Now())
+	alice, bob := testKeypair("alice"), testKeypair("bob")
+	err := s.Fund(alice.Address(), 100*xlm.Lumen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.LoadAccount(bob.Address()); err == nil {
+		t.Fatal("got no error loading unfunded account")
+	}
+	seq, err := s.SequenceForAccount(alice.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := submit(t, s, alice.Address(), seq+1, []string{alice.Seed()},
+		b.CreateAccount(b.Destination{AddressOrSeed: bob.Address()}, b.NativeAmount{Amount: "10"}),
+	)
+	if err != nil {
+		t.Fatalf("got error %s (%s)", err, res.Result.Code)
+	}
+	if got, want := balance(t, s, alice.Address()), 90*xlm.Lumen-100*xlm.Stroop; got != want {
+		t.Errorf("got alice balance %s, want %s", got, want)
+	}
+	if got := balance(t, s, bob.Address()); got != 10*xlm.Lumen {
+		t.Errorf("got bob balance %s, want 10 XLM", got)
+	}
+
+	cases := []struct {
+		name    string
+		seq     xdr.SequenceNumber
+		signers []string
+		ops     []b.TransactionMutator
+		want    xdr.TransactionResultCode
+	}{{
+		name:    "reused seqnum",
+		seq:     seq + 1,
+		signers: []string{alice.Seed()},
+		ops:     []b.TransactionMutator{b.Payment(b.Destination{AddressOrSeed: bob.Address()}, b.NativeAmount{Amount: "1"})},
+		want:    xdr.TransactionResultCodeTxBadSeq,
+	}, {
+		name:    "wrong signer",
+		seq:     seq + 2,
+		signers: []string{bob.Seed()},
+		ops:     []b.TransactionMutator{b.Payment(b.Destination{AddressOrSeed: bob.Address()}, b.NativeAmount{Amount: "1"})},
+		want:    xdr.TransactionResultCodeTxBadAuth,
+	}, {
+		name:    "too late",
+		seq:     seq + 2,
+		signers: []string{alice.Seed()},
+		ops: []b.TransactionMutator{
+			b.Timebounds{MaxTime: uint64(s.Now().Add(-time.Minute).Unix())},
+			b.Payment(b.Destination{AddressOrSeed: bob.Address()}, b.NativeAmount{Amount: "1"}),
+		},
+		want: xdr.TransactionResultCodeTxTooLate,
+	}, {
+		name:    "underfunded",
+		seq:     seq + 2,
+		signers: []string{alice.Seed()},
+		ops:     []b.TransactionMutator{b.Payment(b.Destination{AddressOrSeed: bob.Address()}, b.NativeAmount{Amount: "90"})},
+		want:    xdr.TransactionResultCodeTxFailed,
+	}}
+	for _, tc := range cases {
+		res, err := submit(t, s, alice.Address(), tc.seq, tc.signers, tc.ops...)
+		if err == nil || res.Result.Code != tc.want {
+			t.Errorf("%s: got %s (error %v), want %s", tc.name, res.Result.Code, err, tc.want)
+		}
+	}
+
+	// The failed payment was still included in the ledger.
+	if got, _ := s.SequenceForAccount(alice.Address()); got != seq+2 {
+		t.Errorf("got seqnum %d after failed tx, want %d", got, seq+2)
+	}
+}
+
+func TestSimulatorMultisig(t *testing.T) {
+	s := NewSimulator(testPassphrase, time.Now())
+	escrow, guest, host := testKeypair("escrow"), testKeypair("guest"), testKeypair("host")
+	for _, kp := range []*keypair.Full{escrow, host} {
+		err := s.Fund(kp.Address(), 100*xlm.Lumen)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	seq, _ := s.SequenceForAccount(escrow.Address())
+
+	err := s.Fund(guest.Address(), 0)
+	if err == nil {
+		t.Fatal("got no error funding account with zero lumens")
+	}
+	_, err = submit(t, s, escrow.Address(), seq+1, []string{escrow.Seed()},
+		b.SetOptions(
+			b.SetLowThreshold(2),
+			b.SetMediumThreshold(2),
+			b.SetHighThreshold(2),
+			b.AddSigner(guest.Address(), 1),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, _ := s.LoadAccount(escrow.Address())
+	if len(acct.Signers) != 2 {
+		t.Errorf("got %d signers, want 2", len(acct.Signers))
+	}
+
+	res, err := submit(t, s, escrow.Address(), seq+2, []string{escrow.Seed()},
+		b.AccountMerge(b.Destination{AddressOrSeed: host.Address()}),
+	)
+	if err == nil || res.Result.Code != xdr.TransactionResultCodeTxBadAuth {
+		t.Errorf("got %s (error %v) with one of two signatures, want %s", res.Result.Code, err, xdr.TransactionResultCodeTxBadAuth)
+	}
+
+	before := balance(t, s, host.Address())
+	res, err = submit(t, s, escrow.Address(), seq+2, []string{escrow.Seed(), guest.Seed()},
+		b.AccountMerge(b.Destination{AddressOrSeed: host.Address()}),
+	)
+	if err != nil {
+		t.Fatalf("got error %s (%s) merging with both signatures", err, res.Result.Code)
+	}
+	merged := xlm.Amount(*(*res.Result.Results)[0].Tr.AccountMergeResult.SourceAccountBalance)
+	if got := balance(t, s, host.Address()); got != before+merged {
+		t.Errorf("got host balance %s, want %s", got, before+merged)
+	}
+	if _, err := s.LoadAccount(escrow.Address()); err == nil {
+		t.Error("got no error loading merged account")
+	}
+}
+
+func TestSimulatorStreams(t *testing.T) {
+	start := time.Now()
+	s := NewSimulator(testPassphrase, start)
+	alice := testKeypair("alice")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	txs := make(chan horizon.Transaction, 10)
+	txCur := horizon.Cursor("")
+	go s.StreamTransactions(ctx, alice.Address(), &txCur, func(tx horizon.Transaction) { txs <- tx })
+	ledgers := make(chan horizon.Ledger, 10)
+	ledgerCur := horizon.Cursor("now")
+	go s.StreamLedgers(ctx, &ledgerCur, func(l horizon.Ledger) { ledgers <- l })
+
+	if l := <-ledgers; !l.ClosedAt.Equal(s.Now()) {
+		t.Errorf("got first ledger at %s, want latest at %s", l.ClosedAt, s.Now())
+	}
+	s.Fund(testKeypair("bob").Address(), 10*xlm.Lumen) // not alice's
+	s.Fund(alice.Address(), 10*xlm.Lumen)
+	select {
+	case tx := <-txs:
+		if tx.Ledger != 3 {
+			t.Errorf("got tx in ledger %d, want 3", tx.Ledger)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no transaction streamed")
+	}
+
+	s.Advance(time.Hour)
+	for {
+		select {
+		case l := <-ledgers:
+			if l.Sequence < 4 {
+				continue
+			}
+			if want := start.Add(time.Hour).Truncate(time.Second); !l.ClosedAt.Equal(want) || l.Sequence != 4 {
+				t.Errorf("got ledger %d at %s, want 4 at %s", l.Sequence, l.ClosedAt, want)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("no ledger streamed after Advance")
+		}
+	}
+}
+
+func TestSimulatorErrors(t *testing.T) {
+	s := NewSimulator(testPassphrase, time.Now())
+	_, err := s.SubmitTransaction("bogus")
+	if herr, ok := errors.Root(err).(*horizon.Error); !ok || herr.Problem.Status != 400 {
+		t.Errorf("got error %v for malformed tx, want 400", err)
+	}
+}
+
+func TestSimulatorHTTP(t *testing.T) {
+	s := NewSimulator(testPassphrase, time.Now())
+	s.Advance(5 * time.Second)
+	hc := &horizon.Client{URL: "http://horizon.test", HTTP: &http.Client{Transport: handlerTransport{s}}}
+	root, err := hc.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.NetworkPassphrase != testPassphrase {
+		t.Errorf("got passphrase %q, want %q", root.NetworkPassphrase, testPassphrase)
+	}
+
+	resp, err := hc.HTTP.Get("http://horizon.test/ledgers?order=desc&limit=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var page struct {
+		Embedded struct {
+			Records []horizon.Ledger
+		} `json:"_embedded"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Embedded.Records) != 1 {
+		t.Fatalf("got %d ledgers, want 1", len(page.Embedded.Records))
+	}
+	l := page.Embedded.Records[0]
+	if l.Sequence != 2 || xlm.Amount(l.BaseReserve) != DefaultBaseReserve {
+		t.Errorf("got ledger %d with base reserve %d, want ledger 2 with %d", l.Sequence, l.BaseReserve, DefaultBaseReserve)
+	}
+}
+
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	t.h.ServeHTTP(w, req)
+	return w.Result(), nil
+}
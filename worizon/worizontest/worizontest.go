@@ -2,16 +2,46 @@ package worizontest
 
 import (
 	"context"
+	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
 	"github.com/stellar/go/clients/horizon"
+	hProtocol "github.com/stellar/go/protocols/horizon"
 	"github.com/stellar/go/xdr"
+
+	"github.com/interstellar/starlight/clock"
 )
 
+// ledgerInterval is how often a FakeHorizonClient with a Clock
+// closes a ledger.
+// Stellar closes a ledger every five seconds or so.
+const ledgerInterval = 5 * time.Second
+
 type FakeHorizonClient struct {
 	mu                   sync.Mutex
 	transactionEnvelopes []string
+
+	// Paths is returned from every LoadPaths call.
+	Paths []hProtocol.Path
+
+	// NotFound holds the IDs of accounts
+	// that LoadAccount reports as not existing.
+	NotFound map[string]bool
+
+	// Accounts, if non-nil, holds the only accounts
+	// that LoadAccount reports as existing.
+	Accounts map[string]horizon.Account
+
+	// Clock, if non-nil, drives StreamLedgers,
+	// which then closes a ledger at the clock's time
+	// whenever it passes the next ledger interval,
+	// so that advancing a clock.Manual
+	// moves ledger time with it.
+	// If Clock is nil, StreamLedgers delivers one ledger
+	// at the current time and returns.
+	Clock clock.Clock
 }
 
 func (c *FakeHorizonClient) Root() (horizon.Root, error) {
@@ -25,20 +55,56 @@ func (c *FakeHorizonClient) SubmitTransaction(txeBase64 string) (horizon.Transac
 	return horizon.TransactionSuccess{}, nil
 }
 
+// TransactionEnvelopes returns the base64 transaction envelopes
+// passed to SubmitTransaction, in order.
+func (c *FakeHorizonClient) TransactionEnvelopes() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.transactionEnvelopes...)
+}
+
 func (c *FakeHorizonClient) StreamLedgers(ctx context.Context, cursor *horizon.Cursor, handler horizon.LedgerHandler) error {
-	ledger := horizon.Ledger{
-		ClosedAt: time.Now(),
+	if c.Clock == nil {
+		ledger := horizon.Ledger{
+			ClosedAt: time.Now(),
+		}
+		handler(ledger)
+		return nil
+	}
+	for {
+		handler(horizon.Ledger{ClosedAt: c.Clock.Now()})
+		if clock.Sleep(ctx, c.Clock, ledgerInterval) != nil {
+			return nil
+		}
 	}
-	handler(ledger)
-	return nil
 }
 
-// Not Implemented
+func (c *FakeHorizonClient) LoadPaths(v url.Values) ([]hProtocol.Path, error) {
+	return c.Paths, nil
+}
 
 func (c *FakeHorizonClient) LoadAccount(accountID string) (horizon.Account, error) {
+	if c.NotFound[accountID] {
+		return horizon.Account{}, &horizon.Error{
+			Response: &http.Response{StatusCode: http.StatusNotFound},
+			Problem:  horizon.Problem{Status: http.StatusNotFound, Title: "Resource Missing"},
+		}
+	}
+	if c.Accounts != nil {
+		acct, ok := c.Accounts[accountID]
+		if !ok {
+			return horizon.Account{}, &horizon.Error{
+				Response: &http.Response{StatusCode: http.StatusNotFound},
+				Problem:  horizon.Problem{Status: http.StatusNotFound, Title: "Resource Missing"},
+			}
+		}
+		return acct, nil
+	}
 	return horizon.Account{}, nil
 }
 
+// Not Implemented
+
 func (c *FakeHorizonClient) SequenceForAccount(accountID string) (xdr.SequenceNumber, error) {
 	return xdr.SequenceNumber(0), nil
 }